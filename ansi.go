@@ -0,0 +1,22 @@
+package main
+
+import "regexp"
+
+// ANSI escape sequences: CSI sequences such as colors and cursor movement,
+// OSC sequences such as window titles and hyperlinks, character set
+// selections such as ESC ( B, and two-byte escapes
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[ -/]+[0-~]|\x1b[@-Z\\-_]`)
+
+// Function to tell whether ANSI escapes are stripped from a job's output: its
+// strip_ansi option, or else STRIP_ANSI
+func stripsANSI(j Job) bool {
+	if j.StripANSI != nil {
+		return *j.StripANSI
+	}
+	return getEnvBool("STRIP_ANSI", false)
+}
+
+// Function to remove ANSI escape sequences from a command's output
+func stripANSI(output []byte) []byte {
+	return ansiEscape.ReplaceAll(output, nil)
+}
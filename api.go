@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Helper function to write a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("Error writing JSON response: %s\n", err)
+	}
+}
+
+// Helper function to write a JSON error response
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Helper function to decode an optional JSON request body into v
+func readJSON(r *http.Request, v any) error {
+	if r.ContentLength == 0 {
+		return nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+// Struct to hold the body accepted by the pause and resume endpoints
+type pauseRequest struct {
+	Actor  string `json:"actor"`
+	Reason string `json:"reason"`
+}
+
+// Struct to hold the scheduler state returned by the pause and resume endpoints
+type pauseResponse struct {
+	Paused    bool   `json:"paused"`
+	Actor     string `json:"actor"`
+	Reason    string `json:"reason"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Handler for POST /api/v1/scheduler/pause and /api/v1/scheduler/resume
+func apiSetPausedHandler(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestAdmin(r); !ok {
+			writeJSONError(w, http.StatusForbidden, "only admins can pause and resume the scheduler")
+			return
+		}
+		var req pauseRequest
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Actor == "" {
+			req.Actor = r.RemoteAddr
+		}
+
+		if err := setPaused(requestTenant(r), paused, req.Actor, req.Reason, "api"); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		state := currentPauseState(requestTenant(r))
+		writeJSON(w, http.StatusOK, pauseResponse{
+			Paused:    state.Paused,
+			Actor:     state.Actor,
+			Reason:    state.Reason,
+			Timestamp: state.Timestamp,
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct to hold one job of the desired state sent to POST /api/v1/apply
+type applyJob struct {
+	Name        string            `json:"name" yaml:"name"`
+	Schedule    string            `json:"schedule" yaml:"schedule"`
+	RunAt       string            `json:"run_at" yaml:"run_at"`         // RFC 3339 time of a one-time job, instead of a schedule
+	Schedules   []string          `json:"schedules" yaml:"schedules"`   // additional schedules
+	Exclusions  []string          `json:"exclusions" yaml:"exclusions"` // cron expressions during which the job must not run
+	Command     string            `json:"command" yaml:"command"`
+	Description string            `json:"description" yaml:"description"` // kept as is when empty
+	Options     map[string]string `json:"options" yaml:"options"`         // the same options as in the cron jobs file
+}
+
+// Struct to hold the body of POST /api/v1/apply
+type applyRequest struct {
+	Jobs []applyJob `json:"jobs" yaml:"jobs"`
+}
+
+// Struct to hold a job whose definition was changed by an apply
+type applyUpdate struct {
+	Name    string   `json:"name"`
+	Changes []string `json:"changes"`
+}
+
+// Struct to hold the differences between the jobs table and the desired state
+type applyDiff struct {
+	DryRun    bool          `json:"dry_run"`
+	Created   []string      `json:"created"`
+	Updated   []applyUpdate `json:"updated"`
+	Disabled  []string      `json:"disabled"`
+	Unchanged []string      `json:"unchanged"`
+}
+
+// Struct to hold the current state of a job in the jobs table
+type appliedJob struct {
+	ID          int64
+	CronExpr    string
+	Command     string
+	Description string
+	Options     string
+	Source      string
+	Enabled     bool
+	Exhausted   bool
+	Schedules   []string
+	Exclusions  []string
+}
+
+// Function to turn a desired job into a Job, validating it the same way as a
+// line of the cron jobs file
+func (a applyJob) toJob() (Job, error) {
+	if a.Name == "" {
+		return Job{}, fmt.Errorf("job without a name")
+	}
+	if a.Command == "" {
+		return Job{}, fmt.Errorf("job %s: missing command", a.Name)
+	}
+	if a.RunAt != "" {
+		if a.Schedule != "" {
+			return Job{}, fmt.Errorf("job %s: set either schedule or run_at", a.Name)
+		}
+		a.Schedule = runAtPrefix + a.RunAt
+	}
+	for _, expr := range append([]string{a.Schedule}, append(a.Schedules, a.Exclusions...)...) {
+		if _, err := parseSchedule(expr); err != nil {
+			return Job{}, fmt.Errorf("job %s: %w", a.Name, err)
+		}
+	}
+
+	keys := make([]string, 0, len(a.Options))
+	for key := range a.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	options := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := a.Options[key]
+		if key == "name" || key == "exclude" {
+			return Job{}, fmt.Errorf("job %s: option %s cannot be set here", a.Name, key)
+		}
+		if strings.ContainsAny(value, " \t\n]") {
+			return Job{}, fmt.Errorf("job %s: value of option %s cannot contain spaces or ]", a.Name, key)
+		}
+		options = append(options, key+"="+value)
+	}
+
+	j := Job{
+		Name:        a.Name,
+		CronExpr:    a.Schedule,
+		Command:     a.Command,
+		Description: strings.TrimSpace(a.Description),
+		Options:     strings.Join(options, " "),
+		Schedules:   a.Schedules,
+		Exclusions:  a.Exclusions,
+	}
+	if err := parseJobOptions(&j, j.Options); err != nil {
+		return Job{}, fmt.Errorf("job %s: %w", a.Name, err)
+	}
+	if err := applyRunAt(&j); err != nil {
+		return Job{}, fmt.Errorf("job %s: %w", a.Name, err)
+	}
+	return j, nil
+}
+
+// Function to list what differs between a job in the table and its desired
+// definition, owned by source
+func applyChanges(current appliedJob, j Job, source string) []string {
+	var changes []string
+	if current.CronExpr != j.CronExpr {
+		changes = append(changes, "schedule")
+	}
+	if current.Command != j.Command {
+		changes = append(changes, "command")
+	}
+	if j.Description != "" && current.Description != j.Description {
+		changes = append(changes, "description")
+	}
+	if current.Options != j.Options {
+		changes = append(changes, "options")
+	}
+	if !slices.Equal(current.Schedules, j.Schedules) {
+		changes = append(changes, "schedules")
+	}
+	if !slices.Equal(current.Exclusions, j.Exclusions) {
+		changes = append(changes, "exclusions")
+	}
+	if !current.Enabled && !current.Exhausted {
+		changes = append(changes, "enabled")
+	}
+	if current.Source != source {
+		changes = append(changes, "source")
+	}
+	return changes
+}
+
+// Handler for POST /api/v1/apply, making the jobs of the request's tenant match
+// a full set of job definitions. Jobs in the set are created or updated and owned by the API from
+// then on; jobs previously applied but missing from the set are disabled. Jobs
+// created in other ways and not in the set are left alone. With ?dry_run=true
+// the differences are returned without changing anything.
+func apiApplyHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can apply jobs")
+		return
+	}
+	var req applyRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Jobs == nil {
+		// An empty list disables every applied job, so it must be given explicitly
+		writeJSONError(w, http.StatusBadRequest, "missing jobs list")
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	desired := make([]Job, 0, len(req.Jobs))
+	names := make(map[string]bool)
+	for _, a := range req.Jobs {
+		j, err := a.toJob()
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if names[j.Name] {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("job %s is defined more than once", j.Name))
+			return
+		}
+		names[j.Name] = true
+		desired = append(desired, j)
+	}
+
+	diff, err := applyJobs(requestTenant(r), desired, dryRun)
+	if err != nil {
+		if errors.Is(err, errDependencyCycle) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !dryRun && (len(diff.Created) > 0 || len(diff.Updated) > 0 || len(diff.Disabled) > 0) {
+		recordEvent(requestTenant(r), eventConfig, fmt.Sprintf("Applied job definitions of tenant %s from %s: %d created, %d updated, %d disabled",
+			requestTenant(r), r.RemoteAddr, len(diff.Created), len(diff.Updated), len(diff.Disabled)))
+		requestReconcile()
+	}
+	writeJSON(w, http.StatusOK, diff)
+}
+
+// Function to bring a tenant's jobs in line with the desired jobs in one
+// transaction, returning what was (or, for a dry run, would be) changed
+func applyJobs(tenant string, desired []Job, dryRun bool) (applyDiff, error) {
+	diff := applyDiff{DryRun: dryRun, Created: []string{}, Updated: []applyUpdate{}, Disabled: []string{}, Unchanged: []string{}}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return diff, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := loadAppliedJobs(tx, tenant)
+	if err != nil {
+		return diff, err
+	}
+
+	now := time.Now().Format("02-01-2006 15:04:05")
+	inSet := make(map[string]bool, len(desired))
+	for _, j := range desired {
+		inSet[j.Name] = true
+		existing, ok := current[j.Name]
+		var changes []string
+		if ok {
+			changes = applyChanges(*existing, j, "api")
+			if len(changes) == 0 {
+				diff.Unchanged = append(diff.Unchanged, j.Name)
+				continue
+			}
+			diff.Updated = append(diff.Updated, applyUpdate{Name: j.Name, Changes: changes})
+		} else {
+			diff.Created = append(diff.Created, j.Name)
+		}
+		if dryRun {
+			continue
+		}
+
+		if err := saveAppliedJob(tx, tenant, "api", j, now); err != nil {
+			return diff, err
+		}
+	}
+
+	for name, existing := range current {
+		if inSet[name] || existing.Source != "api" || !existing.Enabled {
+			continue
+		}
+		diff.Disabled = append(diff.Disabled, name)
+		if dryRun {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE jobs SET enabled = 0, updated_at = ? WHERE id = ?`, now, existing.ID); err != nil {
+			return diff, fmt.Errorf("error disabling job %s: %w", name, err)
+		}
+	}
+	sort.Strings(diff.Disabled)
+
+	if dryRun {
+		return diff, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return diff, fmt.Errorf("error committing changes: %w", err)
+	}
+	return diff, nil
+}
+
+// Struct to hold the response of PUT /api/v1/jobs/{name}
+type putJobResponse struct {
+	Name    string   `json:"name"`
+	Created bool     `json:"created"`
+	Changed bool     `json:"changed"`
+	Changes []string `json:"changes"`
+}
+
+// Handler for PUT /api/v1/jobs/{name}, creating the job if it is missing or
+// updating it if it differs. The body is a job as in POST /api/v1/apply, the
+// name being optional. Sending the same definition again changes nothing, so
+// scripts can be re-run safely.
+func apiPutJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can change jobs")
+		return
+	}
+	var a applyJob
+	if err := readJSON(r, &a); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := r.PathValue("name")
+	if a.Name != "" && a.Name != name {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("job name %q in the body does not match %q in the URL", a.Name, name))
+		return
+	}
+	a.Name = name
+	j, err := a.toJob()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tenant := requestTenant(r)
+	resp, err := storage.UpsertJob(tenant, j)
+	if err != nil {
+		if errors.Is(err, errDependencyCycle) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status := http.StatusOK
+	if resp.Created {
+		status = http.StatusCreated
+	}
+	if resp.Changed {
+		recordEvent(tenant, eventConfig, fmt.Sprintf("Saved job %s of tenant %s from %s", name, tenant, r.RemoteAddr))
+		requestReconcile()
+	}
+	writeJSON(w, status, resp)
+}
+
+// Function to load the current state of a tenant's jobs, by name
+func loadAppliedJobs(tx *sql.Tx, tenant string) (map[string]*appliedJob, error) {
+	rows, err := tx.Query(`
+		SELECT j.id, j.name, j.cron_expr, j.command, j.description, j.options, j.source, j.enabled,
+		       j.max_runs > 0 AND j.run_count >= j.max_runs, COALESCE(s.cron_expr, ''), COALESCE(s.kind, '')
+		FROM jobs j
+		LEFT JOIN job_schedules s ON s.job_id = j.id
+		WHERE j.tenant = ?
+		ORDER BY j.id, s.id`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %w", err)
+	}
+	defer rows.Close()
+
+	current := make(map[string]*appliedJob)
+	for rows.Next() {
+		var name, expr, kind string
+		var j appliedJob
+		if err := rows.Scan(&j.ID, &name, &j.CronExpr, &j.Command, &j.Description, &j.Options, &j.Source, &j.Enabled, &j.Exhausted, &expr, &kind); err != nil {
+			return nil, fmt.Errorf("error reading jobs: %w", err)
+		}
+		existing, ok := current[name]
+		if !ok {
+			existing = &j
+			current[name] = existing
+		}
+		switch kind {
+		case "run":
+			existing.Schedules = append(existing.Schedules, expr)
+		case "exclude":
+			existing.Exclusions = append(existing.Exclusions, expr)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading jobs: %w", err)
+	}
+	return current, nil
+}
+
+// Function to create or update a job owned by source, such as "api", enabling
+// it unless it has used up its runs
+func saveAppliedJob(q dbExecutor, tenant, source string, j Job, now string) error {
+	_, err := q.Exec(`
+		INSERT INTO jobs (tenant, name, cron_expr, command, description, options, source, revision, enabled, max_runs, retries, retry_backoff, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+		ON CONFLICT(tenant, name) DO UPDATE SET
+			cron_expr = excluded.cron_expr, command = excluded.command,
+			description = CASE WHEN excluded.description != '' THEN excluded.description ELSE description END,
+			options = excluded.options, source = excluded.source, revision = excluded.revision, max_runs = excluded.max_runs,
+			retries = excluded.retries, retry_backoff = excluded.retry_backoff,
+			schedule_phrase = CASE WHEN cron_expr = excluded.cron_expr THEN schedule_phrase ELSE '' END,
+			enabled = CASE WHEN excluded.max_runs > 0 AND run_count >= excluded.max_runs THEN enabled ELSE 1 END,
+			consecutive_failures = 0, disabled_reason = '',
+			updated_at = excluded.updated_at`,
+		tenant, j.Name, j.CronExpr, j.Command, j.Description, j.Options, source, j.Revision, j.MaxRuns, j.Retries, retryBackoffColumn(j), now)
+	if err != nil {
+		return fmt.Errorf("error saving job %s: %w", j.Name, err)
+	}
+	if err := replaceSchedules(q, tenant, j.Name, j.Schedules, j.Exclusions); err != nil {
+		return fmt.Errorf("error saving schedules of job %s: %w", j.Name, err)
+	}
+	if err := replaceDependencies(q, tenant, j.Name, j.After); err != nil {
+		return fmt.Errorf("error saving dependencies of job %s: %w", j.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Function to record a security-relevant event in the audit_events table and
+// the scheduler log
+func recordAuditEvent(tenant, actor, action, detail, remoteAddr string) {
+	recordEvent(tenant, eventAuth, fmt.Sprintf("Audit: %s (tenant %s, actor %s, from %s): %s", action, tenant, actor, remoteAddr, detail))
+
+	timestamp := time.Now().Format("02-01-2006 15:04:05")
+	err := guardDB("recording audit event", func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := db.Exec(`INSERT INTO audit_events (tenant, actor, action, detail, remote_addr, timestamp) VALUES (?, ?, ?, ?, ?, ?)`,
+			tenant, actor, action, detail, remoteAddr, timestamp)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("Error recording audit event: %s\n", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Struct to hold the response of POST /api/v1/jobs/{name}/enable
+type enableJobResponse struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Helper function to get the number of failed runs in a row after which a
+// job disables itself: its max_failures option, else MAX_CONSECUTIVE_FAILURES
+func failureLimit(j Job) int {
+	if j.MaxFailures > 0 {
+		return j.MaxFailures
+	}
+	return getEnvInt("MAX_CONSECUTIVE_FAILURES", 0)
+}
+
+// Function to count a finished run of a job towards its consecutive
+// failures, disabling the job once they reach its failure limit. A success
+// starts the count over; cancelled and suppressed runs leave it alone.
+func recordRunOutcome(j Job, status string) {
+	failed := isFailureStatus(status)
+	if j.ID == 0 || (!failed && status != "Success") {
+		return
+	}
+
+	failures, err := storage.RecordOutcome(j, failed)
+	limit := failureLimit(j)
+	tripped := err == nil && failed && limit > 0 && failures >= limit
+	if tripped {
+		err = storage.DisableJob(j, fmt.Sprintf("Disabled after %d consecutive failures, the last one at %s", failures, time.Now().Format("02-01-2006 15:04:05")))
+	}
+	if err != nil {
+		fmt.Printf("Error counting failures of job %s: %s\n", j.Name, err)
+		return
+	}
+	if !tripped {
+		return
+	}
+
+	requestReconcile()
+	message := fmt.Sprintf("Job %s of tenant %s failed %d times in a row and was disabled; enable it again once it is fixed", j.Name, j.Tenant, failures)
+	recordEvent(j.Tenant, eventJob, message)
+	notifyTenant(j.Tenant, "critical", fmt.Sprintf("Job %s disabled", j.Name), message)
+}
+
+// Function to enable a disabled job of a tenant again, clearing its failure count
+func enableJob(tenant, name, actor string) error {
+	if err := storage.EnableJob(tenant, name); err != nil {
+		return err
+	}
+	requestReconcile()
+	recordEvent(tenant, eventJob, fmt.Sprintf("Job %s enabled by %s", name, actor))
+	return nil
+}
+
+// Handler for POST /api/v1/jobs/{name}/enable, enabling a disabled job again
+func apiEnableJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can enable jobs")
+		return
+	}
+	name := r.PathValue("name")
+	err := enableJob(requestTenant(r), name, requestActor(r))
+	if errors.Is(err, errJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", name))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, enableJobResponse{Name: name, Enabled: true})
+}
+
+// Handler for the Enable button on the jobs page
+func enableJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can enable jobs", http.StatusForbidden)
+		return
+	}
+	name := r.FormValue("name")
+	err := enableJob(requestTenant(r), name, requestActor(r))
+	if errors.Is(err, errJobNotFound) {
+		http.Error(w, fmt.Sprintf("Job %s not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, tenantURL(r, "/jobs"), http.StatusSeeOther)
+}
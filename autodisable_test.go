@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// Notifier keeping the notifications sent during a test
+type recordingNotifier struct {
+	sent []Notification
+}
+
+func (n *recordingNotifier) Notify(notification Notification) error {
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+// Helper function to collect the notifications sent for the rest of a test
+func recordNotifications(t *testing.T) *recordingNotifier {
+	recorder := &recordingNotifier{}
+	notifiersMu.Lock()
+	previous := notifiers
+	notifiers = []Notifier{recorder}
+	notifiersMu.Unlock()
+	t.Cleanup(func() {
+		notifiersMu.Lock()
+		notifiers = previous
+		notifiersMu.Unlock()
+	})
+	return recorder
+}
+
+func TestRecordRunOutcome(t *testing.T) {
+	t.Setenv("MAX_CONSECUTIVE_FAILURES", "")
+	fake := useFakeStore(t)
+	sent := recordNotifications(t)
+	if err := fake.CreateJob(defaultTenant, "db", Job{Name: "backup", CronExpr: "0 2 * * *", Command: "./backup.sh"}); err != nil {
+		t.Fatal(err)
+	}
+	stored := fake.jobs[jobKey(defaultTenant, "backup")]
+	j := stored.Job
+	j.MaxFailures = 3
+
+	steps := []struct {
+		status       string
+		wantFailures int
+		wantEnabled  bool
+	}{
+		{"Failure", 1, true},
+		{"Failure", 2, true},
+		{"Success", 0, true},
+		{"Failure", 1, true},
+		{"Cancelled", 1, true},
+		{"Skipped", 1, true},
+		{"Failure", 2, true},
+		{"Failure (timeout)", 3, false},
+	}
+	for i, step := range steps {
+		recordRunOutcome(j, step.status)
+		if stored.failures != step.wantFailures || stored.enabled != step.wantEnabled {
+			t.Fatalf("step %d (%s): failures = %d, enabled = %v; want %d, %v",
+				i+1, step.status, stored.failures, stored.enabled, step.wantFailures, step.wantEnabled)
+		}
+	}
+	if stored.disabledReason == "" {
+		t.Error("disabled job has no reason")
+	}
+	if len(sent.sent) != 1 || sent.sent[0].Level != "critical" {
+		t.Errorf("notifications = %+v, want one critical notification", sent.sent)
+	}
+
+	if err := enableJob(defaultTenant, "backup", "test"); err != nil {
+		t.Fatalf("enableJob: %s", err)
+	}
+	if !stored.enabled || stored.failures != 0 || stored.disabledReason != "" {
+		t.Errorf("after enabling: enabled = %v, failures = %d, reason = %q", stored.enabled, stored.failures, stored.disabledReason)
+	}
+	if err := enableJob(defaultTenant, "missing", "test"); !errors.Is(err, errJobNotFound) {
+		t.Errorf("enabling a missing job: err = %v, want errJobNotFound", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// Template of a flat, shields.io-style badge. Widths are estimated from the
+// text length since the font is chosen by the viewer.
+const badgeTemplate = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">
+  <title>%[3]s: %[4]s</title>
+  <linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+  <clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+  <g clip-path="url(#r)">
+    <rect width="%[2]d" height="20" fill="#555"/>
+    <rect x="%[2]d" width="%[6]d" height="20" fill="%[5]s"/>
+    <rect width="%[1]d" height="20" fill="url(#s)"/>
+  </g>
+  <g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+    <text x="%[7]d" y="14">%[3]s</text>
+    <text x="%[8]d" y="14">%[4]s</text>
+  </g>
+</svg>
+`
+
+// Helper function to render a badge with a label on the left and a colored value on the right
+func renderBadge(label, value, color string) string {
+	textWidth := func(s string) int { return len([]rune(s))*7 + 10 }
+	labelWidth, valueWidth := textWidth(label), textWidth(value)
+	return fmt.Sprintf(badgeTemplate, labelWidth+valueWidth, labelWidth,
+		html.EscapeString(label), html.EscapeString(value), color, valueWidth,
+		labelWidth/2, labelWidth+valueWidth/2)
+}
+
+// Handler for GET /badge/{job}.svg, rendering a passing/failing badge for the
+// latest run of a job. Suppressed triggers and dry runs do not change the badge.
+// Without signing in, only jobs with the public=true option have a badge.
+func badgeHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".svg")
+	if !ok || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	tenant := requestTenant(r)
+	mu.Lock()
+	var j Job
+	err := db.QueryRow(`SELECT options FROM jobs WHERE tenant = ? AND name = ?`, tenant, name).Scan(&j.Options)
+	exists := err == nil
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if exists && authEnabled() {
+		_, signedIn := requestSession(r)
+		exists = signedIn || (parseJobOptions(&j, j.Options) == nil && j.Public)
+	}
+	var status string
+	if err == nil && exists {
+		err = db.QueryRow(`
+			SELECT status FROM job_status
+			WHERE tenant = ? AND job_name = ? AND (status = 'Success' OR status LIKE 'Fail%')
+			ORDER BY job_id DESC LIMIT 1`, tenant, name).Scan(&status)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	mu.Unlock()
+
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	value, color := "no runs", "#9f9f9f"
+	switch {
+	case status == "Success":
+		value, color = "passing", "#4c1"
+	case isFailureStatus(status):
+		value, color = "failing", "#e05d44"
+	}
+
+	// Keep image proxies such as GitHub's from serving a stale result
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache, max-age=0")
+	fmt.Fprint(w, renderBadge(name, value, color))
+}
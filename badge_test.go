@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBadgeHandlerOnlyServesPublicJobsWithoutSession(t *testing.T) {
+	openTestDatabase(t)
+	s := newSQLiteStore(db)
+	for _, j := range []Job{
+		{Name: "nightly-export", CronExpr: "0 2 * * *", Command: "./export.sh", Options: "public=true"},
+		{Name: "payroll", CronExpr: "0 3 * * *", Command: "./payroll.sh"},
+	} {
+		if err := s.CreateJob(defaultTenant, "db", j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /badge/{file}", badgeHandler)
+
+	tests := []struct {
+		name       string
+		auth       bool
+		signedIn   bool
+		job        string
+		wantStatus int
+	}{
+		{"public job", true, false, "nightly-export", http.StatusOK},
+		{"private job", true, false, "payroll", http.StatusNotFound},
+		{"private job with a session", true, true, "payroll", http.StatusOK},
+		{"unknown job with a session", true, true, "missing", http.StatusNotFound},
+		{"private job without auth", false, false, "payroll", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			password := ""
+			if tt.auth {
+				password = "secret"
+			}
+			t.Setenv("ADMIN_PASSWORD", password)
+			r := httptest.NewRequest("GET", "/badge/"+tt.job+".svg", nil)
+			if tt.signedIn {
+				r = sessionRequest("GET", "/badge/"+tt.job+".svg", "", "admin")
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errCalendarNotFound = errors.New("calendar not found")
+
+// Largest calendar accepted by an upload
+const maxCalendarSize = 1 << 20
+
+// Calendar names, which are listed comma separated in the skip_calendar option
+var calendarNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Struct to hold a date of a calendar on which runs are skipped
+type calendarDate struct {
+	Date        string `json:"date"` // YYYY-MM-DD
+	Description string `json:"description,omitempty"`
+}
+
+// Struct to hold a calendar as listed by GET /api/v1/calendars
+type calendarInfo struct {
+	Name      string `json:"name"`
+	Dates     int    `json:"dates"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Function to parse an uploaded calendar: an iCalendar file, whose all-day and
+// timed events each skip the days they cover, or a list with one date
+// (YYYY-MM-DD) per line, optionally followed by a description. Blank lines and
+// lines starting with # are ignored.
+func parseCalendar(body []byte) ([]calendarDate, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("BEGIN:VCALENDAR")) {
+		return parseICalendar(body)
+	}
+
+	byDate := make(map[string]calendarDate)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		date, description, _ := strings.Cut(line, " ")
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q, expected YYYY-MM-DD", lineNumber, date)
+		}
+		byDate[date] = calendarDate{Date: date, Description: strings.TrimSpace(description)}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sortedCalendarDates(byDate), nil
+}
+
+// Function to read the days covered by the events of an iCalendar file.
+// Recurrence rules are not expanded, which suits holiday calendars listing
+// every year's dates.
+func parseICalendar(body []byte) ([]calendarDate, error) {
+	// Long lines are folded onto continuation lines starting with a space or tab
+	unfolded := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(string(body))
+
+	byDate := make(map[string]calendarDate)
+	var start, end time.Time
+	var summary string
+	inEvent := false
+	for _, line := range strings.Split(unfolded, "\n") {
+		line = strings.TrimRight(line, "\r")
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		property, _, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(property) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				inEvent, start, end, summary = true, time.Time{}, time.Time{}, ""
+			}
+		case "DTSTART", "DTEND":
+			if !inEvent {
+				continue
+			}
+			t, err := parseICalDate(value)
+			if err != nil {
+				return nil, err
+			}
+			if strings.EqualFold(property, "DTSTART") {
+				start = t
+			} else {
+				end = t
+			}
+		case "SUMMARY":
+			if inEvent {
+				summary = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\\`, `\`).Replace(value)
+			}
+		case "END":
+			if !strings.EqualFold(value, "VEVENT") || !inEvent {
+				continue
+			}
+			inEvent = false
+			if start.IsZero() {
+				return nil, fmt.Errorf("event %q has no DTSTART", summary)
+			}
+			// DTEND is exclusive; events without one last a day
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+				date := day.Format(time.DateOnly)
+				byDate[date] = calendarDate{Date: date, Description: summary}
+			}
+		}
+	}
+	return sortedCalendarDates(byDate), nil
+}
+
+// Helper function to parse an iCalendar DATE or DATE-TIME value to the day it falls on
+func parseICalDate(value string) (time.Time, error) {
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range []string{"20060102", "20060102T150405"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid iCalendar date %q", value)
+}
+
+// Helper function to list the dates of a calendar in order
+func sortedCalendarDates(byDate map[string]calendarDate) []calendarDate {
+	dates := make([]calendarDate, 0, len(byDate))
+	for _, d := range byDate {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(a, b int) bool { return dates[a].Date < dates[b].Date })
+	return dates
+}
+
+// Function to create or replace a tenant's calendar, returning whether it was created
+func saveCalendar(tenant, name string, dates []calendarDate) (bool, error) {
+	if !calendarNamePattern.MatchString(name) {
+		return false, fmt.Errorf("invalid calendar name %q, use letters, digits, dots, dashes and underscores", name)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := formatStorageTime(time.Now())
+	var id int64
+	created := false
+	err = tx.QueryRow(`SELECT id FROM calendars WHERE tenant = ? AND name = ?`, tenant, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		result, err := tx.Exec(`INSERT INTO calendars (tenant, name, updated_at) VALUES (?, ?, ?)`, tenant, name, now)
+		if err != nil {
+			return false, fmt.Errorf("error saving calendar %s: %w", name, err)
+		}
+		id, _ = result.LastInsertId()
+		created = true
+	} else if err != nil {
+		return false, fmt.Errorf("error loading calendar %s: %w", name, err)
+	} else if _, err := tx.Exec(`UPDATE calendars SET updated_at = ? WHERE id = ?`, now, id); err != nil {
+		return false, fmt.Errorf("error saving calendar %s: %w", name, err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM calendar_dates WHERE calendar_id = ?`, id); err != nil {
+		return false, fmt.Errorf("error saving calendar %s: %w", name, err)
+	}
+	for _, d := range dates {
+		if _, err := tx.Exec(`INSERT INTO calendar_dates (calendar_id, date, description) VALUES (?, ?, ?)`, id, d.Date, d.Description); err != nil {
+			return false, fmt.Errorf("error saving calendar %s: %w", name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing changes: %w", err)
+	}
+	return created, nil
+}
+
+// Function to delete a tenant's calendar. Jobs that still name it run on every day.
+func deleteCalendar(tenant, name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var id int64
+	err := db.QueryRow(`SELECT id FROM calendars WHERE tenant = ? AND name = ?`, tenant, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errCalendarNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error loading calendar %s: %w", name, err)
+	}
+	if _, err := db.Exec(`DELETE FROM calendar_dates WHERE calendar_id = ?`, id); err != nil {
+		return fmt.Errorf("error deleting calendar %s: %w", name, err)
+	}
+	if _, err := db.Exec(`DELETE FROM calendars WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("error deleting calendar %s: %w", name, err)
+	}
+	return nil
+}
+
+// Function to list a tenant's calendars by name
+func listCalendars(tenant string) ([]calendarInfo, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`
+		SELECT c.name, COUNT(d.id), c.updated_at
+		FROM calendars c
+		LEFT JOIN calendar_dates d ON d.calendar_id = c.id
+		WHERE c.tenant = ?
+		GROUP BY c.id
+		ORDER BY c.name`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying calendars: %w", err)
+	}
+	defer rows.Close()
+
+	list := []calendarInfo{}
+	for rows.Next() {
+		var c calendarInfo
+		if err := rows.Scan(&c.Name, &c.Dates, &c.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error reading calendars: %w", err)
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// Function to load the dates of a tenant's calendar
+func loadCalendarDates(tenant, name string) ([]calendarDate, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var id int64
+	err := db.QueryRow(`SELECT id FROM calendars WHERE tenant = ? AND name = ?`, tenant, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errCalendarNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading calendar %s: %w", name, err)
+	}
+	rows, err := db.Query(`SELECT date, description FROM calendar_dates WHERE calendar_id = ? ORDER BY date`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading calendar %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	dates := []calendarDate{}
+	for rows.Next() {
+		var d calendarDate
+		if err := rows.Scan(&d.Date, &d.Description); err != nil {
+			return nil, fmt.Errorf("error reading calendar %s: %w", name, err)
+		}
+		dates = append(dates, d)
+	}
+	return dates, rows.Err()
+}
+
+// Function to find the calendar date, if any, on which a job's run at t must
+// be skipped. Dates are matched in the scheduler's time zone.
+func calendarSkip(j Job, t time.Time) (calendarDate, string, bool) {
+	if len(j.SkipCalendars) == 0 {
+		return calendarDate{}, "", false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	args := []any{j.Tenant, t.In(time.Local).Format(time.DateOnly)}
+	for _, name := range j.SkipCalendars {
+		args = append(args, name)
+	}
+	var d calendarDate
+	var name string
+	err := db.QueryRow(`
+		SELECT d.date, d.description, c.name
+		FROM calendar_dates d
+		JOIN calendars c ON c.id = d.calendar_id
+		WHERE c.tenant = ? AND d.date = ? AND c.name IN (?`+strings.Repeat(", ?", len(j.SkipCalendars)-1)+`)
+		LIMIT 1`, args...).Scan(&d.Date, &d.Description, &name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, "", false
+	}
+	if err != nil {
+		fmt.Printf("Error checking calendars of job %s: %s\n", j.Name, err)
+		return d, "", false
+	}
+	return d, name, true
+}
+
+// Handler for GET /api/v1/calendars, listing the tenant's calendars
+func apiCalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := listCalendars(requestTenant(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Handler for GET /api/v1/calendars/{name}, returning a calendar's dates
+func apiCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	dates, err := loadCalendarDates(requestTenant(r), name)
+	if errors.Is(err, errCalendarNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("calendar %s not found", name))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"name": name, "dates": dates})
+}
+
+// Handler for PUT /api/v1/calendars/{name}, creating or replacing a calendar
+// from an iCalendar file or a list of dates in the body
+func apiPutCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can change calendars")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCalendarSize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("calendar larger than %d bytes", maxCalendarSize))
+		return
+	}
+	dates, err := parseCalendar(body)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tenant, name := requestTenant(r), r.PathValue("name")
+	created, err := saveCalendar(tenant, name, dates)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Saved calendar %s with %d dates from %s", name, len(dates), r.RemoteAddr))
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, calendarInfo{Name: name, Dates: len(dates), UpdatedAt: formatStorageTime(time.Now())})
+}
+
+// Handler for DELETE /api/v1/calendars/{name}
+func apiDeleteCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can delete calendars")
+		return
+	}
+	tenant, name := requestTenant(r), r.PathValue("name")
+	err := deleteCalendar(tenant, name)
+	if errors.Is(err, errCalendarNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("calendar %s not found", name))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Deleted calendar %s from %s", name, r.RemoteAddr))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler for the calendars page (GET /calendars), listing the calendars with
+// a form to upload one (POST)
+func calendarsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	message := ""
+	if r.Method == http.MethodPost {
+		if _, ok := requestAdmin(r); !ok {
+			http.Error(w, "Only admins can upload calendars", http.StatusForbidden)
+			return
+		}
+		err := uploadCalendarFromForm(w, r, tenant)
+		if err == nil {
+			http.Redirect(w, r, tenantURL(r, "/calendars"), http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		message = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+	}
+
+	list, err := listCalendars(tenant)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	var rows strings.Builder
+	for _, c := range list {
+		fmt.Fprintf(&rows, `<tr>
+				<td>%s</td>
+				<td>%d</td>
+				<td>%s</td>
+				<td><form action="%s" method="post" class="m-0" onsubmit="return confirm('Delete this calendar?')">
+					<input type="hidden" name="name" value="%s">
+					<button type="submit" class="btn btn-sm btn-outline-danger">Delete</button>
+				</form></td>
+			</tr>`, html.EscapeString(c.Name), c.Dates, html.EscapeString(c.UpdatedAt), tenantURL(r, "/calendars/delete"), html.EscapeString(c.Name))
+	}
+	if len(list) == 0 {
+		rows.WriteString(`<tr><td colspan="4" class="text-muted">No calendars.</td></tr>`)
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Calendars</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Calendars</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	        </div>
+	        `+message+`
+	        <p class="text-muted">Jobs with the <code>skip_calendar</code> option skip their scheduled runs on the dates of the calendars it names, recorded with the status <code>Suppressed (calendar)</code>.</p>
+	        <table class="table table-striped table-hover">
+	            <thead>
+	                <tr>
+	                    <th>Name</th>
+	                    <th>Dates</th>
+	                    <th>Updated</th>
+	                    <th></th>
+	                </tr>
+	            </thead>
+	            <tbody>`+rows.String()+`</tbody>
+	        </table>
+	        <h2 class="h5">Upload Calendar</h2>
+	        <form action="`+tenantURL(r, "/calendars")+`" method="post" enctype="multipart/form-data">
+	            <div class="mb-3">
+	                <label for="name" class="form-label">Name</label>
+	                <input type="text" class="form-control" id="name" name="name" required>
+	                <div class="form-text">Uploading a calendar with an existing name replaces its dates.</div>
+	            </div>
+	            <div class="mb-3">
+	                <label for="file" class="form-label">iCalendar or list file</label>
+	                <input type="file" class="form-control" id="file" name="file" accept=".ics,.txt,text/calendar,text/plain">
+	            </div>
+	            <div class="mb-3">
+	                <label for="dates" class="form-label">Or dates, one per line</label>
+	                <textarea class="form-control" id="dates" name="dates" rows="5" placeholder="2026-12-25 Christmas Day"></textarea>
+	            </div>
+	            <button type="submit" class="btn btn-primary">Upload</button>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Helper function to save the calendar uploaded through the calendars page
+func uploadCalendarFromForm(w http.ResponseWriter, r *http.Request, tenant string) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCalendarSize+1<<10)
+	if err := r.ParseMultipartForm(maxCalendarSize); err != nil {
+		return fmt.Errorf("calendar larger than %d bytes", maxCalendarSize)
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	body := []byte(r.FormValue("dates"))
+	if file, _, err := r.FormFile("file"); err == nil {
+		defer file.Close()
+		if body, err = io.ReadAll(file); err != nil {
+			return fmt.Errorf("error reading the uploaded file: %w", err)
+		}
+	}
+	dates, err := parseCalendar(body)
+	if err != nil {
+		return err
+	}
+	if _, err := saveCalendar(tenant, name, dates); err != nil {
+		return err
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Saved calendar %s with %d dates by %s", name, len(dates), requestActor(r)))
+	return nil
+}
+
+// Handler for the Delete buttons on the calendars page
+func deleteCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can delete calendars", http.StatusForbidden)
+		return
+	}
+	tenant, name := requestTenant(r), r.FormValue("name")
+	err := deleteCalendar(tenant, name)
+	if errors.Is(err, errCalendarNotFound) {
+		http.Error(w, fmt.Sprintf("Calendar %s not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Deleted calendar %s by %s", name, requestActor(r)))
+	http.Redirect(w, r, tenantURL(r, "/calendars"), http.StatusSeeOther)
+}
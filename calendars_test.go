@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCalendar(t *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261224",
+		"DTEND;VALUE=DATE:20261227",
+		"SUMMARY:Christmas\\, Boxing Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20270101T090000Z",
+		"DTEND:20270101T170000Z",
+		"SUMMARY:New Year's",
+		"  Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261225",
+		"SUMMARY:Christmas Day",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	tests := []struct {
+		name string
+		body string
+		want []calendarDate
+	}{
+		{
+			name: "date list",
+			body: "# UK bank holidays\n2026-12-28 Boxing Day (substitute)\n\n2026-12-25 Christmas Day\n2026-12-25\n",
+			want: []calendarDate{{Date: "2026-12-25"}, {Date: "2026-12-28", Description: "Boxing Day (substitute)"}},
+		},
+		{
+			name: "iCalendar",
+			body: ics,
+			want: []calendarDate{
+				{Date: "2026-12-24", Description: "Christmas, Boxing Day"},
+				{Date: "2026-12-25", Description: "Christmas Day"},
+				{Date: "2026-12-26", Description: "Christmas, Boxing Day"},
+				{Date: "2027-01-01", Description: "New Year's Day"},
+			},
+		},
+		{
+			name: "empty",
+			body: "# nothing yet\n",
+			want: []calendarDate{},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseCalendar([]byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: parseCalendar failed: %s", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseCalendar = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCalendarErrors(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"2026-12-25 Christmas Day\n25/12/2026 Christmas Day\n", `line 2: invalid date "25/12/2026"`},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\nEND:VCALENDAR\n", `invalid iCalendar date "tomorrow"`},
+		{"BEGIN:VCALENDAR\nBEGIN:VEVENT\nSUMMARY:Offsite\nEND:VEVENT\nEND:VCALENDAR\n", `event "Offsite" has no DTSTART`},
+	}
+	for _, tt := range tests {
+		_, err := parseCalendar([]byte(tt.body))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseCalendar(%q) error = %v, want %q", tt.body, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Struct to hold the JSON record of a run, posted to a job's callback_url
+// after each run and shipped to Loki and Elasticsearch
+type runRecord struct {
+	UID        string `json:"uid"`
+	Tenant     string `json:"tenant"`
+	Job        string `json:"job"`
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	ExitCode   int    `json:"exit_code"`
+	RunNumber  int64  `json:"run_number"`
+	Attempt    int    `json:"attempt"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Output     string `json:"output"` // the end of the output, see newRunRecord
+	Runner     string `json:"runner"`
+	Hostname   string `json:"hostname"`
+	PID        int    `json:"pid,omitempty"`
+}
+
+// Function to post the result of a run to the job's callback_url, if it has
+// one, in the background. Failed deliveries are retried CALLBACK_RETRIES
+// times, waiting CALLBACK_RETRY_DELAY before the first retry and twice as
+// long before each further one.
+func sendRunCallback(j Job, s JobStatus) {
+	if j.CallbackURL == "" {
+		return
+	}
+	body, err := json.Marshal(newRunRecord(s, getEnvInt("NOTIFY_OUTPUT_LIMIT", 2000)))
+	if err != nil {
+		fmt.Printf("Error encoding callback of job %s: %s\n", j.Name, err)
+		return
+	}
+
+	retries := getEnvInt("CALLBACK_RETRIES", 3)
+	delay := getEnvDuration("CALLBACK_RETRY_DELAY", 5*time.Second)
+	go func() {
+		for attempt := 0; ; attempt++ {
+			err := postRunCallback(j.CallbackURL, body)
+			if err == nil {
+				return
+			}
+			if attempt >= retries {
+				recordEvent(j.Tenant, eventIntegration, fmt.Sprintf("Error sending callback of run %s of job %s after %d attempts: %s", s.UID, j.Name, attempt+1, err))
+				return
+			}
+			time.Sleep(delay << attempt)
+		}
+	}()
+}
+
+// Function to build the record of a run, keeping at most outputLimit bytes of
+// the end of its output
+func newRunRecord(s JobStatus, outputLimit int) runRecord {
+	return runRecord{
+		UID:        s.UID,
+		Tenant:     s.Tenant,
+		Job:        s.JobName,
+		Command:    s.Command,
+		Status:     s.Status,
+		ExitCode:   s.ExitCode,
+		RunNumber:  s.RunNumber,
+		Attempt:    s.Attempt,
+		StartedAt:  s.StartedAt,
+		FinishedAt: s.FinishedAt,
+		DurationMs: s.DurationMs,
+		Output:     truncateOutput(s.Output, outputLimit),
+		Runner:     s.Runner,
+		Hostname:   s.Hostname,
+		PID:        s.PID,
+	}
+}
+
+// Helper function to make one delivery attempt of a run callback
+func postRunCallback(callbackURL string, body []byte) error {
+	client := http.Client{Timeout: getEnvDuration("CALLBACK_TIMEOUT", 10*time.Second)}
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gtask/"+runnerName)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Most missed runs counted for a job, so that a frequent schedule after a
+// long downtime does not keep startup busy
+const maxMissedRunsCounted = 10000
+
+// Function to get the earliest time after a given time at which any of a
+// job's schedules fires, the zero time if none fires again
+func nextScheduledRun(j Job, after time.Time) time.Time {
+	var next time.Time
+	for _, expr := range j.CronExprs() {
+		schedule, err := parseSchedule(expr)
+		if err != nil {
+			continue
+		}
+		if t := schedule.Next(after); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
+
+// Function to store the time a job is next expected to run after a given
+// time, which startup compares against the clock to find missed runs
+func saveNextRun(j Job, after time.Time) {
+	if j.ID == 0 {
+		return
+	}
+	nextRunAt := ""
+	if next := nextScheduledRun(j, after); !next.IsZero() {
+		nextRunAt = formatStorageTime(next)
+	}
+
+	if err := storage.SaveNextRun(j, nextRunAt); err != nil {
+		fmt.Printf("Error saving next run of job %s: %s\n", j.Name, err)
+	}
+}
+
+// Function to load the next run times stored by the previous scheduler
+// process, keyed by job ID. Must be called before the jobs are scheduled,
+// which stores new ones.
+func loadExpectedRuns() map[int64]time.Time {
+	expected, err := storage.NextRuns()
+	if err != nil {
+		fmt.Printf("Error loading next run times: %s\n", err)
+		return make(map[int64]time.Time)
+	}
+	return expected
+}
+
+// Function to find the runs of a job that were due between its expected
+// next run and now, returning the latest ones, at most limit, and how many
+// were missed in total
+func missedRuns(j Job, expected, now time.Time, limit int) ([]time.Time, int) {
+	var latest []time.Time
+	missed := 0
+	for t := expected; !t.IsZero() && !t.After(now) && missed < maxMissedRunsCounted; t = nextScheduledRun(j, t) {
+		missed++
+		latest = append(latest, t)
+		if len(latest) > limit {
+			latest = latest[1:]
+		}
+	}
+	return latest, missed
+}
+
+// Function to run, one after the other, the scheduled runs that jobs with the
+// catch_up option missed while the scheduler was down. Missed runs still go
+// through the job's exclusions, calendars and maintenance windows.
+func catchUpMissedRuns(expected map[int64]time.Time, now time.Time) {
+	jobsMu.RLock()
+	var catchUp []Job
+	for _, j := range jobs {
+		if _, ok := expected[j.ID]; ok && j.CatchUp {
+			catchUp = append(catchUp, j)
+		}
+	}
+	jobsMu.RUnlock()
+
+	for _, j := range catchUp {
+		times, missed := missedRuns(j, expected[j.ID], now, max(j.CatchUpMax, 1))
+		if missed == 0 {
+			continue
+		}
+		count := fmt.Sprint(missed)
+		if missed >= maxMissedRunsCounted {
+			count = "at least " + count
+		}
+		recordEvent(j.Tenant, eventJob, fmt.Sprintf("Job %s missed %s runs while the scheduler was down, catching up %d", j.Name, count, len(times)))
+		go func() {
+			for _, t := range times {
+				runScheduled(j, t)
+			}
+		}()
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Overlap policies of the concurrency option, deciding what happens when a
+// job is triggered while a previous run of it is still in progress
+const (
+	concurrencyAllow   = "allow"   // start another run next to it (the default)
+	concurrencyForbid  = "forbid"  // skip the new run, recording it as "Skipped"
+	concurrencyReplace = "replace" // cancel the running one, then start the new run
+)
+
+// Struct to hold a run of a job in progress, from its first attempt to its last
+type jobRun struct {
+	replaced chan struct{} // closed when a new run replaces this one
+	done     chan struct{} // closed when the run has finished
+}
+
+// Runs in progress per job, keyed by jobKey
+var (
+	activeJobRuns   = make(map[string]map[*jobRun]bool)
+	activeJobRunsMu sync.Mutex
+)
+
+// Function to start a run of a job, applying the job's concurrency policy.
+// Returns false when the run must be skipped.
+func claimJobRun(j Job) (*jobRun, bool) {
+	key := jobKey(j.Tenant, j.Name)
+	run := &jobRun{replaced: make(chan struct{}), done: make(chan struct{})}
+
+	activeJobRunsMu.Lock()
+	previous := make([]*jobRun, 0, len(activeJobRuns[key]))
+	for r := range activeJobRuns[key] {
+		previous = append(previous, r)
+	}
+	if len(previous) > 0 && j.Concurrency == concurrencyForbid {
+		activeJobRunsMu.Unlock()
+		return nil, false
+	}
+	if len(previous) > 0 && j.Concurrency == concurrencyReplace {
+		for _, r := range previous {
+			select {
+			case <-r.replaced:
+			default:
+				close(r.replaced)
+			}
+		}
+	}
+	if activeJobRuns[key] == nil {
+		activeJobRuns[key] = make(map[*jobRun]bool)
+	}
+	activeJobRuns[key][run] = true
+	activeJobRunsMu.Unlock()
+
+	if len(previous) > 0 && j.Concurrency == concurrencyReplace {
+		replaceJobRuns(j, previous)
+	}
+	return run, true
+}
+
+// Function to finish a run of a job
+func releaseJobRun(j Job, run *jobRun) {
+	key := jobKey(j.Tenant, j.Name)
+	activeJobRunsMu.Lock()
+	defer activeJobRunsMu.Unlock()
+	delete(activeJobRuns[key], run)
+	if len(activeJobRuns[key]) == 0 {
+		delete(activeJobRuns, key)
+	}
+	close(run.done)
+}
+
+// Function to replace the previous runs of a job: their running commands are
+// cancelled, their pending retries dropped, and the new run waits for them to
+// finish, at most RUN_CANCEL_GRACE and a second
+func replaceJobRuns(j Job, previous []*jobRun) {
+	for _, run := range runningRuns(j.Tenant) {
+		if run.Job == j.Name {
+			cancelRun(j.Tenant, run.UID, "a new run of the job")
+		}
+	}
+	recordEvent(j.Tenant, eventJob, fmt.Sprintf("Replacing %d runs of job %s with a new run", len(previous), j.Name))
+
+	deadline := time.After(getEnvDuration("RUN_CANCEL_GRACE", 5*time.Second) + time.Second)
+	for _, run := range previous {
+		select {
+		case <-run.done:
+		case <-deadline:
+			fmt.Printf("Error replacing runs of job %s: previous run still in progress, starting the new run anyway\n", j.Name)
+			return
+		}
+	}
+}
+
+// Helper function to tell whether a channel has been closed
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
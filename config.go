@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Function to read a string setting, falling back to def when it is unset
+func getEnvString(name string, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// Function to read an integer setting, falling back to def when it is unset or invalid
+func getEnvInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Invalid value for %s: %s, using %d\n", name, value, def)
+		return def
+	}
+	return n
+}
+
+// Function to read a duration setting such as "5m", falling back to def when it is unset or invalid
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Printf("Invalid value for %s: %s, using %s\n", name, value, def)
+		return def
+	}
+	return d
+}
+
+// Function to read a boolean setting, falling back to def when it is unset or invalid
+func getEnvBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		fmt.Printf("Invalid value for %s: %s, using %t\n", name, value, def)
+		return def
+	}
+	return b
+}
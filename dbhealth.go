@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Returned without touching the database while the circuit breaker is open
+var errStoreUnavailable = errors.New("database unavailable, circuit breaker is open")
+
+// Struct to hold the health of the database as seen by the circuit breaker.
+// After DB_BREAKER_THRESHOLD consecutive failed operations the breaker opens
+// and writes are buffered instead of attempted; once DB_BREAKER_COOLDOWN has
+// passed one operation is let through to probe whether the database is back.
+type dbCircuitBreaker struct {
+	mu          sync.Mutex
+	open        bool
+	probing     bool
+	failures    int
+	openedAt    time.Time
+	lastError   string
+	lastErrorAt time.Time
+	buffered    []JobStatus // run statuses waiting for the database to come back
+	dropped     int
+}
+
+// Circuit breaker shared by every guarded database operation
+var dbBreaker = &dbCircuitBreaker{}
+
+// Function to tell whether a database error is likely to go away on its own,
+// such as a locked database or a dropped connection
+func isTransientDBError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrBusy, sqlite3.ErrLocked, sqlite3.ErrIoErr, sqlite3.ErrCantOpen, sqlite3.ErrProtocol:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, driver.ErrBadConn) || strings.Contains(err.Error(), "database is locked")
+}
+
+// Function to run a database operation through the circuit breaker, retrying
+// transient errors up to DB_RETRY_ATTEMPTS times with a doubling delay
+// starting at DB_RETRY_DELAY. The caller must not hold mu while waiting, so
+// fn is expected to take the lock itself.
+func guardDB(op string, fn func() error) error {
+	if !dbBreaker.allow() {
+		return errStoreUnavailable
+	}
+
+	attempts := max(getEnvInt("DB_RETRY_ATTEMPTS", 3), 1)
+	delay := getEnvDuration("DB_RETRY_DELAY", 100*time.Millisecond)
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = fn(); err == nil || !isTransientDBError(err) {
+			break
+		}
+		if attempt < attempts {
+			fmt.Printf("Retrying %s after transient database error: %s\n", op, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	dbBreaker.record(op, err)
+	return err
+}
+
+// Function to tell whether an operation may try the database now
+func (s *dbCircuitBreaker) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.open {
+		return true
+	}
+	if s.probing || time.Since(s.openedAt) < getEnvDuration("DB_BREAKER_COOLDOWN", 30*time.Second) {
+		return false
+	}
+	s.probing = true
+	return true
+}
+
+// Function to record the outcome of a guarded operation, opening or closing
+// the circuit breaker. Only errors from the database count as failures.
+func (s *dbCircuitBreaker) record(op string, err error) {
+	s.mu.Lock()
+	wasOpen := s.open
+	if err == nil || !isTransientDBError(err) {
+		s.failures, s.open, s.probing = 0, false, false
+	} else {
+		s.failures++
+		s.lastError, s.lastErrorAt = fmt.Sprintf("%s: %s", op, err), time.Now()
+		if s.probing || s.failures >= max(getEnvInt("DB_BREAKER_THRESHOLD", 5), 1) {
+			s.open, s.probing, s.openedAt = true, false, time.Now()
+		}
+	}
+	isOpen, lastError := s.open, s.lastError
+	s.mu.Unlock()
+
+	setGauge("gtask_db_up", map[bool]float64{true: 0, false: 1}[isOpen])
+	switch {
+	case isOpen && !wasOpen:
+		notify("critical", "Database unavailable", fmt.Sprintf("Circuit breaker opened after repeated errors, run statuses are buffered in memory. Last error: %s", lastError))
+	case !isOpen && wasOpen:
+		notify("info", "Database available again", "Circuit breaker closed, buffered run statuses are written with the next batch")
+	}
+}
+
+// Function to buffer run statuses that could not be written, dropping the
+// oldest ones beyond DB_BUFFER_MAX_ROWS
+func (s *dbCircuitBreaker) buffer(batch []JobStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buffered = append(s.buffered, batch...)
+	if limit := getEnvInt("DB_BUFFER_MAX_ROWS", 10000); len(s.buffered) > limit {
+		excess := len(s.buffered) - limit
+		s.dropped += excess
+		s.buffered = s.buffered[excess:]
+		fmt.Printf("Error buffering run statuses: buffer full, dropped %d oldest\n", excess)
+	}
+	setGauge("gtask_db_buffered_statuses", float64(len(s.buffered)))
+}
+
+// Function to take the buffered run statuses, to write them with the next batch
+func (s *dbCircuitBreaker) takeBuffered() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	buffered := s.buffered
+	s.buffered = nil
+	setGauge("gtask_db_buffered_statuses", 0)
+	return buffered
+}
+
+// Struct to hold the health report returned by GET /healthz
+type healthReport struct {
+	Status   string         `json:"status"` // "ok", "degraded" or "down"
+	Database databaseHealth `json:"database"`
+}
+
+// Struct to hold the database part of the health report
+type databaseHealth struct {
+	Breaker             string `json:"breaker"` // "closed" or "open"
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastError           string `json:"last_error,omitempty"`
+	LastErrorAt         string `json:"last_error_at,omitempty"`
+	BufferedStatuses    int    `json:"buffered_statuses"`
+	DroppedStatuses     int    `json:"dropped_statuses"`
+}
+
+// Function to report the health of the database
+func (s *dbCircuitBreaker) report() healthReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := healthReport{Status: "ok", Database: databaseHealth{Breaker: "closed", ConsecutiveFailures: s.failures,
+		LastError: s.lastError, BufferedStatuses: len(s.buffered), DroppedStatuses: s.dropped}}
+	if !s.lastErrorAt.IsZero() {
+		report.Database.LastErrorAt = formatStorageTime(s.lastErrorAt)
+	}
+	switch {
+	case s.open:
+		report.Status, report.Database.Breaker = "down", "open"
+	case s.failures > 0 || len(s.buffered) > 0:
+		report.Status = "degraded"
+	}
+	return report
+}
+
+// Handler for GET /healthz, reporting the scheduler's health for load
+// balancers and monitors. Responds 503 while the database is down.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	report := dbBreaker.report()
+	status := http.StatusOK
+	if report.Status == "down" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// Helper function to render the dashboard banner shown while the database is
+// failing
+func storeBanner() string {
+	report := dbBreaker.report()
+	switch report.Status {
+	case "down":
+		return fmt.Sprintf(`<div class="alert alert-danger"><strong>Database unavailable.</strong> Jobs keep running and %d run statuses are buffered in memory. Last error: %s</div>`,
+			report.Database.BufferedStatuses, html.EscapeString(report.Database.LastError))
+	case "degraded":
+		if report.Database.BufferedStatuses > 0 {
+			return fmt.Sprintf(`<div class="alert alert-warning">%d run statuses are waiting to be written to the database.</div>`, report.Database.BufferedStatuses)
+		}
+	}
+	return ""
+}
+
+// Function to get the journal mode the database is opened with: DB_JOURNAL_MODE,
+// WAL by default so that readers do not wait for the writer
+func journalMode() (string, error) {
+	mode := strings.ToUpper(strings.TrimSpace(getEnvString("DB_JOURNAL_MODE", "WAL")))
+	switch mode {
+	case "WAL", "DELETE", "TRUNCATE", "PERSIST":
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown journal mode %q, expected WAL, DELETE, TRUNCATE or PERSIST", mode)
+}
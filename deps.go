@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errDependencyCycle = errors.New("dependency cycle")
+
+// Function to find a path through the after links of a tenant's jobs that
+// leads from a job back to itself. The graph maps job names to the names of
+// their upstream jobs. Returns nil when the job is not part of a cycle.
+func dependencyCycle(graph map[string][]string, name string) []string {
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(current string) bool
+	visit = func(current string) bool {
+		for _, upstream := range graph[current] {
+			if upstream == name {
+				path = append(path, upstream)
+				return true
+			}
+			if visited[upstream] {
+				continue
+			}
+			visited[upstream] = true
+			path = append(path, upstream)
+			if visit(upstream) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+	if visit(name) {
+		return append([]string{name}, path...)
+	}
+	return nil
+}
+
+// Function to replace the upstream jobs of a tenant's job, refusing links that
+// would make the job depend on itself. The caller must hold mu and roll back
+// on error.
+func replaceDependencies(q dbExecutor, tenant, name string, after []string) error {
+	var id int64
+	if err := q.QueryRow(`SELECT id FROM jobs WHERE tenant = ? AND name = ?`, tenant, name).Scan(&id); err != nil {
+		return err
+	}
+	if _, err := q.Exec(`DELETE FROM job_dependencies WHERE job_id = ?`, id); err != nil {
+		return err
+	}
+	for _, upstream := range after {
+		if _, err := q.Exec(`INSERT INTO job_dependencies (job_id, upstream) VALUES (?, ?)`, id, upstream); err != nil {
+			return err
+		}
+	}
+	if len(after) == 0 {
+		return nil
+	}
+
+	graph, err := loadDependencies(q, tenant)
+	if err != nil {
+		return err
+	}
+	if cycle := dependencyCycle(graph, name); cycle != nil {
+		return fmt.Errorf("%w: job %s would run after itself (%s)", errDependencyCycle, name, strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// Function to load the upstream jobs of each of a tenant's jobs from the
+// job_dependencies table
+func loadDependencies(q dbExecutor, tenant string) (map[string][]string, error) {
+	rows, err := q.Query(`
+		SELECT j.name, d.upstream
+		FROM job_dependencies d
+		JOIN jobs j ON j.id = d.job_id
+		WHERE j.tenant = ?
+		ORDER BY d.id`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying job dependencies: %w", err)
+	}
+	defer rows.Close()
+
+	graph := make(map[string][]string)
+	for rows.Next() {
+		var name, upstream string
+		if err := rows.Scan(&name, &upstream); err != nil {
+			return nil, fmt.Errorf("error reading job dependencies: %w", err)
+		}
+		graph[name] = append(graph[name], upstream)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading job dependencies: %w", err)
+	}
+	return graph, nil
+}
+
+// Function to drop after links that point at unknown jobs or form a cycle.
+// The caller must hold jobsMu.
+func checkDependencies() {
+	graphs := make(map[string]map[string][]string)
+	for _, j := range jobs {
+		if graphs[j.Tenant] == nil {
+			graphs[j.Tenant] = make(map[string][]string)
+		}
+		graphs[j.Tenant][j.Name] = j.After
+	}
+
+	for key, j := range jobs {
+		if len(j.After) == 0 {
+			continue
+		}
+		if cycle := dependencyCycle(graphs[j.Tenant], j.Name); cycle != nil {
+			fmt.Printf("Dependency cycle detected at job %s (%s), disabling its dependencies\n", j.Name, strings.Join(cycle, " -> "))
+			j.After = nil
+			jobs[key] = j
+			continue
+		}
+		for _, upstream := range j.After {
+			if _, ok := jobs[jobKey(j.Tenant, upstream)]; !ok {
+				fmt.Printf("Warning: job %s runs after undefined job %s\n", j.Name, upstream)
+			}
+		}
+	}
+}
+
+// Upstream jobs that have succeeded since each dependent job was last
+// triggered by them, keyed by the dependent's jobKey
+var (
+	dependencyProgress   = make(map[string]map[string]bool)
+	dependencyProgressMu sync.Mutex
+)
+
+// Function to start the jobs that run after a job, once it has succeeded. A
+// job with several upstream jobs starts when all of them have succeeded since
+// it was last started this way.
+func triggerDependents(j Job) {
+	jobsMu.RLock()
+	var dependents []Job
+	for _, d := range jobs {
+		if d.Tenant != j.Tenant {
+			continue
+		}
+		for _, upstream := range d.After {
+			if upstream == j.Name {
+				dependents = append(dependents, d)
+				break
+			}
+		}
+	}
+	jobsMu.RUnlock()
+	sort.Slice(dependents, func(a, b int) bool { return dependents[a].Name < dependents[b].Name })
+
+	var ready []Job
+	dependencyProgressMu.Lock()
+	for _, d := range dependents {
+		key := jobKey(d.Tenant, d.Name)
+		if dependencyProgress[key] == nil {
+			dependencyProgress[key] = make(map[string]bool)
+		}
+		dependencyProgress[key][j.Name] = true
+		done := true
+		for _, upstream := range d.After {
+			if !dependencyProgress[key][upstream] {
+				done = false
+				break
+			}
+		}
+		if done {
+			delete(dependencyProgress, key)
+			ready = append(ready, d)
+		}
+	}
+	dependencyProgressMu.Unlock()
+
+	for _, d := range ready {
+		recordEvent(d.Tenant, eventJob, fmt.Sprintf("Job %s started after %s succeeded", d.Name, strings.Join(d.After, ", ")))
+		go job(d, nil)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencyCycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph map[string][]string
+		job   string
+		want  []string
+	}{
+		{"no upstream jobs", map[string][]string{}, "load", nil},
+		{"chain", map[string][]string{"load": {"transform"}, "transform": {"extract"}}, "load", nil},
+		{"self", map[string][]string{"load": {"load"}}, "load", []string{"load", "load"}},
+		{"two jobs", map[string][]string{"load": {"extract"}, "extract": {"load"}}, "load", []string{"load", "extract", "load"}},
+		{
+			"long way round",
+			map[string][]string{"load": {"extract", "transform"}, "transform": {"clean"}, "clean": {"load"}},
+			"load",
+			[]string{"load", "transform", "clean", "load"},
+		},
+		{
+			"cycle not through the job",
+			map[string][]string{"report": {"load"}, "load": {"extract"}, "extract": {"load"}},
+			"report",
+			nil,
+		},
+		{
+			"shared upstream",
+			map[string][]string{"report": {"load", "audit"}, "load": {"extract"}, "audit": {"extract"}},
+			"report",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		if got := dependencyCycle(tt.graph, tt.job); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: dependencyCycle(%q) = %q, want %q", tt.name, tt.job, got, tt.want)
+		}
+	}
+}
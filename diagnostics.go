@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Struct to hold a difference between the jobs table and the live cron
+// entries. Fix names the action that resolves it: "reschedule", "disable",
+// "reconcile" or "remove_entry".
+type driftItem struct {
+	Kind    string       `json:"kind"`
+	JobID   int64        `json:"job_id,omitempty"`
+	Job     string       `json:"job,omitempty"`
+	EntryID cron.EntryID `json:"entry_id,omitempty"`
+	Problem string       `json:"problem"`
+	Fix     string       `json:"fix"`
+}
+
+// Function to compare a tenant's enabled jobs in the jobs table with the live
+// cron entries, listing jobs that are not scheduled as defined and entries
+// no active job accounts for
+func driftReport(c *cron.Cron, tenant string) ([]driftItem, error) {
+	tableJobs, err := storage.ListJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := c.Entries()
+	live := make(map[cron.EntryID]bool)
+	for _, e := range entries {
+		live[e.ID] = true
+	}
+
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+
+	items := []driftItem{}
+	inTable := make(map[int64]bool)
+	for _, j := range tableJobs {
+		if j.Tenant != tenant {
+			continue
+		}
+		inTable[j.ID] = true
+		entry, ok := registered[j.ID]
+		item := driftItem{Kind: "unscheduled", JobID: j.ID, Job: j.Name}
+		switch {
+		case !ok:
+			item.Problem, item.Fix = "Enabled in the jobs table but not scheduled yet", "reconcile"
+		case entry.Err != nil:
+			item.Problem, item.Fix = "Could not be scheduled: "+entry.Err.Error(), "disable"
+		case entry.Disabled:
+			item.Problem, item.Fix = "Stopped after its last run, but still enabled in the jobs table", "reschedule"
+		case entry.Signature != jobSignature(j):
+			item.Kind, item.Problem, item.Fix = "outdated", "Scheduled with a definition that differs from the jobs table", "reconcile"
+		default:
+			missing := 0
+			for _, id := range entry.EntryIDs {
+				if !live[id] {
+					missing++
+				}
+			}
+			if missing == 0 {
+				continue
+			}
+			item.Kind, item.Problem, item.Fix = "missing_entries", fmt.Sprintf("%d of its %d cron entries are missing", missing, len(entry.EntryIDs)), "reschedule"
+		}
+		items = append(items, item)
+	}
+
+	owned := make(map[cron.EntryID]bool)
+	for id, entry := range registered {
+		for _, entryID := range entry.EntryIDs {
+			owned[entryID] = true
+		}
+		if entry.Job.Tenant != tenant || inTable[id] || len(entry.EntryIDs) == 0 {
+			continue
+		}
+		items = append(items, driftItem{Kind: "orphaned", JobID: id, Job: entry.Job.Name,
+			Problem: "Still scheduled, but disabled or deleted in the jobs table", Fix: "reconcile"})
+	}
+	for id := range internalEntries {
+		owned[id] = true
+	}
+	if tenant == defaultTenant {
+		for _, e := range entries {
+			if !owned[e.ID] {
+				items = append(items, driftItem{Kind: "unknown_entry", EntryID: e.ID,
+					Problem: "Cron entry not backed by any job", Fix: "remove_entry"})
+			}
+		}
+	}
+	return items, nil
+}
+
+// Function to apply a drift fix on behalf of an admin, recording it as an event
+func fixDrift(c *cron.Cron, tenant, actor, fix string, jobID int64, entryID cron.EntryID) error {
+	switch fix {
+	case "reconcile":
+	case "reschedule":
+		// Forget the job's registration so the reconcile adds it afresh
+		jobsMu.Lock()
+		entry, ok := registered[jobID]
+		if ok && entry.Job.Tenant == tenant {
+			removeEntries(c, entry.EntryIDs)
+			delete(jobs, jobKey(tenant, entry.Job.Name))
+			delete(registered, jobID)
+		}
+		jobsMu.Unlock()
+		if !ok || entry.Job.Tenant != tenant {
+			return errJobNotFound
+		}
+	case "disable":
+		mu.Lock()
+		result, err := db.Exec(`UPDATE jobs SET enabled = 0, updated_at = ? WHERE id = ? AND tenant = ?`, getCurrentTime(), jobID, tenant)
+		mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("error disabling job: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return errJobNotFound
+		}
+	case "remove_entry":
+		jobsMu.RLock()
+		_, internal := internalEntries[entryID]
+		owned := false
+		for _, entry := range registered {
+			for _, id := range entry.EntryIDs {
+				owned = owned || id == entryID
+			}
+		}
+		jobsMu.RUnlock()
+		if tenant != defaultTenant || internal || owned {
+			return fmt.Errorf("cron entry %d belongs to a job, fix the job instead", entryID)
+		}
+		c.Remove(entryID)
+	default:
+		return fmt.Errorf("unknown fix %q", fix)
+	}
+
+	reconcileJobs(c)
+	detail := fix
+	if jobID > 0 {
+		detail += fmt.Sprintf(" job %d", jobID)
+	}
+	if entryID > 0 {
+		detail += fmt.Sprintf(" entry %d", entryID)
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Drift fix by %s: %s", actor, detail))
+	return nil
+}
+
+// Handler for GET /api/v1/diagnostics/drift, returning the drift report of
+// the request's tenant to admins
+func apiDriftHandler(c *cron.Cron) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestAdmin(r); !ok {
+			writeJSONError(w, http.StatusForbidden, "only admins can view diagnostics")
+			return
+		}
+		items, err := driftReport(c, requestTenant(r))
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, items)
+	}
+}
+
+// Handler for the diagnostics page, showing the drift between the jobs table
+// and the live cron entries with a button to fix each difference. Only admins
+// may use it.
+func diagnosticsHandler(c *cron.Cron) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := requestAdmin(r)
+		if !ok {
+			http.Error(w, "Only admins can view diagnostics", http.StatusForbidden)
+			return
+		}
+		tenant := requestTenant(r)
+
+		message := ""
+		if r.Method == http.MethodPost {
+			jobID, _ := strconv.ParseInt(r.FormValue("job_id"), 10, 64)
+			entryID, _ := strconv.Atoi(r.FormValue("entry_id"))
+			if err := fixDrift(c, tenant, actor, r.FormValue("fix"), jobID, cron.EntryID(entryID)); err != nil {
+				message = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+			} else {
+				http.Redirect(w, r, tenantURL(r, "/diagnostics"), http.StatusSeeOther)
+				return
+			}
+		}
+
+		items, err := driftReport(c, tenant)
+		if err != nil {
+			http.Error(w, "Error querying database", http.StatusInternalServerError)
+			return
+		}
+
+		fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Diagnostics</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Diagnostics</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	            <a href="`+tenantURL(r, "/api/v1/cron/entries")+`" class="btn btn-outline-secondary">Cron Entries</a>
+	        </div>
+	        `+message)
+
+		if len(items) == 0 {
+			fmt.Fprintln(w, `<div class="alert alert-success">The live cron entries match the jobs table.</div>`)
+		} else {
+			fmt.Fprintln(w, `<table class="table table-striped table-hover">
+	            <thead>
+	                <tr>
+	                    <th>Job</th>
+	                    <th>Problem</th>
+	                    <th>Fix</th>
+	                </tr>
+	            </thead>
+	            <tbody>`)
+			labels := map[string]string{"reconcile": "Reconcile Now", "reschedule": "Reschedule", "disable": "Disable Job", "remove_entry": "Remove Entry"}
+			for _, item := range items {
+				name := html.EscapeString(item.Job)
+				if item.EntryID > 0 {
+					name = fmt.Sprintf("Entry %d", item.EntryID)
+				}
+				fmt.Fprintf(w, `<tr>
+				<td>%s</td>
+				<td>%s</td>
+				<td>
+					<form action="%s" method="post" class="m-0">
+						<input type="hidden" name="job_id" value="%d">
+						<input type="hidden" name="entry_id" value="%d">
+						<button type="submit" name="fix" value="%s" class="btn btn-sm btn-outline-primary">%s</button>
+					</form>
+				</td>
+			</tr>`, name, html.EscapeString(item.Problem), tenantURL(r, "/diagnostics"), item.JobID, item.EntryID, item.Fix, labels[item.Fix])
+			}
+			fmt.Fprintln(w, `</tbody></table>`)
+		}
+
+		fmt.Fprintln(w, `
+	    </div>
+	</body>
+	</html>
+	`)
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Lines of context around the changes of a diff
+const diffContext = 3
+
+// Most line edits a diff looks for before showing the outputs as replaced whole
+const maxDiffEdits = 2000
+
+// Struct to hold the run whose output a diff compares
+type diffRun struct {
+	ID        int64
+	UID       string
+	Job       string
+	RunNumber int64
+	Timestamp string
+	Status    string
+	Output    string
+}
+
+// Function to load a tenant's run by UID for a diff
+func loadDiffRun(tenant, uid string) (diffRun, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	var run diffRun
+	err := db.QueryRow(`SELECT job_id, task_id, COALESCE(NULLIF(job_name, ''), command), run_number, timestamp, status, output
+		FROM job_status WHERE task_id = ? AND tenant = ?`, uid, tenant).Scan(&run.ID, &run.UID, &run.Job, &run.RunNumber, &run.Timestamp, &run.Status, &run.Output)
+	return run, err
+}
+
+// Function to load the run of the same job before the given one
+func loadPreviousRun(tenant string, run diffRun) (diffRun, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	var previous diffRun
+	err := db.QueryRow(`SELECT job_id, task_id, COALESCE(NULLIF(job_name, ''), command), run_number, timestamp, status, output
+		FROM job_status WHERE tenant = ? AND COALESCE(NULLIF(job_name, ''), command) = ? AND job_id < ? ORDER BY job_id DESC LIMIT 1`,
+		tenant, run.Job, run.ID).Scan(&previous.ID, &previous.UID, &previous.Job, &previous.RunNumber, &previous.Timestamp, &previous.Status, &previous.Output)
+	return previous, err
+}
+
+// Function to load the two runs of a diff request, given by the from and to
+// run UIDs. Without from, the run of the same job before to is compared.
+// Returns the HTTP status of the error, if any.
+func loadDiffRuns(r *http.Request) (diffRun, diffRun, int, error) {
+	tenant := requestTenant(r)
+	fromUID, toUID := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	if toUID == "" {
+		return diffRun{}, diffRun{}, http.StatusBadRequest, fmt.Errorf("to must be a run UID")
+	}
+	to, err := loadDiffRun(tenant, toUID)
+	if err == sql.ErrNoRows {
+		return diffRun{}, diffRun{}, http.StatusNotFound, fmt.Errorf("no run has UID %s", toUID)
+	} else if err != nil {
+		return diffRun{}, diffRun{}, http.StatusInternalServerError, fmt.Errorf("error querying runs: %w", err)
+	}
+
+	var from diffRun
+	if fromUID == "" {
+		from, err = loadPreviousRun(tenant, to)
+		if err == sql.ErrNoRows {
+			return diffRun{}, diffRun{}, http.StatusNotFound, fmt.Errorf("run %s is the first run of its job", toUID)
+		}
+	} else {
+		from, err = loadDiffRun(tenant, fromUID)
+		if err == sql.ErrNoRows {
+			return diffRun{}, diffRun{}, http.StatusNotFound, fmt.Errorf("no run has UID %s", fromUID)
+		}
+	}
+	if err != nil {
+		return diffRun{}, diffRun{}, http.StatusInternalServerError, fmt.Errorf("error querying runs: %w", err)
+	}
+	if from.Job != to.Job {
+		return diffRun{}, diffRun{}, http.StatusBadRequest, fmt.Errorf("runs %s and %s belong to different jobs", fromUID, toUID)
+	}
+	return from, to, http.StatusOK, nil
+}
+
+// Helper function to name a run in the header of a diff
+func (d diffRun) label() string {
+	if d.RunNumber > 0 {
+		return fmt.Sprintf("%s run #%d (%s)", d.Job, d.RunNumber, d.Timestamp)
+	}
+	return fmt.Sprintf("%s (%s)", d.Job, d.Timestamp)
+}
+
+// Struct to hold a line of a diff, with its kind: ' ' kept, '-' removed, '+' added
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// Function to split an output into lines, without the break ending the last
+func splitLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+}
+
+// Function to compute the line edits turning a into b with Myers' algorithm.
+// Lines the two share at their start and end are matched first. When more
+// than maxDiffEdits edits are needed, the differing middle is shown as
+// removed and added whole.
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var lines []diffLine
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	lines = append(lines, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{' ', text})
+	}
+	return lines
+}
+
+// Helper function running Myers' algorithm on the differing middle of two outputs
+func myersDiff(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	// Before round d, only diagonals -d to d are read, so only they are kept
+	var trace [][]int
+	found := false
+	for d := 0; d <= n+m && d <= maxDiffEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		var lines []diffLine
+		for _, text := range a {
+			lines = append(lines, diffLine{'-', text})
+		}
+		for _, text := range b {
+			lines = append(lines, diffLine{'+', text})
+		}
+		return lines
+	}
+
+	// Walk back through the trace, collecting the edits from the end
+	var reversed []diffLine
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d] // diagonal k at index k+d
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[d+prevK]
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffLine{' ', a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffLine{'+', b[prevY]})
+			} else {
+				reversed = append(reversed, diffLine{'-', a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	lines := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
+
+// Function to format the edits between two outputs as a unified diff,
+// empty when the outputs are the same
+func unifiedDiff(fromLabel, toLabel string, lines []diffLine) string {
+	var out strings.Builder
+	changed := false
+	for _, line := range lines {
+		if line.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return ""
+	}
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	// Line numbers in a and b at the start of each diff line
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, line := range lines {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if line.kind != '+' {
+			aLine[i+1]++
+		}
+		if line.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			i++
+			continue
+		}
+		// A hunk runs from the context before a change to the context after
+		// the last change closer than twice the context to the one before
+		start := max(0, i-diffContext)
+		end := i
+		for j := i; j < len(lines); j++ {
+			if lines[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(len(lines), end+diffContext)
+
+		aCount, bCount := aLine[end]-aLine[start], bLine[end]-bLine[start]
+		// Empty ranges are numbered by the line before them
+		aStart, bStart := aLine[start]+1, bLine[start]+1
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+		for _, line := range lines[start:end] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text + "\n")
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// Handler for GET /api/v1/runs/diff, returning the unified diff of the
+// outputs of two runs of a job as text, empty when they are the same
+func apiRunDiffHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, status, err := loadDiffRuns(r)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, unifiedDiff(from.label(), to.label(), diffLines(splitLines(from.Output), splitLines(to.Output))))
+}
+
+// Handler for the page showing the diff of the outputs of two runs of a job
+func runDiffHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, status, err := loadDiffRuns(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	prefs, err := loadPreferences(requestTenant(r), requestUser(r))
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	loc := prefs.Location()
+	describe := func(d diffRun) string {
+		name := html.EscapeString(d.Job)
+		if d.RunNumber > 0 {
+			name += fmt.Sprintf(" run #%d", d.RunNumber)
+		}
+		return fmt.Sprintf(`<a href="%s">%s</a> <span class="text-muted">%s, %s</span>`,
+			html.EscapeString(tenantURL(r, "/download?task_id="+url.QueryEscape(d.UID))), name, displayStorageTime(d.Timestamp, loc), html.EscapeString(d.Status))
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Output Changes</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	    <style>
+	        .diff { font-family: monospace; white-space: pre-wrap; }
+	        .diff .add { background-color: #d1e7dd; }
+	        .diff .del { background-color: #f8d7da; }
+	        .diff .hunk { color: #6c757d; }
+	    </style>
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Output Changes</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	            <a href="`+tenantURL(r, "/runs?job="+url.QueryEscape(to.Job))+`" class="btn btn-outline-secondary">Run History</a>
+	        </div>
+	        <p>From `+describe(from)+`<br>To `+describe(to)+`</p>`)
+
+	diff := unifiedDiff(from.label(), to.label(), diffLines(splitLines(from.Output), splitLines(to.Output)))
+	if diff == "" {
+		fmt.Fprintln(w, `<p>The outputs are the same.</p>`)
+	} else {
+		fmt.Fprint(w, `<div class="diff border rounded p-2">`)
+		// The file header names the runs, which the page shows above
+		for _, line := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n")[2:] {
+			class := ""
+			switch line[0] {
+			case '+':
+				class = "add"
+			case '-':
+				class = "del"
+			case '@':
+				class = "hunk"
+			}
+			fmt.Fprintf(w, `<div class="%s">%s</div>`, class, html.EscapeString(line))
+		}
+		fmt.Fprintln(w, `</div>`)
+	}
+
+	fmt.Fprintln(w, `
+	    </div>
+	</body>
+	</html>
+	`)
+}
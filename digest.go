@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Values of the notify job option
+const (
+	notifyEach   = "each"   // every run result is notified (the default)
+	notifyDigest = "digest" // run results are summed up in the periodic digest
+	notifyNone   = "none"   // run results are not notified
+)
+
+// Most failed runs listed in a digest
+const maxDigestFailures = 20
+
+// End of the period covered by the previous digest
+var (
+	lastDigestAt   = time.Now()
+	lastDigestAtMu sync.Mutex
+)
+
+// Function to schedule the digest of the runs of jobs with notify=digest,
+// every hour unless NOTIFY_DIGEST_SCHEDULE says otherwise
+func scheduleDigest(c *cron.Cron) {
+	schedule := os.Getenv("NOTIFY_DIGEST_SCHEDULE")
+	if schedule == "" {
+		schedule = "0 * * * *"
+	}
+
+	id, err := c.AddFunc(schedule, sendDigests)
+	if err != nil {
+		fmt.Printf("Error scheduling notification digest: %s\n", err)
+		return
+	}
+	registerInternalEntry(id, "digest", "notification digest", schedule)
+}
+
+// Function to send, per tenant, one notification summing up the runs of its
+// digest jobs since the previous digest. Tenants whose digest jobs did not
+// run are skipped.
+func sendDigests() {
+	lastDigestAtMu.Lock()
+	since, until := lastDigestAt, time.Now()
+	lastDigestAt = until
+	lastDigestAtMu.Unlock()
+
+	jobsMu.RLock()
+	byTenant := make(map[string][]string)
+	for _, j := range jobs {
+		if j.Notify == notifyDigest {
+			byTenant[j.Tenant] = append(byTenant[j.Tenant], j.Name)
+		}
+	}
+	jobsMu.RUnlock()
+
+	for tenant, names := range byTenant {
+		sort.Strings(names)
+		subject, message, failed, err := buildDigest(tenant, names, since, until)
+		if err != nil {
+			fmt.Printf("Error building notification digest: %s\n", err)
+			continue
+		}
+		if subject == "" {
+			continue
+		}
+		level := "info"
+		if failed {
+			level = "warning"
+		}
+		notifyTenant(tenant, level, subject, message)
+	}
+}
+
+// Function to sum up the runs of a tenant's jobs that finished in (since, until].
+// Returns an empty subject when none did.
+func buildDigest(tenant string, names []string, since, until time.Time) (string, string, bool, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ")
+	args := []any{tenant, formatStorageTime(since), formatStorageTime(until)}
+	for _, name := range names {
+		args = append(args, name)
+	}
+	// Only the last attempt of a run counts, so retried runs are counted once
+	filter := `tenant = ? AND finished_at > ? AND finished_at <= ? AND job_name IN (` + placeholders + `) AND ` + lastAttemptCondition
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`SELECT job_name, status, COUNT(*) FROM job_status WHERE `+filter+` GROUP BY job_name, status`, args...)
+	if err != nil {
+		return "", "", false, err
+	}
+	type jobCounts struct{ runs, succeeded, failed int }
+	counts := make(map[string]*jobCounts)
+	total, totalFailed := 0, 0
+	for rows.Next() {
+		var name, status string
+		var n int
+		if err := rows.Scan(&name, &status, &n); err != nil {
+			rows.Close()
+			return "", "", false, err
+		}
+		if counts[name] == nil {
+			counts[name] = &jobCounts{}
+		}
+		counts[name].runs += n
+		total += n
+		switch {
+		case status == "Success":
+			counts[name].succeeded += n
+		case isFailureStatus(status):
+			counts[name].failed += n
+			totalFailed += n
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", "", false, err
+	}
+	if total == 0 {
+		return "", "", false, nil
+	}
+
+	var message strings.Builder
+	fmt.Fprintf(&message, "Runs of the digest jobs of tenant %s from %s to %s:\n\n", tenant, since.Format("02-01-2006 15:04:05"), until.Format("02-01-2006 15:04:05"))
+	for _, name := range names {
+		if c := counts[name]; c != nil {
+			fmt.Fprintf(&message, "%s: %d runs, %d succeeded, %d failed\n", name, c.runs, c.succeeded, c.failed)
+		}
+	}
+
+	if totalFailed > 0 {
+		failures, err := db.Query(`SELECT task_id, job_name, run_number, status, timestamp FROM job_status WHERE `+filter+` AND status LIKE 'Fail%'
+			ORDER BY job_id DESC LIMIT ?`, append(args, maxDigestFailures)...)
+		if err != nil {
+			return "", "", false, err
+		}
+		defer failures.Close()
+		message.WriteString("\nLatest failures:\n")
+		for failures.Next() {
+			var s JobStatus
+			if err := failures.Scan(&s.UID, &s.JobName, &s.RunNumber, &s.Status, &s.Timestamp); err != nil {
+				return "", "", false, err
+			}
+			s.Tenant = tenant
+			fmt.Fprintf(&message, "%s run #%d: %s at %s", s.JobName, s.RunNumber, s.Status, displayStorageTime(s.Timestamp, time.Local))
+			if link := runLogURL(s); link != "" {
+				message.WriteString(" " + link)
+			}
+			message.WriteString("\n")
+		}
+	}
+
+	subject := fmt.Sprintf("Digest: %d runs, %d failed", total, totalFailed)
+	if tenant != defaultTenant {
+		subject += " in tenant " + tenant
+	}
+	return subject, message.String(), totalFailed > 0, nil
+}
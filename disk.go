@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Struct to hold a directory whose disk is watched by the disk janitor
+type watchedDir struct {
+	label string // "log" or "db", as exported on /metrics
+	path  string
+}
+
+// Function to return the fraction of the filesystem holding dir that is in use
+func diskUsage(dir string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	total := float64(stat.Blocks) * float64(stat.Bsize)
+	if total == 0 {
+		return 0, nil
+	}
+	free := float64(stat.Bavail) * float64(stat.Bsize)
+	return 1 - free/total, nil
+}
+
+// Function to group directories by the filesystem holding them, so a disk
+// shared by several of them is checked and pruned once. Directories that
+// cannot be examined get a group of their own.
+func groupByFilesystem(dirs []watchedDir) [][]watchedDir {
+	var groups [][]watchedDir
+	byDevice := make(map[uint64]int)
+	for _, d := range dirs {
+		var stat syscall.Stat_t
+		if err := syscall.Stat(d.path, &stat); err != nil {
+			groups = append(groups, []watchedDir{d})
+			continue
+		}
+		if i, ok := byDevice[uint64(stat.Dev)]; ok {
+			groups[i] = append(groups[i], d)
+			continue
+		}
+		byDevice[uint64(stat.Dev)] = len(groups)
+		groups = append(groups, []watchedDir{d})
+	}
+	return groups
+}
+
+// Function to start the janitor that watches the disks holding the log and
+// database directories. It exports their usage on /metrics, notifies when
+// usage crosses DISK_WARN_PERCENT and prunes old run history when it crosses
+// DISK_PRUNE_PERCENT, keeping the newest DISK_PRUNE_KEEP_ROWS runs.
+func startDiskJanitor(logDir, dbDir string) {
+	interval := getEnvDuration("DISK_CHECK_INTERVAL", 5*time.Minute)
+	warnAt := float64(getEnvInt("DISK_WARN_PERCENT", 85)) / 100
+	pruneAt := float64(getEnvInt("DISK_PRUNE_PERCENT", 95)) / 100
+	keepRows := getEnvInt("DISK_PRUNE_KEEP_ROWS", 10000)
+
+	dirs := []watchedDir{{"log", logDir}, {"db", dbDir}}
+	warned := make(map[string]bool)
+
+	check := func() {
+		for _, group := range groupByFilesystem(dirs) {
+			usage, err := diskUsage(group[0].path)
+			if err != nil {
+				fmt.Printf("Error checking disk usage of %s: %s\n", group[0].path, err)
+				continue
+			}
+			var described, paths []string
+			for _, d := range group {
+				setGauge(fmt.Sprintf(`gtask_disk_used_ratio{dir=%q}`, d.label), usage)
+				described = append(described, d.label+" directory "+d.path)
+				paths = append(paths, d.path)
+			}
+			verb := "is"
+			if len(group) > 1 {
+				verb = "are"
+			}
+
+			// Only notify again once usage has dropped back below the threshold
+			key := group[0].label
+			if usage >= warnAt && !warned[key] {
+				notify("warning", "Disk usage high", fmt.Sprintf("%s %s on a disk that is %.0f%% full", strings.Join(described, " and "), verb, usage*100))
+			}
+			warned[key] = usage >= warnAt
+
+			if usage >= pruneAt {
+				pruned, err := pruneJobHistory(keepRows)
+				if err != nil {
+					fmt.Printf("Error pruning job history: %s\n", err)
+					continue
+				}
+				notify("critical", "Emergency pruning", fmt.Sprintf("Disk holding %s is %.0f%% full, deleted %d old job runs", strings.Join(paths, " and "), usage*100, pruned))
+			}
+		}
+	}
+
+	go func() {
+		check()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			check()
+		}
+	}()
+}
+
+// Function to delete all but the newest keep rows from the job history
+func pruneJobHistory(keep int) (int64, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, err := db.Exec(`DELETE FROM job_status WHERE job_id NOT IN (SELECT job_id FROM job_status ORDER BY job_id DESC LIMIT ?)`, keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Function to delete runs older than RUN_RETENTION_DAYS, along with their SLA
+// breaches, in batches so the write-ahead log stays small. The caller must hold mu.
+func pruneOldRuns() {
+	days := getEnvInt("RUN_RETENTION_DAYS", 0)
+	if days <= 0 {
+		return
+	}
+	cutoff := formatStorageTime(time.Now().AddDate(0, 0, -days))
+	var total int64
+	for {
+		result, err := db.Exec(`DELETE FROM job_status WHERE job_id IN (SELECT job_id FROM job_status WHERE timestamp < ? LIMIT 10000)`, cutoff)
+		if err != nil {
+			fmt.Printf("Error pruning runs: %s\n", err)
+			return
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n == 0 {
+			break
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM sla_breaches WHERE started_at < ?`, cutoff); err != nil {
+		fmt.Printf("Error pruning SLA breaches: %s\n", err)
+	}
+	if total > 0 {
+		fmt.Printf("Deleted %d runs older than %d days\n", total, days)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGroupByFilesystem(t *testing.T) {
+	root := t.TempDir()
+	logDir, dbDir := filepath.Join(root, "logs"), filepath.Join(root, "database")
+	for _, dir := range []string{logDir, dbDir} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(root, "missing")
+
+	tests := []struct {
+		name string
+		dirs []watchedDir
+		want [][]watchedDir
+	}{
+		{
+			"shared disk",
+			[]watchedDir{{"log", logDir}, {"db", dbDir}},
+			[][]watchedDir{{{"log", logDir}, {"db", dbDir}}},
+		},
+		{
+			"separate filesystems",
+			[]watchedDir{{"log", logDir}, {"db", "/proc"}},
+			[][]watchedDir{{{"log", logDir}}, {{"db", "/proc"}}},
+		},
+		{
+			"missing directory",
+			[]watchedDir{{"log", missing}, {"db", dbDir}},
+			[][]watchedDir{{{"log", missing}}, {{"db", dbDir}}},
+		},
+	}
+	for _, tt := range tests {
+		if got := groupByFilesystem(tt.dirs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: groupByFilesystem = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log/syslog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Execution modes set by command line flags. In dry-run mode jobs are recorded
+// as "Dry run" instead of executed; safe mode suppresses every trigger.
+var (
+	dryRun   bool
+	safeMode bool
+)
+
+// Number of upcoming fire times reported per job when starting in dry-run mode
+const dryRunPreviewCount = 5
+
+// Function to report the next fire times of every registered job, so a
+// migrated crontab can be checked before it goes live
+func logDryRunProjection() {
+	jobsMu.RLock()
+	keys := make([]string, 0, len(jobs))
+	for key := range jobs {
+		keys = append(keys, key)
+	}
+	projected := make([]Job, 0, len(keys))
+	sort.Strings(keys)
+	for _, key := range keys {
+		projected = append(projected, jobs[key])
+	}
+	jobsMu.RUnlock()
+
+	var report strings.Builder
+	report.WriteString("Dry-run mode: no commands will be executed. Projected runs:\n")
+	for _, j := range projected {
+		for _, expr := range j.CronExprs() {
+			schedule, err := parseSchedule(expr)
+			if err != nil {
+				fmt.Fprintf(&report, "  %s: %s\n", j.Name, err)
+				continue
+			}
+
+			next := time.Now()
+			times := make([]string, 0, dryRunPreviewCount)
+			for i := 0; i < dryRunPreviewCount; i++ {
+				if next = schedule.Next(next); next.IsZero() {
+					break
+				}
+				times = append(times, next.Format("02-01-2006 15:04:05"))
+			}
+			fmt.Fprintf(&report, "  %s (%s): %s\n", j.Name, expr, strings.Join(times, ", "))
+		}
+	}
+
+	fmt.Print(report.String())
+	mu.Lock()
+	defer mu.Unlock()
+	if logFile != nil {
+		if err := writeLogLine(report.String(), syslog.LOG_INFO, nil); err != nil {
+			fmt.Printf("Error writing to log file: %s\n", err)
+		}
+	}
+}
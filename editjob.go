@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+// Struct to hold an edit of a job's definition. Fields left out are kept.
+type jobEdit struct {
+	Schedule    *string `json:"schedule"`
+	Command     *string `json:"command"`
+	Description *string `json:"description"`
+}
+
+// Struct to hold the response of PATCH /api/v1/jobs/{name}
+type editJobResponse struct {
+	Name    string   `json:"name"`
+	Changes []string `json:"changes"`
+}
+
+// Struct to hold the definition of a job as shown on the edit form
+type editableJob struct {
+	Schedule    string
+	Phrase      string // phrase the schedule was derived from, if any
+	Command     string
+	Description string
+	Source      string
+}
+
+// Function to change a job's schedule, command or description. Jobs from the
+// cron jobs file are changed in the file as well, so the edit survives a
+// restart. The running cron entries are replaced by the next reconcile.
+func editJob(tenant, name string, edit jobEdit) ([]string, error) {
+	current, err := storage.GetEditableJob(tenant, name)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := current
+	changes := []string{}
+	if edit.Schedule != nil {
+		expr, phrase, err := resolveSchedule(*edit.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		if expr != current.Schedule || phrase != current.Phrase {
+			if isRunAt(expr) != isRunAt(current.Schedule) {
+				return nil, fmt.Errorf("a one-time job can only be moved to another time, and a recurring job cannot become a one-time one")
+			}
+			updated.Schedule, updated.Phrase = expr, phrase
+			changes = append(changes, "schedule")
+		}
+	}
+	if edit.Command != nil && strings.TrimSpace(*edit.Command) != current.Command {
+		updated.Command = strings.TrimSpace(*edit.Command)
+		if updated.Command == "" || strings.ContainsAny(updated.Command, "\r\n") {
+			return nil, fmt.Errorf("the command must be a single non-empty line")
+		}
+		changes = append(changes, "command")
+	}
+	if edit.Description != nil && strings.TrimSpace(*edit.Description) != current.Description {
+		updated.Description = strings.TrimSpace(*edit.Description)
+		changes = append(changes, "description")
+	}
+	if len(changes) == 0 {
+		return changes, nil
+	}
+
+	fromFile := current.Source == "file" && tenant == defaultTenant
+	if fromFile && (updated.Schedule != current.Schedule || updated.Command != current.Command) {
+		if err := rewriteJobInFile(cronJobsFile, name, updated.Schedule, updated.Command); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := storage.EditJob(tenant, name, updated); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// Handler for PATCH /api/v1/jobs/{name}, changing the schedule, command or
+// description of a job. Only the fields in the body are changed.
+func apiEditJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can edit jobs")
+		return
+	}
+	var edit jobEdit
+	if err := readJSON(r, &edit); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tenant, name := requestTenant(r), r.PathValue("name")
+	changes, err := editJob(tenant, name, edit)
+	if errors.Is(err, errJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", name))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(changes) > 0 {
+		recordEvent(tenant, eventConfig, fmt.Sprintf("Edited %s of job %s from %s", strings.Join(changes, ", "), name, r.RemoteAddr))
+		requestReconcile()
+	}
+	writeJSON(w, http.StatusOK, editJobResponse{Name: name, Changes: changes})
+}
+
+// Handler for the form to edit a job's schedule, command and description
+// (GET /edit-job?name=...) and for saving it (POST)
+func editJobHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, name := requestTenant(r), r.FormValue("name")
+	message := ""
+	if r.Method == http.MethodPost {
+		if _, ok := requestAdmin(r); !ok {
+			http.Error(w, "Only admins can edit jobs", http.StatusForbidden)
+			return
+		}
+		schedule, command, description := r.FormValue("cron_expr"), r.FormValue("command"), r.FormValue("description")
+		changes, err := editJob(tenant, name, jobEdit{Schedule: &schedule, Command: &command, Description: &description})
+		if errors.Is(err, errJobNotFound) {
+			http.Error(w, fmt.Sprintf("Job %s not found", name), http.StatusNotFound)
+			return
+		}
+		if err == nil {
+			if len(changes) > 0 {
+				recordEvent(tenant, eventConfig, fmt.Sprintf("Edited %s of job %s by %s", strings.Join(changes, ", "), name, requestActor(r)))
+				requestReconcile()
+			}
+			http.Redirect(w, r, tenantURL(r, "/jobs"), http.StatusSeeOther)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		message = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+	}
+
+	j, err := storage.GetEditableJob(tenant, name)
+	if errors.Is(err, errJobNotFound) {
+		http.Error(w, fmt.Sprintf("Job %s not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	schedule, derived := j.Schedule, ""
+	if j.Phrase != "" {
+		schedule = j.Phrase
+		derived = `
+	                <div class="form-text">Runs as <code>` + html.EscapeString(j.Schedule) + `</code>.</div>`
+	}
+	note := ""
+	if j.Source == "file" && tenant == defaultTenant {
+		note = `<div class="alert alert-info">This job is defined in ` + cronJobsFile + `, which is updated as well.</div>`
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Edit Job</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Edit Job `+html.EscapeString(name)+`</h1>
+	        `+message+note+`
+	        <form action="`+tenantURL(r, "/edit-job")+`" method="post">
+	            <input type="hidden" name="name" value="`+html.EscapeString(name)+`">
+	            <div class="mb-3">
+	                <label for="cronExpr" class="form-label">Schedule</label>
+	                <input type="text" class="form-control" id="cronExpr" name="cron_expr" value="`+html.EscapeString(schedule)+`" required>`+derived+`
+	            </div>
+	            <div class="mb-3">
+	                <label for="command" class="form-label">Command</label>
+	                <input type="text" class="form-control" id="command" name="command" value="`+html.EscapeString(j.Command)+`" required>
+	            </div>
+	            <div class="mb-3">
+	                <label for="description" class="form-label">Description</label>
+	                <textarea class="form-control" id="description" name="description" rows="2">`+html.EscapeString(j.Description)+`</textarea>
+	            </div>
+	            <button type="submit" class="btn btn-primary">Save</button>
+	            <a href="`+tenantURL(r, "/jobs")+`" class="btn btn-outline-secondary">Cancel</a>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notifier that sends notifications by email through an SMTP server
+type emailNotifier struct {
+	addr     string // host:port of the SMTP server
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+	minLevel string
+	template *template.Template // body of run notifications, see loadNotifyTemplate
+}
+
+// Function to configure the email notifier of a tenant from the SMTP_*
+// settings, see tenantSetting. Returns false when SMTP_HOST is not set.
+func newEmailNotifier(tenant string) (*emailNotifier, bool, error) {
+	setting := func(name string) string { return tenantSetting(tenant, name) }
+	host := getEnvString(setting("SMTP_HOST"), "")
+	if host == "" {
+		return nil, false, nil
+	}
+	n := &emailNotifier{
+		addr:     net.JoinHostPort(host, getEnvString(setting("SMTP_PORT"), "587")),
+		host:     host,
+		username: getEnvString(setting("SMTP_USERNAME"), ""),
+		password: getEnvString(setting("SMTP_PASSWORD"), ""),
+		from:     getEnvString(setting("SMTP_FROM"), "gtask@"+runnerName),
+		minLevel: getEnvString(setting("SMTP_MIN_LEVEL"), "warning"),
+	}
+	for _, address := range strings.Split(getEnvString(setting("SMTP_TO"), ""), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			n.to = append(n.to, address)
+		}
+	}
+	if len(n.to) == 0 {
+		return nil, false, fmt.Errorf("%s must list at least one recipient", setting("SMTP_TO"))
+	}
+	if _, ok := notificationLevels[n.minLevel]; !ok {
+		return nil, false, fmt.Errorf("invalid %s %q, expected info, warning or critical", setting("SMTP_MIN_LEVEL"), n.minLevel)
+	}
+	var err error
+	if n.template, err = loadNotifyTemplate(setting("SMTP_TEMPLATE")); err != nil {
+		return nil, false, err
+	}
+	return n, true, nil
+}
+
+func (e *emailNotifier) Notify(n Notification) error {
+	if notificationLevels[n.Level] < notificationLevels[e.minLevel] {
+		return nil
+	}
+
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+	// Header values must not contain line breaks
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(n.Subject)
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", e.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&message, "Subject: [gtask %s] %s\r\n", n.Level, subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	body := renderNotification(e.template, n)
+	message.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	message.WriteString("\r\n")
+
+	return smtp.SendMail(e.addr, auth, e.from, e.to, []byte(message.String()))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Struct to hold a cron entry that does not belong to a job from the jobs
+// table, such as the database maintenance
+type internalEntry struct {
+	Kind string
+	Name string
+	Expr string
+}
+
+// Internal cron entries keyed by entry ID, guarded by jobsMu
+var internalEntries = make(map[cron.EntryID]internalEntry)
+
+// Function to remember what an internal cron entry is for
+func registerInternalEntry(id cron.EntryID, kind, name, expr string) {
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+	internalEntries[id] = internalEntry{Kind: kind, Name: name, Expr: expr}
+}
+
+// Struct to hold a live cron entry as returned by GET /api/v1/cron/entries.
+// Kind is "job" for jobs from the jobs table, "maintenance", "digest" or "loadtest" for
+// internal entries, and "unknown" for entries nothing accounts for.
+type cronEntryInfo struct {
+	ID         int    `json:"id"`
+	Kind       string `json:"kind"`
+	Expression string `json:"expression"`
+	Tenant     string `json:"tenant,omitempty"`
+	Job        string `json:"job,omitempty"`
+	JobID      int64  `json:"job_id,omitempty"`
+	Next       string `json:"next,omitempty"` // empty when the schedule never fires again
+	Prev       string `json:"prev,omitempty"` // empty until the entry fired
+}
+
+// Function to describe the live cron entries, matched with the jobs and
+// internal tasks they were registered for
+func describeCronEntries(c *cron.Cron) []cronEntryInfo {
+	jobsMu.RLock()
+	owners := make(map[cron.EntryID]cronEntryInfo)
+	for id, entry := range registered {
+		exprs := entry.Job.CronExprs()
+		for i, entryID := range entry.EntryIDs {
+			info := cronEntryInfo{Kind: "job", Tenant: entry.Job.Tenant, Job: entry.Job.Name, JobID: id}
+			if i < len(exprs) {
+				info.Expression = exprs[i]
+			}
+			owners[entryID] = info
+		}
+	}
+	for entryID, internal := range internalEntries {
+		owners[entryID] = cronEntryInfo{Kind: internal.Kind, Job: internal.Name, Expression: internal.Expr}
+	}
+	jobsMu.RUnlock()
+
+	list := []cronEntryInfo{}
+	for _, e := range c.Entries() {
+		info, ok := owners[e.ID]
+		if !ok {
+			info.Kind = "unknown"
+		}
+		info.ID = int(e.ID)
+		if !e.Next.IsZero() {
+			info.Next = formatStorageTime(e.Next)
+		}
+		if !e.Prev.IsZero() {
+			info.Prev = formatStorageTime(e.Prev)
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+// Handler for GET /api/v1/cron/entries, listing the scheduler's live cron
+// entries for admins, to compare with what the jobs table says. Job entries
+// of other tenants are left out, internal ones are only shown to the default
+// tenant. ?job= limits the list to one job.
+func apiCronEntriesHandler(c *cron.Cron) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := requestAdmin(r); !ok {
+			writeJSONError(w, http.StatusForbidden, "only admins can list cron entries")
+			return
+		}
+		tenant, jobName := requestTenant(r), r.URL.Query().Get("job")
+
+		list := []cronEntryInfo{}
+		for _, info := range describeCronEntries(c) {
+			if info.Kind == "job" && info.Tenant != tenant || info.Kind != "job" && tenant != defaultTenant {
+				continue
+			}
+			if jobName != "" && (info.Kind != "job" || info.Job != jobName) {
+				continue
+			}
+			list = append(list, info)
+		}
+		writeJSON(w, http.StatusOK, list)
+	}
+}
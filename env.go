@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Prefix of settings that define environment variables injected into every job
+const jobEnvPrefix = "JOB_ENV_"
+
+// Default environment applied to all jobs, loaded from JOB_ENV_* settings
+var defaultJobEnv map[string]string
+
+// Function to collect the JOB_ENV_* settings into the default job environment.
+// JOB_ENV_TZ=UTC in .env, for example, sets TZ=UTC for every job.
+func loadDefaultJobEnv() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(key, jobEnvPrefix); ok && name != "" {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// Function to build the environment a job's command runs with: the
+// scheduler's own environment, overlaid with the global defaults, the job's
+// env_file (read on every run) and then the job's env.* options. Values may
+// reference existing variables, e.g. JOB_ENV_PATH=/opt/tools/bin:$PATH.
+func jobEnvironment(j Job) ([]string, error) {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		// Jobs must not see the settings, such as secrets, of other tenants
+		if strings.HasPrefix(key, jobEnvPrefix) || strings.HasPrefix(key, tenantSettingPrefix) {
+			continue
+		}
+		env[key] = value
+	}
+
+	overlay := func(vars map[string]string) {
+		// Expand against a snapshot so the order of keys does not matter
+		base := make(map[string]string, len(env))
+		for k, v := range env {
+			base[k] = v
+		}
+		for key, value := range vars {
+			env[key] = os.Expand(value, func(name string) string { return base[name] })
+		}
+	}
+	overlay(defaultJobEnv)
+	if j.EnvFile != "" {
+		fileEnv, err := godotenv.Read(j.EnvFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading env file %s: %w", j.EnvFile, err)
+		}
+		overlay(fileEnv)
+	}
+	overlay(j.Env)
+
+	result := make([]string, 0, len(env))
+	for key, value := range env {
+		result = append(result, key+"="+value)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// Default name fragments marking environment variables whose values are masked
+// in stored run environments, overridable with ENV_MASK_PATTERNS
+var defaultEnvMaskPatterns = []string{"PASSWORD", "PASSWD", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "AUTH"}
+
+// Function to render a command's environment for storage, one variable per
+// line, with the values of variables that look like secrets masked
+func maskEnvironment(env []string) string {
+	patterns := defaultEnvMaskPatterns
+	if setting := os.Getenv("ENV_MASK_PATTERNS"); setting != "" {
+		patterns = strings.Split(strings.ToUpper(setting), ",")
+	}
+
+	lines := make([]string, 0, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		upper := strings.ToUpper(key)
+		for _, pattern := range patterns {
+			if pattern = strings.TrimSpace(pattern); pattern != "" && strings.Contains(upper, pattern) {
+				kv = key + "=****"
+				break
+			}
+		}
+		lines = append(lines, kv)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Categories of scheduler events stored in the events table
+const (
+	eventScheduler   = "scheduler"   // start, stop and execution modes
+	eventReconcile   = "reconcile"   // jobs scheduled, rescheduled and unscheduled
+	eventConfig      = "config"      // job definitions and pause states changed
+	eventJob         = "job"         // jobs disabled, archived or started by hand
+	eventAuth        = "auth"        // sign-ins, rejected requests and audit events
+	eventIntegration = "integration" // failures talking to monitors and other services
+)
+
+// Categories offered as filters on the events page
+var eventCategories = []string{eventScheduler, eventReconcile, eventConfig, eventJob, eventAuth, eventIntegration}
+
+// Number of events shown per page and returned by the API by default
+const eventsPageSize = 100
+
+// Struct to hold a scheduler event
+type Event struct {
+	ID        int64  `json:"id"`
+	Tenant    string `json:"tenant"` // empty for events that concern every tenant
+	Category  string `json:"category"`
+	Message   string `json:"message"`
+	Runner    string `json:"runner"`
+	Timestamp string `json:"timestamp"` // RFC 3339 UTC, see formatStorageTime
+}
+
+// Function to record a scheduler event in the events table and the scheduler
+// log. Events without a tenant concern every tenant.
+func recordEvent(tenant, category, message string) {
+	logSchedulerEvent(message)
+
+	timestamp := formatStorageTime(time.Now())
+	err := guardDB("recording event", func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if db == nil {
+			return nil
+		}
+		_, err := db.Exec(`INSERT INTO events (tenant, category, message, runner, timestamp) VALUES (?, ?, ?, ?, ?)`,
+			tenant, category, message, runnerName, timestamp)
+		return err
+	})
+	if err != nil {
+		fmt.Printf("Error recording event: %s\n", err)
+	}
+}
+
+// Struct to hold the filters of an events query
+type eventFilter struct {
+	Category string
+	Search   string
+	Since    time.Time
+	Until    time.Time
+	Before   int64 // only events with a lower ID, for paging
+	Limit    int
+}
+
+// Function to read event filters from the query string
+func parseEventFilter(r *http.Request) (eventFilter, error) {
+	q := r.URL.Query()
+	f := eventFilter{Category: q.Get("category"), Search: strings.TrimSpace(q.Get("q")), Limit: eventsPageSize}
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("since must be an RFC 3339 time")
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("until must be an RFC 3339 time")
+		}
+	}
+	if v := q.Get("before"); v != "" {
+		if f.Before, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("before must be an event ID")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > 1000 {
+			return f, fmt.Errorf("limit must be between 1 and 1000")
+		}
+	}
+	return f, nil
+}
+
+// Function to list a tenant's events matching a filter, newest first
+func queryEvents(tenant string, f eventFilter) ([]Event, error) {
+	query := `SELECT id, tenant, category, message, runner, timestamp FROM events WHERE (tenant = ? OR tenant = '')`
+	args := []any{tenant}
+	if f.Category != "" {
+		query += ` AND category = ?`
+		args = append(args, f.Category)
+	}
+	if f.Search != "" {
+		query += ` AND message LIKE ? ESCAPE '\'`
+		args = append(args, "%"+strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Search)+"%")
+	}
+	if !f.Since.IsZero() {
+		query += ` AND timestamp >= ?`
+		args = append(args, formatStorageTime(f.Since))
+	}
+	if !f.Until.IsZero() {
+		query += ` AND timestamp < ?`
+		args = append(args, formatStorageTime(f.Until))
+	}
+	if f.Before > 0 {
+		query += ` AND id < ?`
+		args = append(args, f.Before)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, f.Limit)
+
+	mu.Lock()
+	defer mu.Unlock()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.Tenant, &e.Category, &e.Message, &e.Runner, &e.Timestamp); err != nil {
+			return nil, fmt.Errorf("error reading events: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Function to delete events older than EVENT_RETENTION_DAYS. The caller must hold mu.
+func pruneEvents() {
+	days := getEnvInt("EVENT_RETENTION_DAYS", 90)
+	if days <= 0 {
+		return
+	}
+	cutoff := formatStorageTime(time.Now().AddDate(0, 0, -days))
+	if _, err := db.Exec(`DELETE FROM events WHERE timestamp < ?`, cutoff); err != nil {
+		fmt.Printf("Error pruning events: %s\n", err)
+	}
+}
+
+// Handler for GET /api/v1/events, listing the tenant's events newest first.
+// Accepts the category, q, since, until, before and limit parameters.
+func apiEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can view events")
+		return
+	}
+	f, err := parseEventFilter(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := queryEvents(requestTenant(r), f)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// Handler for the events page, browsing the tenant's scheduler events with
+// filters by category and text. Only admins may use it.
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can view events", http.StatusForbidden)
+		return
+	}
+	f, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := queryEvents(requestTenant(r), f)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	options := `<option value="">All categories</option>`
+	for _, category := range eventCategories {
+		selected := ""
+		if category == f.Category {
+			selected = " selected"
+		}
+		options += fmt.Sprintf(`<option value="%s"%s>%s</option>`, category, selected, category)
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Events</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Events</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	        </div>
+	        <form action="`+tenantURL(r, "/events")+`" method="get" class="row g-2 mb-3">
+	            <div class="col-md-3"><select name="category" class="form-select">`+options+`</select></div>
+	            <div class="col-md-5"><input type="text" name="q" class="form-control" placeholder="Search messages" value="`+html.EscapeString(f.Search)+`"></div>
+	            <div class="col-md-2"><button type="submit" class="btn btn-primary">Filter</button></div>
+	        </form>
+	        <table class="table table-striped table-hover">
+	            <thead>
+	                <tr>
+	                    <th>Time</th>
+	                    <th>Category</th>
+	                    <th>Message</th>
+	                    <th>Runner</th>
+	                </tr>
+	            </thead>
+	            <tbody>`)
+
+	for _, e := range events {
+		timestamp := e.Timestamp
+		if t, err := time.Parse(storageTimeFormat, e.Timestamp); err == nil {
+			timestamp = t.Local().Format("02-01-2006 15:04:05")
+		}
+		fmt.Fprintf(w, `<tr>
+				<td class="text-nowrap">%s</td>
+				<td><span class="badge text-bg-secondary">%s</span></td>
+				<td>%s</td>
+				<td>%s</td>
+			</tr>`, timestamp, html.EscapeString(e.Category), html.EscapeString(e.Message), html.EscapeString(e.Runner))
+	}
+	fmt.Fprintln(w, `</tbody></table>`)
+
+	if len(events) == f.Limit {
+		next := url.Values{"before": {strconv.FormatInt(events[len(events)-1].ID, 10)}}
+		if f.Category != "" {
+			next.Set("category", f.Category)
+		}
+		if f.Search != "" {
+			next.Set("q", f.Search)
+		}
+		fmt.Fprintln(w, `<a href="`+html.EscapeString(tenantURL(r, "/events?"+next.Encode()))+`" class="btn btn-outline-secondary">Older</a>`)
+	}
+
+	fmt.Fprintln(w, `
+	    </div>
+	</body>
+	</html>
+	`)
+}
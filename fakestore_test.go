@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Struct to hold a job kept by the fake store
+type fakeJob struct {
+	Job
+	source         string
+	enabled        bool
+	archived       bool
+	runCount       int64
+	failures       int
+	disabledReason string
+	nextRunAt      string
+	editable       editableJob
+}
+
+// Store keeping jobs and runs in memory, for tests of code using the Store
+type fakeStore struct {
+	mu     sync.Mutex
+	nextID int64
+	jobs   map[string]*fakeJob // keyed by jobKey
+	runs   []JobStatus
+}
+
+// Function to create an empty fake store
+func newFakeStore() *fakeStore {
+	return &fakeStore{jobs: make(map[string]*fakeJob)}
+}
+
+// Helper function to find a job by its ID
+func (s *fakeStore) byID(id int64) *fakeJob {
+	for _, j := range s.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func (s *fakeStore) ListJobs() ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Job
+	for _, j := range s.jobs {
+		if j.enabled {
+			result = append(result, j.Job)
+		}
+	}
+	sort.Slice(result, func(a, b int) bool { return result[a].ID < result[b].ID })
+	return result, nil
+}
+
+func (s *fakeStore) CreateJob(tenant, source string, j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[jobKey(tenant, j.Name)]; ok {
+		return fmt.Errorf("job %s already exists", j.Name)
+	}
+	s.nextID++
+	j.ID, j.Tenant = s.nextID, tenant
+	s.jobs[jobKey(tenant, j.Name)] = &fakeJob{Job: j, source: source, enabled: true,
+		editable: editableJob{Schedule: j.CronExpr, Phrase: j.Phrase, Command: j.Command, Description: j.Description, Source: source}}
+	return nil
+}
+
+func (s *fakeStore) UpsertJob(tenant string, j Job) (putJobResponse, error) {
+	s.mu.Lock()
+	existing, ok := s.jobs[jobKey(tenant, j.Name)]
+	s.mu.Unlock()
+	if !ok {
+		return putJobResponse{Name: j.Name, Created: true, Changed: true, Changes: []string{}}, s.CreateJob(tenant, "api", j)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := existing.CronExpr != j.CronExpr || existing.Command != j.Command
+	j.ID, j.Tenant = existing.ID, tenant
+	existing.Job = j
+	return putJobResponse{Name: j.Name, Changed: changed, Changes: []string{}}, nil
+}
+
+func (s *fakeStore) DeleteJob(tenant, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[jobKey(tenant, name)]
+	if !ok {
+		return "", errJobNotFound
+	}
+	delete(s.jobs, jobKey(tenant, name))
+	return j.source, nil
+}
+
+func (s *fakeStore) ReplaceJobs(tenant, source string, desired []Job) (jobSync, error) {
+	var result jobSync
+	wanted := make(map[string]bool)
+	for _, j := range desired {
+		wanted[j.Name] = true
+		response, err := s.UpsertJob(tenant, j)
+		if err != nil {
+			return result, err
+		}
+		switch {
+		case response.Created:
+			result.Created = append(result.Created, j.Name)
+		case response.Changed:
+			result.Updated = append(result.Updated, j.Name)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, j := range s.jobs {
+		if j.Tenant == tenant && j.source == source && !wanted[j.Name] {
+			delete(s.jobs, key)
+			result.Deleted = append(result.Deleted, j.Name)
+		}
+	}
+	return result, nil
+}
+
+func (s *fakeStore) CountRun(j Job) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.byID(j.ID)
+	if stored == nil {
+		return 0, false, errJobNotFound
+	}
+	if stored.MaxRuns > 0 && stored.runCount >= int64(stored.MaxRuns) {
+		return 0, false, errRunLimitReached
+	}
+	stored.runCount++
+	exhausted := stored.MaxRuns > 0 && stored.runCount >= int64(stored.MaxRuns)
+	if exhausted {
+		stored.enabled, stored.archived = false, j.IsOneShot()
+	}
+	return stored.runCount, exhausted, nil
+}
+
+func (s *fakeStore) GetEditableJob(tenant, name string) (editableJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[jobKey(tenant, name)]
+	if !ok {
+		return editableJob{}, errJobNotFound
+	}
+	return j.editable, nil
+}
+
+func (s *fakeStore) EditJob(tenant, name string, edited editableJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[jobKey(tenant, name)]
+	if !ok {
+		return errJobNotFound
+	}
+	j.editable = edited
+	j.CronExpr, j.Phrase, j.Command, j.Description = edited.Schedule, edited.Phrase, edited.Command, edited.Description
+	return nil
+}
+
+func (s *fakeStore) RecordOutcome(j Job, failed bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := s.byID(j.ID)
+	if stored == nil {
+		return 0, errJobNotFound
+	}
+	if failed {
+		stored.failures++
+	} else {
+		stored.failures = 0
+	}
+	return stored.failures, nil
+}
+
+func (s *fakeStore) DisableJob(j Job, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := s.byID(j.ID); stored != nil && stored.enabled {
+		stored.enabled, stored.disabledReason = false, reason
+	}
+	return nil
+}
+
+func (s *fakeStore) EnableJob(tenant, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[jobKey(tenant, name)]
+	if !ok || j.archived {
+		return errJobNotFound
+	}
+	j.enabled, j.failures, j.disabledReason = true, 0, ""
+	return nil
+}
+
+func (s *fakeStore) SaveNextRun(j Job, nextRunAt string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := s.byID(j.ID); stored != nil {
+		stored.nextRunAt = nextRunAt
+	}
+	return nil
+}
+
+func (s *fakeStore) NextRuns() (map[int64]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := make(map[int64]time.Time)
+	for _, j := range s.jobs {
+		if t, err := time.Parse(storageTimeFormat, j.nextRunAt); err == nil && j.enabled {
+			next[j.ID] = t
+		}
+	}
+	return next, nil
+}
+
+func (s *fakeStore) SaveRuns(batch []JobStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range batch {
+		run.AutoIncrementalID = int64(len(s.runs) + 1)
+		s.runs = append(s.runs, run)
+	}
+	return nil
+}
+
+func (s *fakeStore) GetRun(tenant, uid string) (RunLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, run := range s.runs {
+		if run.Tenant == tenant && run.UID == uid {
+			return RunLog{PastRun: fakePastRun(run), Output: run.Output, Env: run.Env}, nil
+		}
+	}
+	return RunLog{}, errRunNotFound
+}
+
+func (s *fakeStore) ListRuns(tenant string, f runFilter) ([]PastRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []PastRun
+	for i := len(s.runs) - 1; i >= 0 && (f.Limit == 0 || len(result) < f.Limit); i-- {
+		run := s.runs[i]
+		if run.Tenant != tenant || (f.Job != "" && run.JobName != f.Job) || (f.Status != "" && run.Status != f.Status) ||
+			(f.Search != "" && !strings.Contains(run.Output, f.Search)) {
+			continue
+		}
+		result = append(result, fakePastRun(run))
+	}
+	return result, nil
+}
+
+func (s *fakeStore) JobStats(tenant, name string, from, to time.Time) (JobStats, error) {
+	return JobStats{}, fmt.Errorf("job statistics are not supported by the fake store")
+}
+
+func (s *fakeStore) LatestRunAt(tenant, name string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if run := s.runs[i]; run.Tenant == tenant && run.JobName == name {
+			t, err := time.Parse(storageTimeFormat, run.Timestamp)
+			return t, err == nil, err
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+func (s *fakeStore) PreviousOutput(tenant, name, exceptUID string) (checkedOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		run := s.runs[i]
+		if run.Tenant == tenant && run.JobName == name && run.Status == "Success" && run.OutputHash != "" && run.UID != exceptUID {
+			return checkedOutput{uid: run.UID, hash: run.OutputHash, timestamp: run.Timestamp}, nil
+		}
+	}
+	return checkedOutput{}, nil
+}
+
+// Helper function to describe a stored run as listed by the Store
+func fakePastRun(run JobStatus) PastRun {
+	return PastRun{ID: run.AutoIncrementalID, UID: run.UID, Job: run.JobName, Command: run.Command, Status: run.Status,
+		RunNumber: run.RunNumber, Attempt: run.Attempt, Timestamp: run.Timestamp, Runner: run.Runner}
+}
+
+// Helper function to use a fake store for the rest of a test
+func useFakeStore(t *testing.T) *fakeStore {
+	fake := newFakeStore()
+	previous := storage
+	storage = fake
+	t.Cleanup(func() { storage = previous })
+	return fake
+}
+
+var _ Store = (*fakeStore)(nil)
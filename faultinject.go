@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Struct to hold a failure injected into the next runs of a job, so
+// notifications, monitors and dashboards can be tested end to end
+type InjectedFailure struct {
+	Mode      string `json:"mode"` // "fail" or "timeout"
+	Runs      int    `json:"runs"` // remaining runs that will fail
+	Actor     string `json:"actor"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Injected failures, keyed by jobKey. They are kept in memory only, so a
+// restart never leaves a job failing on purpose.
+var (
+	injectedFailures   = make(map[string]*InjectedFailure)
+	injectedFailuresMu sync.Mutex
+)
+
+// Error returned as the result of a run replaced by an injected failure
+type injectedError struct {
+	mode string
+}
+
+func (e *injectedError) Error() string {
+	if e.mode == "timeout" {
+		return "injected timeout, the command was not run"
+	}
+	return "injected failure, the command was not run"
+}
+
+// Function to take one run of a job's injected failure, if it has one
+func takeInjectedFailure(j Job) (string, bool) {
+	injectedFailuresMu.Lock()
+	defer injectedFailuresMu.Unlock()
+
+	key := jobKey(j.Tenant, j.Name)
+	injected, ok := injectedFailures[key]
+	if !ok {
+		return "", false
+	}
+	injected.Runs--
+	if injected.Runs <= 0 {
+		delete(injectedFailures, key)
+	}
+	return injected.Mode, true
+}
+
+// Function to stand in for running a job's command when a failure is injected
+func injectedResult(mode string) (commandResult, error) {
+	err := &injectedError{mode: mode}
+	return commandResult{Output: []byte(err.Error() + "\n"), StartedAt: time.Now(), ExitCode: -1}, err
+}
+
+// Struct to hold the body accepted by the failure injection endpoint
+type injectFailureRequest struct {
+	Mode string `json:"mode"`
+	Runs int    `json:"runs"`
+}
+
+// Handler for the failure injection endpoint of a job, for admins only.
+// POST /api/v1/jobs/{name}/inject-failure makes the job's next runs fail
+// ("fail") or time out ("timeout") without running its command, GET shows the
+// pending injection and DELETE cancels it.
+func apiInjectFailureHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requestAdmin(r)
+	if !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can inject failures")
+		return
+	}
+	tenant, name := requestTenant(r), r.PathValue("name")
+	if _, ok := lookupJob(tenant, name); !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", name))
+		return
+	}
+	key := jobKey(tenant, name)
+
+	switch r.Method {
+	case http.MethodGet:
+		injectedFailuresMu.Lock()
+		injected, ok := injectedFailures[key]
+		var pending InjectedFailure
+		if ok {
+			pending = *injected
+		}
+		injectedFailuresMu.Unlock()
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no failure injected into job %s", name))
+			return
+		}
+		writeJSON(w, http.StatusOK, pending)
+
+	case http.MethodDelete:
+		injectedFailuresMu.Lock()
+		_, ok := injectedFailures[key]
+		delete(injectedFailures, key)
+		injectedFailuresMu.Unlock()
+		if ok {
+			recordAuditEvent(tenant, actor, "failure_injection_cancelled", "job "+name, r.RemoteAddr)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		var req injectFailureRequest
+		if err := readJSON(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := req.validate(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		injected := InjectedFailure{Mode: req.Mode, Runs: req.Runs, Actor: actor, Timestamp: time.Now().Format("02-01-2006 15:04:05")}
+		injectedFailuresMu.Lock()
+		injectedFailures[key] = &injected
+		injectedFailuresMu.Unlock()
+
+		recordAuditEvent(tenant, actor, "failure_injected", fmt.Sprintf("job %s, mode %s, next %d runs", name, req.Mode, req.Runs), r.RemoteAddr)
+		writeJSON(w, http.StatusOK, injected)
+	}
+}
+
+// Function to fill in the defaults of a failure injection and check it
+func (req *injectFailureRequest) validate() error {
+	if req.Mode == "" {
+		req.Mode = "fail"
+	}
+	if req.Runs == 0 {
+		req.Runs = 1
+	}
+	if req.Mode != "fail" && req.Mode != "timeout" {
+		return fmt.Errorf("unknown mode %q, expected fail or timeout", req.Mode)
+	}
+	if req.Runs < 0 {
+		return errors.New("runs must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Longest a git command of the repository sync may take
+const gitSyncTimeout = 2 * time.Minute
+
+// Struct to hold the settings of the repository sync
+type gitSync struct {
+	repo   string // URL of the repository
+	branch string // branch to follow, empty for the repository's default branch
+	path   string // directory of the repository holding the job files
+	dir    string // local checkout
+}
+
+// Function to read the repository sync settings, reporting whether the sync
+// is configured at all
+func newGitSync() (gitSync, bool) {
+	g := gitSync{
+		repo:   os.Getenv("GIT_SYNC_REPO"),
+		branch: os.Getenv("GIT_SYNC_BRANCH"),
+		path:   getEnvString("GIT_SYNC_PATH", "."),
+		dir:    getEnvString("GIT_SYNC_DIR", filepath.Join(getEnvString("DB_DIR", "."), "git-sync")),
+	}
+	return g, g.repo != ""
+}
+
+// Function to run a git command, never prompting for credentials
+func (g gitSync) git(args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitSyncTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Function to bring the local checkout to the latest commit of the branch,
+// cloning the repository the first time, and return that commit's SHA
+func (g gitSync) pull() (string, error) {
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); errors.Is(err, os.ErrNotExist) {
+		args := []string{"clone", "--quiet", "--depth", "1", "--single-branch"}
+		if g.branch != "" {
+			args = append(args, "--branch", g.branch)
+		}
+		if _, err := g.git(append(args, g.repo, g.dir)...); err != nil {
+			return "", err
+		}
+	} else {
+		ref := g.branch
+		if ref == "" {
+			ref = "HEAD"
+		}
+		// The repository may have been changed in the settings since the clone
+		if _, err := g.git("-C", g.dir, "remote", "set-url", "origin", g.repo); err != nil {
+			return "", err
+		}
+		if _, err := g.git("-C", g.dir, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+			return "", err
+		}
+		if _, err := g.git("-C", g.dir, "reset", "--quiet", "--hard", "FETCH_HEAD"); err != nil {
+			return "", err
+		}
+	}
+	return g.git("-C", g.dir, "rev-parse", "HEAD")
+}
+
+// Function to read the jobs of every YAML file below the sync path of the
+// checkout, each in the form of jobs.yaml, marking them with the commit they
+// came from. A job may only be defined once across the files.
+func (g gitSync) loadJobs(revision string) ([]Job, error) {
+	root := filepath.Join(g.dir, g.path)
+	var files []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if ext := filepath.Ext(path); !d.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing job files: %w", err)
+	}
+	sort.Strings(files)
+
+	var desired []Job
+	definedIn := make(map[string]string)
+	for _, file := range files {
+		name, _ := filepath.Rel(root, file)
+		jobs, err := loadJobsYAML(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		for _, j := range jobs {
+			if other, ok := definedIn[j.Name]; ok {
+				return nil, fmt.Errorf("%s: job %s is already defined in %s", name, j.Name, other)
+			}
+			definedIn[j.Name] = name
+			j.Revision = revision
+			desired = append(desired, j)
+		}
+	}
+	return desired, nil
+}
+
+// Function to pull the repository and, when it moved on from the last synced
+// commit, make the default tenant's jobs from the repository match its job
+// files. Jobs are owned by the repository from then on, and those it no
+// longer defines are deleted. Nothing changes when a file has a problem. The
+// synced commit is returned.
+func (g gitSync) sync(last string) (string, error) {
+	revision, err := g.pull()
+	if err != nil || revision == last {
+		return last, err
+	}
+	desired, err := g.loadJobs(revision)
+	if err != nil {
+		return last, fmt.Errorf("commit %s: %w", revision, err)
+	}
+	result, err := storage.ReplaceJobs(defaultTenant, "git", desired)
+	if err != nil {
+		return last, fmt.Errorf("commit %s: %w", revision, err)
+	}
+
+	if len(result.Created)+len(result.Updated)+len(result.Deleted) == 0 {
+		fmt.Printf("Synced jobs from %s at commit %s, nothing changed\n", g.repo, revision)
+		return revision, nil
+	}
+	recordEvent(defaultTenant, eventConfig, fmt.Sprintf("Synced jobs from %s at commit %s: %d created, %d updated, %d deleted",
+		g.repo, revision, len(result.Created), len(result.Updated), len(result.Deleted)))
+	requestReconcile()
+	return revision, nil
+}
+
+// Function to start syncing jobs from GIT_SYNC_REPO, right away and then every
+// GIT_SYNC_INTERVAL (1m by default). A failing sync is recorded as an event
+// once, not on every attempt, until it fails differently.
+func startGitSync() {
+	g, ok := newGitSync()
+	if !ok {
+		return
+	}
+	interval := getEnvDuration("GIT_SYNC_INTERVAL", time.Minute)
+
+	go func() {
+		var revision, lastError string
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			var err error
+			revision, err = g.sync(revision)
+			switch {
+			case err == nil:
+				lastError = ""
+			case err.Error() != lastError:
+				lastError = err.Error()
+				fmt.Printf("Error syncing jobs from %s: %s\n", g.repo, err)
+				recordEvent(defaultTenant, eventConfig, fmt.Sprintf("Jobs not synced from %s: %s", g.repo, err))
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -8,4 +8,10 @@ require (
 	github.com/robfig/cron/v3 v3.0.1
 )
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
+
+require golang.org/x/crypto v0.31.0
+
+require github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Largest import accepted, to keep a runaway upload from exhausting memory
+const maxImportSize = 10 << 20
+
+// Struct to hold the outcome of one imported job. Status is "create",
+// "update" or "unchanged" for valid jobs and "invalid" otherwise.
+type importEntry struct {
+	Entry   int      `json:"entry"` // position in the list, or line number for crontab imports
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Changes []string `json:"changes,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// Struct to hold the report of an import
+type importReport struct {
+	DryRun    bool          `json:"dry_run"`
+	Valid     bool          `json:"valid"`
+	Imported  bool          `json:"imported"`
+	Created   int           `json:"created"`
+	Updated   int           `json:"updated"`
+	Unchanged int           `json:"unchanged"`
+	Invalid   int           `json:"invalid"`
+	Skipped   []int         `json:"skipped_lines,omitempty"` // crontab lines setting variables, which are not imported as jobs
+	Warnings  []string      `json:"warnings,omitempty"`      // crontab lines left out of the import, and why
+	Entries   []importEntry `json:"entries"`
+}
+
+// Struct to hold a job read from an import along with where it came from
+type importedJob struct {
+	Entry  int
+	Job    applyJob
+	Errors []string
+}
+
+// Function to list everything wrong with a job definition, so an import
+// report can show all problems of an entry at once
+func (a applyJob) problems() []string {
+	var problems []string
+	if a.Name == "" {
+		problems = append(problems, "missing name")
+	}
+	if a.Command == "" {
+		problems = append(problems, "missing command")
+	}
+	if a.Schedule == "" {
+		problems = append(problems, "missing schedule")
+	} else if _, err := parseSchedule(a.Schedule); err != nil {
+		problems = append(problems, "schedule: "+err.Error())
+	}
+	for i, expr := range a.Schedules {
+		if _, err := parseSchedule(expr); err != nil {
+			problems = append(problems, fmt.Sprintf("schedules[%d]: %s", i, err))
+		}
+	}
+	for i, expr := range a.Exclusions {
+		if _, err := parseSchedule(expr); err != nil {
+			problems = append(problems, fmt.Sprintf("exclusions[%d]: %s", i, err))
+		}
+	}
+	if len(problems) == 0 {
+		if _, err := a.toJob(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// Function to read the jobs of a JSON or YAML import, given either as
+// {"jobs": [...]} like POST /api/v1/apply or as a bare list
+func parseStructuredImport(body []byte, format string) ([]importedJob, error) {
+	unmarshal := json.Unmarshal
+	if format == "yaml" {
+		unmarshal = yaml.Unmarshal
+	}
+
+	var list []applyJob
+	var req applyRequest
+	trimmed := bytes.TrimSpace(body)
+	if (format == "json" && bytes.HasPrefix(trimmed, []byte("["))) || (format == "yaml" && bytes.HasPrefix(trimmed, []byte("-"))) {
+		if err := unmarshal(body, &list); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", strings.ToUpper(format), err)
+		}
+	} else {
+		if err := unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", strings.ToUpper(format), err)
+		}
+		list = req.Jobs
+	}
+
+	imported := make([]importedJob, len(list))
+	for i, a := range list {
+		imported[i] = importedJob{Entry: i + 1, Job: a}
+	}
+	return imported, nil
+}
+
+// Variable assignment line of a crontab, such as PATH=/usr/bin:/bin or
+// MAILTO = ""
+var crontabVariable = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=\s*(.*)$`)
+
+// Commands whose first argument, rather than themselves, names a job imported
+// from a crontab line without a name
+var crontabWrappers = map[string]bool{
+	"sh": true, "bash": true, "python": true, "python3": true, "perl": true, "php": true, "node": true, "ruby": true,
+	"env": true, "nice": true, "ionice": true, "nohup": true, "sudo": true,
+}
+
+// Function to read the jobs of a crontab import, such as the output of
+// crontab -l. Lines are in the format of the cron jobs file, so plain crontab
+// lines work as well; like in the file, lines with the name of an earlier job
+// add schedules or exclusions to it. Jobs without a name option are named
+// after their command, and the comment lines right above a job become its
+// description. Variable assignments are set for the jobs below them as env.*
+// options; those that cannot be, such as MAILTO, are skipped with a warning.
+func parseCrontabImport(body []byte) ([]importedJob, []int, []string, error) {
+	var imported []importedJob
+	var skipped []int
+	var warnings []string
+	byName := make(map[string]int)
+	names := make(map[string]bool)
+	env := make(map[string]string)
+	var comments []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			comments = nil
+			continue
+		}
+		if comment, ok := strings.CutPrefix(line, "#"); ok {
+			comment = strings.TrimSpace(comment)
+			if j, err := parseJobLine(comment); err == nil && validSchedule(j.CronExpr) {
+				warnings = append(warnings, fmt.Sprintf("line %d: commented-out job is not imported", lineNumber))
+				comments = nil
+				continue
+			}
+			comments = append(comments, comment)
+			continue
+		}
+		if m := crontabVariable.FindStringSubmatch(line); m != nil {
+			comments = nil
+			skipped = append(skipped, lineNumber)
+			key, value := m[1], m[2]
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			switch {
+			case key == "MAILTO" || key == "MAILFROM":
+				warnings = append(warnings, fmt.Sprintf("line %d: %s is not imported, set up notifications instead", lineNumber, key))
+			case key == "SHELL":
+				warnings = append(warnings, fmt.Sprintf("line %d: SHELL is not imported, commands run with bash", lineNumber))
+			case key == "CRON_TZ":
+				warnings = append(warnings, fmt.Sprintf("line %d: CRON_TZ is not imported, add TZ= to the schedules instead", lineNumber))
+			case value == "":
+				delete(env, key)
+			case strings.ContainsAny(value, " \t]"):
+				warnings = append(warnings, fmt.Sprintf("line %d: %s is not imported, its value contains spaces or ], put it in an env_file instead", lineNumber, key))
+			default:
+				env[key] = value
+			}
+			continue
+		}
+
+		j, err := parseJobLine(line)
+		description := crontabDescription(comments)
+		comments = nil
+		if err != nil {
+			imported = append(imported, importedJob{Entry: lineNumber, Errors: []string{err.Error()}})
+			continue
+		}
+		if i, ok := byName[j.Name]; ok {
+			switch {
+			case imported[i].Job.Command != j.Command:
+				imported = append(imported, importedJob{Entry: lineNumber, Job: applyJob{Name: j.Name},
+					Errors: []string{fmt.Sprintf("job %s is already defined on line %d with a different command", j.Name, imported[i].Entry)}})
+			case j.Exclude:
+				imported[i].Job.Exclusions = append(imported[i].Job.Exclusions, j.CronExpr)
+			default:
+				imported[i].Job.Schedules = append(imported[i].Job.Schedules, j.CronExpr)
+			}
+			continue
+		}
+		if j.Exclude {
+			imported = append(imported, importedJob{Entry: lineNumber, Job: applyJob{Name: j.Name},
+				Errors: []string{"exclusions must follow the job they apply to"}})
+			continue
+		}
+
+		name := j.Name
+		if name == j.Command {
+			name = crontabJobName(j.Command, names)
+		}
+		names[name] = true
+		a := applyJob{Name: name, Schedule: j.CronExpr, Command: j.Command, Description: description, Options: map[string]string{}}
+		for key, value := range env {
+			a.Options["env."+key] = value
+		}
+		for _, opt := range strings.Fields(j.Options) {
+			key, value, _ := strings.Cut(opt, "=")
+			if key != "name" && key != "exclude" {
+				a.Options[key] = value
+			}
+		}
+		byName[j.Name] = len(imported)
+		imported = append(imported, importedJob{Entry: lineNumber, Job: a})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("error reading crontab: %w", err)
+	}
+	return imported, skipped, warnings, nil
+}
+
+// Helper function to tell whether a cron expression is valid
+func validSchedule(expr string) bool {
+	_, err := parseSchedule(expr)
+	return err == nil
+}
+
+// Function to turn the comment lines above a crontab job into its description,
+// leaving out the headers crontab -l and the default crontab add
+func crontabDescription(comments []string) string {
+	// The default crontab ends its explanation with a header of the columns
+	if len(comments) > 0 && strings.HasPrefix(comments[len(comments)-1], "m h ") {
+		return ""
+	}
+	var lines []string
+	for _, comment := range comments {
+		if comment == "" || strings.HasPrefix(comment, "DO NOT EDIT THIS FILE") || strings.HasPrefix(comment, "(") {
+			continue
+		}
+		lines = append(lines, comment)
+	}
+	return strings.Join(lines, " ")
+}
+
+// Function to name a job imported from a crontab line after the script or
+// program its command runs, such as backup for /opt/bin/backup.sh --full,
+// adding -2, -3 and so on when an earlier job took the name
+func crontabJobName(command string, taken map[string]bool) string {
+	base := "job"
+	for _, word := range strings.Fields(command) {
+		if strings.Contains(word, "=") || strings.HasPrefix(word, "-") || crontabWrappers[path.Base(word)] {
+			continue
+		}
+		word = path.Base(strings.Trim(word, `"'`))
+		word = strings.TrimSuffix(word, path.Ext(word))
+		word = strings.Trim(nonNameCharacters.ReplaceAllString(strings.ToLower(word), "-"), "-")
+		if word != "" {
+			base = word
+		}
+		break
+	}
+	name := base
+	for n := 2; taken[name]; n++ {
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	return name
+}
+
+// Characters replaced when turning a command into a job name
+var nonNameCharacters = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// Helper function to tell the format of an import from the format parameter
+// or the content type
+func importFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch {
+		case strings.Contains(mediaType, "yaml"):
+			format = "yaml"
+		case mediaType == "text/plain":
+			format = "crontab"
+		default:
+			format = "json"
+		}
+	}
+	if format == "yml" {
+		format = "yaml"
+	}
+	if format != "json" && format != "yaml" && format != "crontab" {
+		return "", fmt.Errorf("unknown format %q, expected json, yaml or crontab", format)
+	}
+	return format, nil
+}
+
+// Handler for POST /api/v1/import, creating and updating jobs of the request's
+// tenant from a JSON, YAML or crontab document. Unlike apply, jobs missing from
+// the import are left alone. Nothing is written unless every entry is valid;
+// with ?dry_run=true the per-entry report is returned without writing anything.
+func apiImportHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can import jobs")
+		return
+	}
+	format, err := importFormat(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("import larger than %d bytes", maxImportSize))
+		return
+	}
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	var imported []importedJob
+	var skipped []int
+	var warnings []string
+	if format == "crontab" {
+		imported, skipped, warnings, err = parseCrontabImport(body)
+	} else {
+		imported, err = parseStructuredImport(body, format)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tenant := requestTenant(r)
+	report, err := importJobs(tenant, imported, dryRun)
+	if err != nil {
+		if errors.Is(err, errDependencyCycle) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	report.Skipped, report.Warnings = skipped, warnings
+
+	status := http.StatusOK
+	if !report.Valid {
+		status = http.StatusUnprocessableEntity
+	}
+	if report.Imported && report.Created+report.Updated > 0 {
+		recordEvent(tenant, eventConfig, fmt.Sprintf("Imported jobs of tenant %s from %s: %d created, %d updated",
+			tenant, r.RemoteAddr, report.Created, report.Updated))
+		requestReconcile()
+	}
+	writeJSON(w, status, report)
+}
+
+// Function to validate imported jobs against a tenant's jobs and, unless this
+// is a dry run or an entry is invalid, save them in one transaction
+func importJobs(tenant string, imported []importedJob, dryRun bool) (importReport, error) {
+	report := importReport{DryRun: dryRun, Valid: true, Entries: []importEntry{}}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return report, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := loadAppliedJobs(tx, tenant)
+	if err != nil {
+		return report, err
+	}
+
+	var valid []Job
+	seen := make(map[string]int)
+	for _, im := range imported {
+		entry := importEntry{Entry: im.Entry, Name: im.Job.Name, Errors: im.Errors}
+		if len(entry.Errors) == 0 {
+			entry.Errors = im.Job.problems()
+		}
+		if first, ok := seen[im.Job.Name]; ok && len(im.Errors) == 0 {
+			entry.Errors = append(entry.Errors, fmt.Sprintf("job %s is already defined in entry %d", im.Job.Name, first))
+		} else if im.Job.Name != "" && !ok {
+			seen[im.Job.Name] = im.Entry
+		}
+
+		if len(entry.Errors) > 0 {
+			entry.Status = "invalid"
+			report.Invalid++
+			report.Valid = false
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+
+		j, _ := im.Job.toJob()
+		if existing, ok := current[j.Name]; !ok {
+			entry.Status = "create"
+			report.Created++
+		} else if entry.Changes = applyChanges(*existing, j, "api"); len(entry.Changes) > 0 {
+			entry.Status = "update"
+			report.Updated++
+		} else {
+			entry.Status = "unchanged"
+			report.Unchanged++
+		}
+		if entry.Status != "unchanged" {
+			valid = append(valid, j)
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	sort.SliceStable(report.Entries, func(a, b int) bool { return report.Entries[a].Entry < report.Entries[b].Entry })
+
+	if dryRun || !report.Valid {
+		return report, nil
+	}
+	now := time.Now().Format("02-01-2006 15:04:05")
+	for _, j := range valid {
+		if err := saveAppliedJob(tx, tenant, "api", j, now); err != nil {
+			return report, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return report, fmt.Errorf("error committing changes: %w", err)
+	}
+	report.Imported = true
+	return report, nil
+}
+
+// Handler for the page to paste a crontab, such as the output of crontab -l,
+// and import its jobs (GET /import). Posting the form checks the crontab,
+// or imports it when the Import button was used.
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can import jobs", http.StatusForbidden)
+		return
+	}
+	crontab, result := r.FormValue("crontab"), ""
+	if r.Method == http.MethodPost {
+		tenant := requestTenant(r)
+		imported, _, warnings, err := parseCrontabImport([]byte(crontab))
+		var report importReport
+		if err == nil {
+			report, err = importJobs(tenant, imported, r.FormValue("action") != "import")
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			result = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+		} else {
+			if report.Imported && report.Created+report.Updated > 0 {
+				recordEvent(tenant, eventConfig, fmt.Sprintf("Imported jobs of tenant %s by %s: %d created, %d updated",
+					tenant, requestActor(r), report.Created, report.Updated))
+				requestReconcile()
+			}
+			result = importReportHTML(report, warnings)
+		}
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Import Crontab</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Import Crontab</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/jobs")+`" class="btn btn-outline-secondary">Jobs</a>
+	        </div>
+	        `+result+`
+	        <form action="`+tenantURL(r, "/import")+`" method="post">
+	            <div class="mb-3">
+	                <label for="crontab" class="form-label">Crontab</label>
+	                <textarea class="form-control font-monospace" id="crontab" name="crontab" rows="15" placeholder="# Nightly backup&#10;0 2 * * * /opt/bin/backup.sh" required>`+html.EscapeString(crontab)+`</textarea>
+	                <div class="form-text">Paste the output of <code>crontab -l</code>. Comments above a job become its description and variables such as <code>PATH=...</code> are set for the jobs below them.</div>
+	            </div>
+	            <button type="submit" name="action" value="check" class="btn btn-outline-primary">Check</button>
+	            <button type="submit" name="action" value="import" class="btn btn-primary">Import</button>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Function to render the report of a crontab import for the import page
+func importReportHTML(report importReport, warnings []string) string {
+	var b strings.Builder
+	switch {
+	case !report.Valid:
+		fmt.Fprintf(&b, `<div class="alert alert-danger">%d of the jobs are invalid, nothing was imported.</div>`, report.Invalid)
+	case report.Imported:
+		fmt.Fprintf(&b, `<div class="alert alert-success">Imported: %d created, %d updated, %d unchanged.</div>`, report.Created, report.Updated, report.Unchanged)
+	default:
+		fmt.Fprintf(&b, `<div class="alert alert-info">Ready to import: %d to create, %d to update, %d unchanged.</div>`, report.Created, report.Updated, report.Unchanged)
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(&b, `<div class="alert alert-warning py-1">%s</div>`, html.EscapeString(warning))
+	}
+	b.WriteString(`<table class="table table-sm"><thead><tr><th>Line</th><th>Name</th><th>Status</th><th>Details</th></tr></thead><tbody>`)
+	for _, entry := range report.Entries {
+		details := strings.Join(entry.Changes, ", ")
+		if len(entry.Errors) > 0 {
+			details = strings.Join(entry.Errors, "; ")
+		}
+		fmt.Fprintf(&b, `<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			entry.Entry, html.EscapeString(entry.Name), entry.Status, html.EscapeString(details))
+	}
+	b.WriteString(`</tbody></table>`)
+	return b.String()
+}
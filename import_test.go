@@ -0,0 +1,107 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCrontabImport(t *testing.T) {
+	crontab := strings.Join([]string{
+		"# DO NOT EDIT THIS FILE - edit the master and reinstall.",   // 1
+		"# (/tmp/crontab.Xb3 installed on Tue Oct  6 09:12:44 2026)", // 2
+		"MAILTO=ops@example.com",                                     // 3
+		"PATH=/usr/local/bin:/usr/bin:/bin",                          // 4
+		`GREETING="hello world"`,                                     // 5
+		"",                                                           // 6
+		"# Nightly backup",                                           // 7
+		"# of the database",                                          // 8
+		"0 2 * * * /opt/bin/backup.sh --full",                        // 9
+		"30 14 * * 6 /opt/bin/backup.sh --full",                      // 10
+		"* * 25 12 * [exclude=true] /opt/bin/backup.sh --full",       // 11
+		"# 15 * * * * ./old.sh",                                      // 12
+		"REGION='eu'",                                                // 13
+		"0 * * * * [name=report retries=2] ./report.sh",              // 14
+		"@daily bash ./report.sh",                                    // 15
+		"0 3 * * * [name=report] ./other.sh",                         // 16
+		"0 4 * * * [name=cleanup ./cleanup.sh",                       // 17
+		"0 5 * * * [exclude=true] ./orphan.sh",                       // 18
+	}, "\n")
+
+	imported, skipped, warnings, err := parseCrontabImport([]byte(crontab))
+	if err != nil {
+		t.Fatalf("parseCrontabImport failed: %s", err)
+	}
+
+	if want := []int{3, 4, 5, 13}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped lines = %v, want %v", skipped, want)
+	}
+	wantWarnings := []string{
+		"line 3: MAILTO is not imported",
+		"line 5: GREETING is not imported",
+		"line 12: commented-out job is not imported",
+	}
+	if len(warnings) != len(wantWarnings) {
+		t.Fatalf("warnings = %q, want %d", warnings, len(wantWarnings))
+	}
+	for i, want := range wantWarnings {
+		if !strings.HasPrefix(warnings[i], want) {
+			t.Errorf("warning %d = %q, want %q", i, warnings[i], want)
+		}
+	}
+
+	want := []importedJob{
+		{Entry: 9, Job: applyJob{
+			Name:        "backup",
+			Schedule:    "0 2 * * *",
+			Schedules:   []string{"30 14 * * 6"},
+			Exclusions:  []string{"* * 25 12 *"},
+			Command:     "/opt/bin/backup.sh --full",
+			Description: "Nightly backup of the database",
+			Options:     map[string]string{"env.PATH": "/usr/local/bin:/usr/bin:/bin"},
+		}},
+		{Entry: 14, Job: applyJob{
+			Name:     "report",
+			Schedule: "0 * * * *",
+			Command:  "./report.sh",
+			Options:  map[string]string{"env.PATH": "/usr/local/bin:/usr/bin:/bin", "env.REGION": "eu", "retries": "2"},
+		}},
+		{Entry: 15, Job: applyJob{
+			Name:     "report-2",
+			Schedule: "@daily",
+			Command:  "bash ./report.sh",
+			Options:  map[string]string{"env.PATH": "/usr/local/bin:/usr/bin:/bin", "env.REGION": "eu"},
+		}},
+		{Entry: 16, Job: applyJob{Name: "report"}, Errors: []string{"job report is already defined on line 14 with a different command"}},
+		{Entry: 17, Errors: []string{"unterminated option block"}},
+		{Entry: 18, Job: applyJob{Name: "./orphan.sh"}, Errors: []string{"exclusions must follow the job they apply to"}},
+	}
+	if len(imported) != len(want) {
+		t.Fatalf("imported %d jobs, want %d: %+v", len(imported), len(want), imported)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(imported[i], want[i]) {
+			t.Errorf("job %d = %+v, want %+v", i, imported[i], want[i])
+		}
+	}
+}
+
+func TestCrontabJobName(t *testing.T) {
+	taken := map[string]bool{"backup": true}
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"/opt/bin/sync_files.sh", "sync_files"},
+		{"/opt/bin/backup.sh --full", "backup-2"},
+		{"python3 -u /srv/app/Poll.Queue.py", "poll-queue"},
+		{"LANG=C nice /usr/bin/updatedb", "updatedb"},
+		{`bash "/opt/tools/rotate logs.sh"`, "rotate"},
+		{"--help", "job"},
+	}
+	for _, tt := range tests {
+		if got := crontabJobName(tt.command, taken); got != tt.want {
+			t.Errorf("crontabJobName(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct to hold a job definition from the jobs table
+type Job struct {
+	ID            int64
+	Tenant        string
+	Name          string
+	CronExpr      string
+	Phrase        string // phrase CronExpr was derived from, such as "every weekday at 6pm"
+	Command       string
+	Description   string // shown on the jobs page, kept as is when empty on an apply or import
+	Revision      string // git commit the definition came from, for jobs synced from a repository
+	PipeTo        string
+	After         []string // jobs that must succeed before this one is started
+	Env           map[string]string
+	EnvFile       string
+	CPUs          string
+	MemLimit      string
+	MaxOutput     string // most output kept of a run, e.g. 64K, see outputLimit
+	StripANSI     *bool  // whether ANSI escapes are stripped from the output, nil to follow STRIP_ANSI
+	DropOutput    bool   // set by store_output=false, the command's output is not kept
+	RateLimit     string
+	MaxRuns       int           // the job disables itself after this many runs, 0 for no limit
+	Retries       int           // failed runs are retried this many times
+	RetryBackoff  time.Duration // delay before the first retry, doubled for each further one
+	Concurrency   string        // overlap policy, see concurrencyAllow
+	Jitter        time.Duration // scheduled runs start after a random delay of up to this long
+	SkipCalendars []string      // calendars whose dates the job does not run on
+	MaxFailures   int           // the job disables itself after this many failed runs in a row
+	SLA           time.Duration // runs taking longer than this are recorded as SLA breaches
+	CatchUp       bool          // runs missed while the scheduler was down are run on startup
+	CatchUpMax    int           // most missed runs caught up, the latest ones
+	Options       string        // option block as written, without the brackets
+	Schedules     []string      // additional cron expressions from job_schedules
+	Exclusions    []string      // cron expressions during which the job must not run
+	Exclude       bool          // set on cron jobs file lines that define an exclusion
+	Public        bool          // listed on the unauthenticated status page
+	PingURL       string        // external monitor notified when a run starts and ends
+	PingStyle     string        // "healthchecks" (the default) or "cronitor"
+	CallbackURL   string        // the result of every run is posted here as JSON
+	Critical      bool          // failed runs page through PagerDuty
+	Notify        string        // how run results are notified, see notifyEach
+	OutputCheck   string        // "stable" or "changing", see outputStable
+
+	// Fire time of the trigger being run, zero for runs that were not scheduled
+	ScheduledAt time.Time
+	// Random delay the run waited out before starting, see Jitter
+	JitterDelay time.Duration
+	// W3C traceparent of the run's span, empty when tracing is off
+	TraceParent string
+}
+
+// Delay before the first retry of jobs with retries but no retry_backoff option
+const defaultRetryBackoff = 10 * time.Second
+
+// Function to list all cron expressions a job runs on
+func (j Job) CronExprs() []string {
+	return append([]string{j.CronExpr}, j.Schedules...)
+}
+
+// Function to tell whether a job is meant to run a single time
+func (j Job) IsOneShot() bool {
+	return j.MaxRuns == 1
+}
+
+// Scheduled jobs keyed by jobKey, used to resolve pipe targets
+var (
+	jobs   = make(map[string]Job)
+	jobsMu sync.RWMutex
+)
+
+// Function to parse a cron jobs file line into a Job.
+//
+// A line is five cron fields, an optional bracketed option block and the
+// command, e.g.:
+//
+//	0 * * * * [name=extract pipe_to=load] python ./scripts/extract.py
+//
+// A six-field expression, whose first field is the second, is told apart
+// from a five-field one by checking whether the first six fields form a valid
+// expression:
+//
+//	*/15 * * * * * ./check_health.sh
+//
+// A command whose first word would be read as the sixth field, such as a
+// program named 5 or mon, needs an option block (which may be empty) after a
+// five-field expression.
+//
+// A one-time job has "@at" and the time it runs at instead of the cron
+// expression:
+//
+//	@at 2026-11-02T09:30:00Z [name=migrate] ./migrate.sh
+//
+// Descriptors such as @daily, @every 90s and @reboot can be used as well.
+//
+// Option values cannot contain spaces or a closing bracket.
+func parseJobLine(line string) (Job, error) {
+	parts := strings.Fields(line)
+	fields := 5
+	switch {
+	case len(parts) > 0 && (parts[0] == strings.TrimSpace(runAtPrefix) || parts[0] == "@every"):
+		fields = 2
+	case len(parts) > 0 && strings.HasPrefix(parts[0], "@"):
+		fields = 1
+	case len(parts) > 6 && validSchedule(strings.Join(parts[:6], " ")):
+		fields = 6
+	}
+	if len(parts) <= fields {
+		return Job{}, fmt.Errorf("expected a cron expression and a command")
+	}
+
+	j := Job{CronExpr: strings.Join(parts[:fields], " ")}
+	rest := parts[fields:]
+
+	if strings.HasPrefix(rest[0], "[") {
+		end := -1
+		for i, p := range rest {
+			if strings.HasSuffix(p, "]") {
+				end = i
+				break
+			}
+		}
+		if end == -1 {
+			return Job{}, fmt.Errorf("unterminated option block")
+		}
+
+		block := strings.Join(rest[:end+1], " ")
+		j.Options = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(block, "["), "]"))
+		if err := parseJobOptions(&j, j.Options); err != nil {
+			return Job{}, err
+		}
+		rest = rest[end+1:]
+	}
+
+	if len(rest) == 0 {
+		return Job{}, fmt.Errorf("missing command")
+	}
+	j.Command = strings.Join(rest, " ")
+	if j.Name == "" {
+		j.Name = j.Command
+	}
+	if err := applyRunAt(&j); err != nil {
+		return Job{}, err
+	}
+	return j, nil
+}
+
+// Function to build a cron jobs file line from a job's expression, options and
+// command, adding an empty option block when the command would otherwise be
+// read as part of the expression
+func jobLine(expr, options, command string) string {
+	if options != "" {
+		return expr + " [" + options + "] " + command
+	}
+	line := expr + " " + command
+	if j, err := parseJobLine(line); err == nil && j.CronExpr != strings.Join(strings.Fields(expr), " ") {
+		line = expr + " [] " + command
+	}
+	return line
+}
+
+// Function to limit a job with an @at schedule to a single run, so it
+// disables itself and is archived once it has run
+func applyRunAt(j *Job) error {
+	if !isRunAt(j.CronExpr) {
+		return nil
+	}
+	if _, err := parseSchedule(j.CronExpr); err != nil {
+		return err
+	}
+	if j.MaxRuns > 1 {
+		return fmt.Errorf("a one-time job cannot have max_runs above 1")
+	}
+	j.MaxRuns = 1
+	return nil
+}
+
+// Function to apply a space separated list of key=value options to a job
+func parseJobOptions(j *Job, block string) error {
+	for _, opt := range strings.Fields(block) {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok || value == "" {
+			return fmt.Errorf("invalid option %q, expected key=value", opt)
+		}
+
+		switch key {
+		case "name":
+			j.Name = value
+		case "pipe_to":
+			j.PipeTo = value
+		case "after":
+			j.After = nil
+			for _, name := range strings.Split(value, ",") {
+				if name == "" {
+					return fmt.Errorf("invalid value %q for after, expected job names separated by commas", value)
+				}
+				j.After = append(j.After, name)
+			}
+		case "env_file":
+			j.EnvFile = value
+		case "cpus":
+			if !validCPUList(value) {
+				return fmt.Errorf("invalid cpu list %q, expected e.g. 0-3,6", value)
+			}
+			j.CPUs = value
+		case "mem_limit":
+			if _, err := parseMemorySize(value); err != nil {
+				return err
+			}
+			j.MemLimit = value
+		case "store_output":
+			store, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for store_output, expected true or false", value)
+			}
+			j.DropOutput = !store
+		case "strip_ansi":
+			strip, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for strip_ansi, expected true or false", value)
+			}
+			j.StripANSI = &strip
+		case "max_output":
+			if _, err := parseMemorySize(value); err != nil {
+				return fmt.Errorf("invalid value %q for max_output, expected a size such as 64K", value)
+			}
+			j.MaxOutput = value
+		case "exclude":
+			exclude, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for exclude, expected true or false", value)
+			}
+			j.Exclude = exclude
+		case "max_failures":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid value %q for max_failures, expected a number of at least 1", value)
+			}
+			j.MaxFailures = n
+		case "sla":
+			sla, err := time.ParseDuration(value)
+			if err != nil || sla <= 0 {
+				return fmt.Errorf("invalid value %q for sla, expected a duration such as 30m", value)
+			}
+			j.SLA = sla
+		case "catch_up":
+			catchUp, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for catch_up, expected true or false", value)
+			}
+			j.CatchUp = catchUp
+		case "catch_up_max":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid value %q for catch_up_max, expected a number of at least 1", value)
+			}
+			j.CatchUpMax = n
+		case "notify":
+			if value != notifyEach && value != notifyDigest && value != notifyNone {
+				return fmt.Errorf("invalid value %q for notify, expected each, digest or none", value)
+			}
+			j.Notify = value
+		case "output_check":
+			if value != outputStable && value != outputChanging {
+				return fmt.Errorf("invalid value %q for output_check, expected stable or changing", value)
+			}
+			j.OutputCheck = value
+		case "critical":
+			critical, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for critical, expected true or false", value)
+			}
+			j.Critical = critical
+		case "public":
+			public, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for public, expected true or false", value)
+			}
+			j.Public = public
+		case "ping_url":
+			if err := validatePingURL(value); err != nil {
+				return err
+			}
+			j.PingURL = value
+		case "callback_url":
+			if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid callback_url %q, expected an http or https URL", value)
+			}
+			j.CallbackURL = value
+		case "ping_style":
+			if value != "healthchecks" && value != "cronitor" {
+				return fmt.Errorf("invalid value %q for ping_style, expected healthchecks or cronitor", value)
+			}
+			j.PingStyle = value
+		case "max_runs":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid value %q for max_runs, expected a number", value)
+			}
+			j.MaxRuns = n
+		case "retries":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid value %q for retries, expected a number", value)
+			}
+			j.Retries = n
+		case "retry_backoff":
+			backoff, err := time.ParseDuration(value)
+			if err != nil || backoff <= 0 {
+				return fmt.Errorf("invalid value %q for retry_backoff, expected a duration such as 30s", value)
+			}
+			j.RetryBackoff = backoff
+		case "concurrency":
+			if value != concurrencyAllow && value != concurrencyForbid && value != concurrencyReplace {
+				return fmt.Errorf("invalid value %q for concurrency, expected allow, forbid or replace", value)
+			}
+			j.Concurrency = value
+		case "skip_calendar":
+			j.SkipCalendars = nil
+			for _, name := range strings.Split(value, ",") {
+				if !calendarNamePattern.MatchString(name) {
+					return fmt.Errorf("invalid value %q for skip_calendar, expected calendar names separated by commas", value)
+				}
+				j.SkipCalendars = append(j.SkipCalendars, name)
+			}
+		case "jitter":
+			jitter, err := time.ParseDuration(value)
+			if err != nil || jitter < 0 {
+				return fmt.Errorf("invalid value %q for jitter, expected a duration such as 2m", value)
+			}
+			j.Jitter = jitter
+		case "rate_limit":
+			if _, _, err := parseRateLimit(value); err != nil {
+				return err
+			}
+			j.RateLimit = value
+		default:
+			if name, ok := strings.CutPrefix(key, "env."); ok && name != "" {
+				if j.Env == nil {
+					j.Env = make(map[string]string)
+				}
+				j.Env[name] = value
+				continue
+			}
+			return fmt.Errorf("unknown option %q", key)
+		}
+	}
+	if j.Retries > 0 && j.RetryBackoff == 0 {
+		j.RetryBackoff = defaultRetryBackoff
+	}
+	return nil
+}
+
+// Function to check a taskset-style CPU list such as "2" or "0-3,6"
+func validCPUList(list string) bool {
+	for _, part := range strings.Split(list, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil || first < 0 {
+			return false
+		}
+		if isRange {
+			last, err := strconv.Atoi(hi)
+			if err != nil || last < first {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Function to look up a registered job of a tenant by name
+func lookupJob(tenant, name string) (Job, bool) {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	j, ok := jobs[jobKey(tenant, name)]
+	return j, ok
+}
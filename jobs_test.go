@@ -0,0 +1,143 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJobLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		cronExpr string
+		name     string
+		command  string
+		options  string
+	}{
+		{"*/5 * * * * ./backup.sh --full", "*/5 * * * *", "./backup.sh --full", "./backup.sh --full", ""},
+		{"0 2 * * * [name=backup retries=2] ./backup.sh", "0 2 * * *", "backup", "./backup.sh", "name=backup retries=2"},
+		{"*/10 * * * * * [name=poll] ./poll.sh", "*/10 * * * * *", "poll", "./poll.sh", "name=poll"},
+		{"*/15 * * * * * ./check_health.sh", "*/15 * * * * *", "./check_health.sh", "./check_health.sh", ""},
+		{"0 * * * * if [ -f /tmp/ready ]; then ./load.sh; fi", "0 * * * *", "if [ -f /tmp/ready ]; then ./load.sh; fi",
+			"if [ -f /tmp/ready ]; then ./load.sh; fi", ""},
+		{"0 * * * * test [ -f x ] && ./x.sh", "0 * * * *", "test [ -f x ] && ./x.sh", "test [ -f x ] && ./x.sh", ""},
+		{"0 9 * * * mon ./weekly.sh", "0 9 * * * mon", "./weekly.sh", "./weekly.sh", ""},
+		{"0 9 * * * [] mon ./weekly.sh", "0 9 * * *", "mon ./weekly.sh", "mon ./weekly.sh", ""},
+		{"@daily [name=report] ./report.sh", "@daily", "report", "./report.sh", "name=report"},
+		{"@every 90s ./heartbeat.sh", "@every 90s", "./heartbeat.sh", "./heartbeat.sh", ""},
+		{"@at 2026-11-02T09:30:00Z [name=migrate] ./migrate.sh", "@at 2026-11-02T09:30:00Z", "migrate", "./migrate.sh", "name=migrate"},
+	}
+	for _, tt := range tests {
+		j, err := parseJobLine(tt.line)
+		if err != nil {
+			t.Errorf("parseJobLine(%q) failed: %s", tt.line, err)
+			continue
+		}
+		if j.CronExpr != tt.cronExpr || j.Name != tt.name || j.Command != tt.command || j.Options != tt.options {
+			t.Errorf("parseJobLine(%q) = schedule %q, name %q, command %q, options %q; want %q, %q, %q, %q",
+				tt.line, j.CronExpr, j.Name, j.Command, j.Options, tt.cronExpr, tt.name, tt.command, tt.options)
+		}
+	}
+}
+
+func TestParseJobLineOneShot(t *testing.T) {
+	j, err := parseJobLine("@at 2026-11-02T09:30:00Z ./migrate.sh")
+	if err != nil {
+		t.Fatalf("parseJobLine failed: %s", err)
+	}
+	if j.MaxRuns != 1 {
+		t.Errorf("one-time job has max_runs %d, want 1", j.MaxRuns)
+	}
+}
+
+func TestParseJobLineErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"", "expected a cron expression and a command"},
+		{"* * * * *", "expected a cron expression and a command"},
+		{"@daily", "expected a cron expression and a command"},
+		{"0 2 * * * [name=backup ./backup.sh", "unterminated option block"},
+		{"0 2 * * * [name=backup]", "missing command"},
+		{"0 2 * * * [backup] ./backup.sh", `invalid option "backup", expected key=value`},
+		{"0 2 * * * [colour=red] ./backup.sh", `unknown option "colour"`},
+		{"@at tomorrow ./migrate.sh", "invalid run time"},
+		{"@at 2026-11-02T09:30:00Z [max_runs=3] ./migrate.sh", "a one-time job cannot have max_runs above 1"},
+	}
+	for _, tt := range tests {
+		_, err := parseJobLine(tt.line)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseJobLine(%q) error = %v, want %q", tt.line, err, tt.want)
+		}
+	}
+}
+
+func TestJobLine(t *testing.T) {
+	tests := []struct {
+		expr, options, command string
+		want                   string
+	}{
+		{"0 2 * * *", "", "./backup.sh", "0 2 * * * ./backup.sh"},
+		{"*/15 * * * * *", "", "./check_health.sh", "*/15 * * * * * ./check_health.sh"},
+		{"0 2 * * *", "name=backup", "./backup.sh", "0 2 * * * [name=backup] ./backup.sh"},
+		{"0 9 * * *", "", "mon ./weekly.sh", "0 9 * * * [] mon ./weekly.sh"},
+		{"0 9 * * *", "", "[name=weekly] mon ./weekly.sh", "0 9 * * * [name=weekly] mon ./weekly.sh"},
+		{"@daily", "", "5 ./report.sh", "@daily 5 ./report.sh"},
+	}
+	for _, tt := range tests {
+		line := jobLine(tt.expr, tt.options, tt.command)
+		if line != tt.want {
+			t.Errorf("jobLine(%q, %q, %q) = %q, want %q", tt.expr, tt.options, tt.command, line, tt.want)
+		}
+		if j, err := parseJobLine(line); err != nil || j.CronExpr != tt.expr {
+			t.Errorf("parseJobLine(%q) = schedule %q, %v; want %q", line, j.CronExpr, err, tt.expr)
+		}
+	}
+}
+
+func TestParseJobOptions(t *testing.T) {
+	var j Job
+	err := parseJobOptions(&j, "after=extract,load retries=3 sla=30m concurrency=forbid env.REGION=eu jitter=2m")
+	if err != nil {
+		t.Fatalf("parseJobOptions failed: %s", err)
+	}
+	if len(j.After) != 2 || j.After[0] != "extract" || j.After[1] != "load" {
+		t.Errorf("after = %q, want [extract load]", j.After)
+	}
+	if j.Retries != 3 || j.RetryBackoff != defaultRetryBackoff {
+		t.Errorf("retries = %d with backoff %s, want 3 with %s", j.Retries, j.RetryBackoff, defaultRetryBackoff)
+	}
+	if j.SLA != 30*time.Minute || j.Jitter != 2*time.Minute {
+		t.Errorf("sla = %s, jitter = %s, want 30m and 2m", j.SLA, j.Jitter)
+	}
+	if j.Concurrency != concurrencyForbid || j.Env["REGION"] != "eu" {
+		t.Errorf("concurrency = %q, env = %v", j.Concurrency, j.Env)
+	}
+}
+
+func TestParseJobOptionsErrors(t *testing.T) {
+	tests := []struct {
+		block string
+		want  string
+	}{
+		{"name=", `invalid option "name=", expected key=value`},
+		{"after=a,,b", "invalid value \"a,,b\" for after"},
+		{"cpus=3-1", `invalid cpu list "3-1"`},
+		{"max_failures=0", "invalid value \"0\" for max_failures"},
+		{"sla=soon", "invalid value \"soon\" for sla"},
+		{"notify=sometimes", "invalid value \"sometimes\" for notify"},
+		{"callback_url=ftp://example.com", `invalid callback_url "ftp://example.com"`},
+		{"retries=-1", "invalid value \"-1\" for retries"},
+		{"concurrency=queue", "invalid value \"queue\" for concurrency"},
+		{"jitter=-1m", "invalid value \"-1m\" for jitter"},
+		{"env.=x", `unknown option "env."`},
+	}
+	for _, tt := range tests {
+		var j Job
+		err := parseJobOptions(&j, tt.block)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseJobOptions(%q) error = %v, want %q", tt.block, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// File the jobs of the default tenant are read from on startup
+const cronJobsFile = "cron_jobs.txt"
+
+// Guards changes to the cron jobs file
+var cronJobsFileMu sync.Mutex
+
+// Function to append a job line to the cron jobs file
+func appendJobToFile(path, line string) error {
+	cronJobsFileMu.Lock()
+	defer cronJobsFileMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintf(file, "%s\n", line); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// Function to change the schedule and command of a job in the cron jobs file.
+// The job's first line gets the new schedule; every line of the job, including
+// additional schedules and exclusions, gets the new command. Options are kept.
+func rewriteJobInFile(path, name, schedule, command string) error {
+	cronJobsFileMu.Lock()
+	defer cronJobsFileMu.Unlock()
+
+	current, err := readFileLines(path)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	found := false
+	for _, line := range current {
+		j, err := parseJobLine(line)
+		if err != nil || j.Name != name {
+			lines = append(lines, line)
+			continue
+		}
+		if j.Name == j.Command && command != j.Command {
+			return fmt.Errorf("job %s is named after its command in %s, give it a name= option there before changing its command", name, path)
+		}
+		expr := j.CronExpr
+		if !found && !j.Exclude {
+			expr, found = schedule, true
+		}
+		lines = append(lines, jobLine(expr, j.Options, command))
+	}
+	if !found {
+		return fmt.Errorf("job %s is not in %s", name, path)
+	}
+	return writeFileLines(path, lines)
+}
+
+// Function to remove every line of a job from the cron jobs file, including
+// its additional schedules and exclusions
+func removeJobFromFile(path, name string) error {
+	cronJobsFileMu.Lock()
+	defer cronJobsFileMu.Unlock()
+
+	current, err := readFileLines(path)
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(current))
+	for _, line := range current {
+		if j, err := parseJobLine(line); err == nil && j.Name == name {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == len(current) {
+		return nil
+	}
+	return writeFileLines(path, lines)
+}
+
+// Function to read the lines of a file
+func readFileLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+// Function to replace the lines of a file. A new file is written and moved in
+// place, so a crash never leaves half a file.
+func writeFileLines(path string, lines []string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strings.Join(lines, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
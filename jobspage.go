@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Handler for listing the jobs in the jobs table. Archived jobs are hidden
+// unless ?archived=1 is given.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	showArchived := r.URL.Query().Get("archived") == "1"
+	tenant := requestTenant(r)
+	prefs, err := loadPreferences(tenant, requestUser(r))
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	quarantined := make(map[string]quarantinedJob)
+	for _, q := range quarantinedJobs(tenant) {
+		quarantined[q.Name] = q
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`
+		SELECT j.name, j.cron_expr, j.schedule_phrase, j.command, j.enabled, j.disabled_reason, j.run_count, j.max_runs, j.description, j.revision,
+		       COALESCE(GROUP_CONCAT(s.cron_expr, ' | '), '')
+		FROM jobs j
+		LEFT JOIN job_schedules s ON s.job_id = j.id AND s.kind = 'run'
+		WHERE j.tenant = ? AND j.archived = ?
+		GROUP BY j.id
+		ORDER BY j.name`, tenant, showArchived)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	title, toggle := "Active Jobs", `<a href="`+tenantURL(r, "/jobs?archived=1")+`" class="btn btn-outline-secondary">Show Archived</a>`
+	if showArchived {
+		title, toggle = "Archived Jobs", `<a href="`+tenantURL(r, "/jobs")+`" class="btn btn-outline-secondary">Show Active</a>`
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>`+title+`</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>`+title+`</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	            `+toggle+`
+	            <a href="`+tenantURL(r, "/import")+`" class="btn btn-outline-secondary">Import Crontab</a>
+	        </div>
+	        <table class="table table-striped table-hover">
+	            <thead>
+	                <tr>
+	                    <th></th>
+	                    <th>Name</th>
+	                    <th>Schedule</th>
+	                    <th>Command</th>
+	                    <th>Enabled</th>
+	                    <th>Runs</th>
+	                    <th></th>
+	                </tr>
+	            </thead>
+	            <tbody>`)
+
+	for rows.Next() {
+		var name, cronExpr, phrase, command, disabledReason, description, revision, extra string
+		var enabled bool
+		var runCount, maxRuns int
+		if err := rows.Scan(&name, &cronExpr, &phrase, &command, &enabled, &disabledReason, &runCount, &maxRuns, &description, &revision, &extra); err != nil {
+			http.Error(w, "Error reading from database", http.StatusInternalServerError)
+			return
+		}
+
+		schedules := []string{cronExpr}
+		if extra != "" {
+			schedules = append(schedules, extra)
+		}
+		scheduleText := "<code>" + html.EscapeString(strings.Join(schedules, " | ")) + "</code>"
+		if phrase != "" {
+			scheduleText += `<div class="small text-muted">` + html.EscapeString(phrase) + `</div>`
+		}
+		runs := fmt.Sprint(runCount)
+		if maxRuns > 0 {
+			runs = fmt.Sprintf("%d / %d", runCount, maxRuns)
+		}
+		enabledText := "Yes"
+		if !enabled {
+			enabledText = "No"
+			if disabledReason != "" {
+				enabledText = `<span class="badge text-bg-danger">Disabled</span> ` + html.EscapeString(disabledReason)
+			}
+		} else if q, ok := quarantined[name]; ok {
+			enabledText = `<span class="badge text-bg-danger">` + q.Status + `</span> ` + html.EscapeString(q.Error)
+		} else if state := jobPauseState(tenant, name); state.Paused {
+			enabledText = "Paused by " + html.EscapeString(state.Actor)
+		}
+
+		star, starTitle := "&#9734;", "Add to favorites"
+		if prefs.IsFavorite(name) {
+			star, starTitle = "&#9733;", "Remove from favorites"
+		}
+		favorite := fmt.Sprintf(`<form action="%s" method="post" class="m-0">
+					<input type="hidden" name="job" value="%s">
+					<button type="submit" class="btn btn-link p-0 text-warning" title="%s">%s</button>
+				</form>`, tenantURL(r, "/preferences/favorite"), html.EscapeString(name), starTitle, star)
+
+		nameText := html.EscapeString(name)
+		if description != "" {
+			nameText += `<div class="small text-muted">` + html.EscapeString(description) + `</div>`
+		}
+		if revision != "" {
+			nameText += `<div class="small text-muted">From commit <code>` + html.EscapeString(revision[:min(len(revision), 12)]) + `</code></div>`
+		}
+		actions := `<a href="` + html.EscapeString(tenantURL(r, "/edit-job?name="+url.QueryEscape(name))) + `" class="btn btn-sm btn-outline-primary">Edit</a>` +
+			fmt.Sprintf(` <form action="%s" method="post" class="d-inline" onsubmit="return confirm('Delete this job? Its run history is kept.')">
+					<input type="hidden" name="name" value="%s">
+					<button type="submit" class="btn btn-sm btn-outline-danger">Delete</button>
+				</form>`, tenantURL(r, "/delete-job"), html.EscapeString(name))
+		if !enabled && !showArchived {
+			actions = fmt.Sprintf(`<form action="%s" method="post" class="d-inline">
+					<input type="hidden" name="name" value="%s">
+					<button type="submit" class="btn btn-sm btn-outline-success">Enable</button>
+				</form> `, tenantURL(r, "/enable-job"), html.EscapeString(name)) + actions
+		}
+		if _, scheduled := lookupJob(tenant, name); scheduled {
+			actions = fmt.Sprintf(`<form action="%s" method="post" class="d-inline">
+					<input type="hidden" name="name" value="%s">
+					<button type="submit" class="btn btn-sm btn-outline-success">Run Now</button>
+				</form> `, tenantURL(r, "/run-job"), html.EscapeString(name)) + actions
+		}
+
+		fmt.Fprintf(w, `<tr>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td class="text-nowrap">%s</td>
+			</tr>`, favorite, nameText, scheduleText, html.EscapeString(command), enabledText, runs, actions)
+	}
+
+	fmt.Fprintln(w, `</tbody></table>
+	    </div>
+	</body>
+	</html>
+	`)
+}
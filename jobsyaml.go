@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Struct to hold the changes made when the jobs of a source were replaced
+type jobSync struct {
+	Created []string
+	Updated []string
+	Deleted []string
+}
+
+// Function to get the path of the declarative jobs file
+func jobsYAMLFile() string {
+	return getEnvString("JOBS_FILE", "jobs.yaml")
+}
+
+// Function to read the jobs of the jobs file, in the form of POST
+// /api/v1/apply, either under jobs or as a bare list. Every problem of every
+// entry is reported at once.
+func loadJobsYAML(path string) ([]Job, error) {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	imported, err := parseStructuredImport(body, "yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	desired := make([]Job, 0, len(imported))
+	seen := make(map[string]int)
+	for _, im := range imported {
+		if first, ok := seen[im.Job.Name]; ok && im.Job.Name != "" {
+			problems = append(problems, fmt.Sprintf("entry %d: job %s is already defined in entry %d", im.Entry, im.Job.Name, first))
+			continue
+		}
+		seen[im.Job.Name] = im.Entry
+		if entryProblems := im.Job.problems(); len(entryProblems) > 0 {
+			for _, problem := range entryProblems {
+				problems = append(problems, fmt.Sprintf("entry %d: %s", im.Entry, problem))
+			}
+			continue
+		}
+		j, _ := im.Job.toJob()
+		desired = append(desired, j)
+	}
+	if len(problems) > 0 {
+		return nil, errors.New(strings.Join(problems, "; "))
+	}
+	return desired, nil
+}
+
+// Function to make the default tenant's jobs from the jobs file match it:
+// jobs in the file are created or updated and owned by the file from then on,
+// and jobs the file owned but no longer lists are deleted. Nothing changes
+// when the file has a problem.
+func syncJobsFromYAML(path string) error {
+	desired, err := loadJobsYAML(path)
+	if err != nil {
+		return err
+	}
+	result, err := storage.ReplaceJobs(defaultTenant, "yaml", desired)
+	if err != nil {
+		return err
+	}
+	if len(result.Created)+len(result.Updated)+len(result.Deleted) == 0 {
+		return nil
+	}
+
+	var changes []string
+	for _, change := range []struct {
+		verb  string
+		names []string
+	}{{"created", result.Created}, {"updated", result.Updated}, {"deleted", result.Deleted}} {
+		if len(change.names) > 0 {
+			changes = append(changes, change.verb+" "+strings.Join(change.names, ", "))
+		}
+	}
+	recordEvent(defaultTenant, eventConfig, fmt.Sprintf("Reloaded jobs from %s: %s", path, strings.Join(changes, "; ")))
+	requestReconcile()
+	return nil
+}
+
+// Struct to hold what the jobs file watcher last saw of the file
+type jobsFileState struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+// Function to get the state of the jobs file
+func statJobsFile(path string) jobsFileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return jobsFileState{}
+	}
+	return jobsFileState{exists: true, size: info.Size(), modTime: info.ModTime().UnixNano()}
+}
+
+// Function to apply the jobs file once on startup, if it exists, and then
+// every time it changes, checking it every JOBS_FILE_POLL_INTERVAL (2s by
+// default). A change is applied once the file stayed the same for one check,
+// so a file that is still being written is not read. The jobs of a removed
+// file are kept.
+func watchJobsYAML(path string) {
+	report := func() {
+		if err := syncJobsFromYAML(path); err != nil {
+			fmt.Printf("Error loading jobs file %s: %s\n", path, err)
+			recordEvent(defaultTenant, eventConfig, fmt.Sprintf("Jobs file %s not applied: %s", path, err))
+		}
+	}
+
+	applied := statJobsFile(path)
+	if applied.exists {
+		report()
+	}
+
+	interval := getEnvDuration("JOBS_FILE_POLL_INTERVAL", 2*time.Second)
+	go func() {
+		pending := applied
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			current := statJobsFile(path)
+			if current == applied {
+				pending = current
+				continue
+			}
+			if current != pending {
+				pending = current
+				continue
+			}
+			applied = current
+			if !current.exists {
+				fmt.Printf("Warning: jobs file %s was removed, its jobs are kept\n", path)
+				continue
+			}
+			report()
+		}
+	}()
+}
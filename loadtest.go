@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// Load test settings, set by command line flags. With -load-test N the
+// scheduler registers N synthetic jobs that run nothing, to measure how a
+// host copes with that many jobs before real ones are onboarded.
+var (
+	loadTestJobs      int
+	loadTestSchedules string
+)
+
+// Struct to hold the measurements of the current load test report interval
+type loadTestStats struct {
+	mu         sync.Mutex
+	triggers   int
+	lags       []time.Duration
+	batches    int
+	rows       int
+	writeTotal time.Duration
+	writeMax   time.Duration
+}
+
+// Measurements of the running load test, nil when no load test is running
+var loadTest *loadTestStats
+
+// Function to register the synthetic jobs of a load test and start reporting
+// on them. Schedules are a comma separated list of cron expressions, assigned
+// to the jobs in turn.
+func startLoadTest(c *cron.Cron, count int, schedules string) error {
+	var parsed []cron.Schedule
+	var exprs []string
+	for _, expr := range strings.Split(schedules, ",") {
+		expr = strings.TrimSpace(expr)
+		schedule, err := parseSchedule(expr)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, schedule)
+		exprs = append(exprs, expr)
+	}
+
+	loadTest = &loadTestStats{}
+	for i := 0; i < count; i++ {
+		j := Job{
+			Tenant:   defaultTenant,
+			Name:     fmt.Sprintf("loadtest-%05d", i+1),
+			CronExpr: exprs[i%len(exprs)],
+			Command:  "(load test, no command)",
+		}
+		schedule := parsed[i%len(parsed)]
+		id := c.Schedule(schedule, scheduledFunc(schedule, func(scheduledAt time.Time) {
+			runLoadTestJob(j, scheduledAt)
+		}))
+		registerInternalEntry(id, "loadtest", j.Name, j.CronExpr)
+	}
+
+	interval := getEnvDuration("LOAD_TEST_REPORT_INTERVAL", 10*time.Second)
+	go func() {
+		for range time.Tick(interval) {
+			reportLoadTest(interval)
+		}
+	}()
+	recordEvent("", eventScheduler, fmt.Sprintf("Load test: registered %d synthetic jobs on %s, reporting every %s",
+		count, strings.Join(exprs, " | "), interval))
+	return nil
+}
+
+// Function to record a trigger of a synthetic job. Its lag is measured and a
+// run status is queued like for a real run, so database writes are part of
+// the load.
+func runLoadTestJob(j Job, scheduledAt time.Time) {
+	lag := time.Since(scheduledAt)
+	loadTest.mu.Lock()
+	loadTest.triggers++
+	loadTest.lags = append(loadTest.lags, lag)
+	loadTest.mu.Unlock()
+
+	now := time.Now()
+	logJobStatusToDB(JobStatus{
+		UID:        uuid.New().String(),
+		Command:    j.Command,
+		Timestamp:  formatStorageTime(now),
+		Status:     "Load test",
+		Runner:     runnerName,
+		JobName:    j.Name,
+		DriftMs:    lag.Milliseconds(),
+		StartedAt:  formatStorageTime(now),
+		FinishedAt: formatStorageTime(now),
+		Tenant:     j.Tenant,
+	})
+}
+
+// Function to record how long writing a batch of run statuses took, while a
+// load test is running
+func observeLoadTestWrite(rows int, elapsed time.Duration) {
+	if loadTest == nil {
+		return
+	}
+	loadTest.mu.Lock()
+	defer loadTest.mu.Unlock()
+	loadTest.batches++
+	loadTest.rows += rows
+	loadTest.writeTotal += elapsed
+	if elapsed > loadTest.writeMax {
+		loadTest.writeMax = elapsed
+	}
+}
+
+// Function to log the measurements of the last interval and export them as
+// gauges on /metrics, then start a new interval
+func reportLoadTest(interval time.Duration) {
+	loadTest.mu.Lock()
+	stats := loadTestStats{triggers: loadTest.triggers, lags: loadTest.lags, batches: loadTest.batches,
+		rows: loadTest.rows, writeTotal: loadTest.writeTotal, writeMax: loadTest.writeMax}
+	loadTest.triggers, loadTest.lags, loadTest.batches, loadTest.rows = 0, nil, 0, 0
+	loadTest.writeTotal, loadTest.writeMax = 0, 0
+	loadTest.mu.Unlock()
+
+	sort.Slice(stats.lags, func(a, b int) bool { return stats.lags[a] < stats.lags[b] })
+	lagP50, lagP95, lagMax := quantile(stats.lags, 0.5), quantile(stats.lags, 0.95), quantile(stats.lags, 1)
+	var writeAvg time.Duration
+	if stats.batches > 0 {
+		writeAvg = stats.writeTotal / time.Duration(stats.batches)
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	logSchedulerEvent(fmt.Sprintf("Load test: %d jobs, %d triggers in %s, lag p50 %s p95 %s max %s, "+
+		"DB writes %d batches %d rows avg %s max %s, write queue %d, heap %.1f MiB, goroutines %d",
+		loadTestJobs, stats.triggers, interval, lagP50.Round(time.Microsecond), lagP95.Round(time.Microsecond), lagMax.Round(time.Microsecond),
+		stats.batches, stats.rows, writeAvg.Round(time.Microsecond), stats.writeMax.Round(time.Microsecond), len(writeQueue),
+		float64(mem.HeapAlloc)/(1<<20), runtime.NumGoroutine()))
+
+	setGauge(`gtask_loadtest_triggers_per_second`, float64(stats.triggers)/interval.Seconds())
+	setGauge(`gtask_loadtest_lag_seconds{quantile="0.5"}`, lagP50.Seconds())
+	setGauge(`gtask_loadtest_lag_seconds{quantile="0.95"}`, lagP95.Seconds())
+	setGauge(`gtask_loadtest_lag_seconds{quantile="1"}`, lagMax.Seconds())
+	setGauge(`gtask_loadtest_db_write_seconds{stat="avg"}`, writeAvg.Seconds())
+	setGauge(`gtask_loadtest_db_write_seconds{stat="max"}`, stats.writeMax.Seconds())
+	setGauge(`gtask_loadtest_write_queue_length`, float64(len(writeQueue)))
+	setGauge(`gtask_loadtest_heap_bytes`, float64(mem.HeapAlloc))
+	setGauge(`gtask_loadtest_goroutines`, float64(runtime.NumGoroutine()))
+}
+
+// Helper function to pick a quantile from sorted durations
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(q*float64(len(sorted)-1))]
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Struct to hold the recent failed sign-ins of an account or address
+type loginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// Failed sign-ins per account ("user:<tenant>/<name>") and per address ("ip:<address>")
+var (
+	loginThrottle   = make(map[string]*loginAttempts)
+	loginThrottleMu sync.Mutex
+)
+
+// Helper function to get the address a request came from, without its port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Function to get how much longer sign-ins are blocked for any of the keys
+func loginLockedFor(keys ...string) time.Duration {
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+
+	var wait time.Duration
+	for _, key := range keys {
+		if a, ok := loginThrottle[key]; ok {
+			wait = max(wait, time.Until(a.LockedUntil))
+		}
+	}
+	return wait
+}
+
+// Function to count a failed sign-in for a key. Once limit failures are
+// reached the key is locked out, for LOGIN_LOCKOUT at first and twice as
+// long with every further failure, up to LOGIN_LOCKOUT_MAX. The length of a
+// new lockout is returned, or zero if the key is not locked out.
+func recordLoginFailure(key string, limit int) time.Duration {
+	base := getEnvDuration("LOGIN_LOCKOUT", time.Minute)
+	ceiling := getEnvDuration("LOGIN_LOCKOUT_MAX", time.Hour)
+
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+
+	// Forget failures that are long past so the map does not grow without bound
+	now := time.Now()
+	for k, a := range loginThrottle {
+		if now.Sub(a.LastFailure) > ceiling && now.After(a.LockedUntil) {
+			delete(loginThrottle, k)
+		}
+	}
+
+	a, ok := loginThrottle[key]
+	if !ok {
+		a = &loginAttempts{}
+		loginThrottle[key] = a
+	}
+	a.Failures++
+	a.LastFailure = now
+	if a.Failures < limit {
+		return 0
+	}
+
+	lockout := ceiling
+	if shift := a.Failures - limit; shift < 30 {
+		lockout = min(base<<shift, ceiling)
+	}
+	a.LockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// Function to clear the failed sign-ins of keys after a successful sign-in
+func recordLoginSuccess(keys ...string) {
+	loginThrottleMu.Lock()
+	defer loginThrottleMu.Unlock()
+	for _, key := range keys {
+		delete(loginThrottle, key)
+	}
+}
+
+// Function to check a sign-in attempt, counting failures against the account
+// and the address it came from. Locked out accounts and addresses are turned
+// away without checking the password, so it cannot be guessed during the
+// lockout; how much longer the lockout lasts is returned then.
+func checkLogin(r *http.Request, tenant, username, password string) (bool, time.Duration) {
+	accountKey, ipKey := "user:"+jobKey(tenant, username), "ip:"+remoteIP(r)
+	if wait := loginLockedFor(accountKey, ipKey); wait > 0 {
+		return false, wait
+	}
+	if authenticate(tenant, username, password) {
+		recordLoginSuccess(accountKey, ipKey)
+		return true, 0
+	}
+
+	recordFailedLogin(r, tenant, username)
+	return false, 0
+}
+
+// Function to count a failed sign-in against the account and the address it
+// came from, recording lockouts in the audit log
+func recordFailedLogin(r *http.Request, tenant, username string) {
+	recordEvent(tenant, eventAuth, fmt.Sprintf("Failed sign-in for user %s from %s", username, r.RemoteAddr))
+	if lockout := recordLoginFailure("user:"+jobKey(tenant, username), getEnvInt("LOGIN_MAX_ATTEMPTS", 5)); lockout > 0 {
+		recordAuditEvent(tenant, username, "login_lockout",
+			fmt.Sprintf("account %s locked for %s after repeated failed sign-ins", username, lockout), remoteIP(r))
+	}
+	if lockout := recordLoginFailure("ip:"+remoteIP(r), getEnvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20)); lockout > 0 {
+		recordAuditEvent(tenant, username, "login_lockout",
+			fmt.Sprintf("address %s locked for %s after repeated failed sign-ins", remoteIP(r), lockout), remoteIP(r))
+	}
+}
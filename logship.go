@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Destination run records are shipped to, such as Loki or Elasticsearch
+type logShipper interface {
+	Name() string
+	Ship(batch []JobStatus) error
+}
+
+// Queue of run records waiting to be shipped, nil when shipping is off
+var (
+	shipQueue     chan JobStatus
+	shipQueueDone sync.WaitGroup
+	shipDropped   atomic.Int64 // records dropped because the queue was full
+)
+
+// Function to set up the log shippers from the LOKI_* and ELASTICSEARCH_*
+// settings. Returns none when neither URL is set.
+func newLogShippers() ([]logShipper, error) {
+	var shippers []logShipper
+	if base := getEnvString("LOKI_URL", ""); base != "" {
+		if err := checkShipURL("LOKI_URL", base); err != nil {
+			return nil, err
+		}
+		shippers = append(shippers, &lokiShipper{
+			pushURL:  strings.TrimSuffix(base, "/") + "/loki/api/v1/push",
+			username: getEnvString("LOKI_USERNAME", ""),
+			password: getEnvString("LOKI_PASSWORD", ""),
+			orgID:    getEnvString("LOKI_TENANT_ID", ""),
+		})
+	}
+	if base := getEnvString("ELASTICSEARCH_URL", ""); base != "" {
+		if err := checkShipURL("ELASTICSEARCH_URL", base); err != nil {
+			return nil, err
+		}
+		shippers = append(shippers, &elasticsearchShipper{
+			bulkURL:  strings.TrimSuffix(base, "/") + "/_bulk",
+			index:    getEnvString("ELASTICSEARCH_INDEX", "gtask-runs"),
+			apiKey:   getEnvString("ELASTICSEARCH_API_KEY", ""),
+			username: getEnvString("ELASTICSEARCH_USERNAME", ""),
+			password: getEnvString("ELASTICSEARCH_PASSWORD", ""),
+		})
+	}
+	return shippers, nil
+}
+
+// Helper function to check the URL of a log shipping destination
+func checkShipURL(setting, value string) error {
+	if u, err := url.Parse(value); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL", setting)
+	}
+	return nil
+}
+
+// Function to start the goroutine that ships run records. Records are sent in
+// batches of at most LOG_SHIP_BATCH_SIZE, gathered for up to LOG_SHIP_INTERVAL.
+// A batch a destination rejects is dropped and recorded as an integration event.
+func startLogShipping(shippers []logShipper) {
+	if len(shippers) == 0 {
+		return
+	}
+	batchSize := getEnvInt("LOG_SHIP_BATCH_SIZE", 100)
+	interval := getEnvDuration("LOG_SHIP_INTERVAL", 5*time.Second)
+
+	shipQueue = make(chan JobStatus, batchSize*10)
+	shipQueueDone.Add(1)
+	go func() {
+		defer shipQueueDone.Done()
+		for first := range shipQueue {
+			batch := []JobStatus{first}
+			timeout := time.After(interval)
+		collect:
+			for len(batch) < batchSize {
+				select {
+				case jobStatus, ok := <-shipQueue:
+					if !ok {
+						break collect
+					}
+					batch = append(batch, jobStatus)
+				case <-timeout:
+					break collect
+				}
+			}
+			for _, shipper := range shippers {
+				if err := shipper.Ship(batch); err != nil {
+					recordEvent("", eventIntegration, fmt.Sprintf("Error shipping %d run records to %s: %s", len(batch), shipper.Name(), err))
+				}
+			}
+		}
+	}()
+}
+
+// Function to stop log shipping once everything queued has been shipped
+func stopLogShipping() {
+	if shipQueue == nil {
+		return
+	}
+	close(shipQueue)
+	shipQueueDone.Wait()
+}
+
+// Function to queue a run record for shipping. Records are dropped rather
+// than holding up the run when the destinations cannot keep up.
+func shipRunRecord(jobStatus JobStatus) {
+	if shipQueue == nil {
+		return
+	}
+	select {
+	case shipQueue <- jobStatus:
+	default:
+		if dropped := shipDropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+			fmt.Printf("Error shipping run records: queue is full, %d records dropped\n", dropped)
+		}
+	}
+}
+
+// Function to build the record of a run as shipped, with at most
+// LOG_SHIP_OUTPUT_LIMIT bytes of output, and the time it is filed under
+func shippedRecord(s JobStatus) (runRecord, time.Time) {
+	at, err := time.Parse(storageTimeFormat, s.FinishedAt)
+	if err != nil {
+		at = time.Now()
+	}
+	return newRunRecord(s, getEnvInt("LOG_SHIP_OUTPUT_LIMIT", 65536)), at
+}
+
+// Shipper pushing run records to Grafana Loki, one stream per tenant, job and
+// status, with the record as JSON log line
+type lokiShipper struct {
+	pushURL  string
+	username string
+	password string
+	orgID    string // X-Scope-OrgID of multi-tenant Loki setups
+}
+
+func (l *lokiShipper) Name() string { return "Loki" }
+
+func (l *lokiShipper) Ship(batch []JobStatus) error {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := make(map[string]*stream)
+	var order []string
+	for _, s := range batch {
+		record, at := shippedRecord(s)
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		key := jobKey(s.Tenant, s.JobName) + "/" + s.Status
+		if streams[key] == nil {
+			streams[key] = &stream{Stream: map[string]string{
+				"service": "gtask",
+				"tenant":  s.Tenant,
+				"job":     s.JobName,
+				"status":  s.Status,
+				"runner":  s.Runner,
+			}}
+			order = append(order, key)
+		}
+		streams[key].Values = append(streams[key].Values, [2]string{strconv.FormatInt(at.UnixNano(), 10), string(line)})
+	}
+	push := struct {
+		Streams []*stream `json:"streams"`
+	}{}
+	for _, key := range order {
+		push.Streams = append(push.Streams, streams[key])
+	}
+
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, l.pushURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.username != "" {
+		req.SetBasicAuth(l.username, l.password)
+	}
+	if l.orgID != "" {
+		req.Header.Set("X-Scope-OrgID", l.orgID)
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Shipper indexing run records in Elasticsearch through the bulk API, with
+// the run's UID as document ID so that resent records do not duplicate
+type elasticsearchShipper struct {
+	bulkURL  string
+	index    string
+	apiKey   string
+	username string
+	password string
+}
+
+func (e *elasticsearchShipper) Name() string { return "Elasticsearch" }
+
+func (e *elasticsearchShipper) Ship(batch []JobStatus) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, s := range batch {
+		record, at := shippedRecord(s)
+		action := map[string]any{"index": map[string]string{"_index": e.index, "_id": s.UID}}
+		document := struct {
+			Timestamp string `json:"@timestamp"`
+			runRecord
+		}{at.UTC().Format(time.RFC3339Nano), record}
+		if err := encoder.Encode(action); err != nil {
+			return err
+		}
+		if err := encoder.Encode(document); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.bulkURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	switch {
+	case e.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.apiKey)
+	case e.username != "":
+		req.SetBasicAuth(e.username, e.password)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("answered %s", resp.Status)
+	}
+	// The bulk API answers 200 even when single documents fail
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error *struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || !result.Errors {
+		return nil
+	}
+	failed, reason := 0, ""
+	for _, item := range result.Items {
+		for _, outcome := range item {
+			if outcome.Error != nil {
+				failed++
+				reason = outcome.Error.Reason
+			}
+		}
+	}
+	return fmt.Errorf("%d of %d records were rejected: %s", failed, len(batch), reason)
+}
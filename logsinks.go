@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/syslog"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Socket of the systemd journal's native protocol
+const journalSocketPath = "/run/systemd/journal/socket"
+
+// Longest message sent to the journal, longer ones keep their start
+const maxJournalMessage = 64 * 1024
+
+// Destinations of the scheduler log besides the terminal, set from LOG_OUTPUT
+var (
+	logToFile     = true
+	syslogWriter  *syslog.Writer
+	journalSocket *net.UnixConn
+)
+
+// Function to parse LOG_OUTPUT, a comma separated list of file, syslog and journald
+func parseLogOutputs(value string) (map[string]bool, error) {
+	outputs := make(map[string]bool)
+	for _, output := range strings.Split(value, ",") {
+		output = strings.TrimSpace(output)
+		switch output {
+		case "":
+		case "file", "syslog", "journald":
+			outputs[output] = true
+		default:
+			return nil, fmt.Errorf("unknown log output %q, expected file, syslog or journald", output)
+		}
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no log output given")
+	}
+	return outputs, nil
+}
+
+// Function to open the log destinations named by LOG_OUTPUT. Syslog is the
+// local daemon unless SYSLOG_ADDRESS names a remote one, such as
+// udp://logs.example.com:514. When no destination can be opened, the log file
+// is written so that the log is not lost.
+func initLogOutputs() error {
+	outputs, err := parseLogOutputs(getEnvString("LOG_OUTPUT", "file"))
+	if err != nil {
+		return err
+	}
+	logToFile = outputs["file"]
+
+	var errs []string
+	if outputs["syslog"] {
+		if syslogWriter, err = dialSyslog(getEnvString("SYSLOG_ADDRESS", ""), getEnvString("SYSLOG_TAG", "gtask")); err != nil {
+			errs = append(errs, fmt.Sprintf("syslog: %s", err))
+		}
+	}
+	if outputs["journald"] {
+		if journalSocket, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocketPath, Net: "unixgram"}); err != nil {
+			errs = append(errs, fmt.Sprintf("journald: %s", err))
+		}
+	}
+	if !logToFile && syslogWriter == nil && journalSocket == nil {
+		logToFile = true
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Helper function to connect to the local or a remote syslog daemon
+func dialSyslog(address, tag string) (*syslog.Writer, error) {
+	if address == "" {
+		return syslog.New(syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	}
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return nil, fmt.Errorf("invalid SYSLOG_ADDRESS %q, expected udp://host:port or tcp://host:port", address)
+	}
+	return syslog.Dial(u.Scheme, u.Host, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+}
+
+// Function to close the log destinations opened by initLogOutputs
+func closeLogOutputs() {
+	if syslogWriter != nil {
+		syslogWriter.Close()
+	}
+	if journalSocket != nil {
+		journalSocket.Close()
+	}
+}
+
+// Function to write a line of the scheduler log to its destinations, with
+// the syslog severity of what it reports. Fields, such as GTASK_JOB, are
+// attached to journal entries. Syslog and the journal timestamp entries
+// themselves, so they get the line without its leading [timestamp]. Returns
+// the error writing the log file; the others are printed. Callers hold mu.
+func writeLogLine(line string, severity syslog.Priority, fields map[string]string) error {
+	var err error
+	if logToFile && logFile != nil {
+		_, err = logFile.WriteString(line)
+	}
+	if syslogWriter == nil && journalSocket == nil {
+		return err
+	}
+
+	message := strings.TrimRight(line, "\n")
+	if strings.HasPrefix(message, "[") {
+		if _, rest, ok := strings.Cut(message, "] "); ok {
+			message = rest
+		}
+	}
+	if syslogWriter != nil {
+		if syslogErr := writeSyslog(message, severity); syslogErr != nil {
+			fmt.Printf("Error writing to syslog: %s\n", syslogErr)
+		}
+	}
+	if journalSocket != nil {
+		if journalErr := writeJournal(message, severity, fields); journalErr != nil {
+			fmt.Printf("Error writing to journald: %s\n", journalErr)
+		}
+	}
+	return err
+}
+
+// Helper function to send a message to syslog with the given severity
+func writeSyslog(message string, severity syslog.Priority) error {
+	switch severity {
+	case syslog.LOG_CRIT:
+		return syslogWriter.Crit(message)
+	case syslog.LOG_ERR:
+		return syslogWriter.Err(message)
+	case syslog.LOG_WARNING:
+		return syslogWriter.Warning(message)
+	case syslog.LOG_NOTICE:
+		return syslogWriter.Notice(message)
+	}
+	return syslogWriter.Info(message)
+}
+
+// Helper function to send an entry to the journal over its native protocol.
+// Values holding line breaks are sent length-prefixed, as the protocol requires.
+func writeJournal(message string, severity syslog.Priority, fields map[string]string) error {
+	if len(message) > maxJournalMessage {
+		message = message[:maxJournalMessage]
+	}
+	var entry bytes.Buffer
+	writeField := func(key, value string) {
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&entry, "%s=%s\n", key, value)
+			return
+		}
+		entry.WriteString(key + "\n")
+		binary.Write(&entry, binary.LittleEndian, uint64(len(value)))
+		entry.WriteString(value + "\n")
+	}
+	writeField("MESSAGE", message)
+	writeField("PRIORITY", fmt.Sprint(int(severity)))
+	writeField("SYSLOG_IDENTIFIER", getEnvString("SYSLOG_TAG", "gtask"))
+	for key, value := range fields {
+		writeField(key, value)
+	}
+	_, err := journalSocket.Write(entry.Bytes())
+	return err
+}
+
+// Function to map a notification level to a syslog severity
+func notificationSeverity(level string) syslog.Priority {
+	switch level {
+	case "critical":
+		return syslog.LOG_CRIT
+	case "warning":
+		return syslog.LOG_WARNING
+	}
+	return syslog.LOG_INFO
+}
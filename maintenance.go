@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Function to schedule the internal database maintenance job. It runs on the
+// DB_MAINTENANCE_SCHEDULE cron expression (nightly at 03:00 by default).
+func scheduleMaintenance(c *cron.Cron) {
+	schedule := os.Getenv("DB_MAINTENANCE_SCHEDULE")
+	if schedule == "" {
+		schedule = "0 3 * * *"
+	}
+
+	id, err := c.AddFunc(schedule, runDatabaseMaintenance)
+	if err != nil {
+		fmt.Printf("Error scheduling database maintenance: %s\n", err)
+		return
+	}
+	registerInternalEntry(id, "maintenance", "database maintenance", schedule)
+	fmt.Printf("Scheduled database maintenance with cron expression: %s\n", schedule)
+}
+
+// Function to check the database for corruption, delete old runs and events
+// and hand free pages back to the filesystem, reporting problems through the
+// notifiers
+func runDatabaseMaintenance() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		notify("critical", "Database integrity check failed", err.Error())
+		return
+	}
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			problems = append(problems, err.Error())
+			break
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	rows.Close()
+	if len(problems) > 0 {
+		notify("critical", "Database integrity check found problems", strings.Join(problems, "\n"))
+	}
+
+	pruneOldRuns()
+	pruneEvents()
+
+	// Incremental vacuum only works once auto_vacuum is INCREMENTAL (2), which
+	// an existing database only picks up after a full VACUUM
+	var autoVacuum int
+	if err := db.QueryRow(`PRAGMA auto_vacuum`).Scan(&autoVacuum); err != nil {
+		notify("warning", "Database vacuum failed", err.Error())
+		return
+	}
+	if autoVacuum != 2 {
+		if _, err := db.Exec(`PRAGMA auto_vacuum = INCREMENTAL`); err == nil {
+			_, err = db.Exec(`VACUUM`)
+		}
+		if err != nil {
+			notify("warning", "Database vacuum failed", err.Error())
+		}
+		return
+	}
+	if _, err := db.Exec(`PRAGMA incremental_vacuum`); err != nil {
+		notify("warning", "Database vacuum failed", err.Error())
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// How often the memory usage of a limited job is sampled
+const memoryPollInterval = 250 * time.Millisecond
+
+// Function to parse a memory size such as "512M", "2G" or a plain byte count
+func parseMemorySize(size string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.ToUpper(size)
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid memory size %q, expected e.g. 512M", size)
+	}
+	return n * multiplier, nil
+}
+
+// Function to sum the resident memory of every process in a process group
+func processGroupRSS(pgid int) int64 {
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	pageSize := int64(os.Getpagesize())
+
+	var total int64
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces, so split after its closing paren
+		end := strings.LastIndexByte(string(data), ')')
+		if end == -1 {
+			continue
+		}
+		fields := strings.Fields(string(data)[end+1:])
+		// fields[0] is the state (field 3), so pgrp is fields[2] and rss fields[21]
+		if len(fields) < 22 || fields[2] != strconv.Itoa(pgid) {
+			continue
+		}
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		total += rss * pageSize
+	}
+	return total
+}
+
+// Function to kill a job's process group once it uses more than limit bytes.
+// The returned stop function ends the watch and reports whether it fired.
+func watchMemory(pgid int, limit int64) func() bool {
+	var killed atomic.Bool
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(memoryPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if processGroupRSS(pgid) > limit {
+					killed.Store(true)
+					syscall.Kill(-pgid, syscall.SIGKILL)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() bool {
+		close(done)
+		return killed.Load()
+	}
+}
+
+// Error recorded when a job is killed for exceeding its memory limit, or by
+// the kernel OOM killer when limit is empty
+type oomError struct {
+	limit string
+}
+
+func (e *oomError) Error() string {
+	if e.limit == "" {
+		return "killed by the kernel OOM killer"
+	}
+	return fmt.Sprintf("killed for exceeding memory limit of %s", e.limit)
+}
+
+// Function to tell whether a finished command was killed with SIGKILL, which
+// is how the kernel OOM killer ends a process, but also how cancelled runs
+// that ignore SIGTERM and kill -9 end one
+func killedBySIGKILL(state *os.ProcessState) bool {
+	if state == nil {
+		return false
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGKILL
+}
+
+// Function to read how many processes the kernel OOM killer has killed in the
+// scheduler's cgroup, from the oom_kill counter of its memory.events file.
+// Returns false when the counter cannot be read, such as outside cgroup v2.
+func cgroupOOMKills() (int64, bool) {
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// The cgroup v2 hierarchy is the line with ID 0 and no controllers
+		path, ok := strings.CutPrefix(line, "0::")
+		if !ok {
+			continue
+		}
+		events, err := os.ReadFile(filepath.Join("/sys/fs/cgroup", path, "memory.events"))
+		if err != nil {
+			return 0, false
+		}
+		for _, event := range strings.Split(string(events), "\n") {
+			if count, ok := strings.CutPrefix(event, "oom_kill "); ok {
+				n, err := strconv.ParseInt(count, 10, 64)
+				return n, err == nil
+			}
+		}
+	}
+	return 0, false
+}
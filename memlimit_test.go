@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Helper function to wait until a tenant has a command running, returning
+// false if none started within a few seconds
+func waitForRunningRun(tenant string) bool {
+	for deadline := time.Now().Add(5 * time.Second); len(runningRuns(tenant)) == 0; {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// Job whose command only ends with SIGKILL, as it ignores SIGTERM
+func stubbornJob() Job {
+	return Job{Name: "stubborn", Tenant: defaultTenant, Command: "trap '' TERM; sleep 10", MemLimit: "1G", Concurrency: concurrencyReplace}
+}
+
+func TestKillIsNotReportedAsOOM(t *testing.T) {
+	j := Job{Name: "suicide", Tenant: defaultTenant, Command: "kill -9 $$", MemLimit: "1G"}
+	_, err := runCommand(j, nil, "kill-9")
+	var oom *oomError
+	if err == nil || errors.As(err, &oom) {
+		t.Errorf("runCommand error = %v, want a plain failure", err)
+	}
+}
+
+func TestCancelIsNotReportedAsOOM(t *testing.T) {
+	openTestDatabase(t)
+	t.Setenv("RUN_CANCEL_GRACE", "100ms")
+	go func() {
+		waitForRunningRun(defaultTenant)
+		cancelRun(defaultTenant, "cancelled", "alice")
+	}()
+
+	_, err := runCommand(stubbornJob(), nil, "cancelled")
+	var cancelled *cancelledError
+	if !errors.As(err, &cancelled) || cancelled.by != "alice" {
+		t.Errorf("runCommand error = %v, want cancelled by alice", err)
+	}
+}
+
+func TestReplaceIsNotReportedAsOOM(t *testing.T) {
+	openTestDatabase(t)
+	t.Setenv("RUN_CANCEL_GRACE", "100ms")
+	j := stubbornJob()
+
+	first, _ := claimJobRun(j)
+	result := make(chan error, 1)
+	go func() {
+		_, err := runCommand(j, nil, "replaced")
+		releaseJobRun(j, first)
+		result <- err
+	}()
+	if !waitForRunningRun(defaultTenant) {
+		t.Fatal("command did not start")
+	}
+
+	second, ok := claimJobRun(j)
+	if !ok {
+		t.Fatal("new run was not started")
+	}
+	defer releaseJobRun(j, second)
+
+	err := <-result
+	var cancelled *cancelledError
+	if !errors.As(err, &cancelled) {
+		t.Errorf("replaced run error = %v, want it cancelled by the new run", err)
+	}
+}
+
+func TestMemoryWatchReportsOOM(t *testing.T) {
+	j := Job{Name: "hungry", Tenant: defaultTenant, Command: "sleep 5", MemLimit: "1K"}
+	_, err := runCommand(j, nil, "hungry")
+	var oom *oomError
+	if !errors.As(err, &oom) || oom.limit != "1K" {
+		t.Errorf("runCommand error = %v, want killed for exceeding 1K", err)
+	}
+}
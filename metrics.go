@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Gauges exposed on /metrics in the Prometheus text format
+var (
+	gauges   = make(map[string]float64)
+	gaugesMu sync.Mutex
+)
+
+// Function to set the current value of a gauge
+func setGauge(name string, value float64) {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+	gauges[name] = value
+}
+
+// Handler for exposing metrics to Prometheus
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	gaugesMu.Lock()
+	defer gaugesMu.Unlock()
+
+	names := make([]string, 0, len(gauges))
+	for name := range gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s %g\n", name, gauges[name])
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct to hold a scheduled run the watchdog found no trace of
+type missedRun struct {
+	Name        string `json:"name"`
+	ScheduledAt string `json:"scheduled_at"`
+	DetectedAt  string `json:"detected_at"`
+	tenant      string
+}
+
+// Jobs whose latest due run went missing, keyed by jobKey, and how far each
+// job's schedule was checked, keyed by job ID, both guarded by missedRunsMu
+var (
+	missedRunAlerts = make(map[string]missedRun)
+	missedChecked   = make(map[int64]time.Time)
+	missedRunsMu    sync.Mutex
+)
+
+// Function to start the watchdog that compares each job's schedule with the
+// job_status table and alerts when a run that was due left no row within
+// MISSED_RUN_GRACE, catching triggers the scheduler silently dropped
+func startMissedRunWatchdog() {
+	grace := getEnvDuration("MISSED_RUN_GRACE", 5*time.Minute)
+	if grace <= 0 {
+		return
+	}
+	interval := getEnvDuration("MISSED_RUN_CHECK_INTERVAL", time.Minute)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			checkMissedRuns(now, grace)
+		}
+	}()
+}
+
+// Function to check the runs due since the previous check, up to the grace
+// period ago. A job is only alerted about once until one of its runs shows up again.
+func checkMissedRuns(now time.Time, grace time.Duration) {
+	jobsMu.RLock()
+	var watched []Job
+	for _, entry := range registered {
+		if entry.Err == nil && !entry.Disabled {
+			watched = append(watched, jobs[jobKey(entry.Job.Tenant, entry.Job.Name)])
+		}
+	}
+	jobsMu.RUnlock()
+
+	seen := make(map[int64]bool, len(watched))
+	for _, j := range watched {
+		seen[j.ID] = true
+		deadline := now.Add(-grace - j.Jitter)
+
+		missedRunsMu.Lock()
+		from, ok := missedChecked[j.ID]
+		if !ok || deadline.After(from) {
+			missedChecked[j.ID] = deadline
+		}
+		missedRunsMu.Unlock()
+		// Jobs are watched from the first check that sees them
+		if !ok || !deadline.After(from) {
+			continue
+		}
+
+		due := lastDueRun(j, from, deadline)
+		if due.IsZero() {
+			continue
+		}
+		accounted, err := runRecordedSince(j, due)
+		if err != nil {
+			fmt.Printf("Error checking missed runs of job %s: %s\n", j.Name, err)
+			continue
+		}
+		updateMissedRun(j, due, accounted, now, grace)
+	}
+
+	missedRunsMu.Lock()
+	for id := range missedChecked {
+		if !seen[id] {
+			delete(missedChecked, id)
+		}
+	}
+	missedRunsMu.Unlock()
+}
+
+// Function to get the latest time in (from, until] at which a job was due to
+// run, the zero time if it was not due
+func lastDueRun(j Job, from, until time.Time) time.Time {
+	var due time.Time
+	for t := nextScheduledRun(j, from); !t.IsZero() && !t.After(until); t = nextScheduledRun(j, t) {
+		due = t
+	}
+	return due
+}
+
+// Function to tell whether a run of a job was recorded at or after a time,
+// or one is still in progress and will be recorded when it finishes
+func runRecordedSince(j Job, t time.Time) (bool, error) {
+	activeJobRunsMu.Lock()
+	running := len(activeJobRuns[jobKey(j.Tenant, j.Name)]) > 0
+	activeJobRunsMu.Unlock()
+	if running {
+		return true, nil
+	}
+
+	recorded, found, err := storage.LatestRunAt(j.Tenant, j.Name)
+	if err != nil || !found {
+		return false, err
+	}
+	return !recorded.Before(t.Truncate(time.Second)), nil
+}
+
+// Function to raise or clear a job's missed run alert
+func updateMissedRun(j Job, due time.Time, accounted bool, now time.Time, grace time.Duration) {
+	key := jobKey(j.Tenant, j.Name)
+
+	missedRunsMu.Lock()
+	_, alerted := missedRunAlerts[key]
+	if accounted {
+		delete(missedRunAlerts, key)
+	} else {
+		missedRunAlerts[key] = missedRun{Name: j.Name, ScheduledAt: formatStorageTime(due), DetectedAt: formatStorageTime(now), tenant: j.Tenant}
+	}
+	missedRunsMu.Unlock()
+
+	switch {
+	case accounted && alerted:
+		recordEvent(j.Tenant, eventJob, fmt.Sprintf("Job %s is running on schedule again", j.Name))
+	case !accounted && !alerted:
+		message := fmt.Sprintf("Job %s of tenant %s was due at %s but no run was recorded within %s", j.Name, j.Tenant, formatStorageTime(due), grace)
+		recordEvent(j.Tenant, eventJob, message)
+		notifyTenant(j.Tenant, "warning", fmt.Sprintf("Missed run of job %s", j.Name), message)
+	}
+}
+
+// Function to list the jobs of a tenant with a missed run, by name
+func listMissedRuns(tenant string) []missedRun {
+	missedRunsMu.Lock()
+	defer missedRunsMu.Unlock()
+
+	list := []missedRun{}
+	for _, m := range missedRunAlerts {
+		if m.tenant == tenant {
+			list = append(list, m)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	return list
+}
+
+// Helper function to tell whether a job of a tenant has a missed run
+func hasMissedRun(tenant, name string) bool {
+	missedRunsMu.Lock()
+	defer missedRunsMu.Unlock()
+	_, ok := missedRunAlerts[jobKey(tenant, name)]
+	return ok
+}
+
+// Helper function to render the dashboard banner listing jobs with a missed run
+func missedRunBanner(r *http.Request) string {
+	list := listMissedRuns(requestTenant(r))
+	if len(list) == 0 {
+		return ""
+	}
+	var items strings.Builder
+	for _, m := range list {
+		fmt.Fprintf(&items, `<li><strong>%s</strong> was due at %s</li>`, html.EscapeString(m.Name), m.ScheduledAt)
+	}
+	return fmt.Sprintf(`<div class="alert alert-warning">
+	            <strong>%d job(s) missed a run:</strong> no run was recorded for them after they were due.
+	            <ul class="mb-1">%s</ul>
+	            <a href="%s" class="alert-link">Open events</a>
+	        </div>`, len(list), items.String(), tenantURL(r, "/events"))
+}
+
+// Handler for GET /api/v1/jobs/missed, listing the tenant's jobs with a missed run
+func apiMissedRunsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, listMissedRuns(requestTenant(r)))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Day names understood in schedule phrases, by their cron day of the week
+var naturalWeekdays = map[string]int{
+	"sunday": 0, "sun": 0, "monday": 1, "mon": 1, "tuesday": 2, "tue": 2, "tues": 2,
+	"wednesday": 3, "wed": 3, "thursday": 4, "thu": 4, "thurs": 4, "friday": 5, "fri": 5,
+	"saturday": 6, "sat": 6,
+}
+
+var (
+	naturalIntervalPattern = regexp.MustCompile(`^every (\d+ )?(second|minute|hour)s?$`)
+	naturalTimePattern     = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))? ?(am|pm)?$`)
+	naturalDayOfMonth      = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?$`)
+)
+
+// Function to resolve what a user typed as a job's schedule: a cron
+// expression or descriptor is used as it is, anything else is read as a
+// phrase such as "every weekday at 6pm". Returns the cron expression and the
+// phrase it was derived from, empty for cron expressions.
+func resolveSchedule(input string) (string, string, error) {
+	input = strings.Join(strings.Fields(input), " ")
+	if input == "" {
+		return "", "", fmt.Errorf("missing schedule")
+	}
+	_, cronErr := parseSchedule(input)
+	if cronErr == nil {
+		return input, "", nil
+	}
+	expr, err := parseNaturalSchedule(input)
+	if err == nil {
+		return expr, input, nil
+	}
+	if first := input[0]; first == '*' || first == '@' || first >= '0' && first <= '9' {
+		return "", "", cronErr
+	}
+	return "", "", err
+}
+
+// Function to convert a schedule phrase into a cron expression. Understood
+// are phrases like "every 15 minutes", "every 2 hours", "every 30 seconds",
+// "every day at 6:30pm", "daily at noon", "every weekday at 6pm", "every
+// weekend at 10am", "every monday and thursday at 9am", "every month on the
+// 1st at 02:00", and "hourly", "weekly" or "monthly".
+func parseNaturalSchedule(phrase string) (string, error) {
+	text := strings.ToLower(strings.Join(strings.Fields(phrase), " "))
+	text = strings.TrimPrefix(text, "run ")
+	unknown := fmt.Errorf("cannot understand schedule %q, use a cron expression or a phrase such as \"every weekday at 6pm\" or \"every 15 minutes\"", phrase)
+
+	if m := naturalIntervalPattern.FindStringSubmatch(text); m != nil {
+		n := 1
+		if m[1] != "" {
+			n, _ = strconv.Atoi(strings.TrimSpace(m[1]))
+		}
+		switch m[2] {
+		case "second":
+			if n < 1 || n > 59 {
+				return "", fmt.Errorf("every %d seconds is not possible, use 1 to 59 seconds", n)
+			}
+			return everyField(n) + " * * * * *", nil
+		case "minute":
+			if n < 1 || n > 59 {
+				return "", fmt.Errorf("every %d minutes is not possible, use 1 to 59 minutes", n)
+			}
+			return everyField(n) + " * * * *", nil
+		default:
+			if n < 1 || n > 23 {
+				return "", fmt.Errorf("every %d hours is not possible, use 1 to 23 hours", n)
+			}
+			return "0 " + everyField(n) + " * * *", nil
+		}
+	}
+
+	// The time of day defaults to midnight
+	minute, hour := 0, 0
+	if base, at, ok := strings.Cut(text, " at "); ok {
+		var err error
+		if minute, hour, err = parseNaturalTime(at); err != nil {
+			return "", err
+		}
+		text = base
+	}
+
+	dayOfMonth := "1"
+	if base, on, ok := strings.Cut(text, " on the "); ok {
+		m := naturalDayOfMonth.FindStringSubmatch(on)
+		if m == nil {
+			return "", unknown
+		}
+		if day, _ := strconv.Atoi(m[1]); day < 1 || day > 31 {
+			return "", fmt.Errorf("day %d of the month is not possible", day)
+		}
+		dayOfMonth, text = m[1], base
+		if text != "every month" && text != "monthly" {
+			return "", unknown
+		}
+	}
+
+	timeFields := fmt.Sprintf("%d %d", minute, hour)
+	switch text {
+	case "hourly":
+		return fmt.Sprintf("%d * * * *", minute), nil
+	case "every day", "daily", "every night", "nightly":
+		return timeFields + " * * *", nil
+	case "every weekday", "weekdays", "on weekdays":
+		return timeFields + " * * 1-5", nil
+	case "every weekend", "weekends", "on weekends":
+		return timeFields + " * * 0,6", nil
+	case "every week", "weekly":
+		return timeFields + " * * 0", nil
+	case "every month", "monthly":
+		return timeFields + " " + dayOfMonth + " * *", nil
+	}
+
+	days, ok := strings.CutPrefix(text, "every ")
+	if !ok {
+		days, ok = strings.CutPrefix(text, "on ")
+	}
+	if !ok {
+		return "", unknown
+	}
+	var numbers []string
+	for _, name := range strings.FieldsFunc(strings.ReplaceAll(days, " and ", ","), func(r rune) bool { return r == ',' || r == ' ' }) {
+		day, ok := naturalWeekdays[strings.TrimSuffix(name, "s")]
+		if !ok {
+			day, ok = naturalWeekdays[name]
+		}
+		if !ok {
+			return "", unknown
+		}
+		numbers = append(numbers, strconv.Itoa(day))
+	}
+	if len(numbers) == 0 {
+		return "", unknown
+	}
+	return timeFields + " * * " + strings.Join(numbers, ","), nil
+}
+
+// Function to parse a time of day in a schedule phrase, such as "6pm",
+// "6:30 am", "18:00", "noon" or "midnight", returning the minute and the hour
+func parseNaturalTime(text string) (int, int, error) {
+	switch text {
+	case "noon", "midday":
+		return 0, 12, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+	m := naturalTimePattern.FindStringSubmatch(text)
+	if m == nil {
+		return 0, 0, fmt.Errorf("cannot understand the time %q, expected e.g. 6pm, 6:30pm or 18:30", text)
+	}
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	switch m[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, fmt.Errorf("invalid time %q", text)
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid time %q", text)
+	}
+	return minute, hour, nil
+}
+
+// Helper function to get the cron field for every n units
+func everyField(n int) string {
+	if n == 1 {
+		return "*"
+	}
+	return "*/" + strconv.Itoa(n)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNaturalSchedule(t *testing.T) {
+	tests := []struct {
+		phrase string
+		want   string
+	}{
+		{"every minute", "* * * * *"},
+		{"every 15 minutes", "*/15 * * * *"},
+		{"every 30 seconds", "*/30 * * * * *"},
+		{"every 2 hours", "0 */2 * * *"},
+		{"hourly", "0 * * * *"},
+		{"daily", "0 0 * * *"},
+		{"every day at 6:30pm", "30 18 * * *"},
+		{"Daily at  noon", "0 12 * * *"},
+		{"every night at midnight", "0 0 * * *"},
+		{"every weekday at 6pm", "0 18 * * 1-5"},
+		{"every weekend at 10am", "0 10 * * 0,6"},
+		{"weekly", "0 0 * * 0"},
+		{"every monday and thursday at 9am", "0 9 * * 1,4"},
+		{"on mondays, wednesdays at 07:15", "15 7 * * 1,3"},
+		{"every month on the 1st at 02:00", "0 2 1 * *"},
+		{"monthly on the 15th", "0 0 15 * *"},
+		{"run every 5 minutes", "*/5 * * * *"},
+		{"every day at 12am", "0 0 * * *"},
+	}
+	for _, tt := range tests {
+		got, err := parseNaturalSchedule(tt.phrase)
+		if err != nil {
+			t.Errorf("parseNaturalSchedule(%q) failed: %s", tt.phrase, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseNaturalSchedule(%q) = %q, want %q", tt.phrase, got, tt.want)
+		}
+	}
+}
+
+func TestParseNaturalScheduleErrors(t *testing.T) {
+	tests := []struct {
+		phrase string
+		want   string
+	}{
+		{"every 60 minutes", "every 60 minutes is not possible"},
+		{"every 0 seconds", "every 0 seconds is not possible"},
+		{"every 24 hours", "every 24 hours is not possible"},
+		{"every day at 25:00", `invalid time "25:00"`},
+		{"every day at 13pm", `invalid time "13pm"`},
+		{"every day at teatime", `cannot understand the time "teatime"`},
+		{"every month on the 32nd", "day 32 of the month is not possible"},
+		{"every week on the 1st", "cannot understand schedule"},
+		{"every blue moon", "cannot understand schedule"},
+		{"sometimes", "cannot understand schedule"},
+	}
+	for _, tt := range tests {
+		_, err := parseNaturalSchedule(tt.phrase)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseNaturalSchedule(%q) error = %v, want %q", tt.phrase, err, tt.want)
+		}
+	}
+}
+
+func TestResolveSchedule(t *testing.T) {
+	tests := []struct {
+		input  string
+		expr   string
+		phrase string
+		err    string
+	}{
+		{"*/5 * * * *", "*/5 * * * *", "", ""},
+		{"@daily", "@daily", "", ""},
+		{"  every weekday   at 6pm ", "0 18 * * 1-5", "every weekday at 6pm", ""},
+		{"", "", "", "missing schedule"},
+		{"61 * * * *", "", "", "invalid cron expression"},
+		{"@fortnightly", "", "", "invalid cron expression"},
+		{"whenever", "", "", "cannot understand schedule"},
+	}
+	for _, tt := range tests {
+		expr, phrase, err := resolveSchedule(tt.input)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolveSchedule(%q) error = %v, want %q", tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || expr != tt.expr || phrase != tt.phrase {
+			t.Errorf("resolveSchedule(%q) = %q, %q, %v; want %q, %q", tt.input, expr, phrase, err, tt.expr, tt.phrase)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Struct to hold a notification raised by the scheduler
+type Notification struct {
+	Level   string // "info", "warning" or "critical"
+	Subject string
+	Message string
+	Time    time.Time
+	Run     *JobStatus // the run the notification is about, nil for scheduler notifications
+	Tenant  string     // tenant the notification is about, empty for the whole scheduler
+}
+
+// Severity of the notification levels, for channels with a minimum level
+var notificationLevels = map[string]int{"info": 0, "warning": 1, "critical": 2}
+
+// Interface implemented by every notification channel
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// Registered notification channels: the deployment-wide ones, and those of
+// tenants with notification settings of their own
+var (
+	notifiers       []Notifier
+	tenantNotifiers = make(map[string][]Notifier)
+	notifiersMu     sync.RWMutex
+)
+
+// Function to add a notification channel
+func registerNotifier(n Notifier) {
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers = append(notifiers, n)
+}
+
+// Function to build the notification channels of a tenant, or the
+// deployment-wide ones for an empty tenant: the log, and email and Slack
+// when they are configured
+func newNotifiers(tenant string) []Notifier {
+	channels := []Notifier{logNotifier{}}
+	if email, ok, err := newEmailNotifier(tenant); err != nil {
+		fmt.Printf("Error configuring email notifications%s: %s\n", ofTenant(tenant), err)
+	} else if ok {
+		channels = append(channels, email)
+	}
+	if slack, ok, err := newSlackNotifier(tenant); err != nil {
+		fmt.Printf("Error configuring Slack notifications%s: %s\n", ofTenant(tenant), err)
+	} else if ok {
+		channels = append(channels, slack)
+	}
+	return channels
+}
+
+// Helper function to name a tenant in a message, if there is one
+func ofTenant(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+	return " of tenant " + tenant
+}
+
+// Function to set up the notification channels once the tenants are loaded.
+// Tenants with TENANT_<NAME>_SMTP_* or TENANT_<NAME>_SLACK_* settings get
+// channels of their own, taking the settings they do not override from the
+// deployment-wide ones; the other tenants share the deployment-wide channels.
+func registerNotifiers() {
+	for _, n := range newNotifiers("") {
+		registerNotifier(n)
+	}
+	for tenant := range tenants {
+		if hasTenantSettings(tenant, "SMTP_", "SLACK_", "NOTIFY_TEMPLATE") {
+			channels := newNotifiers(tenant)
+			notifiersMu.Lock()
+			tenantNotifiers[tenant] = channels
+			notifiersMu.Unlock()
+		}
+	}
+}
+
+// Function to send a notification about the whole scheduler to every
+// deployment-wide channel
+func notify(level, subject, message string) {
+	send(Notification{Level: level, Subject: subject, Message: message, Time: time.Now()})
+}
+
+// Function to send a notification about a tenant to the tenant's channels
+func notifyTenant(tenant, level, subject, message string) {
+	send(Notification{Level: level, Subject: subject, Message: message, Time: time.Now(), Tenant: tenant})
+}
+
+// Function to notify the result of a run of a job: a warning with its
+// command, time and the end of its output, at most NOTIFY_OUTPUT_LIMIT bytes,
+// when it failed, and an info notification when it succeeded. Jobs with
+// notify=digest are left to the digest.
+func notifyRunResult(j Job, s JobStatus) {
+	if j.Notify == notifyDigest || j.Notify == notifyNone {
+		return
+	}
+	details := fmt.Sprintf("Command: %s\nFinished: %s\nDuration: %s\nRun: %s (run #%d, attempt %d)", s.Command, displayStorageTime(s.Timestamp, time.Local), runDuration(s), s.UID, s.RunNumber, s.Attempt)
+	if s.Status == "Success" {
+		send(Notification{Level: "info", Subject: fmt.Sprintf("Job %s succeeded", j.Name), Message: fmt.Sprintf("Job %s of tenant %s succeeded.\n\n%s", j.Name, j.Tenant, details), Time: time.Now(), Run: &s, Tenant: j.Tenant})
+		return
+	}
+	message := fmt.Sprintf("Job %s of tenant %s failed with status %s.\n\n%s\n\nOutput:\n%s", j.Name, j.Tenant, s.Status, details, truncateOutput(s.Output, getEnvInt("NOTIFY_OUTPUT_LIMIT", 2000)))
+	send(Notification{Level: "warning", Subject: fmt.Sprintf("Job %s failed", j.Name), Message: message, Time: time.Now(), Run: &s, Tenant: j.Tenant})
+}
+
+// Helper function to get how long a run took, zero for runs that did not start
+func runDuration(s JobStatus) time.Duration {
+	return time.Duration(s.DurationMs) * time.Millisecond
+}
+
+// Function to build the absolute URL of a run's log download, empty when
+// PUBLIC_URL is not set
+func runLogURL(s JobStatus) string {
+	base := publicTenantURL(s.Tenant)
+	if base == "" {
+		return ""
+	}
+	return base + "/download?task_id=" + url.QueryEscape(s.UID)
+}
+
+// Helper function to get the PUBLIC_URL of a tenant's pages, empty when
+// PUBLIC_URL is not set
+func publicTenantURL(tenant string) string {
+	base := strings.TrimSuffix(getEnvString("PUBLIC_URL", ""), "/")
+	if base != "" && tenant != "" && tenant != defaultTenant {
+		base += "/t/" + tenant
+	}
+	return base
+}
+
+// Helper function to keep the last limit bytes of a run's output
+func truncateOutput(output string, limit int) string {
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	return fmt.Sprintf("[%d bytes truncated]\n%s", len(output)-limit, strings.ToValidUTF8(output[len(output)-limit:], ""))
+}
+
+// Function to hand a notification to every channel of its tenant, which are
+// the deployment-wide ones unless the tenant has channels of its own
+func send(n Notification) {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	channels, ok := tenantNotifiers[n.Tenant]
+	if !ok {
+		channels = notifiers
+	}
+	for _, notifier := range channels {
+		if err := notifier.Notify(n); err != nil {
+			fmt.Printf("Error sending notification %q: %s\n", n.Subject, err)
+		}
+	}
+}
+
+// Notifier that writes notifications to the terminal and the log file
+type logNotifier struct{}
+
+func (logNotifier) Notify(n Notification) error {
+	// Runs are logged with their status already
+	if n.Run != nil {
+		return nil
+	}
+	line := fmt.Sprintf("[%s] Notification (%s): %s - %s\n", n.Time.Format("02-01-2006 15:04:05"), n.Level, n.Subject, n.Message)
+	fmt.Print(line)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if logFile == nil {
+		return nil
+	}
+	return writeLogLine(line, notificationSeverity(n.Level), nil)
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cookie binding a single sign-on to the browser that started it
+const ssoCookieName = "gtask_sso"
+
+// Struct to hold the endpoints of an OpenID Connect provider
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Struct to hold a single sign-on waiting for the identity provider
+type pendingSSO struct {
+	Tenant  string
+	Prefix  string // tenant path prefix to return to
+	Next    string
+	Nonce   string
+	Expires time.Time
+}
+
+// Struct to hold one group-to-role mapping of the SSO_GROUP_ROLES setting
+type groupRole struct {
+	Group  string
+	Tenant string // "*" for every tenant
+	Role   string
+}
+
+var (
+	oidcProviderCache   *oidcProvider
+	oidcProviderCacheMu sync.Mutex
+
+	pendingSSOs   = make(map[string]pendingSSO)
+	pendingSSOsMu sync.Mutex
+)
+
+// Function to tell whether single sign-on with OpenID Connect is configured
+func oidcEnabled() bool {
+	return os.Getenv("OIDC_ISSUER") != "" && os.Getenv("OIDC_CLIENT_ID") != ""
+}
+
+// Function to parse the SSO_GROUP_ROLES setting, a comma separated list of
+// <group>=<tenant>:<role> entries, e.g. "ops=*:admin,payments-team=payments:user"
+func parseGroupRoles(setting string) ([]groupRole, error) {
+	var mappings []groupRole
+	for _, entry := range strings.Split(setting, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, grant, ok := strings.Cut(entry, "=")
+		tenant, role, ok2 := strings.Cut(grant, ":")
+		if !ok || !ok2 || group == "" || (tenant != "*" && !tenantNamePattern.MatchString(tenant)) || (role != roleAdmin && role != roleUser) {
+			return nil, fmt.Errorf("invalid group mapping %q, expected <group>=<tenant>:<admin|user>", entry)
+		}
+		mappings = append(mappings, groupRole{Group: group, Tenant: tenant, Role: role})
+	}
+	return mappings, nil
+}
+
+// Function to get the role the identity provider's groups grant in a tenant,
+// or "" if none of the groups gives access to it. The highest role wins.
+func mapGroupsToRole(tenant string, groups []string) (string, error) {
+	mappings, err := parseGroupRoles(os.Getenv("SSO_GROUP_ROLES"))
+	if err != nil {
+		return "", err
+	}
+	role := ""
+	for _, m := range mappings {
+		if (m.Tenant == "*" || m.Tenant == tenant) && slices.Contains(groups, m.Group) && role != roleAdmin {
+			role = m.Role
+		}
+	}
+	return role, nil
+}
+
+// Function to discover the endpoints of the identity provider, once
+func discoverOIDC() (*oidcProvider, error) {
+	oidcProviderCacheMu.Lock()
+	defer oidcProviderCacheMu.Unlock()
+	if oidcProviderCache != nil {
+		return oidcProviderCache, nil
+	}
+
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	var p oidcProvider
+	if err := getJSON(issuer+"/.well-known/openid-configuration", &p); err != nil {
+		return nil, fmt.Errorf("error discovering identity provider: %w", err)
+	}
+	if strings.TrimSuffix(p.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("identity provider reports issuer %q instead of %q", p.Issuer, issuer)
+	}
+	oidcProviderCache = &p
+	return oidcProviderCache, nil
+}
+
+// Helper function to fetch a JSON document
+func getJSON(url string, v any) error {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Helper function to get the URL the identity provider sends users back to
+func oidcRedirectURL(r *http.Request) string {
+	if redirect := os.Getenv("OIDC_REDIRECT_URL"); redirect != "" {
+		return redirect
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/login/sso/callback"
+}
+
+// Handler for starting a single sign-on, sending the browser to the identity provider
+func ssoLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	provider, err := discoverOIDC()
+	if err != nil {
+		fmt.Printf("Error starting single sign-on: %s\n", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	state, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+
+	tenant, _ := r.Context().Value(tenantContextKey{}).(tenantContext)
+	pendingSSOsMu.Lock()
+	now := time.Now()
+	for s, p := range pendingSSOs {
+		if now.After(p.Expires) {
+			delete(pendingSSOs, s)
+		}
+	}
+	pendingSSOs[state] = pendingSSO{
+		Tenant:  requestTenant(r),
+		Prefix:  tenant.Prefix,
+		Next:    safeRedirectTarget(r.FormValue("next")),
+		Nonce:   nonce,
+		Expires: now.Add(10 * time.Minute),
+	}
+	pendingSSOsMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoCookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || getEnvBool("SESSION_COOKIE_SECURE", false),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	scopes := getEnvString("OIDC_SCOPES", "openid profile email groups")
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {os.Getenv("OIDC_CLIENT_ID")},
+		"redirect_uri":  {oidcRedirectURL(r)},
+		"scope":         {scopes},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	http.Redirect(w, r, provider.AuthorizationEndpoint+"?"+query.Encode(), http.StatusSeeOther)
+}
+
+// Handler for the identity provider sending the browser back after signing
+// in. The ID token is verified, and the user's groups decide their role in
+// the tenant the sign-on was started for.
+func ssoCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !oidcEnabled() {
+		http.NotFound(w, r)
+		return
+	}
+	cookie, err := r.Cookie(ssoCookieName)
+	state := r.FormValue("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		http.Error(w, "Invalid sign-on state, please sign in again", http.StatusBadRequest)
+		return
+	}
+	pendingSSOsMu.Lock()
+	pending, ok := pendingSSOs[state]
+	delete(pendingSSOs, state)
+	pendingSSOsMu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: ssoCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	if !ok || time.Now().After(pending.Expires) {
+		http.Error(w, "Sign-on expired, please sign in again", http.StatusBadRequest)
+		return
+	}
+	if e := r.FormValue("error"); e != "" {
+		http.Error(w, "Identity provider refused the sign-on: "+e, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := exchangeOIDCCode(r, r.FormValue("code"), pending.Nonce)
+	if err != nil {
+		fmt.Printf("Error completing single sign-on: %s\n", err)
+		http.Error(w, "Error completing sign-on", http.StatusUnauthorized)
+		return
+	}
+	username := claimString(claims, os.Getenv("OIDC_USERNAME_CLAIM"), "preferred_username", "email", "sub")
+	groups := claimStrings(claims, getEnvString("OIDC_GROUPS_CLAIM", "groups"))
+
+	role, err := mapGroupsToRole(pending.Tenant, groups)
+	if err != nil {
+		fmt.Printf("Error mapping groups to roles: %s\n", err)
+		http.Error(w, "Error completing sign-on", http.StatusInternalServerError)
+		return
+	}
+	if role == "" || username == "" {
+		recordAuditEvent(pending.Tenant, username, "sso_denied",
+			fmt.Sprintf("no role in tenant %s for groups %s", pending.Tenant, strings.Join(groups, ", ")), remoteIP(r))
+		http.Error(w, "Your groups do not give access to this tenant", http.StatusForbidden)
+		return
+	}
+
+	pruneSessions()
+	if err := createSession(w, r, pending.Tenant, username, "sso", role); err != nil {
+		fmt.Printf("Error creating session: %s\n", err)
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(pending.Tenant, eventAuth, fmt.Sprintf("User %s signed in with single sign-on as %s of tenant %s from %s", username, role, pending.Tenant, r.RemoteAddr))
+	next := pending.Next
+	if next == "/" {
+		next = pending.Prefix + "/"
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// Function to trade an authorization code for an ID token at the identity
+// provider, returning the verified claims of the token
+func exchangeOIDCCode(r *http.Request, code, nonce string) (map[string]any, error) {
+	provider, err := discoverOIDC()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {oidcRedirectURL(r)},
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(os.Getenv("OIDC_CLIENT_ID")), url.QueryEscape(os.Getenv("OIDC_CLIENT_SECRET")))
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %s", resp.Status)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("error reading token: %w", err)
+	}
+
+	claims, err := verifyIDToken(provider, token.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+	return claims, nil
+}
+
+// Function to verify the RS256 signature, issuer, audience and expiry of an
+// ID token against the identity provider's published keys
+func verifyIDToken(provider *oidcProvider, idToken string) (map[string]any, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed ID token signature")
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := getJSON(provider.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("error fetching identity provider keys: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	verified := false
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (header.Kid != "" && k.Kid != header.Kid) {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("ID token signature is invalid")
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(provider.Issuer, "/") {
+		return nil, fmt.Errorf("ID token was issued by %q", iss)
+	}
+	if !slices.Contains(claimStrings(claims, "aud"), os.Getenv("OIDC_CLIENT_ID")) {
+		return nil, fmt.Errorf("ID token is not meant for this client")
+	}
+	if exp, _ := claims["exp"].(float64); time.Now().After(time.Unix(int64(exp), 0).Add(time.Minute)) {
+		return nil, fmt.Errorf("ID token has expired")
+	}
+	return claims, nil
+}
+
+// Helper function to decode a base64url encoded JSON part of a JWT
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return fmt.Errorf("malformed ID token")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("malformed ID token: %w", err)
+	}
+	return nil
+}
+
+// Helper function to get the first non-empty string claim of the given names
+func claimString(claims map[string]any, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// Helper function to get a claim holding a string or a list of strings
+func claimStrings(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGroupRoles(t *testing.T) {
+	got, err := parseGroupRoles(" ops=*:admin, data-eng=data-team:user ,,finance=payments:admin")
+	if err != nil {
+		t.Fatalf("parseGroupRoles failed: %s", err)
+	}
+	want := []groupRole{
+		{Group: "ops", Tenant: "*", Role: roleAdmin},
+		{Group: "data-eng", Tenant: "data-team", Role: roleUser},
+		{Group: "finance", Tenant: "payments", Role: roleAdmin},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGroupRoles = %+v, want %+v", got, want)
+	}
+
+	if got, err := parseGroupRoles(""); err != nil || len(got) != 0 {
+		t.Errorf("parseGroupRoles(\"\") = %+v, %v; want no mappings", got, err)
+	}
+}
+
+func TestParseGroupRolesErrors(t *testing.T) {
+	for _, setting := range []string{
+		"ops",
+		"ops=admin",
+		"=*:admin",
+		"ops=*:owner",
+		"ops=Data Team:user",
+		"ops=*:admin,finance=payments",
+	} {
+		_, err := parseGroupRoles(setting)
+		if err == nil || !strings.Contains(err.Error(), "expected <group>=<tenant>:<admin|user>") {
+			t.Errorf("parseGroupRoles(%q) error = %v, want an invalid group mapping", setting, err)
+		}
+	}
+}
+
+func TestMapGroupsToRole(t *testing.T) {
+	t.Setenv("SSO_GROUP_ROLES", "everyone=*:user,ops=*:admin,finance=payments:admin")
+
+	tests := []struct {
+		tenant string
+		groups []string
+		want   string
+	}{
+		{"default", []string{"everyone"}, roleUser},
+		{"default", []string{"ops", "everyone"}, roleAdmin},
+		{"payments", []string{"everyone", "finance"}, roleAdmin},
+		{"default", []string{"finance"}, ""},
+		{"default", nil, ""},
+	}
+	for _, tt := range tests {
+		got, err := mapGroupsToRole(tt.tenant, tt.groups)
+		if err != nil || got != tt.want {
+			t.Errorf("mapGroupsToRole(%q, %q) = %q, %v; want %q", tt.tenant, tt.groups, got, err, tt.want)
+		}
+	}
+}
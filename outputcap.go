@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Most output kept of a run unless MAX_OUTPUT_BYTES or the job's max_output says otherwise
+const defaultMaxOutputBytes = 1 << 20
+
+// Buffer collecting a command's output, safe to share between its stdout and
+// stderr. Beyond its limit, only the start and the end of the output are
+// kept, half of the limit each.
+type cappedBuffer struct {
+	mu    sync.Mutex
+	limit int64 // 0 for no limit
+	head  []byte
+	tail  []byte
+	total int64 // bytes written, kept or not
+}
+
+// Function to get the output limit of a job: its max_output option, or else
+// MAX_OUTPUT_BYTES, where 0 turns the limit off
+func outputLimit(j Job) int64 {
+	if j.MaxOutput != "" {
+		limit, _ := parseMemorySize(j.MaxOutput)
+		return limit
+	}
+	return int64(max(getEnvInt("MAX_OUTPUT_BYTES", defaultMaxOutputBytes), 0))
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total += int64(len(p))
+	if b.limit == 0 {
+		b.head = append(b.head, p...)
+		return len(p), nil
+	}
+
+	written := len(p)
+	if room := b.limit/2 - int64(len(b.head)); room > 0 {
+		n := min(room, int64(len(p)))
+		b.head = append(b.head, p[:n]...)
+		p = p[n:]
+	}
+	b.tail = append(b.tail, p...)
+	// Drop the start of the tail once it holds twice what is kept, so that
+	// dropping happens once per that many bytes rather than on every write
+	if keep := b.limit - b.limit/2; int64(len(b.tail)) > 2*keep {
+		b.tail = append(b.tail[:0], b.tail[int64(len(b.tail))-keep:]...)
+	}
+	return written, nil
+}
+
+// Function to get the output kept, with a marker where bytes were dropped
+func (b *cappedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit == 0 || b.total <= b.limit {
+		return append(b.head[:len(b.head):len(b.head)], b.tail...)
+	}
+	tail := b.tail[int64(len(b.tail))-(b.limit-b.limit/2):]
+	output := append(b.head[:len(b.head):len(b.head)], fmt.Sprintf("\n[output truncated, %d bytes dropped]\n", b.total-b.limit)...)
+	return append(output, tail...)
+}
+
+// Function to get the size of the whole output, including dropped bytes
+func (b *cappedBuffer) Size() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
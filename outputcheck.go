@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Values of the output_check job option
+const (
+	outputStable   = "stable"   // alert when a run's output differs from the previous run's
+	outputChanging = "changing" // alert when a run's output is the same as the previous run's
+)
+
+// Function to hash the output of a command for output checks
+func outputHash(output []byte) string {
+	sum := sha256.Sum256(output)
+	return hex.EncodeToString(sum[:])
+}
+
+// Struct to hold the successful run an output check compares the next one with
+type checkedOutput struct {
+	uid       string
+	hash      string
+	timestamp string
+}
+
+// Last checked output of each job, keyed by jobKey, loaded from job_status
+// on first use as run statuses reach the database in batches
+var (
+	lastOutputs   = make(map[string]checkedOutput)
+	lastOutputsMu sync.Mutex
+)
+
+// Function to compare the output of a successful run of a job with an
+// output_check option with the job's previous successful run, and alert when
+// it changed although it should be stable or stayed the same although it
+// should change. The first checked run only records its hash.
+func checkRunOutput(j Job, s JobStatus) {
+	if j.OutputCheck == "" || s.Status != "Success" || s.OutputHash == "" {
+		return
+	}
+
+	key := jobKey(j.Tenant, j.Name)
+	lastOutputsMu.Lock()
+	previous, ok := lastOutputs[key]
+	if !ok {
+		var err error
+		if previous, err = storage.PreviousOutput(j.Tenant, j.Name, s.UID); err != nil {
+			fmt.Printf("Error checking the output of job %s: %s\n", j.Name, err)
+		}
+	}
+	lastOutputs[key] = checkedOutput{uid: s.UID, hash: s.OutputHash, timestamp: s.Timestamp}
+	lastOutputsMu.Unlock()
+	if previous.hash == "" {
+		return
+	}
+
+	var subject, message string
+	switch {
+	case j.OutputCheck == outputStable && s.OutputHash != previous.hash:
+		subject = fmt.Sprintf("Output of job %s changed", j.Name)
+		message = fmt.Sprintf("The output of run #%d (%s) of job %s differs from that of the previous successful run %s, although it is expected to stay the same.",
+			s.RunNumber, s.UID, j.Name, previous.uid)
+	case j.OutputCheck == outputChanging && s.OutputHash == previous.hash:
+		subject = fmt.Sprintf("Output of job %s did not change", j.Name)
+		message = fmt.Sprintf("The output of run #%d (%s) of job %s is the same as that of the previous successful run %s from %s, although it is expected to change.",
+			s.RunNumber, s.UID, j.Name, previous.uid, displayStorageTime(previous.timestamp, time.Local))
+	default:
+		return
+	}
+	recordEvent(j.Tenant, eventJob, message)
+	if link := runDiffURL(s.Tenant, previous.uid, s.UID); link != "" && j.OutputCheck == outputStable {
+		message += "\n\nChanges: " + link
+	}
+	notifyTenant(j.Tenant, "warning", subject, message)
+}
+
+// Function to build the absolute URL of the diff of two runs' outputs, empty
+// when PUBLIC_URL is not set
+func runDiffURL(tenant, fromUID, toUID string) string {
+	base := publicTenantURL(tenant)
+	if base == "" {
+		return ""
+	}
+	return base + "/runs/diff?" + url.Values{"from": {fromUID}, "to": {toUID}}.Encode()
+}
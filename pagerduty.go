@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Whether a PagerDuty alert is open per critical job, keyed by jobKey. Jobs
+// missing from the map are in an unknown state, such as after a restart, so
+// their next success resolves the alert in case one is open.
+var (
+	pagerDutyOpen   = make(map[string]bool)
+	pagerDutyOpenMu sync.Mutex
+)
+
+// Struct to hold an event sent to the PagerDuty Events API v2
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"` // "trigger" or "resolve"
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Timestamp     string         `json:"timestamp"`
+	Component     string         `json:"component"`
+	CustomDetails map[string]any `json:"custom_details"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// Function to page on a failed run of a critical job and resolve the alert on
+// its next success, in the background. Alerts of a job share a dedup key, so
+// repeated failures update one open alert.
+func pageRunResult(j Job, s JobStatus) {
+	failed := isFailureStatus(s.Status)
+	if !j.Critical || (!failed && s.Status != "Success") {
+		return
+	}
+	routingKey := getEnvString(tenantSetting(j.Tenant, "PAGERDUTY_ROUTING_KEY"), "")
+	if routingKey == "" {
+		return
+	}
+
+	key := jobKey(j.Tenant, j.Name)
+	pagerDutyOpenMu.Lock()
+	open, known := pagerDutyOpen[key]
+	pagerDutyOpen[key] = failed
+	pagerDutyOpenMu.Unlock()
+	if !failed && known && !open {
+		return
+	}
+
+	event := pagerDutyEvent{RoutingKey: routingKey, EventAction: "resolve", DedupKey: "gtask/" + key}
+	if failed {
+		event.EventAction = "trigger"
+		event.Payload = &pagerDutyPayload{
+			Summary:   fmt.Sprintf("Job %s failed with status %s", j.Name, s.Status),
+			Source:    s.Runner,
+			Severity:  "critical",
+			Timestamp: s.FinishedAt,
+			Component: j.Name,
+			CustomDetails: map[string]any{
+				"tenant":     j.Tenant,
+				"command":    s.Command,
+				"run_uid":    s.UID,
+				"run_number": s.RunNumber,
+				"exit_code":  s.ExitCode,
+				"output":     truncateOutput(s.Output, getEnvInt("NOTIFY_OUTPUT_LIMIT", 2000)),
+			},
+		}
+		if link := runLogURL(s); link != "" {
+			event.Links = []pagerDutyLink{{Href: link, Text: "Run log"}}
+		}
+	}
+
+	go func() {
+		if err := sendPagerDutyEvent(event); err != nil {
+			recordEvent(j.Tenant, eventIntegration, fmt.Sprintf("Error sending PagerDuty %s for job %s: %s", event.EventAction, j.Name, err))
+		}
+	}()
+}
+
+// Helper function to send an event to the PagerDuty Events API
+func sendPagerDutyEvent(event pagerDutyEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(getEnvString("PAGERDUTY_EVENTS_URL", "https://events.pagerduty.com/v2/enqueue"), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("PagerDuty answered %s", resp.Status)
+	}
+	return nil
+}
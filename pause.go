@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Struct to hold a maintenance pause state
+type PauseState struct {
+	Paused    bool
+	Actor     string
+	Reason    string
+	Timestamp string
+}
+
+// Current pause states, mirrored from the latest rows in scheduler_pause_events
+// and keyed by jobKey. An empty job name stands for all jobs of the tenant.
+var (
+	pauseStates  = make(map[string]PauseState)
+	pauseStateMu sync.RWMutex
+)
+
+// Returned when a job to pause or resume is not in the jobs table
+var errJobNotFound = errors.New("job not found")
+
+// Function to load the persisted pause states on startup
+func loadPauseState() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`
+		SELECT e.tenant, e.job_name, e.action, e.actor, e.reason, e.timestamp
+		FROM scheduler_pause_events e
+		JOIN (SELECT MAX(id) AS id FROM scheduler_pause_events GROUP BY tenant, job_name) latest ON latest.id = e.id`)
+	if err != nil {
+		return fmt.Errorf("error loading pause state: %w", err)
+	}
+	defer rows.Close()
+
+	pauseStateMu.Lock()
+	defer pauseStateMu.Unlock()
+	for rows.Next() {
+		var tenant, jobName, action string
+		var state PauseState
+		if err := rows.Scan(&tenant, &jobName, &action, &state.Actor, &state.Reason, &state.Timestamp); err != nil {
+			return fmt.Errorf("error loading pause state: %w", err)
+		}
+		state.Paused = action == "pause"
+		pauseStates[jobKey(tenant, jobName)] = state
+	}
+	return rows.Err()
+}
+
+// Function to get the pause state of all scheduling of a tenant
+func currentPauseState(tenant string) PauseState {
+	return jobPauseState(tenant, "")
+}
+
+// Function to get the pause state of a single job
+func jobPauseState(tenant, name string) PauseState {
+	pauseStateMu.RLock()
+	defer pauseStateMu.RUnlock()
+	return pauseStates[jobKey(tenant, name)]
+}
+
+// Function to pause or resume all scheduling of a tenant, recording who did
+// it, through which interface (source) and when
+func setPaused(tenant string, paused bool, actor, reason, source string) error {
+	return recordPauseEvent(tenant, "", paused, actor, reason, source)
+}
+
+// Function to pause or resume a single job, recorded like setPaused
+func setJobPaused(tenant, name string, paused bool, actor, reason, source string) error {
+	mu.Lock()
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM jobs WHERE tenant = ? AND name = ?)`, tenant, name).Scan(&exists)
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error looking up job: %w", err)
+	}
+	if !exists {
+		return errJobNotFound
+	}
+	return recordPauseEvent(tenant, name, paused, actor, reason, source)
+}
+
+// Helper function to store a pause or resume in scheduler_pause_events, apply
+// it and log it
+func recordPauseEvent(tenant, jobName string, paused bool, actor, reason, source string) error {
+	action := "resume"
+	if paused {
+		action = "pause"
+	}
+	state := PauseState{
+		Paused:    paused,
+		Actor:     actor,
+		Reason:    reason,
+		Timestamp: time.Now().Format("02-01-2006 15:04:05"),
+	}
+
+	mu.Lock()
+	_, err := db.Exec(`INSERT INTO scheduler_pause_events (tenant, job_name, action, actor, reason, source, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tenant, jobName, action, state.Actor, state.Reason, source, state.Timestamp)
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error recording %s: %w", action, err)
+	}
+
+	pauseStateMu.Lock()
+	pauseStates[jobKey(tenant, jobName)] = state
+	pauseStateMu.Unlock()
+
+	target := "Scheduler"
+	if jobName != "" {
+		target = "Job " + jobName
+	}
+	if tenant != defaultTenant {
+		target += " of tenant " + tenant
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("%s %sd by %s via %s", target, action, actor, source))
+	return nil
+}
+
+// Helper function to identify who made a request, preferring a name given in the form
+func requestActor(r *http.Request) string {
+	if actor := r.FormValue("actor"); actor != "" {
+		return actor
+	}
+	return r.RemoteAddr
+}
+
+// Helper function to render the maintenance pause banner and switch for the dashboard
+func pauseBanner(r *http.Request) string {
+	state := currentPauseState(requestTenant(r))
+	if !state.Paused {
+		return `<form action="` + tenantURL(r, "/scheduler/pause") + `" method="post" class="mb-3">
+	            <button type="submit" class="btn btn-outline-danger">Pause All Scheduling</button>
+	        </form>`
+	}
+
+	reason := ""
+	if state.Reason != "" {
+		reason = ": " + html.EscapeString(state.Reason)
+	}
+	return fmt.Sprintf(`<div class="alert alert-danger d-flex justify-content-between align-items-center">
+	            <span><strong>Scheduling is paused.</strong> Paused by %s at %s%s. No jobs will run until scheduling is resumed.</span>
+	            <form action="%s" method="post" class="m-0"><button type="submit" class="btn btn-light">Resume</button></form>
+	        </div>`, html.EscapeString(state.Actor), state.Timestamp, reason, tenantURL(r, "/scheduler/resume"))
+}
+
+// Handler for pausing all scheduling from the dashboard
+func pauseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can pause scheduling", http.StatusForbidden)
+		return
+	}
+	if err := setPaused(requestTenant(r), true, requestActor(r), r.FormValue("reason"), "dashboard"); err != nil {
+		http.Error(w, "Error pausing scheduler", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, tenantURL(r, "/"), http.StatusSeeOther)
+}
+
+// Handler for resuming scheduling from the dashboard
+func resumeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can resume scheduling", http.StatusForbidden)
+		return
+	}
+	if err := setPaused(requestTenant(r), false, requestActor(r), r.FormValue("reason"), "dashboard"); err != nil {
+		http.Error(w, "Error resuming scheduler", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, tenantURL(r, "/"), http.StatusSeeOther)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Events reported to a job's monitoring URL
+const (
+	pingStart   = "start"
+	pingSuccess = "success"
+	pingFail    = "fail"
+)
+
+// Largest part of a run's output sent along with a success or fail ping
+const maxPingBody = 10000
+
+// Function to check a ping_url option value
+func validatePingURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid ping_url %q, expected an http or https URL", value)
+	}
+	return nil
+}
+
+// Function to build the URL an event is reported to. Healthchecks.io-style URLs
+// take /start and /fail suffixes, Cronitor-style ones a state query parameter.
+func pingEventURL(base, style, event string) string {
+	if style == "cronitor" {
+		state := map[string]string{pingStart: "run", pingSuccess: "complete", pingFail: "fail"}[event]
+		u, _ := url.Parse(base)
+		q := u.Query()
+		q.Set("state", state)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	base = strings.TrimSuffix(base, "/")
+	switch event {
+	case pingStart:
+		return base + "/start"
+	case pingFail:
+		return base + "/fail"
+	}
+	return base
+}
+
+// Function to report a run event to the job's external monitor, if it has one.
+// Errors are logged and never affect the run.
+func pingMonitor(j Job, event string, output []byte) {
+	if j.PingURL == "" {
+		return
+	}
+	if len(output) > maxPingBody {
+		output = output[len(output)-maxPingBody:]
+	}
+
+	client := http.Client{Timeout: getEnvDuration("PING_TIMEOUT", 10*time.Second)}
+	resp, err := client.Post(pingEventURL(j.PingURL, j.PingStyle, event), "text/plain", bytes.NewReader(output))
+	if err != nil {
+		recordEvent(j.Tenant, eventIntegration, fmt.Sprintf("Error sending %s ping for job %s: %s", event, j.Name, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		recordEvent(j.Tenant, eventIntegration, fmt.Sprintf("Error sending %s ping for job %s: %s", event, j.Name, resp.Status))
+	}
+}
+
+// Function to send the start ping of a run in the background, so a slow
+// monitor does not hold up the command or add to its drift. The returned
+// function waits until the ping was sent, so that it never arrives after the
+// run's result.
+func pingStarted(j Job) (sent func()) {
+	if j.PingURL == "" {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pingMonitor(j, pingStart, nil)
+	}()
+	return func() { <-done }
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// Slots for commands executing at the same time, nil when MAX_CONCURRENT_RUNS
+// is 0 and the number is not limited
+var runSlots chan struct{}
+
+// Number of runs waiting for a free slot
+var queuedRuns atomic.Int64
+
+// Function to set up the worker pool limiting how many job commands run at
+// once to MAX_CONCURRENT_RUNS. Runs beyond that wait in line for a free slot.
+func startWorkerPool() {
+	if n := getEnvInt("MAX_CONCURRENT_RUNS", 0); n > 0 {
+		runSlots = make(chan struct{}, n)
+	}
+	setGauge("gtask_queued_runs", 0)
+}
+
+// Function to wait for a free slot to run a command in. Returns false when the
+// scheduler starts shutting down while the run is waiting.
+func acquireRunSlot() bool {
+	if runSlots == nil {
+		return true
+	}
+	select {
+	case runSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	setGauge("gtask_queued_runs", float64(queuedRuns.Add(1)))
+	defer func() {
+		setGauge("gtask_queued_runs", float64(queuedRuns.Add(-1)))
+	}()
+	select {
+	case runSlots <- struct{}{}:
+		return true
+	case <-inFlight.stopping:
+		return false
+	}
+}
+
+// Function to free the slot taken by acquireRunSlot
+func releaseRunSlot() {
+	if runSlots != nil {
+		<-runSlots
+	}
+}
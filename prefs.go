@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct to hold the display preferences of a user
+type Preferences struct {
+	RefreshInterval int      // dashboard refresh interval in seconds
+	PageSize        int      // rows per dashboard page
+	Timezone        string   // IANA name times are shown in, empty for the server's
+	Favorites       []string // names of jobs listed first on the dashboard
+}
+
+// Preferences of users who have not saved any
+var defaultPreferences = Preferences{RefreshInterval: 5, PageSize: 50}
+
+// Refresh intervals and page sizes offered in the UI
+var (
+	refreshIntervals = []int{5, 10, 30, 60}
+	pageSizes        = []int{25, 50, 100, 250}
+)
+
+// Cookie identifying a browser whose user has not signed in
+const userCookieName = "gtask_user"
+
+// Function to get the user a request was made by: the signed-in user, or
+// otherwise the browser
+func requestUser(r *http.Request) string {
+	if s, ok := requestSession(r); ok {
+		return s.User
+	}
+	if cookie, err := r.Cookie(userCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	return ""
+}
+
+// Function to get the user a request was made by, giving the browser a new
+// identity when it has none so its preferences can be saved
+func ensureRequestUser(w http.ResponseWriter, r *http.Request) string {
+	if user := requestUser(r); user != "" {
+		return user
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	user := "browser-" + hex.EncodeToString(id)
+	http.SetCookie(w, &http.Cookie{
+		Name:     userCookieName,
+		Value:    user,
+		Path:     "/",
+		MaxAge:   int((5 * 365 * 24 * time.Hour).Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return user
+}
+
+// Function to load a user's preferences, falling back to the defaults
+func loadPreferences(tenant, user string) (Preferences, error) {
+	prefs := defaultPreferences
+	if user == "" {
+		return prefs, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var favorites string
+	err := db.QueryRow(`
+		SELECT refresh_interval, page_size, timezone, favorites FROM user_preferences
+		WHERE tenant = ? AND user = ?`, tenant, user).Scan(&prefs.RefreshInterval, &prefs.PageSize, &prefs.Timezone, &favorites)
+	if err == sql.ErrNoRows {
+		return defaultPreferences, nil
+	}
+	if err != nil {
+		return defaultPreferences, fmt.Errorf("error loading preferences: %w", err)
+	}
+	if favorites != "" {
+		prefs.Favorites = strings.Split(favorites, "\n")
+	}
+	if prefs.RefreshInterval <= 0 || prefs.PageSize <= 0 {
+		prefs.RefreshInterval, prefs.PageSize = defaultPreferences.RefreshInterval, defaultPreferences.PageSize
+	}
+	return prefs, nil
+}
+
+// Function to save a user's preferences
+func savePreferences(tenant, user string, prefs Preferences) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, err := db.Exec(`
+		INSERT INTO user_preferences (tenant, user, refresh_interval, page_size, timezone, favorites, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(tenant, user) DO UPDATE SET
+			refresh_interval = excluded.refresh_interval, page_size = excluded.page_size,
+			timezone = excluded.timezone, favorites = excluded.favorites, updated_at = excluded.updated_at`,
+		tenant, user, prefs.RefreshInterval, prefs.PageSize, prefs.Timezone, strings.Join(prefs.Favorites, "\n"),
+		time.Now().Format("02-01-2006 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("error saving preferences: %w", err)
+	}
+	return nil
+}
+
+// Function to get the location times are shown in
+func (p Preferences) Location() *time.Location {
+	if p.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Function to tell whether a job is one of the user's favorites
+func (p Preferences) IsFavorite(name string) bool {
+	return slices.Contains(p.Favorites, name)
+}
+
+// Helper function to convert a timestamp stored in UTC, see formatStorageTime, to the user's time zone
+func displayStorageTime(timestamp string, loc *time.Location) string {
+	t, err := time.Parse(storageTimeFormat, timestamp)
+	if err != nil {
+		return timestamp
+	}
+	return t.In(loc).Format("02-01-2006 15:04:05")
+}
+
+// Handler for the preferences page, which shows the current user's
+// preferences and saves them on POST
+func preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	user := ensureRequestUser(w, r)
+	prefs, err := loadPreferences(tenant, user)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		interval, _ := strconv.Atoi(r.FormValue("refresh_interval"))
+		pageSize, _ := strconv.Atoi(r.FormValue("page_size"))
+		timezone := strings.TrimSpace(r.FormValue("timezone"))
+		if !slices.Contains(refreshIntervals, interval) || !slices.Contains(pageSizes, pageSize) {
+			http.Error(w, "Invalid refresh interval or page size", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.LoadLocation(timezone); err != nil {
+			http.Error(w, fmt.Sprintf("Unknown time zone %q", timezone), http.StatusBadRequest)
+			return
+		}
+		prefs.RefreshInterval, prefs.PageSize, prefs.Timezone = interval, pageSize, timezone
+		if err := savePreferences(tenant, user, prefs); err != nil {
+			http.Error(w, "Error saving preferences", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, tenantURL(r, "/"), http.StatusSeeOther)
+		return
+	}
+
+	options := func(values []int, current int, unit string) string {
+		var b strings.Builder
+		for _, v := range values {
+			fmt.Fprintf(&b, `<option value="%d" %s>%d%s</option>`, v, checkSelected(strconv.Itoa(current), strconv.Itoa(v)), v, unit)
+		}
+		return b.String()
+	}
+	favorites := "None yet, star jobs on the Jobs page."
+	if len(prefs.Favorites) > 0 {
+		favorites = html.EscapeString(strings.Join(prefs.Favorites, ", "))
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Preferences</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Preferences</h1>
+	        <form action="`+tenantURL(r, "/preferences")+`" method="post">
+	            <div class="mb-3">
+	                <label for="refreshInterval" class="form-label">Dashboard refresh interval</label>
+	                <select id="refreshInterval" name="refresh_interval" class="form-select">`+options(refreshIntervals, prefs.RefreshInterval, "s")+`</select>
+	            </div>
+	            <div class="mb-3">
+	                <label for="pageSize" class="form-label">Rows per page</label>
+	                <select id="pageSize" name="page_size" class="form-select">`+options(pageSizes, prefs.PageSize, "")+`</select>
+	            </div>
+	            <div class="mb-3">
+	                <label for="timezone" class="form-label">Time zone</label>
+	                <input type="text" class="form-control" id="timezone" name="timezone" value="`+html.EscapeString(prefs.Timezone)+`" placeholder="e.g. Europe/Berlin, empty for the server's time zone">
+	            </div>
+	            <p>Favorite jobs: `+favorites+`</p>
+	            <button type="submit" class="btn btn-primary">Save</button>
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Cancel</a>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Handler for starring or unstarring a job as a favorite of the current user
+func favoriteHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	user := ensureRequestUser(w, r)
+	name := r.FormValue("job")
+	prefs, err := loadPreferences(tenant, user)
+	if err != nil || name == "" {
+		http.Error(w, "Error updating favorites", http.StatusBadRequest)
+		return
+	}
+
+	if i := slices.Index(prefs.Favorites, name); i != -1 {
+		prefs.Favorites = slices.Delete(prefs.Favorites, i, i+1)
+	} else {
+		prefs.Favorites = append(prefs.Favorites, name)
+	}
+	if err := savePreferences(tenant, user, prefs); err != nil {
+		http.Error(w, "Error saving preferences", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, tenantURL(r, "/jobs"), http.StatusSeeOther)
+}
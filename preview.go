@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Number of fire times returned by GET /api/v1/cron/preview
+const cronPreviewCount = 5
+
+// Struct to hold the response of GET /api/v1/cron/preview
+type cronPreview struct {
+	Expression string   `json:"expression"`
+	Phrase     string   `json:"phrase,omitempty"`  // set when the expression was derived from a phrase
+	Next       []string `json:"next"`              // empty for @reboot and past @at schedules
+	Warning    string   `json:"warning,omitempty"` // set for schedules firing more often than MIN_SCHEDULE_INTERVAL
+}
+
+// Function to validate a schedule, given as a cron expression or a phrase,
+// and list the next times it fires after now
+func previewSchedule(input string, now time.Time) (cronPreview, error) {
+	expr, phrase, err := resolveSchedule(input)
+	if err != nil {
+		return cronPreview{}, err
+	}
+	schedule, err := parseSchedule(expr)
+	if err != nil {
+		return cronPreview{}, err
+	}
+
+	preview := cronPreview{Expression: expr, Phrase: phrase, Next: []string{}, Warning: frequentScheduleWarning(expr, schedule)}
+	next := now
+	for len(preview.Next) < cronPreviewCount {
+		if next = schedule.Next(next); next.IsZero() {
+			break
+		}
+		preview.Next = append(preview.Next, formatStorageTime(next))
+	}
+	return preview, nil
+}
+
+// Handler for GET /api/v1/cron/preview?expr=..., checking a schedule before
+// a job is saved and returning the next times it would run
+func apiCronPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	expr := r.URL.Query().Get("expr")
+	if strings.TrimSpace(expr) == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing expr parameter")
+		return
+	}
+	preview, err := previewSchedule(expr, time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, preview)
+}
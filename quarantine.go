@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Struct to hold a job that could not be scheduled and will not run until
+// its definition is fixed
+type quarantinedJob struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // "Invalid schedule" or "Invalid options"
+	Error  string `json:"error"`
+}
+
+// Function to record that a job was quarantined: a run with the quarantine
+// status shows up in the job's history and on the dashboard, and the
+// notifiers are told
+func quarantineJob(j Job, status string, cause error) {
+	recordSuppressedRun(j, status, "Job is quarantined and will not run until it is fixed: "+cause.Error())
+	notifyTenant(j.Tenant, "critical", fmt.Sprintf("Job %s quarantined", j.Name),
+		fmt.Sprintf("Job %s of tenant %s will not run: %s: %s", j.Name, j.Tenant, strings.ToLower(status), cause))
+}
+
+// Function to list the quarantined jobs of a tenant by name
+func quarantinedJobs(tenant string) []quarantinedJob {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+
+	list := []quarantinedJob{}
+	for _, entry := range registered {
+		if entry.Err != nil && entry.Job.Tenant == tenant {
+			list = append(list, quarantinedJob{Name: entry.Job.Name, Status: entry.Quarantine, Error: entry.Err.Error()})
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Name < list[b].Name })
+	return list
+}
+
+// Helper function to render the dashboard banner listing quarantined jobs
+func quarantineBanner(r *http.Request) string {
+	list := quarantinedJobs(requestTenant(r))
+	if len(list) == 0 {
+		return ""
+	}
+	var items strings.Builder
+	for _, q := range list {
+		fmt.Fprintf(&items, `<li><strong>%s</strong>: %s: %s</li>`, html.EscapeString(q.Name), q.Status, html.EscapeString(q.Error))
+	}
+	return fmt.Sprintf(`<div class="alert alert-danger">
+	            <strong>%d quarantined job(s) will not run</strong> until their definitions are fixed:
+	            <ul class="mb-1">%s</ul>
+	            <a href="%s" class="alert-link">Open diagnostics</a>
+	        </div>`, len(list), items.String(), tenantURL(r, "/diagnostics"))
+}
+
+// Handler for GET /api/v1/jobs/quarantined, listing the tenant's quarantined jobs
+func apiQuarantinedJobsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, quarantinedJobs(requestTenant(r)))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recent run start times per job, used to enforce rate_limit options
+var (
+	runHistory   = make(map[string][]time.Time)
+	runHistoryMu sync.Mutex
+)
+
+// Function to parse a rate limit of the form "<runs>/<window>", e.g. "10/1h"
+func parseRateLimit(limit string) (int, time.Duration, error) {
+	count, window, ok := strings.Cut(limit, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, expected e.g. 10/1h", limit)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q, expected e.g. 10/1h", limit)
+	}
+	return n, d, nil
+}
+
+// Function to check a job against its rate limit, counting the run if it is allowed
+func allowRun(j Job) bool {
+	if j.RateLimit == "" {
+		return true
+	}
+	limit, window, err := parseRateLimit(j.RateLimit)
+	if err != nil {
+		return true
+	}
+
+	runHistoryMu.Lock()
+	defer runHistoryMu.Unlock()
+
+	now := time.Now()
+	recent := runHistory[j.Name][:0]
+	for _, t := range runHistory[j.Name] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		runHistory[j.Name] = recent
+		return false
+	}
+	runHistory[j.Name] = append(recent, now)
+	return true
+}
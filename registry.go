@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Struct to hold the live cron entries of a job from the jobs table
+type registeredJob struct {
+	EntryIDs   []cron.EntryID
+	Job        Job
+	Signature  string
+	Err        error  // set when the job could not be scheduled
+	Quarantine string // status recorded when the job could not be scheduled
+	Disabled   bool   // set when the job was disabled since the last reconcile
+}
+
+// Live cron entries keyed by job ID, guarded by jobsMu
+var registered = make(map[int64]*registeredJob)
+
+// Function to build the string used to detect edits to a job
+func jobSignature(j Job) string {
+	fields := append([]string{j.Name, j.Command, j.Options, strconv.Itoa(j.MaxRuns)}, j.CronExprs()...)
+	return strings.Join(append(fields, j.Exclusions...), "\x00")
+}
+
+// Function to copy the jobs defined in the cron jobs file into the jobs table,
+// as jobs of the default tenant. Jobs are matched by name; jobs that came from the file but are no longer in
+// it are deleted, while jobs created directly in the table are left alone.
+// Further lines with the same name and command add schedules to the job, or
+// exclusions when they have the exclude=true option.
+func syncJobsFromFile(filePath string) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		fmt.Printf("Error opening file: %s\n", err)
+		return
+	}
+	defer file.Close()
+
+	var fileJobs []Job
+	byName := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		j, err := parseJobLine(line)
+		if err != nil {
+			fmt.Printf("Skipping invalid line: %s (%s)\n", line, err)
+			continue
+		}
+		if i, ok := byName[j.Name]; ok {
+			if fileJobs[i].Command != j.Command {
+				fmt.Printf("Skipping invalid line: %s (job %s is already defined with a different command)\n", line, j.Name)
+				continue
+			}
+			if j.Exclude {
+				fileJobs[i].Exclusions = append(fileJobs[i].Exclusions, j.CronExpr)
+			} else {
+				fileJobs[i].Schedules = append(fileJobs[i].Schedules, j.CronExpr)
+			}
+			continue
+		}
+		if j.Exclude {
+			fmt.Printf("Skipping invalid line: %s (exclusions must follow the job they apply to)\n", line)
+			continue
+		}
+		byName[j.Name] = len(fileJobs)
+		fileJobs = append(fileJobs, j)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Printf("Error reading file: %s\n", err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now().Format("02-01-2006 15:04:05")
+	names := make([]any, 0, len(fileJobs))
+	for _, j := range fileJobs {
+		_, err := db.Exec(`
+			INSERT INTO jobs (tenant, name, cron_expr, command, options, source, enabled, max_runs, retries, retry_backoff, updated_at)
+			VALUES (?, ?, ?, ?, ?, 'file', 1, ?, ?, ?, ?)
+			ON CONFLICT(tenant, name) DO UPDATE SET
+				cron_expr = excluded.cron_expr, command = excluded.command,
+				options = excluded.options, source = 'file', max_runs = excluded.max_runs,
+				retries = excluded.retries, retry_backoff = excluded.retry_backoff,
+				schedule_phrase = CASE WHEN cron_expr = excluded.cron_expr THEN schedule_phrase ELSE '' END,
+				updated_at = excluded.updated_at
+			WHERE cron_expr != excluded.cron_expr OR command != excluded.command
+				OR options != excluded.options OR source != 'file' OR max_runs != excluded.max_runs`,
+			defaultTenant, j.Name, j.CronExpr, j.Command, j.Options, j.MaxRuns, j.Retries, retryBackoffColumn(j), now)
+		if err != nil {
+			fmt.Printf("Error saving job %s: %s\n", j.Name, err)
+			continue
+		}
+		names = append(names, j.Name)
+
+		if err := replaceSchedules(db, defaultTenant, j.Name, j.Schedules, j.Exclusions); err != nil {
+			fmt.Printf("Error saving schedules of job %s: %s\n", j.Name, err)
+		}
+		if err := replaceDependencies(db, defaultTenant, j.Name, j.After); err != nil {
+			fmt.Printf("Error saving dependencies of job %s: %s\n", j.Name, err)
+			if err := replaceDependencies(db, defaultTenant, j.Name, nil); err != nil {
+				fmt.Printf("Error removing dependencies of job %s: %s\n", j.Name, err)
+			}
+		}
+	}
+
+	query := `DELETE FROM jobs WHERE source = 'file' AND tenant = ?`
+	if len(names) > 0 {
+		query += ` AND name NOT IN (?` + strings.Repeat(", ?", len(names)-1) + `)`
+	}
+	if _, err := db.Exec(query, append([]any{defaultTenant}, names...)...); err != nil {
+		fmt.Printf("Error removing jobs no longer in %s: %s\n", filePath, err)
+	}
+	if _, err := db.Exec(`DELETE FROM job_schedules WHERE job_id NOT IN (SELECT id FROM jobs)`); err != nil {
+		fmt.Printf("Error removing schedules of deleted jobs: %s\n", err)
+	}
+	if _, err := db.Exec(`DELETE FROM job_dependencies WHERE job_id NOT IN (SELECT id FROM jobs)`); err != nil {
+		fmt.Printf("Error removing dependencies of deleted jobs: %s\n", err)
+	}
+}
+
+// Helper function to get the value of a job's retry_backoff column, empty
+// for jobs without retries
+func retryBackoffColumn(j Job) string {
+	if j.Retries == 0 {
+		return ""
+	}
+	return j.RetryBackoff.String()
+}
+
+// Interface satisfied by both *sql.DB and *sql.Tx
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Function to replace the additional schedules and exclusions of a tenant's
+// job. The caller must hold mu.
+func replaceSchedules(q dbExecutor, tenant, name string, schedules, exclusions []string) error {
+	var id int64
+	if err := q.QueryRow(`SELECT id FROM jobs WHERE tenant = ? AND name = ?`, tenant, name).Scan(&id); err != nil {
+		return err
+	}
+	if _, err := q.Exec(`DELETE FROM job_schedules WHERE job_id = ?`, id); err != nil {
+		return err
+	}
+	for _, expr := range schedules {
+		if _, err := q.Exec(`INSERT INTO job_schedules (job_id, cron_expr, kind) VALUES (?, ?, 'run')`, id, expr); err != nil {
+			return err
+		}
+	}
+	for _, expr := range exclusions {
+		if _, err := q.Exec(`INSERT INTO job_schedules (job_id, cron_expr, kind) VALUES (?, ?, 'exclude')`, id, expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to bring the live cron entries in line with the jobs table, adding,
+// rescheduling and removing entries for jobs created, edited, disabled or
+// deleted in the table since the last pass. Every change is logged.
+func reconcileJobs(c *cron.Cron) {
+	tableJobs, err := storage.ListJobs()
+	if err != nil {
+		fmt.Printf("Error reconciling jobs: %s\n", err)
+		return
+	}
+
+	// Events and quarantines are recorded once jobsMu is released, as
+	// recording takes mu
+	var events []Event
+	var quarantined []registeredJob
+	var scheduled []Job
+	defer func() {
+		for _, e := range events {
+			recordEvent(e.Tenant, e.Category, e.Message)
+		}
+		now := time.Now()
+		for _, j := range scheduled {
+			saveNextRun(j, now)
+		}
+		for _, entry := range quarantined {
+			quarantineJob(entry.Job, entry.Quarantine, entry.Err)
+		}
+	}()
+
+	jobsMu.Lock()
+	defer jobsMu.Unlock()
+
+	changed := false
+	seen := make(map[int64]bool, len(tableJobs))
+	for _, j := range tableJobs {
+		seen[j.ID] = true
+		signature := jobSignature(j)
+
+		current, exists := registered[j.ID]
+		if exists && current.Signature == signature && !current.Disabled {
+			continue
+		}
+		changed = true
+		if exists {
+			removeEntries(c, current.EntryIDs)
+			delete(jobs, jobKey(current.Job.Tenant, current.Job.Name))
+		}
+
+		entry := &registeredJob{Job: j, Signature: signature}
+		registered[j.ID] = entry
+
+		entry.Quarantine = "Invalid options"
+		entry.Err = parseJobOptions(&entry.Job, j.Options)
+		if entry.Err == nil {
+			entry.Quarantine = "Invalid schedule"
+			entry.EntryIDs, entry.Err = addEntries(c, j)
+		}
+		if entry.Err != nil {
+			events = append(events, Event{Tenant: j.Tenant, Category: eventReconcile, Message: fmt.Sprintf("Quarantined job %s: %s", j.Name, entry.Err)})
+			quarantined = append(quarantined, *entry)
+			continue
+		}
+		entry.Quarantine = ""
+		jobs[jobKey(j.Tenant, j.Name)] = entry.Job
+		scheduled = append(scheduled, entry.Job)
+
+		exprs := j.CronExprs()
+		for _, expr := range exprs {
+			if schedule, err := parseSchedule(expr); err == nil {
+				if warning := frequentScheduleWarning(expr, schedule); warning != "" {
+					fmt.Printf("Warning: job %s: %s\n", j.Name, warning)
+				}
+			}
+		}
+
+		if exists {
+			events = append(events, Event{Tenant: j.Tenant, Category: eventReconcile, Message: fmt.Sprintf("Rescheduled job: %s with cron expression: %s", j.Command, strings.Join(exprs, " | "))})
+		} else {
+			events = append(events, Event{Tenant: j.Tenant, Category: eventReconcile, Message: fmt.Sprintf("Scheduled job: %s with cron expression: %s", j.Command, strings.Join(exprs, " | "))})
+		}
+	}
+
+	for id, entry := range registered {
+		if seen[id] {
+			continue
+		}
+		changed = true
+		removeEntries(c, entry.EntryIDs)
+		delete(jobs, jobKey(entry.Job.Tenant, entry.Job.Name))
+		delete(registered, id)
+		events = append(events, Event{Tenant: entry.Job.Tenant, Category: eventReconcile, Message: fmt.Sprintf("Unscheduled job: %s, it was disabled or deleted", entry.Job.Command)})
+	}
+
+	if changed {
+		checkPipes()
+		checkDependencies()
+	}
+}
+
+// Function to add a cron entry for each of a job's schedules, all running the
+// job's current definition unless one of its exclusions matches. Nothing is
+// added if any schedule or exclusion is invalid.
+func addEntries(c *cron.Cron, j Job) ([]cron.EntryID, error) {
+	for _, expr := range j.Exclusions {
+		if _, err := parseSchedule(expr); err != nil {
+			return nil, fmt.Errorf("exclusion: %w", err)
+		}
+	}
+
+	run := func(scheduledAt time.Time) {
+		current, ok := registeredJobByID(j.ID)
+		if !ok {
+			return
+		}
+		saveNextRun(current, scheduledAt)
+		runScheduled(current, scheduledAt)
+	}
+
+	var ids []cron.EntryID
+	for _, expr := range j.CronExprs() {
+		schedule, err := parseSchedule(expr)
+		if err != nil {
+			removeEntries(c, ids)
+			return nil, err
+		}
+		ids = append(ids, c.Schedule(schedule, scheduledFunc(schedule, run)))
+	}
+	return ids, nil
+}
+
+// Function to start a scheduled run of a job unless one of its exclusions,
+// calendars or maintenance windows suppresses it
+func runScheduled(current Job, scheduledAt time.Time) {
+	if expr := matchingExclusion(current, scheduledAt); expr != "" {
+		recordSuppressedRun(current, "Suppressed (excluded)", "Run skipped, it falls in the exclusion schedule "+expr)
+		return
+	}
+	if date, calendar, ok := calendarSkip(current, scheduledAt); ok {
+		reason := fmt.Sprintf("Run skipped, %s is in calendar %s", date.Date, calendar)
+		if date.Description != "" {
+			reason += " (" + date.Description + ")"
+		}
+		recordSuppressedRun(current, "Suppressed (calendar)", reason)
+		return
+	}
+	if window, ok := activeMaintenanceWindow(current.Tenant, current.Name, time.Now()); ok {
+		recordSuppressedRun(current, "Suppressed (maintenance)", "Run skipped during "+window.describe())
+		return
+	}
+	if current.Jitter > 0 {
+		current.JitterDelay = rand.N(current.Jitter + 1)
+		if !inFlight.wait(current.JitterDelay, nil) {
+			recordSuppressedRun(current, "Suppressed (shutdown)", "Scheduler shut down while the run was waiting out its jitter")
+			return
+		}
+	}
+	current.ScheduledAt = scheduledAt
+	job(current, nil)
+}
+
+// Function to wrap a job function so it is told the time it was scheduled
+// for. The fire times are tracked the same way cron computes them, from the
+// time the previous trigger was dispatched.
+func scheduledFunc(schedule cron.Schedule, run func(scheduledAt time.Time)) cron.FuncJob {
+	var mu sync.Mutex
+	next := schedule.Next(time.Now())
+	return func() {
+		mu.Lock()
+		scheduledAt := next
+		next = schedule.Next(time.Now())
+		mu.Unlock()
+		run(scheduledAt)
+	}
+}
+
+// Function to remove a job's cron entries
+func removeEntries(c *cron.Cron, ids []cron.EntryID) {
+	for _, id := range ids {
+		c.Remove(id)
+	}
+}
+
+var errRunLimitReached = errors.New("job has used up its max_runs")
+
+// Function to count a run of a job in the jobs table before its command
+// starts, returning its run number, and disable the job once it has used up
+// its max_runs. One-shot jobs are archived as well, keeping their runs but
+// leaving the active jobs list. Returns false when the job has no runs left,
+// such as for a trigger overlapping the job's last run.
+func countJobRun(j Job) (int64, bool) {
+	if j.ID == 0 {
+		return 0, true
+	}
+
+	runNumber, exhausted, err := storage.CountRun(j)
+	if errors.Is(err, errRunLimitReached) {
+		return 0, false
+	}
+	if err != nil {
+		fmt.Printf("Error counting run of job %s: %s\n", j.Name, err)
+		return 0, true
+	}
+
+	if exhausted {
+		// Stop further triggers now; the next reconcile removes the entries
+		jobsMu.Lock()
+		if entry, ok := registered[j.ID]; ok {
+			entry.Disabled = true
+		}
+		jobsMu.Unlock()
+		if j.IsOneShot() {
+			recordEvent(j.Tenant, eventJob, fmt.Sprintf("Archived one-time job %s after its run", j.Name))
+		} else {
+			recordEvent(j.Tenant, eventJob, fmt.Sprintf("Disabled job %s after reaching its limit of %d runs", j.Name, j.MaxRuns))
+		}
+	}
+	return runNumber, true
+}
+
+// Function to get the current definition of a scheduled job
+func registeredJobByID(id int64) (Job, bool) {
+	jobsMu.RLock()
+	defer jobsMu.RUnlock()
+	entry, ok := registered[id]
+	if !ok || entry.Err != nil || entry.Disabled {
+		return Job{}, false
+	}
+	return jobs[jobKey(entry.Job.Tenant, entry.Job.Name)], true
+}
+
+// Signals the reconcile loop to run before its next tick
+var reconcileNow = make(chan struct{}, 1)
+
+// Function to ask for a reconcile as soon as possible, after the jobs table was
+// changed by this instance
+func requestReconcile() {
+	select {
+	case reconcileNow <- struct{}{}:
+	default:
+	}
+}
+
+// Function to schedule the jobs in the jobs table on startup and keep the
+// entries reconciled with it every RECONCILE_INTERVAL (30s by default)
+func scheduleJobsFromTable(c *cron.Cron) {
+	reconcileJobs(c)
+
+	interval := getEnvDuration("RECONCILE_INTERVAL", 30*time.Second)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-reconcileNow:
+			}
+			reconcileJobs(c)
+		}
+	}()
+}
+
+// Function to start the jobs with an @reboot schedule, once when the
+// scheduler starts
+func runRebootJobs() {
+	jobsMu.RLock()
+	var startup []Job
+	for _, j := range jobs {
+		if slices.Contains(j.CronExprs(), rebootDescriptor) {
+			startup = append(startup, j)
+		}
+	}
+	jobsMu.RUnlock()
+
+	for _, j := range startup {
+		recordEvent(j.Tenant, eventJob, fmt.Sprintf("Job %s started on scheduler startup", j.Name))
+		go job(j, nil)
+	}
+}
+
+// Function to drop pipe_to links that point at unknown jobs or form a cycle.
+// The caller must hold jobsMu.
+func checkPipes() {
+	for key, j := range jobs {
+		if j.PipeTo == "" {
+			continue
+		}
+		seen := map[string]bool{j.Name: true}
+		for next := j.PipeTo; next != ""; next = jobs[jobKey(j.Tenant, next)].PipeTo {
+			if _, ok := jobs[jobKey(j.Tenant, next)]; !ok {
+				fmt.Printf("Warning: job %s pipes to undefined job %s\n", j.Name, next)
+				break
+			}
+			if seen[next] {
+				fmt.Printf("Pipe cycle detected at job %s, disabling its pipe\n", j.Name)
+				j.PipeTo = ""
+				jobs[key] = j
+				break
+			}
+			seen[next] = true
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Function to delete a tenant's job. Jobs from the cron jobs file are removed
+// from the file first, so they do not come back on the next restart. The next
+// reconcile removes the job's cron entries; a run in progress is left to finish.
+func removeJob(tenant, name string) error {
+	current, err := storage.GetEditableJob(tenant, name)
+	if err != nil {
+		return err
+	}
+	if current.Source == "file" && tenant == defaultTenant {
+		if err := removeJobFromFile(cronJobsFile, name); err != nil {
+			return err
+		}
+	}
+	_, err = storage.DeleteJob(tenant, name)
+	return err
+}
+
+// Handler for DELETE /api/v1/jobs/{name}, deleting a job and unscheduling it
+func apiDeleteJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can delete jobs")
+		return
+	}
+	tenant, name := requestTenant(r), r.PathValue("name")
+	err := removeJob(tenant, name)
+	if errors.Is(err, errJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", name))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Deleted job %s from %s", name, r.RemoteAddr))
+	requestReconcile()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler for the Delete buttons on the jobs page
+func deleteJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can delete jobs", http.StatusForbidden)
+		return
+	}
+	tenant, name := requestTenant(r), r.FormValue("name")
+	err := removeJob(tenant, name)
+	if errors.Is(err, errJobNotFound) {
+		http.Error(w, fmt.Sprintf("Job %s not found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Deleted job %s by %s", name, requestActor(r)))
+	requestReconcile()
+	http.Redirect(w, r, tenantURL(r, "/jobs"), http.StatusSeeOther)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Number of runs shown per page and returned by the API by default
+const runsPageSize = 100
+
+// Struct to hold a past run as listed by GET /api/v1/runs. Exit code,
+// duration, output size and PID are null for triggers that did not run the
+// command.
+type PastRun struct {
+	ID          int64  `json:"id"`
+	UID         string `json:"uid"`
+	Job         string `json:"job"`
+	Command     string `json:"command"`
+	Status      string `json:"status"`
+	ExitCode    *int64 `json:"exit_code"`
+	RunNumber   int64  `json:"run_number"`
+	Attempt     int    `json:"attempt"`
+	Timestamp   string `json:"timestamp"` // RFC 3339 UTC, see formatStorageTime
+	StartedAt   string `json:"started_at,omitempty"`
+	FinishedAt  string `json:"finished_at,omitempty"`
+	DurationMs  *int64 `json:"duration_ms"`
+	OutputBytes *int64 `json:"output_bytes"` // size of the whole output, which may be stored truncated
+	Runner      string `json:"runner"`
+	Hostname    string `json:"hostname,omitempty"`
+	PID         *int64 `json:"pid"`
+	Match       string `json:"match,omitempty"` // excerpt of the output around the searched text
+}
+
+// Struct to hold the filters of a run history query
+type runFilter struct {
+	Job    string
+	Status string // a status, or "failed" for every failure status
+	Search string // text the output contains
+	Since  time.Time
+	Until  time.Time
+	Before int64 // only runs with a lower ID, for paging
+	Limit  int
+}
+
+// Function to read run filters from the query string. Times are RFC 3339,
+// or, as sent by the history page's inputs, local times in loc.
+func parseRunFilter(r *http.Request, loc *time.Location) (runFilter, error) {
+	q := r.URL.Query()
+	f := runFilter{Job: q.Get("job"), Status: q.Get("status"), Search: strings.TrimSpace(q.Get("q")), Limit: runsPageSize}
+	var err error
+	if f.Since, err = parseFilterTime(q.Get("since"), loc); err != nil {
+		return f, fmt.Errorf("since must be an RFC 3339 time")
+	}
+	if f.Until, err = parseFilterTime(q.Get("until"), loc); err != nil {
+		return f, fmt.Errorf("until must be an RFC 3339 time")
+	}
+	if v := q.Get("before"); v != "" {
+		if f.Before, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return f, fmt.Errorf("before must be a run ID")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 || f.Limit > 1000 {
+			return f, fmt.Errorf("limit must be between 1 and 1000")
+		}
+	}
+	return f, nil
+}
+
+// Helper function to parse a time filter, zero when empty
+func parseFilterTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04", value, loc)
+}
+
+// Function to list the names of the jobs a tenant has runs of
+func runJobNames(tenant string) ([]string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	rows, err := db.Query(`SELECT DISTINCT job_name FROM job_status WHERE tenant = ? AND job_name != '' ORDER BY job_name`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// Handler for GET /api/v1/runs, listing the tenant's runs newest first.
+// Accepts the job, status, q, since, until, before and limit parameters.
+func apiRunsHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := parseRunFilter(r, time.UTC)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	runs, err := storage.ListRuns(requestTenant(r), f)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// Handler for the run history page, browsing the tenant's individual runs
+// with filters by job, status and time range
+func runHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	prefs, err := loadPreferences(tenant, requestUser(r))
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	loc := prefs.Location()
+	f, err := parseRunFilter(r, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	runs, err := storage.ListRuns(tenant, f)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	names, err := runJobNames(tenant)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	jobOptions := `<option value="">All jobs</option>`
+	for _, name := range names {
+		jobOptions += fmt.Sprintf(`<option value="%s" %s>%s</option>`, html.EscapeString(name), checkSelected(f.Job, name), html.EscapeString(name))
+	}
+	statusOptions := ""
+	for _, s := range [][2]string{{"", "All statuses"}, {"Success", "Success"}, {"failed", "Failed"}, {"Cancelled", "Cancelled"}, {"Skipped", "Skipped"}} {
+		statusOptions += fmt.Sprintf(`<option value="%s" %s>%s</option>`, s[0], checkSelected(f.Status, s[0]), s[1])
+	}
+	inputTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.In(loc).Format("2006-01-02T15:04")
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Run History</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Run History</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	        </div>
+	        <form action="`+tenantURL(r, "/runs")+`" method="get" class="row g-2 mb-3">
+	            <div class="col-md-3"><select name="job" class="form-select">`+jobOptions+`</select></div>
+	            <div class="col-md-2"><select name="status" class="form-select">`+statusOptions+`</select></div>
+	            <div class="col-md-3"><input type="datetime-local" name="since" class="form-control" title="From" value="`+inputTime(f.Since)+`"></div>
+	            <div class="col-md-3"><input type="datetime-local" name="until" class="form-control" title="To" value="`+inputTime(f.Until)+`"></div>
+	            <div class="col-md-1"><button type="submit" class="btn btn-primary">Filter</button></div>
+	        </form>
+	        <table class="table table-striped table-hover">
+	            <thead>
+	                <tr>
+	                    <th>Time</th>
+	                    <th>Job</th>
+	                    <th>Status</th>
+	                    <th>Exit Code</th>
+	                    <th>Duration</th>
+	                    <th>Runner</th>
+	                    <th>Log</th>
+	                </tr>
+	            </thead>
+	            <tbody>`)
+
+	for _, run := range runs {
+		job := html.EscapeString(run.Job)
+		if job == "" {
+			job = html.EscapeString(run.Command)
+		}
+		if run.RunNumber > 0 {
+			job += fmt.Sprintf(" (run #%d", run.RunNumber)
+			if run.Attempt > 1 {
+				job += fmt.Sprintf(", attempt %d", run.Attempt)
+			}
+			job += ")"
+		}
+		color := "secondary"
+		switch {
+		case run.Status == "Success":
+			color = "success"
+		case isFailureStatus(run.Status):
+			color = "danger"
+		}
+		exitCode, duration := "-", "-"
+		if run.ExitCode != nil {
+			exitCode = strconv.FormatInt(*run.ExitCode, 10)
+		}
+		if run.DurationMs != nil {
+			duration = (time.Duration(*run.DurationMs) * time.Millisecond).String()
+		}
+		fmt.Fprintf(w, `<tr>
+				<td class="text-nowrap">%s</td>
+				<td>%s</td>
+				<td><span class="badge text-bg-%s">%s</span></td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td class="text-nowrap">
+					<a href="%s" class="btn btn-sm btn-outline-primary">Download</a>
+					<a href="%s" class="btn btn-sm btn-outline-secondary" title="Changes in the output since the job's previous run">Changes</a>
+				</td>
+			</tr>`, displayStorageTime(run.Timestamp, loc), job, color, html.EscapeString(run.Status), exitCode, duration, html.EscapeString(run.Runner),
+			html.EscapeString(tenantURL(r, "/download?task_id="+url.QueryEscape(run.UID))), html.EscapeString(tenantURL(r, "/runs/diff?to="+url.QueryEscape(run.UID))))
+	}
+	fmt.Fprintln(w, `</tbody></table>`)
+
+	if len(runs) == f.Limit {
+		next := url.Values{"before": {strconv.FormatInt(runs[len(runs)-1].ID, 10)}}
+		for key, value := range map[string]string{"job": f.Job, "status": f.Status, "since": inputTime(f.Since), "until": inputTime(f.Until)} {
+			if value != "" {
+				next.Set(key, value)
+			}
+		}
+		fmt.Fprintln(w, `<a href="`+html.EscapeString(tenantURL(r, "/runs?"+next.Encode()))+`" class="btn btn-outline-secondary">Older</a>`)
+	}
+
+	fmt.Fprintln(w, `
+	    </div>
+	</body>
+	</html>
+	`)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Struct to hold the response of POST /api/v1/jobs/{name}/run
+type runJobResponse struct {
+	Name    string `json:"name"`
+	Started bool   `json:"started"`
+}
+
+// Function to start a scheduled job of a tenant right away, outside its
+// schedule. The run is recorded like any scheduled run.
+func runJobNow(tenant, name, startedBy string) error {
+	j, ok := lookupJob(tenant, name)
+	if !ok {
+		return errJobNotFound
+	}
+	recordEvent(j.Tenant, eventJob, fmt.Sprintf("Job %s started by hand by %s", j.Name, startedBy))
+	go job(j, nil)
+	return nil
+}
+
+// Handler for POST /api/v1/jobs/{name}/run, starting a job without waiting
+// for its next scheduled run. Answers 202 Accepted once the job has started.
+func apiRunJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can run jobs")
+		return
+	}
+	name := r.PathValue("name")
+	if err := runJobNow(requestTenant(r), name, requestActor(r)); err != nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no scheduled job is named %s", name))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, runJobResponse{Name: name, Started: true})
+}
+
+// Handler for the Run Now button on the jobs page
+func runJobHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can run jobs", http.StatusForbidden)
+		return
+	}
+	name := r.FormValue("name")
+	if err := runJobNow(requestTenant(r), name, requestActor(r)); err != nil {
+		http.Error(w, fmt.Sprintf("No scheduled job is named %s", name), http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, tenantURL(r, "/jobs"), http.StatusSeeOther)
+}
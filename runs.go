@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errRunNotFound = errors.New("run not found")
+
+// Struct to hold a job command that is executing right now. Every command
+// runs in its own process group, so cancelling kills everything it started.
+type runningProcess struct {
+	UID         string
+	Tenant      string
+	JobName     string
+	Command     string
+	PID         int
+	StartedAt   time.Time
+	CancelledBy string        // set once the run is cancelled
+	done        chan struct{} // closed when the command has exited
+}
+
+// Commands executing right now, keyed by run UID
+var (
+	runningProcesses   = make(map[string]*runningProcess)
+	runningProcessesMu sync.Mutex
+)
+
+// Function to track a started command of a job under its run UID
+func trackRun(uid string, j Job, pid int, startedAt time.Time) {
+	runningProcessesMu.Lock()
+	defer runningProcessesMu.Unlock()
+	runningProcesses[uid] = &runningProcess{UID: uid, Tenant: j.Tenant, JobName: j.Name, Command: j.Command,
+		PID: pid, StartedAt: startedAt, done: make(chan struct{})}
+}
+
+// Function to stop tracking a command that has exited, returning who
+// cancelled it, if anyone
+func untrackRun(uid string) string {
+	runningProcessesMu.Lock()
+	defer runningProcessesMu.Unlock()
+	p, ok := runningProcesses[uid]
+	if !ok {
+		return ""
+	}
+	delete(runningProcesses, uid)
+	close(p.done)
+	return p.CancelledBy
+}
+
+// Function to cancel a tenant's running command. The process group gets
+// SIGTERM, and SIGKILL if it has not exited after RUN_CANCEL_GRACE.
+// Cancelling a run again changes nothing.
+func cancelRun(tenant, uid, actor string) (runningProcess, error) {
+	runningProcessesMu.Lock()
+	p, ok := runningProcesses[uid]
+	if !ok || p.Tenant != tenant {
+		runningProcessesMu.Unlock()
+		return runningProcess{}, errRunNotFound
+	}
+	if p.CancelledBy != "" {
+		cancelled := *p
+		runningProcessesMu.Unlock()
+		return cancelled, nil
+	}
+	p.CancelledBy = actor
+	cancelled := *p
+	runningProcessesMu.Unlock()
+	recordEvent(tenant, eventJob, fmt.Sprintf("Run %s of job %s cancelled by %s", uid, p.JobName, actor))
+
+	if err := syscall.Kill(-p.PID, syscall.SIGTERM); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return cancelled, fmt.Errorf("error signalling run %s: %w", uid, err)
+	}
+	go func() {
+		select {
+		case <-p.done:
+		case <-time.After(getEnvDuration("RUN_CANCEL_GRACE", 5*time.Second)):
+			syscall.Kill(-p.PID, syscall.SIGKILL)
+		}
+	}()
+	return cancelled, nil
+}
+
+// Function to cancel the running commands of every tenant, returning how many
+// were cancelled
+func cancelAllRuns(actor string) int {
+	runningProcessesMu.Lock()
+	processes := make([]runningProcess, 0, len(runningProcesses))
+	for _, p := range runningProcesses {
+		processes = append(processes, *p)
+	}
+	runningProcessesMu.Unlock()
+
+	cancelled := 0
+	for _, p := range processes {
+		if _, err := cancelRun(p.Tenant, p.UID, actor); err == nil {
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// Error recorded when a run was cancelled before its command finished
+type cancelledError struct {
+	by string
+}
+
+func (e *cancelledError) Error() string {
+	return "cancelled by " + e.by
+}
+
+// Struct to hold the response of POST /api/v1/runs/{uid}/cancel
+type cancelRunResponse struct {
+	UID         string `json:"uid"`
+	Job         string `json:"job"`
+	PID         int    `json:"pid"`
+	StartedAt   string `json:"started_at"`
+	CancelledBy string `json:"cancelled_by"`
+}
+
+// Handler for POST /api/v1/runs/{uid}/cancel, stopping a running command.
+// The run is recorded with the status "Cancelled" once the command has exited.
+func apiCancelRunHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can cancel runs")
+		return
+	}
+	tenant, uid, actor := requestTenant(r), r.PathValue("uid"), requestActor(r)
+	p, err := cancelRun(tenant, uid, actor)
+	if errors.Is(err, errRunNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no running run has UID %s", uid))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, cancelRunResponse{UID: p.UID, Job: p.JobName, PID: p.PID,
+		StartedAt: formatStorageTime(p.StartedAt), CancelledBy: p.CancelledBy})
+}
+
+// Struct to hold a running command as listed by GET /api/v1/runs/running
+type runningRun struct {
+	UID            string  `json:"uid"`
+	Job            string  `json:"job"`
+	Command        string  `json:"command"`
+	PID            int     `json:"pid"`
+	StartedAt      string  `json:"started_at"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	CancelledBy    string  `json:"cancelled_by,omitempty"`
+}
+
+// Function to list a tenant's running commands, longest running first
+func runningRuns(tenant string) []runningRun {
+	runningProcessesMu.Lock()
+	var processes []runningProcess
+	for _, p := range runningProcesses {
+		if p.Tenant == tenant {
+			processes = append(processes, *p)
+		}
+	}
+	runningProcessesMu.Unlock()
+
+	sort.Slice(processes, func(a, b int) bool { return processes[a].StartedAt.Before(processes[b].StartedAt) })
+	list := []runningRun{}
+	for _, p := range processes {
+		list = append(list, runningRun{UID: p.UID, Job: p.JobName, Command: p.Command, PID: p.PID,
+			StartedAt: formatStorageTime(p.StartedAt), ElapsedSeconds: time.Since(p.StartedAt).Seconds(), CancelledBy: p.CancelledBy})
+	}
+	return list
+}
+
+// Handler for GET /api/v1/runs/running, listing the tenant's commands that
+// are executing right now
+func apiRunningRunsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, runningRuns(requestTenant(r)))
+}
+
+// Handler for the Cancel buttons of the running jobs on the dashboard
+func cancelRunHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can cancel runs", http.StatusForbidden)
+		return
+	}
+	uid := r.FormValue("uid")
+	if _, err := cancelRun(requestTenant(r), uid, requestActor(r)); errors.Is(err, errRunNotFound) {
+		http.Error(w, fmt.Sprintf("No running run has UID %s", uid), http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, tenantURL(r, "/"), http.StatusSeeOther)
+}
+
+// Helper function to render the dashboard section listing the running jobs
+func runningSection(r *http.Request, loc *time.Location) string {
+	list := runningRuns(requestTenant(r))
+	queued := ""
+	if n := queuedRuns.Load(); n > 0 {
+		queued = fmt.Sprintf(`
+	        <p class="text-muted">%d runs are waiting for a free slot, at most %d jobs run at once.</p>`, n, cap(runSlots))
+	}
+	if len(list) == 0 {
+		return `<h2 class="h5">Running Now</h2>
+	        <p class="text-muted">No jobs are running.</p>` + queued
+	}
+
+	var rows strings.Builder
+	for _, run := range list {
+		startedAt, _ := time.Parse(storageTimeFormat, run.StartedAt)
+		action := fmt.Sprintf(`<form action="%s" method="post" class="m-0">
+					<input type="hidden" name="uid" value="%s">
+					<button type="submit" class="btn btn-sm btn-outline-danger">Cancel</button>
+				</form>`, tenantURL(r, "/cancel-run"), run.UID)
+		if run.CancelledBy != "" {
+			action = "Cancelling"
+		}
+		fmt.Fprintf(&rows, `<tr>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%d</td>
+				<td>%s</td>
+			</tr>`, html.EscapeString(run.Job), html.EscapeString(run.Command), startedAt.In(loc).Format("02-01-2006 15:04:05"),
+			time.Since(startedAt).Round(time.Second), run.PID, action)
+	}
+	return `<h2 class="h5">Running Now</h2>
+	        <table class="table table-sm table-hover">
+	            <thead>
+	                <tr>
+	                    <th>Job</th>
+	                    <th>Command</th>
+	                    <th>Started</th>
+	                    <th>Elapsed</th>
+	                    <th>PID</th>
+	                    <th></th>
+	                </tr>
+	            </thead>
+	            <tbody>` + rows.String() + `</tbody>
+	        </table>` + queued
+}
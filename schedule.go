@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Parser accepting standard five-field expressions as well as six-field
+// expressions whose first field is the second
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Prefix of the schedule of a one-time job, followed by the RFC 3339 time the
+// job runs at, e.g. "@at 2026-11-02T09:30:00+01:00"
+const runAtPrefix = "@at "
+
+// Schedule firing a single time, for one-time jobs
+type onceSchedule struct {
+	at time.Time
+}
+
+// Function to get the run time of a one-time job, or the zero time, which
+// cron never fires, once it has passed
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if s.at.After(t) {
+		return s.at
+	}
+	return time.Time{}
+}
+
+// Schedule of jobs that run once each time the scheduler starts
+const rebootDescriptor = "@reboot"
+
+// Schedule that cron never fires, the runs of @reboot jobs being started by
+// runRebootJobs instead
+type rebootSchedule struct{}
+
+// Function to get the next run of an @reboot job, always the zero time
+func (rebootSchedule) Next(time.Time) time.Time {
+	return time.Time{}
+}
+
+// Function to tell whether an expression is the schedule of a one-time job
+func isRunAt(expr string) bool {
+	return strings.HasPrefix(expr, runAtPrefix)
+}
+
+// Function to parse a cron expression, returning a readable error for invalid ones
+func parseSchedule(expr string) (cron.Schedule, error) {
+	if value, ok := strings.CutPrefix(expr, runAtPrefix); ok {
+		at, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid run time %q, expected e.g. 2026-11-02T09:30:00Z", value)
+		}
+		return onceSchedule{at: at}, nil
+	}
+	if expr == rebootDescriptor {
+		return rebootSchedule{}, nil
+	}
+	schedule, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	return schedule, nil
+}
+
+// Function to tell whether an expression has a leading seconds field
+func hasSecondsField(expr string) bool {
+	return len(strings.Fields(expr)) == 6
+}
+
+// Function to find the shortest gap between the next few fire times of a schedule
+func shortestInterval(schedule cron.Schedule) time.Duration {
+	shortest := time.Duration(0)
+	prev := schedule.Next(time.Now())
+	for i := 0; i < 10; i++ {
+		next := schedule.Next(prev)
+		if gap := next.Sub(prev); shortest == 0 || gap < shortest {
+			shortest = gap
+		}
+		prev = next
+	}
+	return shortest
+}
+
+// Function to check a schedule against MIN_SCHEDULE_INTERVAL (10s by default),
+// returning a warning for schedules that fire more often, such as a
+// seconds-field expression accidentally left as "* * * * * *"
+func frequentScheduleWarning(expr string, schedule cron.Schedule) string {
+	switch schedule.(type) {
+	case onceSchedule, rebootSchedule:
+		return ""
+	}
+	limit := getEnvDuration("MIN_SCHEDULE_INTERVAL", 10*time.Second)
+	if interval := shortestInterval(schedule); interval < limit {
+		return fmt.Sprintf("schedule %q runs every %s, more often than the recommended minimum of %s", expr, interval, limit)
+	}
+	return ""
+}
+
+// Function to check whether t matches a cron expression, to the second for
+// six-field expressions and to the minute otherwise
+func scheduleMatches(expr string, t time.Time) (bool, error) {
+	schedule, err := parseSchedule(expr)
+	if err != nil {
+		return false, err
+	}
+	precision := time.Minute
+	if hasSecondsField(expr) {
+		precision = time.Second
+	}
+	t = t.Truncate(precision)
+	return schedule.Next(t.Add(-time.Second)).Equal(t), nil
+}
+
+// Function to find the exclusion expression, if any, that covers t for a job
+func matchingExclusion(j Job, t time.Time) string {
+	for _, expr := range j.Exclusions {
+		if ok, _ := scheduleMatches(expr, t); ok {
+			return expr
+		}
+	}
+	return ""
+}
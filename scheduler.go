@@ -1,14 +1,24 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/syslog"
 	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -22,9 +32,24 @@ type JobStatus struct {
 	UID               string
 	AutoIncrementalID int64
 	Command           string
-	Timestamp         string
+	Timestamp         string // when the run finished, RFC 3339 UTC, see formatStorageTime
 	Status            string
 	Output            string
+	Env               string // environment passed to the command, secrets masked
+	Runner            string // host or agent that executed the run
+	JobName           string
+	RunNumber         int64 // sequential per job, 0 for triggers that did not run
+	Attempt           int   // 1 for the first attempt of a run, higher for retries
+	DriftMs           int64 // delay between the scheduled fire time and the process start
+	StartedAt         string // RFC 3339 UTC, see formatStorageTime
+	FinishedAt        string
+	Tenant            string
+	ExitCode          int   // exit status of the command, -1 when it did not exit normally
+	DurationMs        int64 // time from the process start to its exit, 0 when the command was not run
+	Hostname          string
+	PID               int // process ID of the command, 0 when it did not start
+	OutputHash        string // SHA-256 of the command's output, only for jobs with output_check
+	OutputBytes       int64  // size of the command's whole output, Output may be truncated
 }
 
 // Global log file handle, database handle, and mutex
@@ -34,6 +59,25 @@ var (
 	mu      sync.Mutex
 )
 
+// Identity of this scheduler instance, recorded with every run
+var runnerName string
+
+// Hostname of the machine the scheduler runs on, recorded with every run
+// since RUNNER_NAME may differ from it
+var hostName string
+
+// Function to determine the runner identity from RUNNER_NAME, defaulting to the hostname
+func resolveRunnerName() string {
+	if name := os.Getenv("RUNNER_NAME"); name != "" {
+		return name
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return hostname
+}
+
 // Function to initialize the log file
 func initLogFile(filePath string) (*os.File, error) {
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -45,11 +89,44 @@ func initLogFile(filePath string) (*os.File, error) {
 
 // Function to initialize the SQLite database
 func initDatabase(dbPath string) (*sql.DB, error) {
-	database, err := sql.Open("sqlite3", dbPath)
+	// Wait for locks held by other connections instead of failing at once.
+	// In WAL mode readers and the writer do not block each other, and syncing
+	// at checkpoints only is safe.
+	busyTimeout := getEnvDuration("DB_BUSY_TIMEOUT", 5*time.Second)
+	mode, err := journalMode()
+	if err != nil {
+		return nil, err
+	}
+	dsn := fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=%s&_foreign_keys=1", dbPath, busyTimeout.Milliseconds(), mode)
+	if mode == "WAL" {
+		dsn += "&_synchronous=NORMAL"
+	}
+	database, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}
 
+	// SQLite allows a single writer, so by default keep to one connection
+	database.SetMaxOpenConns(getEnvInt("DB_MAX_OPEN_CONNS", 1))
+	database.SetMaxIdleConns(getEnvInt("DB_MAX_IDLE_CONNS", 1))
+	database.SetConnMaxLifetime(getEnvDuration("DB_CONN_MAX_LIFETIME", 0))
+	database.SetConnMaxIdleTime(getEnvDuration("DB_CONN_MAX_IDLE_TIME", 0))
+
+	// New databases hand free pages back gradually, see runDatabaseMaintenance
+	_, err = database.Exec(`PRAGMA auto_vacuum = INCREMENTAL`)
+	if err != nil {
+		return nil, fmt.Errorf("error setting auto_vacuum: %w", err)
+	}
+
+	// Some filesystems, such as network ones, cannot hold a WAL database
+	var active string
+	if err := database.QueryRow(`PRAGMA journal_mode`).Scan(&active); err != nil {
+		return nil, fmt.Errorf("error reading journal mode: %w", err)
+	}
+	if !strings.EqualFold(active, mode) {
+		fmt.Printf("Warning: database journal mode is %s instead of %s\n", active, mode)
+	}
+
 	// Create table if not exists
 	createTableSQL := `
 CREATE TABLE IF NOT EXISTS job_status (
@@ -58,16 +135,352 @@ CREATE TABLE IF NOT EXISTS job_status (
     command TEXT,
     timestamp TEXT,
     status TEXT,
-    output TEXT
+    output TEXT,
+    env TEXT DEFAULT '',
+    runner TEXT DEFAULT '',
+    job_name TEXT DEFAULT '',
+    run_number INTEGER DEFAULT 0,
+    drift_ms INTEGER DEFAULT 0,
+    started_at TEXT DEFAULT '',
+    finished_at TEXT DEFAULT '',
+    tenant TEXT DEFAULT 'default',
+    attempt INTEGER DEFAULT 0,
+    exit_code INTEGER,
+    duration_ms INTEGER,
+    hostname TEXT DEFAULT '',
+    pid INTEGER,
+    output_hash TEXT DEFAULT '',
+    output_bytes INTEGER
+);
+CREATE TABLE IF NOT EXISTS jobs (`+jobsTableColumns+`);
+CREATE TABLE IF NOT EXISTS job_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER REFERENCES jobs(id) ON DELETE CASCADE,
+    cron_expr TEXT,
+    kind TEXT DEFAULT 'run'
+);
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT DEFAULT 'default',
+    job_name TEXT DEFAULT '',
+    starts_at TEXT,
+    ends_at TEXT DEFAULT '',
+    reason TEXT DEFAULT '',
+    created_by TEXT DEFAULT '',
+    created_at TEXT,
+    ended_by TEXT DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS sla_breaches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT DEFAULT 'default',
+    job_name TEXT,
+    task_id TEXT,
+    sla TEXT,
+    started_at TEXT,
+    breached_at TEXT,
+    finished_at TEXT DEFAULT '',
+    duration_ms INTEGER DEFAULT 0,
+    status TEXT DEFAULT ''
 );
+CREATE TABLE IF NOT EXISTS calendars (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT DEFAULT 'default',
+    name TEXT,
+    updated_at TEXT,
+    UNIQUE (tenant, name)
+);
+CREATE TABLE IF NOT EXISTS calendar_dates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    calendar_id INTEGER REFERENCES calendars(id) ON DELETE CASCADE,
+    date TEXT,
+    description TEXT DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_calendar_dates_date ON calendar_dates (calendar_id, date);
+CREATE TABLE IF NOT EXISTS job_dependencies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER REFERENCES jobs(id) ON DELETE CASCADE,
+    upstream TEXT
+);
+CREATE TABLE IF NOT EXISTS scheduler_pause_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    action TEXT,
+    actor TEXT,
+    reason TEXT,
+    timestamp TEXT,
+    job_name TEXT DEFAULT '',
+    source TEXT DEFAULT '',
+    tenant TEXT DEFAULT 'default'
+);
+CREATE TABLE IF NOT EXISTS tenants (
+    name TEXT PRIMARY KEY,
+    created_at TEXT
+);
+CREATE TABLE IF NOT EXISTS user_preferences (
+    tenant TEXT,
+    user TEXT,
+    refresh_interval INTEGER,
+    page_size INTEGER,
+    timezone TEXT DEFAULT '',
+    favorites TEXT DEFAULT '',
+    updated_at TEXT,
+    PRIMARY KEY (tenant, user)
+);
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash TEXT PRIMARY KEY,
+    tenant TEXT,
+    user TEXT,
+    source TEXT DEFAULT 'local',
+    role TEXT DEFAULT '',
+    created_at TEXT,
+    last_seen_at TEXT,
+    remote_addr TEXT,
+    user_agent TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(tenant, user);
+CREATE TABLE IF NOT EXISTS users (
+    tenant TEXT,
+    username TEXT,
+    password_hash TEXT,
+    role TEXT DEFAULT 'user',
+    disabled INTEGER DEFAULT 0,
+    created_at TEXT,
+    updated_at TEXT,
+    totp_secret TEXT DEFAULT '',
+    totp_enabled INTEGER DEFAULT 0,
+    totp_last_step INTEGER DEFAULT 0,
+    PRIMARY KEY (tenant, username)
+);
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    tenant TEXT,
+    username TEXT,
+    code_hash TEXT,
+    used_at TEXT DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user ON user_recovery_codes(tenant, username);
+CREATE TABLE IF NOT EXISTS audit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT,
+    actor TEXT,
+    action TEXT,
+    detail TEXT,
+    remote_addr TEXT,
+    timestamp TEXT
+);
+CREATE TABLE IF NOT EXISTS events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT,
+    category TEXT,
+    message TEXT,
+    runner TEXT,
+    timestamp TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_events_timestamp ON events (timestamp);
 	`
 	_, err = database.Exec(createTableSQL)
 	if err != nil {
 		return nil, fmt.Errorf("error creating table: %w", err)
 	}
+
+	// Columns added after a table was first created
+	migrations := []struct{ table, column, definition string }{
+		{"job_status", "env", "TEXT DEFAULT ''"},
+		{"job_status", "runner", "TEXT DEFAULT ''"},
+		{"job_status", "job_name", "TEXT DEFAULT ''"},
+		{"job_status", "run_number", "INTEGER DEFAULT 0"},
+		{"job_status", "drift_ms", "INTEGER DEFAULT 0"},
+		{"job_status", "started_at", "TEXT DEFAULT ''"},
+		{"job_status", "finished_at", "TEXT DEFAULT ''"},
+		{"job_schedules", "kind", "TEXT DEFAULT 'run'"},
+		{"jobs", "max_runs", "INTEGER DEFAULT 0"},
+		{"jobs", "run_count", "INTEGER DEFAULT 0"},
+		{"jobs", "archived", "INTEGER DEFAULT 0"},
+		{"jobs", "description", "TEXT DEFAULT ''"},
+		{"jobs", "retries", "INTEGER DEFAULT 0"},
+		{"jobs", "retry_backoff", "TEXT DEFAULT ''"},
+		{"jobs", "schedule_phrase", "TEXT DEFAULT ''"},
+		{"jobs", "next_run_at", "TEXT DEFAULT ''"},
+		{"jobs", "consecutive_failures", "INTEGER DEFAULT 0"},
+		{"jobs", "disabled_reason", "TEXT DEFAULT ''"},
+		{"job_status", "attempt", "INTEGER DEFAULT 0"},
+		{"scheduler_pause_events", "job_name", "TEXT DEFAULT ''"},
+		{"scheduler_pause_events", "source", "TEXT DEFAULT ''"},
+		{"job_status", "tenant", "TEXT DEFAULT 'default'"},
+		{"scheduler_pause_events", "tenant", "TEXT DEFAULT 'default'"},
+		{"users", "totp_secret", "TEXT DEFAULT ''"},
+		{"users", "totp_enabled", "INTEGER DEFAULT 0"},
+		{"users", "totp_last_step", "INTEGER DEFAULT 0"},
+		{"sessions", "source", "TEXT DEFAULT 'local'"},
+		{"sessions", "role", "TEXT DEFAULT ''"},
+		{"job_status", "exit_code", "INTEGER"},
+		{"job_status", "duration_ms", "INTEGER"},
+		{"job_status", "hostname", "TEXT DEFAULT ''"},
+		{"job_status", "pid", "INTEGER"},
+		{"job_status", "output_hash", "TEXT DEFAULT ''"},
+		{"job_status", "output_bytes", "INTEGER"},
+		{"jobs", "revision", "TEXT DEFAULT ''"},
+	}
+	for _, m := range migrations {
+		if err := addColumnIfMissing(database, m.table, m.column, m.definition); err != nil {
+			return nil, fmt.Errorf("error migrating table %s: %w", m.table, err)
+		}
+	}
+	if err := rebuildJobsTable(database); err != nil {
+		return nil, fmt.Errorf("error migrating table jobs: %w", err)
+	}
+	if err := migrateRunTimestamps(database); err != nil {
+		return nil, fmt.Errorf("error migrating table job_status: %w", err)
+	}
+	if err := initOutputSearch(database); err != nil {
+		return nil, fmt.Errorf("error creating output search index: %w", err)
+	}
 	return database, nil
 }
 
+// Columns of the jobs table. Job names are unique within a tenant.
+const jobsTableColumns = `
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT DEFAULT 'default',
+    name TEXT,
+    cron_expr TEXT,
+    command TEXT,
+    options TEXT DEFAULT '',
+    source TEXT DEFAULT 'db',
+    enabled INTEGER DEFAULT 1,
+    max_runs INTEGER DEFAULT 0,
+    run_count INTEGER DEFAULT 0,
+    archived INTEGER DEFAULT 0,
+    description TEXT DEFAULT '',
+    retries INTEGER DEFAULT 0,
+    retry_backoff TEXT DEFAULT '',
+    schedule_phrase TEXT DEFAULT '',
+    next_run_at TEXT DEFAULT '',
+    consecutive_failures INTEGER DEFAULT 0,
+    disabled_reason TEXT DEFAULT '',
+    revision TEXT DEFAULT '',
+    updated_at TEXT,
+    UNIQUE (tenant, name)
+`
+
+// Function to rebuild a jobs table from before tenants, whose names were
+// unique across the whole table, assigning its jobs to the default tenant.
+// SQLite cannot change a table's constraints in place.
+func rebuildJobsTable(database *sql.DB) error {
+	ok, err := hasColumn(database, "jobs", "tenant")
+	if err != nil || ok {
+		return err
+	}
+
+	// Dropping the old table would delete the schedules and dependencies
+	// referencing it, so foreign keys are off on the connection doing it.
+	// They can only be switched outside a transaction.
+	ctx := context.Background()
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `PRAGMA foreign_keys = ON`)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	columns := "id, name, cron_expr, command, options, source, enabled, max_runs, run_count, archived, updated_at"
+	statements := []string{
+		`CREATE TABLE jobs_new (` + jobsTableColumns + `)`,
+		`INSERT INTO jobs_new (` + columns + `) SELECT ` + columns + ` FROM jobs`,
+		`DROP TABLE jobs`,
+		`ALTER TABLE jobs_new RENAME TO jobs`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Function to convert run timestamps stored in the old "02-01-2006 15:04:05"
+// layout, in the server's time zone, to the sortable UTC layout of
+// formatStorageTime, so that MAX(timestamp) and ordering by it work across
+// days, months and years
+func migrateRunTimestamps(database *sql.DB) error {
+	rows, err := database.Query(`SELECT job_id, timestamp FROM job_status
+		WHERE timestamp GLOB '[0-9][0-9]-[0-9][0-9]-[0-9][0-9][0-9][0-9] [0-9][0-9]:[0-9][0-9]:[0-9][0-9]'`)
+	if err != nil {
+		return err
+	}
+	converted := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var timestamp string
+		if err := rows.Scan(&id, &timestamp); err != nil {
+			rows.Close()
+			return err
+		}
+		if t, err := time.ParseInLocation("02-01-2006 15:04:05", timestamp, time.Local); err == nil {
+			converted[id] = formatStorageTime(t)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(converted) == 0 {
+		return err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for id, timestamp := range converted {
+		if _, err := tx.Exec(`UPDATE job_status SET timestamp = ? WHERE job_id = ?`, timestamp, id); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fmt.Printf("Converted the timestamps of %d runs to RFC 3339\n", len(converted))
+	return nil
+}
+
+// Function to add a column to an existing table unless it is already there
+func addColumnIfMissing(database *sql.DB, table, column, definition string) error {
+	ok, err := hasColumn(database, table, column)
+	if err != nil || ok {
+		return err
+	}
+	_, err = database.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
+	return err
+}
+
+// Function to tell whether a table has a column
+func hasColumn(database *sql.DB, table, column string) (bool, error) {
+	rows, err := database.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
 // Function to write job status to the log file and print to terminal
 func logJobStatus(jobStatus JobStatus) {
 	mu.Lock()
@@ -77,135 +490,384 @@ func logJobStatus(jobStatus JobStatus) {
 		return
 	}
 
-	logLine := fmt.Sprintf("[%s] Status: %s, Job UID: %s, Command: %s\n", jobStatus.Timestamp, jobStatus.Status, jobStatus.UID, jobStatus.Command)
-	if jobStatus.Status == "Failure" {
-		logLine += fmt.Sprintf("[%s] Error Occured Status: %s, Job UID: %s\nCommand: %s, Output: %s\n", jobStatus.Timestamp, jobStatus.Status, jobStatus.UID, jobStatus.Command, jobStatus.Output)
+	timestamp := displayStorageTime(jobStatus.Timestamp, time.Local)
+	logLine := fmt.Sprintf("[%s] Status: %s, Job UID: %s, Command: %s\n", timestamp, jobStatus.Status, jobStatus.UID, jobStatus.Command)
+	if jobStatus.RunNumber > 0 {
+		logLine = fmt.Sprintf("[%s] Status: %s, Job UID: %s, Run: %s #%d, Command: %s\n", timestamp, jobStatus.Status, jobStatus.UID, jobStatus.JobName, jobStatus.RunNumber, jobStatus.Command)
+	}
+	if jobStatus.Attempt > 1 {
+		logLine = fmt.Sprintf("[%s] Status: %s, Job UID: %s, Run: %s #%d, Attempt: %d, Command: %s\n", timestamp, jobStatus.Status, jobStatus.UID, jobStatus.JobName, jobStatus.RunNumber, jobStatus.Attempt, jobStatus.Command)
+	}
+	if isFailureStatus(jobStatus.Status) {
+		logLine += fmt.Sprintf("[%s] Error Occured Status: %s, Job UID: %s\nCommand: %s, Output: %s\n", timestamp, jobStatus.Status, jobStatus.UID, jobStatus.Command, jobStatus.Output)
 	}
 
 	// Print to terminal
 	fmt.Print(logLine)
 
-	_, err := logFile.WriteString(logLine)
+	severity := syslog.LOG_INFO
+	if isFailureStatus(jobStatus.Status) {
+		severity = syslog.LOG_ERR
+	}
+	err := writeLogLine(logLine, severity, map[string]string{
+		"GTASK_TENANT":  jobStatus.Tenant,
+		"GTASK_JOB":     jobStatus.JobName,
+		"GTASK_RUN_UID": jobStatus.UID,
+		"GTASK_STATUS":  jobStatus.Status,
+	})
 	if err != nil {
 		fmt.Printf("Error writing to log file: %s\n", err)
 	}
 }
 
-// Function to log job status into the SQLite database
-func logJobStatusToDB(jobStatus JobStatus) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	if db == nil {
-		return
-	}
+// Function to check whether a run status is a failure, including "Failed (OOM)"
+func isFailureStatus(status string) bool {
+	return strings.HasPrefix(status, "Fail")
+}
 
-	insertSQL := `INSERT INTO job_status (task_id, command, timestamp, status, output) VALUES (?, ?, ?, ?, ?)`
-	result, err := db.Exec(insertSQL, jobStatus.UID, jobStatus.Command, jobStatus.Timestamp, jobStatus.Status, jobStatus.Output)
-	if err != nil {
-		fmt.Printf("Error inserting into database: %s\n", err)
+// Function to queue job status for writing into the SQLite database
+func logJobStatusToDB(jobStatus JobStatus) {
+	shipRunRecord(jobStatus)
+	if writeQueue == nil {
 		return
 	}
+	writeQueue <- jobStatus
+}
 
-	// Get the auto-incremental ID
-	autoIncrementalID, _ := result.LastInsertId()
-	jobStatus.AutoIncrementalID = autoIncrementalID
-
-	// Debug logging for database insertion
-	fmt.Printf("Inserted job status into database with Auto Incremental ID: %d\n", jobStatus.AutoIncrementalID)
+// Struct to hold what a job's command produced
+type commandResult struct {
+	Output      []byte   // stdout and stderr interleaved, truncated to the job's output limit
+	OutputBytes int64    // size of the whole output
+	Stdout      []byte   // stdout alone, for piping into the next job
+	Env         []string // environment the command ran with
+	StartedAt   time.Time
+	ExitCode    int // -1 when the command did not start or was killed by a signal
+	PID         int // process ID of the command, 0 when it did not start
 }
 
-// Function to simulate a job
-func job(command string) {
-	cmd := exec.Command("bash", "-c", command)
-	output, err := cmd.CombinedOutput()
+// Function to run a job's command, tracked under the run's UID so it can be
+// cancelled
+func runCommand(j Job, stdin []byte, uid string) (commandResult, error) {
+	env, err := jobEnvironment(j)
+	if err != nil {
+		return commandResult{Output: []byte(err.Error() + "\n"), ExitCode: -1}, err
+	}
+	result := commandResult{Env: env, ExitCode: -1}
 
-	endTime := time.Now()
+	args := []string{"bash", "-c", j.Command}
+	if j.CPUs != "" {
+		// Confine the command and everything it forks to the given CPUs
+		args = append([]string{"taskset", "--cpu-list", j.CPUs}, args...)
+	}
 
-	status := "Success"
-	if err != nil {
-		status = "Failure"
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	if j.TraceParent != "" {
+		cmd.Env = append(env[:len(env):len(env)], "TRACEPARENT="+j.TraceParent)
+	}
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
 	}
 
-	uid := uuid.New().String()
+	// Stdout is kept whole, beyond the output limit, only for piping
+	var stdout bytes.Buffer
+	combined := &cappedBuffer{limit: outputLimit(j)}
+	cmd.Stdout = combined
+	if j.PipeTo != "" {
+		cmd.Stdout = io.MultiWriter(&stdout, combined)
+	}
+	cmd.Stderr = combined
+
+	// Run in its own process group so the whole tree can be measured and killed
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	oomKills, countingOOMKills := cgroupOOMKills()
+	result.StartedAt = time.Now()
+	if err = cmd.Start(); err != nil {
+		result.Output = []byte(err.Error() + "\n")
+		return result, err
+	}
+	result.PID = cmd.Process.Pid
+	trackRun(uid, j, result.PID, result.StartedAt)
+	stopWatch := func() bool { return false }
+	if j.MemLimit != "" {
+		limit, _ := parseMemorySize(j.MemLimit)
+		stopWatch = watchMemory(cmd.Process.Pid, limit)
+	}
+	err = cmd.Wait()
+	result.ExitCode = cmd.ProcessState.ExitCode()
+	oom := stopWatch()
+	cancelledBy := untrackRun(uid)
+	switch {
+	case cancelledBy != "":
+		err = &cancelledError{by: cancelledBy}
+	case oom:
+		err = &oomError{limit: j.MemLimit}
+	case countingOOMKills && killedBySIGKILL(cmd.ProcessState):
+		// Other reasons for a SIGKILL, such as kill -9, are plain failures
+		if n, ok := cgroupOOMKills(); ok && n > oomKills {
+			err = &oomError{}
+		}
+	}
+	result.Output, result.Stdout, result.OutputBytes = combined.Bytes(), stdout.Bytes(), combined.Size()
+	return result, err
+}
 
+// Function to record a trigger that did not run the job's command
+func recordSuppressedRun(j Job, status, reason string) {
 	jobStatus := JobStatus{
-		UID:       uid,
-		Command:   command,
-		Timestamp: endTime.Format("02-01-2006 15:04:05"), // Custom timestamp format
+		UID:       uuid.New().String(),
+		Command:   j.Command,
+		Timestamp: formatStorageTime(time.Now()),
 		Status:    status,
-		Output:    string(output),
+		Output:    reason,
+		Runner:    runnerName,
+		JobName:   j.Name,
+		Tenant:    j.Tenant,
 	}
 
 	logJobStatusToDB(jobStatus)
 	logJobStatus(jobStatus)
 }
 
-// Function to parse cron job file and schedule jobs
-func scheduleJobsFromFile(c *cron.Cron, filePath string) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		fmt.Printf("Error opening file: %s\n", err)
+// Function to run a job, feeding stdin to the command when it is not nil.
+// On success the job's stdout is piped into its pipe_to target, if any, and
+// the jobs that run after it are started.
+func job(j Job, stdin []byte) {
+	if !allowRun(j) {
+		recordSuppressedRun(j, "Suppressed (rate limit)", fmt.Sprintf("Run skipped, job is limited to %s runs", j.RateLimit))
 		return
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Fields(line)
-		if len(parts) < 6 {
-			fmt.Printf("Skipping invalid line: %s\n", line)
-			continue
-		}
+	if safeMode {
+		recordSuppressedRun(j, "Suppressed (safe mode)", "Scheduler is in safe mode, command was not run")
+		return
+	}
 
-		cronExpr := strings.Join(parts[:5], " ")
-		command := strings.Join(parts[5:], " ")
+	if !inFlight.begin() {
+		recordSuppressedRun(j, "Suppressed (shutdown)", "Scheduler is shutting down, command was not run")
+		return
+	}
+	defer inFlight.end()
 
-		_, err := c.AddFunc(cronExpr, func(cmd string) func() {
-			return func() {
-				job(cmd)
-			}
-		}(command))
-		var SchedulerLine string
-		if err != nil {
-			SchedulerLine += fmt.Sprintf("Error scheduling job: %s\n", err)
-		} else {
-			SchedulerLine += fmt.Sprintf("Scheduled job: %s with cron expression: %s\n", command, cronExpr)
+	if state := currentPauseState(j.Tenant); state.Paused {
+		recordSuppressedRun(j, "Suppressed (paused)", "Scheduling was paused by "+state.Actor+" at "+state.Timestamp)
+		return
+	}
+
+	if state := jobPauseState(j.Tenant, j.Name); state.Paused {
+		recordSuppressedRun(j, "Suppressed (paused)", "Job was paused by "+state.Actor+" at "+state.Timestamp)
+		return
+	}
+
+	if dryRun {
+		recordSuppressedRun(j, "Dry run", "Would run: "+j.Command)
+		triggerDependents(j)
+		if next, ok := lookupJob(j.Tenant, j.PipeTo); ok {
+			job(next, nil)
 		}
-		fmt.Print(SchedulerLine)
+		return
+	}
 
-		_, err = logFile.WriteString(SchedulerLine)
-		if err != nil {
-			fmt.Printf("Error writing to log file: %s\n", err)
+	run, ok := claimJobRun(j)
+	if !ok {
+		recordSuppressedRun(j, "Skipped", "Run skipped, the previous run of the job is still in progress")
+		return
+	}
+	defer releaseJobRun(j, run)
+
+	runNumber, ok := countJobRun(j)
+	if !ok {
+		recordSuppressedRun(j, "Suppressed (max runs)", fmt.Sprintf("Run skipped, the job has used up its %d runs", j.MaxRuns))
+		return
+	}
+	startPingSent := pingStarted(j)
+	span := startRunSpan(j)
+	j.TraceParent = span.traceParent()
+
+	// Failed attempts are retried up to the job's retries option, waiting
+	// retry_backoff before the first retry and twice as long before each further one
+	var jobStatus JobStatus
+	var result commandResult
+	for attempt := 1; ; attempt++ {
+		if !acquireRunSlot() {
+			recordSuppressedRun(j, "Suppressed (shutdown)", "Scheduler shut down while the run was waiting for a free slot")
+			return
+		}
+		jobStatus, result = runAttempt(j, stdin, runNumber, attempt)
+		releaseRunSlot()
+		retry := attempt <= j.Retries && isFailureStatus(jobStatus.Status) && !isClosed(run.replaced)
+		delay := j.RetryBackoff << (attempt - 1)
+		if retry {
+			jobStatus.Output += fmt.Sprintf("\nRetrying in %s, attempt %d of %d\n", delay, attempt+1, j.Retries+1)
 		}
+		logJobStatusToDB(jobStatus)
+		logJobStatus(jobStatus)
+		if !retry || !inFlight.wait(delay, run.replaced) {
+			break
+		}
+	}
+
+	span.end(jobStatus)
+	status, output := jobStatus.Status, []byte(jobStatus.Output)
+	recordRunOutcome(j, status)
+	checkRunOutput(j, jobStatus)
+	if status == "Success" || isFailureStatus(status) {
+		notifyRunResult(j, jobStatus)
+	}
+	sendRunCallback(j, jobStatus)
+	pageRunResult(j, jobStatus)
+	startPingSent()
+	if status == "Success" {
+		pingMonitor(j, pingSuccess, output)
+	} else {
+		pingMonitor(j, pingFail, output)
+	}
+
+	if status != "Success" {
+		return
+	}
+	triggerDependents(j)
+	if j.PipeTo == "" {
+		return
+	}
+
+	next, ok := lookupJob(j.Tenant, j.PipeTo)
+	if !ok {
+		fmt.Printf("Pipe target %s of job %s is not defined\n", j.PipeTo, j.Name)
+		return
+	}
+	job(next, result.Stdout)
+}
+
+// Function to run one attempt of a job's command, returning its status
+func runAttempt(j Job, stdin []byte, runNumber int64, attempt int) (JobStatus, commandResult) {
+	uid := uuid.New().String()
+	addRunning(j.Tenant, 1)
+	attemptStart := time.Now()
+	slaEnded := watchSLA(j, uid, attemptStart)
+	var result commandResult
+	var err error
+	if mode, injected := takeInjectedFailure(j); injected {
+		result, err = injectedResult(mode)
+	} else {
+		result, err = runCommand(j, stdin, uid)
+	}
+	addRunning(j.Tenant, -1)
+	if stripsANSI(j) {
+		result.Output = stripANSI(result.Output)
+	}
+	output := result.Output
+	if j.DropOutput {
+		// Only the scheduler's own notes about the run are kept, so the
+		// output reaches neither the database nor logs, notifications or pings
+		output = []byte(fmt.Sprintf("[output not stored, %d bytes]\n", result.OutputBytes))
+	}
+
+	endTime := time.Now()
+
+	var oom *oomError
+	var injected *injectedError
+	var cancelled *cancelledError
+	status := "Success"
+	switch {
+	case errors.As(err, &cancelled):
+		status = "Cancelled"
+		output = append(output, fmt.Sprintf("\nCancelled by %s\n", cancelled.by)...)
+	case errors.As(err, &oom):
+		status = "Failed (OOM)"
+		output = append(output, fmt.Sprintf("\n%s\n", oom)...)
+	case errors.As(err, &injected) && injected.mode == "timeout":
+		status = "Failed (timeout)"
+	case err != nil:
+		status = "Failure"
+	}
+	if slaEnded(status, endTime) {
+		output = append(output, fmt.Sprintf("\nSLA breached: run took %s, longer than its SLA of %s\n", endTime.Sub(attemptStart).Round(time.Millisecond), j.SLA)...)
 	}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Error reading file: %s\n", err)
+	jobStatus := JobStatus{
+		UID:       uid,
+		Command:   j.Command,
+		Timestamp: formatStorageTime(endTime),
+		Status:    status,
+		Output:    string(output),
+		Env:       maskEnvironment(result.Env),
+		Runner:    runnerName,
+		JobName:   j.Name,
+		RunNumber: runNumber,
+		Attempt:   attempt,
+		Tenant:    j.Tenant,
+		ExitCode:  result.ExitCode,
+		Hostname:  hostName,
+		PID:       result.PID,
+	}
+	if !result.StartedAt.IsZero() {
+		jobStatus.StartedAt = formatStorageTime(result.StartedAt)
+		jobStatus.FinishedAt = formatStorageTime(endTime)
+		jobStatus.DurationMs = endTime.Sub(result.StartedAt).Milliseconds()
+		jobStatus.OutputBytes = result.OutputBytes
+		if j.OutputCheck != "" {
+			jobStatus.OutputHash = outputHash(result.Output)
+		}
+	}
+	if attempt == 1 && !j.ScheduledAt.IsZero() && !result.StartedAt.IsZero() {
+		// The jitter delay is chosen on purpose, so it is not drift
+		jobStatus.DriftMs = result.StartedAt.Sub(j.ScheduledAt.Add(j.JitterDelay)).Milliseconds()
+		setGauge(fmt.Sprintf(`gtask_schedule_drift_seconds{tenant=%q,job=%q}`, j.Tenant, j.Name), float64(jobStatus.DriftMs)/1000)
 	}
+	return jobStatus, result
 }
 
-// Function to print scheduler start log
+// Function to record the scheduler start, along with the execution mode
 func logSchedulerStart() {
-	timestamp := time.Now().Format("02-01-2006 15:04:05")
-	message := fmt.Sprintf("[%s] Scheduler has started\n", timestamp)
-	fmt.Print(message)
+	message := "Scheduler has started"
+	if safeMode {
+		message += " in safe mode"
+	} else if dryRun {
+		message += " in dry-run mode"
+	}
+	recordEvent("", eventScheduler, message+" on "+runnerName)
+}
+
+// Function to print a scheduler event and write it to the log file
+func logSchedulerEvent(message string) {
+	line := fmt.Sprintf("[%s] %s\n", time.Now().Format("02-01-2006 15:04:05"), message)
+	fmt.Print(line)
 	mu.Lock()
 	defer mu.Unlock()
 	if logFile != nil {
-		_, err := logFile.WriteString(message)
+		err := writeLogLine(line, syslog.LOG_NOTICE, nil)
 		if err != nil {
 			fmt.Printf("Error writing to log file: %s\n", err)
 		}
 	}
 }
 
+// Layout of the sortable timestamps stored in the started_at and finished_at columns
+const storageTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Function to format a time for storage, in UTC so that text ordering matches time ordering
+func formatStorageTime(t time.Time) string {
+	return t.UTC().Format(storageTimeFormat)
+}
+
 // Function to get the current date and time
 func getCurrentTime() string {
 	return time.Now().Format("02-01-2006 15:04:05")
 }
 
+// Helper function to render the warning banners shown at the top of the dashboard
+func dashboardBanners() string {
+	var banners string
+	if safeMode {
+		banners += `<div class="alert alert-danger">Safe mode: job execution is disabled, every trigger is recorded as suppressed.</div>`
+	}
+	if dryRun {
+		banners += `<div class="alert alert-warning">Dry-run mode: jobs are recorded but not executed.</div>`
+	}
+	return banners
+}
+
 // Helper function to check if an option should be selected
 func checkSelected(current, option string) string {
 	if current == option {
@@ -216,31 +878,81 @@ func checkSelected(current, option string) string {
 
 // Handler for displaying distinct commands and their last status
 func distinctCommandsHandler(w http.ResponseWriter, r *http.Request) {
-	mu.Lock()
-	defer mu.Unlock()
+	tenant := requestTenant(r)
+	user := ensureRequestUser(w, r)
+	prefs, err := loadPreferences(tenant, user)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
 
-	// Get refresh interval from URL query parameters
-	refreshInterval := r.URL.Query().Get("interval")
-	if refreshInterval == "" {
-		refreshInterval = "5" // default to 5 seconds if no interval specified
+	// Picking a refresh interval saves it as the user's preference
+	if value := r.URL.Query().Get("interval"); value != "" {
+		if interval, err := strconv.Atoi(value); err == nil && slices.Contains(refreshIntervals, interval) {
+			prefs.RefreshInterval = interval
+			if err := savePreferences(tenant, user, prefs); err != nil {
+				http.Error(w, "Error saving preferences", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Redirect(w, r, tenantURL(r, "/"), http.StatusSeeOther)
+		return
 	}
+	refreshInterval := strconv.Itoa(prefs.RefreshInterval)
+	loc := prefs.Location()
 
-	rows, err := db.Query(`
-		SELECT command, task_id, MAX(timestamp) AS last_run, 
-		       SUM(CASE WHEN status = 'Success' THEN 1 ELSE 0 END) AS success_count,
-		       SUM(CASE WHEN status = 'Failure' THEN 1 ELSE 0 END) AS failure_count,
-		       output
-		FROM job_status
-		GROUP BY command
-		ORDER BY last_run DESC
-	`)
+	summary, err := loadSummary(tenant)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := distinctCommandsStmt.Query(tenant)
 	if err != nil {
 		http.Error(w, "Error querying database", http.StatusInternalServerError)
 		return
 	}
 	defer rows.Close()
 
-	currentTime := getCurrentTime()
+	type dashboardRow struct {
+		taskID, command, lastRun, runner, jobName, output, startedAt, hostname string
+		runNumber                                                              int64
+		successCount, failureCount                                             int
+		exitCode, durationMs, pid                                              sql.NullInt64
+	}
+	var list []dashboardRow
+	for rows.Next() {
+		var row dashboardRow
+		err := rows.Scan(&row.command, &row.taskID, &row.lastRun, &row.runner, &row.runNumber, &row.jobName, &row.successCount, &row.failureCount, &row.output,
+			&row.exitCode, &row.durationMs, &row.startedAt, &row.hostname, &row.pid)
+		if err != nil {
+			http.Error(w, "Error reading from database", http.StatusInternalServerError)
+			return
+		}
+		list = append(list, row)
+	}
+
+	// Favorite jobs first, then one page of rows
+	sort.SliceStable(list, func(a, b int) bool {
+		return prefs.IsFavorite(list[a].jobName) && !prefs.IsFavorite(list[b].jobName)
+	})
+	pages := max(1, (len(list)+prefs.PageSize-1)/prefs.PageSize)
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	page = min(max(page, 1), pages)
+	list = list[min((page-1)*prefs.PageSize, len(list)):min(page*prefs.PageSize, len(list))]
+
+	currentTime := time.Now().In(loc).Format("02-01-2006 15:04:05")
+	heading := "Job Execution Details"
+	if tenant != defaultTenant {
+		heading += ` <span class="badge bg-secondary">` + tenant + `</span>`
+	}
+	var intervalOptions strings.Builder
+	for _, interval := range refreshIntervals {
+		fmt.Fprintf(&intervalOptions, `<option value="%d" %s>%ds</option>`, interval, checkSelected(refreshInterval, strconv.Itoa(interval)), interval)
+	}
 
 	fmt.Fprintln(w, `
 	<!DOCTYPE html>
@@ -263,18 +975,29 @@ func distinctCommandsHandler(w http.ResponseWriter, r *http.Request) {
 	</head>
 	<body>
 	    <div class="container">
-	        <h1>Job Execution Details</h1>
+	        <h1>` + heading + `</h1>
+	        ` + sessionBar(r) + dashboardBanners() + storeBanner() + quarantineBanner(r) + missedRunBanner(r) + pauseBanner(r) + `
 	        <p>Current Time: ` + currentTime + `</p>
+	        ` + summaryCards(summary) + `
+	        ` + runningSection(r, loc) + `
 	        <div class="mb-3">
 	            <label for="refreshInterval" class="form-label">Select refresh interval:</label>
 	            <select id="refreshInterval" class="form-select" onchange="updateRefreshInterval()">
-	                <option value="5" ` + checkSelected(refreshInterval, "5") + `>5s</option>
-	                <option value="10" ` + checkSelected(refreshInterval, "10") + `>10s</option>
-	                <option value="30" ` + checkSelected(refreshInterval, "30") + `>30s</option>
+	                ` + intervalOptions.String() + `
 	            </select>
 	        </div>
 	        <div class="mb-3">
-	            <a href="/add-job" class="btn btn-primary">Add New Job</a>
+	            <a href="` + tenantURL(r, "/add-job") + `" class="btn btn-primary">Add New Job</a>
+	            <a href="` + tenantURL(r, "/jobs") + `" class="btn btn-outline-secondary">Jobs</a>
+	            <a href="` + tenantURL(r, "/runs") + `" class="btn btn-outline-secondary">Run History</a>
+	            <a href="` + tenantURL(r, "/search") + `" class="btn btn-outline-secondary">Search</a>
+	            <a href="` + tenantURL(r, "/timeline") + `" class="btn btn-outline-secondary">Timeline</a>
+	            <a href="` + tenantURL(r, "/maintenance") + `" class="btn btn-outline-secondary">Maintenance</a>
+	            <a href="` + tenantURL(r, "/calendars") + `" class="btn btn-outline-secondary">Calendars</a>
+	            <a href="` + tenantURL(r, "/preferences") + `" class="btn btn-outline-secondary">Preferences</a>
+	            <a href="` + tenantURL(r, "/users") + `" class="btn btn-outline-secondary">Users</a>
+	            <a href="` + tenantURL(r, "/events") + `" class="btn btn-outline-secondary">Events</a>
+	            <a href="` + tenantURL(r, "/diagnostics") + `" class="btn btn-outline-secondary">Diagnostics</a>
 	        </div>
 	        <table class="table table-striped table-hover">
 	            <thead>
@@ -282,6 +1005,9 @@ func distinctCommandsHandler(w http.ResponseWriter, r *http.Request) {
 	                    <th>UID</th>
 	                    <th>Command</th>
 	                    <th>Last Run</th>
+	                    <th>Runner</th>
+	                    <th>Exit Code</th>
+	                    <th>Duration</th>
 	                    <th>Success Count</th>
 	                    <th>Failure Count</th>
 	                    <th>Output</th>
@@ -289,58 +1015,83 @@ func distinctCommandsHandler(w http.ResponseWriter, r *http.Request) {
 	            </thead>
 	            <tbody>`)
 
-	for rows.Next() {
-		var taskID string
-		var command string
-		var lastRun string
-		var successCount, failureCount int
-		var output string
-
-		err := rows.Scan(&command, &taskID, &lastRun, &successCount, &failureCount, &output)
-		if err != nil {
-			http.Error(w, "Error reading from database", http.StatusInternalServerError)
-			return
+	for _, row := range list {
+		taskID, command, output := row.taskID, row.command, row.output
+		lastRun := displayStorageTime(row.lastRun, loc)
+		if row.runNumber > 0 {
+			lastRun += fmt.Sprintf(" (run #%d)", row.runNumber)
+		}
+		if prefs.IsFavorite(row.jobName) {
+			command = "&#9733; " + command
+		}
+		if hasMissedRun(tenant, row.jobName) {
+			command += ` <span class="badge bg-warning text-dark">Missed run</span>`
+		}
+		exitCode, duration, runner := "-", "-", row.runner
+		if row.hostname != "" && row.pid.Valid {
+			runner = fmt.Sprintf(`<span title="Host %s, PID %d">%s</span>`, row.hostname, row.pid.Int64, row.runner)
+		}
+		if row.exitCode.Valid {
+			exitCode = strconv.FormatInt(row.exitCode.Int64, 10)
+		}
+		if row.durationMs.Valid {
+			duration = fmt.Sprintf(`<span title="Started %s">%s</span>`, displayStorageTime(row.startedAt, loc), time.Duration(row.durationMs.Int64)*time.Millisecond)
 		}
 
 		if len(output) > 2 {
 			// Create a button to download the log file
 			fmt.Fprintf(w, `<tr>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
 				<td>%s</td>
 				<td>%s</td>
 				<td>%s</td>
 				<td>%d</td>
 				<td>%d</td>
 				<td><button class="btn btn-primary" onclick="downloadLog('%s')">Download Log</button></td>
-			</tr>`, taskID, command, lastRun, successCount, failureCount, taskID)
+			</tr>`, taskID, command, lastRun, runner, exitCode, duration, row.successCount, row.failureCount, taskID)
 		} else {
 			fmt.Fprintf(w, `<tr>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
 				<td>%s</td>
 				<td>%s</td>
 				<td>%s</td>
 				<td>%d</td>
 				<td>%d</td>
 				<td>%s</td>
-			</tr>`, taskID, command, lastRun, successCount, failureCount, output)
+			</tr>`, taskID, command, lastRun, runner, exitCode, duration, row.successCount, row.failureCount, output)
 		}
 	}
 
-	fmt.Fprintln(w, `</tbody></table>
+	fmt.Fprintln(w, `</tbody></table>`)
+	if pages > 1 {
+		fmt.Fprintf(w, `<nav><ul class="pagination">`)
+		for p := 1; p <= pages; p++ {
+			active := ""
+			if p == page {
+				active = " active"
+			}
+			fmt.Fprintf(w, `<li class="page-item%s"><a class="page-link" href="%s?page=%d">%d</a></li>`, active, tenantURL(r, "/"), p, p)
+		}
+		fmt.Fprintln(w, `</ul></nav>`)
+	}
+	fmt.Fprintln(w, `
 	    <script>
 	        function updateRefreshInterval() {
 	            var interval = document.getElementById('refreshInterval').value;
-	            if (interval == 0) {
-	                interval = 5; // Default to 5 seconds for real-time
-	            }
 	            window.location.search = 'interval=' + interval;
 	        }
 
 	        var selectedInterval = document.getElementById('refreshInterval').value;
 	        setInterval(function() {
-	            window.location.search = 'interval=' + selectedInterval;
+	            window.location.reload();
 	        }, selectedInterval * 1000);
 
 	        function downloadLog(taskID) {
-	            window.location.href = '/download?task_id=' + taskID;
+	            window.location.href = '`+tenantURL(r, "/download")+`?task_id=' + taskID;
 	        }
 	    </script>
 	</body>
@@ -348,7 +1099,6 @@ func distinctCommandsHandler(w http.ResponseWriter, r *http.Request) {
 	`)
 }
 
-
 // Handler for downloading log file
 func downloadLogHandler(w http.ResponseWriter, r *http.Request) {
 	taskID := r.URL.Query().Get("task_id")
@@ -359,13 +1109,9 @@ func downloadLogHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve job details from the database based on taskID
-	query := `SELECT task_id, command, timestamp, status, output FROM job_status WHERE task_id = ?`
-	row := db.QueryRow(query, taskID)
-
-	var command, timestamp, status, output string
-	err := row.Scan(&taskID, &command, &timestamp, &status, &output)
+	run, err := storage.GetRun(requestTenant(r), taskID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, errRunNotFound) {
 			http.Error(w, "No log entries found for the specified task ID", http.StatusNotFound)
 		} else {
 			http.Error(w, "Error querying database", http.StatusInternalServerError)
@@ -374,8 +1120,33 @@ func downloadLogHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Format the log content
-	logContent := fmt.Sprintf("Task ID: %s\nCommand: %s\nTimestamp: %s\nStatus: %s\n\nOutput:\n%s\n", 
-		taskID, command, timestamp, status, output)
+	var timing string
+	if run.StartedAt != "" {
+		timing = fmt.Sprintf("Started: %s\nFinished: %s\n", run.StartedAt, run.FinishedAt)
+	}
+	if run.DurationMs != nil {
+		timing += fmt.Sprintf("Duration: %s\n", time.Duration(*run.DurationMs)*time.Millisecond)
+	}
+	if run.ExitCode != nil {
+		timing += fmt.Sprintf("Exit Code: %d\n", *run.ExitCode)
+	}
+	if run.Hostname != "" {
+		timing += fmt.Sprintf("Host: %s\n", run.Hostname)
+	}
+	if run.PID != nil {
+		timing += fmt.Sprintf("PID: %d\n", *run.PID)
+	}
+	if run.OutputBytes != nil {
+		timing += fmt.Sprintf("Output Size: %d bytes\n", *run.OutputBytes)
+	}
+	logContent := fmt.Sprintf("Task ID: %s\nCommand: %s\nTimestamp: %s\nStatus: %s\n%sRunner: %s\n\nOutput:\n%s\n",
+		run.UID, run.Command, displayStorageTime(run.Timestamp, time.Local), run.Status, timing, run.Runner, run.Output)
+	if run.RunNumber > 0 {
+		logContent = fmt.Sprintf("Run: %s #%d\n", run.Job, run.RunNumber) + logContent
+	}
+	if run.Env != "" {
+		logContent += fmt.Sprintf("\nEnvironment:\n%s\n", run.Env)
+	}
 
 	// Set headers for file download
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.log", taskID))
@@ -401,10 +1172,21 @@ func addJobHandler(w http.ResponseWriter, r *http.Request) {
 	<body>
 	    <div class="container mt-5">
 	        <h1>Add New Cron Job</h1>
-	        <form action="/submit-job" method="post">
+	        <form action="`+tenantURL(r, "/submit-job")+`" method="post">
+	            <div class="mb-3">
+	                <label for="cronExpr" class="form-label">Schedule</label>
+	                <input type="text" class="form-control" id="cronExpr" name="cron_expr">
+	                <div class="form-text">A phrase such as <code>every weekday at 6pm</code> or <code>every 15 minutes</code>, or a cron expression: five fields (minute hour day month weekday), or six with a leading seconds field, e.g. <code>*/30 * * * * *</code> for every 30 seconds. Descriptors such as <code>@daily</code>, <code>@every 90s</code> and <code>@reboot</code> (on each scheduler start) work as well.</div>
+	                <div id="cronPreview" class="form-text"></div>
+	            </div>
 	            <div class="mb-3">
-	                <label for="cronExpr" class="form-label">Cron Expression</label>
-	                <input type="text" class="form-control" id="cronExpr" name="cron_expr" required>
+	                <label for="runAt" class="form-label">Or Run Once At</label>
+	                <input type="datetime-local" class="form-control" id="runAt" name="run_at">
+	                <div class="form-text">Leave the schedule empty to run the job a single time, in your time zone. It is disabled and archived after its run.</div>
+	            </div>
+	            <div class="mb-3 form-check">
+	                <input type="checkbox" class="form-check-input" id="allowFrequent" name="allow_frequent" value="1">
+	                <label for="allowFrequent" class="form-check-label">Allow frequent runs (more often than the configured minimum interval)</label>
 	            </div>
 	            <div class="mb-3">
 	                <label for="command" class="form-label">Command</label>
@@ -413,6 +1195,40 @@ func addJobHandler(w http.ResponseWriter, r *http.Request) {
 	            <button type="submit" class="btn btn-primary">Add Job</button>
 	        </form>
 	    </div>
+	    <script>
+	        var previewTimer;
+	        document.getElementById('cronExpr').addEventListener('input', function() {
+	            clearTimeout(previewTimer);
+	            previewTimer = setTimeout(previewSchedule, 300);
+	        });
+
+	        function previewSchedule() {
+	            var expr = document.getElementById('cronExpr').value.trim();
+	            var preview = document.getElementById('cronPreview');
+	            preview.className = 'form-text';
+	            preview.textContent = '';
+	            if (expr === '') {
+	                return;
+	            }
+	            var url = '`+tenantURL(r, "/api/v1/cron/preview")+`?expr=' + encodeURIComponent(expr);
+	            fetch(url).then(function(response) { return response.json(); }).then(function(data) {
+	                if (data.error) {
+	                    preview.className = 'form-text text-danger';
+	                    preview.textContent = data.error;
+	                    return;
+	                }
+	                var times = data.next.map(function(t) { return new Date(t).toLocaleString(); });
+	                preview.textContent = times.length > 0 ? 'Next runs: ' + times.join(', ') : 'No upcoming runs on a timer.';
+	                if (data.phrase) {
+	                    preview.textContent = 'Runs as ' + data.expression + '. ' + preview.textContent;
+	                }
+	                if (data.warning) {
+	                    preview.className = 'form-text text-warning';
+	                    preview.textContent += ' Warning: ' + data.warning + '.';
+	                }
+	            });
+	        }
+	    </script>
 	</body>
 	</html>
 	`)
@@ -424,39 +1240,110 @@ func submitJobHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can add jobs", http.StatusForbidden)
+		return
+	}
 
 	cronExpr := r.FormValue("cron_expr")
 	command := r.FormValue("command")
 
+	// A one-time job runs at the time picked in the form, in the user's time zone
+	if runAt := r.FormValue("run_at"); runAt != "" {
+		if cronExpr != "" {
+			http.Error(w, "Set either a schedule or a time to run once at", http.StatusBadRequest)
+			return
+		}
+		loc := time.Local
+		if prefs, err := loadPreferences(requestTenant(r), ensureRequestUser(w, r)); err == nil {
+			loc = prefs.Location()
+		}
+		at, err := time.ParseInLocation("2006-01-02T15:04", runAt, loc)
+		if err != nil {
+			at, err = time.ParseInLocation("2006-01-02T15:04:05", runAt, loc)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid run time %q", runAt), http.StatusBadRequest)
+			return
+		}
+		if !at.After(time.Now()) {
+			http.Error(w, "The run time must be in the future", http.StatusBadRequest)
+			return
+		}
+		cronExpr = runAtPrefix + at.Format(time.RFC3339)
+	}
+
 	if cronExpr == "" || command == "" {
-		http.Error(w, "Missing cron expression or command", http.StatusBadRequest)
+		http.Error(w, "Missing schedule or command", http.StatusBadRequest)
 		return
 	}
 
-	// Add the new job to the file
-	file, err := os.OpenFile("cron_jobs.txt", os.O_APPEND|os.O_WRONLY, 0644)
+	// Phrases such as "every weekday at 6pm" are turned into a cron expression
+	cronExpr, phrase, err := resolveSchedule(cronExpr)
 	if err != nil {
-		http.Error(w, "Error opening cron jobs file", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	schedule, err := parseSchedule(cronExpr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	warning := frequentScheduleWarning(cronExpr, schedule)
+	if warning != "" && r.FormValue("allow_frequent") == "" {
+		http.Error(w, "Refusing to add job: "+warning+". Tick \"Allow frequent runs\" to add it anyway.", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
-
-	// _, err = file.WriteString("\n" + cronExpr + " " + command)
-	// if err != nil {
-	// 	http.Error(w, "Error writing to cron jobs file", http.StatusInternalServerError)
-	// 	return
-	// }
 
-	_, err = fmt.Fprintf(file, "%s %s\n", cronExpr, command)
+	line := jobLine(cronExpr, "", command)
+	j, err := parseJobLine(line)
 	if err != nil {
-		http.Error(w, "Error writing to cron jobs file", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if j.Exclude {
+		http.Error(w, "Exclusions must follow the job they apply to in the cron jobs file", http.StatusBadRequest)
 		return
 	}
+	j.Phrase = phrase
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	// Jobs of the default tenant are added to the cron jobs file as well, so
+	// they survive a restart. Other tenants have no cron jobs file.
+	tenant, source := requestTenant(r), "db"
+	if tenant == defaultTenant {
+		source = "file"
+	}
+	if err := storage.CreateJob(tenant, source, j); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if source == "file" {
+		if err := appendJobToFile(cronJobsFile, line); err != nil {
+			fmt.Printf("Error adding job %s: %s\n", j.Name, err)
+			if _, err := storage.DeleteJob(tenant, j.Name); err != nil {
+				fmt.Printf("Error removing job %s: %s\n", j.Name, err)
+			}
+			http.Error(w, "Error writing to cron jobs file", http.StatusInternalServerError)
+			return
+		}
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Added job %s by %s", j.Name, requestActor(r)))
+	requestReconcile()
+
+	http.Redirect(w, r, tenantURL(r, "/"), http.StatusSeeOther)
 }
 
 func main() {
+	flag.BoolVar(&dryRun, "dry-run", false, "record what would run without executing any commands")
+	flag.BoolVar(&safeMode, "safe-mode", false, "disable all job execution while keeping the web interface running")
+	flag.IntVar(&loadTestJobs, "load-test", 0, "register this many synthetic no-op jobs and report scheduler lag, DB write latency and memory")
+	flag.StringVar(&loadTestSchedules, "load-test-schedule", "* * * * *", "comma separated cron expressions assigned in turn to the load test jobs")
+	flag.Parse()
+
+	// gtask validate checks the configuration without starting the scheduler
+	if flag.Arg(0) == "validate" {
+		os.Exit(runValidate(flag.Args()[1:]))
+	}
 
 	// Load environment variables from .env file
 	loadErr := godotenv.Load()
@@ -487,6 +1374,10 @@ func main() {
 		}
 	}
 
+	defaultJobEnv = loadDefaultJobEnv()
+	runnerName = resolveRunnerName()
+	hostName, _ = os.Hostname()
+
 	var err error
 	logFilePath := fmt.Sprintf("%s/scheduler.log", logDir)
 	logFile, err = initLogFile(logFilePath)
@@ -494,7 +1385,14 @@ func main() {
 		fmt.Printf("Error initializing log file: %s\n", err)
 		return
 	}
-	defer logFile.Close()
+	defer func() {
+		logFile.Sync()
+		logFile.Close()
+	}()
+	if err := initLogOutputs(); err != nil {
+		fmt.Printf("Error opening log outputs: %s\n", err)
+	}
+	defer closeLogOutputs()
 
 	db, err = initDatabase(fmt.Sprintf("%s/jobs.db", dbDir))
 	if err != nil {
@@ -503,18 +1401,168 @@ func main() {
 	}
 	defer db.Close()
 
-	c := cron.New()
-	scheduleJobsFromFile(c, "cron_jobs.txt")
+	err = prepareStatements(db)
+	if err != nil {
+		fmt.Printf("Error preparing statements: %s\n", err)
+		return
+	}
+	defer closeStatements()
+	storage = newSQLiteStore(db)
+
+	startWriteQueue()
+	startWorkerPool()
+	defer stopWriteQueue()
+	if shippers, err := newLogShippers(); err != nil {
+		fmt.Printf("Error configuring log shipping: %s\n", err)
+	} else {
+		startLogShipping(shippers)
+		defer stopLogShipping()
+	}
+
+	err = loadTenants()
+	if err != nil {
+		fmt.Printf("Error initializing database: %s\n", err)
+		return
+	}
+
+	err = loadUsersExist()
+	if err != nil {
+		fmt.Printf("Error initializing database: %s\n", err)
+		return
+	}
+	if _, err := parseGroupRoles(os.Getenv("SSO_GROUP_ROLES")); err != nil {
+		fmt.Printf("Error in SSO_GROUP_ROLES: %s\n", err)
+	}
+
+	err = loadPauseState()
+	if err != nil {
+		fmt.Printf("Error initializing database: %s\n", err)
+		return
+	}
+
+	registerNotifiers()
+	if exporter, ok, err := newOTLPExporter(); err != nil {
+		fmt.Printf("Error configuring tracing: %s\n", err)
+	} else if ok {
+		traceExporter = exporter
+	}
+	startDiskJanitor(logDir, dbDir)
+
+	c := cron.New(cron.WithParser(cronParser))
+	syncJobsFromFile("cron_jobs.txt")
+	watchJobsYAML(jobsYAMLFile())
+	startGitSync()
+	startedAt := time.Now()
+	expectedRuns := loadExpectedRuns()
+	scheduleJobsFromTable(c)
+	scheduleMaintenance(c)
+	scheduleDigest(c)
+	if loadTestJobs > 0 {
+		if err := startLoadTest(c, loadTestJobs, loadTestSchedules); err != nil {
+			fmt.Printf("Error starting load test: %s\n", err)
+			return
+		}
+	}
 	c.Start()
 	logSchedulerStart()
+	if dryRun {
+		logDryRunProjection()
+	}
+	runRebootJobs()
+	catchUpMissedRuns(expectedRuns, startedAt)
+	startMissedRunWatchdog()
 
 	http.HandleFunc("/", distinctCommandsHandler)
 	http.HandleFunc("/download", downloadLogHandler)
 	http.HandleFunc("/add-job", addJobHandler)
+	http.HandleFunc("/jobs", jobsHandler)
+	http.HandleFunc("/edit-job", editJobHandler)
+	http.HandleFunc("POST /run-job", runJobHandler)
+	http.HandleFunc("POST /enable-job", enableJobHandler)
+	http.HandleFunc("POST /delete-job", deleteJobHandler)
+	http.HandleFunc("/timeline", timelineHandler)
+	http.HandleFunc("/maintenance", maintenanceWindowsHandler)
+	http.HandleFunc("POST /maintenance/end", endMaintenanceWindowHandler)
+	http.HandleFunc("/calendars", calendarsHandler)
+	http.HandleFunc("POST /calendars/delete", deleteCalendarHandler)
+	http.HandleFunc("/preferences", preferencesHandler)
+	http.HandleFunc("/login", loginHandler)
+	http.HandleFunc("/login/2fa", secondFactorHandler)
+	http.HandleFunc("GET /login/sso", ssoLoginHandler)
+	http.HandleFunc("GET /login/sso/callback", ssoCallbackHandler)
+	http.HandleFunc("/account/2fa", accountTOTPHandler)
+	http.HandleFunc("POST /logout", logoutHandler)
+	http.HandleFunc("/users", usersHandler)
+	http.HandleFunc("GET /api/v1/users", apiListUsersHandler)
+	http.HandleFunc("POST /api/v1/users", apiManageUserHandler)
+	http.HandleFunc("POST /api/v1/users/{name}/{action}", apiManageUserHandler)
+	http.HandleFunc("DELETE /api/v1/users/{name}", apiManageUserHandler)
+	http.HandleFunc("/events", eventsHandler)
+	http.HandleFunc("GET /api/v1/events", apiEventsHandler)
+	http.HandleFunc("POST /preferences/favorite", favoriteHandler)
+	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("GET /badge/{file}", badgeHandler)
+	http.HandleFunc("GET /api/v1/timeline", apiTimelineHandler)
+	http.HandleFunc("GET /api/v1/summary", apiSummaryHandler)
+	http.HandleFunc("POST /api/v1/apply", apiApplyHandler)
+	http.HandleFunc("PUT /api/v1/jobs/{name}", apiPutJobHandler)
+	http.HandleFunc("PATCH /api/v1/jobs/{name}", apiEditJobHandler)
+	http.HandleFunc("DELETE /api/v1/jobs/{name}", apiDeleteJobHandler)
+	http.HandleFunc("POST /api/v1/jobs/{name}/run", apiRunJobHandler)
+	http.HandleFunc("POST /api/v1/jobs/{name}/enable", apiEnableJobHandler)
+	http.HandleFunc("GET /api/v1/jobs/{name}/stats", apiJobStatsHandler)
+	http.HandleFunc("/runs", runHistoryHandler)
+	http.HandleFunc("GET /api/v1/runs", apiRunsHandler)
+	http.HandleFunc("/runs/diff", runDiffHandler)
+	http.HandleFunc("GET /api/v1/runs/diff", apiRunDiffHandler)
+	http.HandleFunc("/search", searchHandler)
+	http.HandleFunc("GET /api/v1/search", apiSearchHandler)
+	http.HandleFunc("GET /api/v1/runs/running", apiRunningRunsHandler)
+	http.HandleFunc("POST /api/v1/runs/{uid}/cancel", apiCancelRunHandler)
+	http.HandleFunc("POST /cancel-run", cancelRunHandler)
+	http.HandleFunc("GET /api/v1/jobs/quarantined", apiQuarantinedJobsHandler)
+	http.HandleFunc("GET /api/v1/jobs/missed", apiMissedRunsHandler)
+	http.HandleFunc("GET /api/v1/sla-breaches", apiSLABreachesHandler)
+	http.HandleFunc("/import", importHandler)
+	http.HandleFunc("POST /api/v1/import", apiImportHandler)
+	http.HandleFunc("GET /api/v1/jobs/{name}/inject-failure", apiInjectFailureHandler)
+	http.HandleFunc("POST /api/v1/jobs/{name}/inject-failure", apiInjectFailureHandler)
+	http.HandleFunc("DELETE /api/v1/jobs/{name}/inject-failure", apiInjectFailureHandler)
 	http.HandleFunc("/submit-job", submitJobHandler)
-	err = http.ListenAndServe("0.0.0.0:8000", nil)
-	if err != nil {
+	http.HandleFunc("/metrics", metricsHandler)
+	http.HandleFunc("GET /healthz", healthzHandler)
+	http.HandleFunc("/scheduler/pause", pauseHandler)
+	http.HandleFunc("/scheduler/resume", resumeHandler)
+	http.HandleFunc("GET /api/v1/cron/entries", apiCronEntriesHandler(c))
+	http.HandleFunc("GET /api/v1/cron/preview", apiCronPreviewHandler)
+	http.HandleFunc("GET /api/v1/diagnostics/drift", apiDriftHandler(c))
+	http.HandleFunc("/diagnostics", diagnosticsHandler(c))
+	http.HandleFunc("POST /api/v1/scheduler/pause", apiSetPausedHandler(true))
+	http.HandleFunc("POST /api/v1/scheduler/resume", apiSetPausedHandler(false))
+	http.HandleFunc("GET /api/v1/maintenance-windows", apiMaintenanceWindowsHandler)
+	http.HandleFunc("POST /api/v1/maintenance-windows", apiCreateMaintenanceWindowHandler)
+	http.HandleFunc("POST /api/v1/maintenance-windows/{id}/end", apiEndMaintenanceWindowHandler)
+	http.HandleFunc("GET /api/v1/calendars", apiCalendarsHandler)
+	http.HandleFunc("GET /api/v1/calendars/{name}", apiCalendarHandler)
+	http.HandleFunc("PUT /api/v1/calendars/{name}", apiPutCalendarHandler)
+	http.HandleFunc("DELETE /api/v1/calendars/{name}", apiDeleteCalendarHandler)
+	http.HandleFunc("POST /webhooks/scheduler/{action}", controlWebhookHandler)
+	http.HandleFunc("POST /webhooks/jobs/{name}/{action}", controlWebhookHandler)
+	http.HandleFunc("POST /slack/command", slackCommandHandler)
+	// SIGINT and SIGTERM shut the scheduler down gracefully
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	server := &http.Server{Addr: "0.0.0.0:8000", Handler: tenantMiddleware(sessionMiddleware(http.DefaultServeMux))}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
 		fmt.Printf("Error starting server: %s\n", err)
-		return
+		recordEvent("", eventScheduler, "Scheduler stopped: "+err.Error())
+	case sig := <-signals:
+		shutdown(c, server, sig)
 	}
 }
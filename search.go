@@ -0,0 +1,219 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Whether run outputs are indexed in the job_status_fts table. SQLite's FTS5
+// module is only built in with the sqlite_fts5 build tag; without it, output
+// search scans the outputs instead.
+var outputSearchIndexed bool
+
+// Characters of output shown around a search match
+const searchExcerptLength = 200
+
+// Function to set up the full-text index of run outputs, an FTS5 table kept
+// in step with job_status by triggers. The index is rebuilt whenever the
+// triggers were missing, such as after running a build without FTS5.
+func initOutputSearch(database *sql.DB) error {
+	var available bool
+	if err := database.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&available); err != nil {
+		return err
+	}
+	if !available {
+		// Runs stored by this build would not reach the index, and the
+		// triggers would make storing them fail, so leave the index behind
+		_, err := database.Exec(`DROP TRIGGER IF EXISTS job_status_fts_insert;
+DROP TRIGGER IF EXISTS job_status_fts_delete;
+DROP TRIGGER IF EXISTS job_status_fts_update;`)
+		return err
+	}
+	_, err := database.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS job_status_fts USING fts5(output, content='job_status', content_rowid='job_id')`)
+	if err != nil {
+		return err
+	}
+
+	var triggers int
+	if err := database.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'job_status_fts_%'`).Scan(&triggers); err != nil {
+		return err
+	}
+	if triggers < 3 {
+		fmt.Println("Indexing run outputs for search")
+		_, err = database.Exec(`INSERT INTO job_status_fts(job_status_fts) VALUES ('rebuild');
+CREATE TRIGGER IF NOT EXISTS job_status_fts_insert AFTER INSERT ON job_status BEGIN
+    INSERT INTO job_status_fts(rowid, output) VALUES (new.job_id, new.output);
+END;
+CREATE TRIGGER IF NOT EXISTS job_status_fts_delete AFTER DELETE ON job_status BEGIN
+    INSERT INTO job_status_fts(job_status_fts, rowid, output) VALUES ('delete', old.job_id, old.output);
+END;
+CREATE TRIGGER IF NOT EXISTS job_status_fts_update AFTER UPDATE OF output ON job_status BEGIN
+    INSERT INTO job_status_fts(job_status_fts, rowid, output) VALUES ('delete', old.job_id, old.output);
+    INSERT INTO job_status_fts(rowid, output) VALUES (new.job_id, new.output);
+END;`)
+		if err != nil {
+			return err
+		}
+	}
+	outputSearchIndexed = true
+	return nil
+}
+
+// Function to get the SQL condition and argument matching runs whose output
+// contains the given text. Indexed searches match the words of the text as a
+// phrase, ignoring case and punctuation; unindexed ones match it as is,
+// ignoring the case of ASCII letters.
+func outputSearchCondition(text string) (string, any) {
+	if outputSearchIndexed {
+		return `job_id IN (SELECT rowid FROM job_status_fts WHERE job_status_fts MATCH ?)`, `"` + strings.ReplaceAll(text, `"`, `""`) + `"`
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(text)
+	return `output LIKE ? ESCAPE '\'`, "%" + escaped + "%"
+}
+
+// Function to cut the part of an output around the first match of a search,
+// or its start when the match cannot be located, such as when the indexed
+// search matched across punctuation
+func searchExcerpt(output, text string) string {
+	start := strings.Index(strings.ToLower(output), strings.ToLower(text))
+	if start < 0 {
+		start = 0
+	}
+	start = max(0, start-(searchExcerptLength-len(text))/2)
+	end := min(len(output), start+searchExcerptLength)
+	// Keep to whole UTF-8 characters
+	for start > 0 && start < len(output) && output[start]&0xC0 == 0x80 {
+		start--
+	}
+	for end < len(output) && output[end]&0xC0 == 0x80 {
+		end++
+	}
+	excerpt := strings.Join(strings.Fields(output[start:end]), " ")
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if end < len(output) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
+// Handler for GET /api/v1/search, listing the tenant's runs whose output
+// contains the q parameter, newest first, with an excerpt of the match.
+// Accepts the filters of GET /api/v1/runs as well.
+func apiSearchHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := parseRunFilter(r, time.UTC)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if f.Search == "" {
+		writeJSONError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	runs, err := storage.ListRuns(requestTenant(r), f)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// Handler for the search page, finding the runs whose output contains a
+// message, such as an error, without downloading their logs
+func searchHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	prefs, err := loadPreferences(tenant, requestUser(r))
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	loc := prefs.Location()
+	f, err := parseRunFilter(r, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var runs []PastRun
+	if f.Search != "" {
+		if runs, err = storage.ListRuns(tenant, f); err != nil {
+			http.Error(w, "Error querying database", http.StatusInternalServerError)
+			return
+		}
+	}
+	names, err := runJobNames(tenant)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	jobOptions := `<option value="">All jobs</option>`
+	for _, name := range names {
+		jobOptions += fmt.Sprintf(`<option value="%s" %s>%s</option>`, html.EscapeString(name), checkSelected(f.Job, name), html.EscapeString(name))
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Search Outputs</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Search Outputs</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	            <a href="`+tenantURL(r, "/runs")+`" class="btn btn-outline-secondary">Run History</a>
+	        </div>
+	        <form action="`+tenantURL(r, "/search")+`" method="get" class="row g-2 mb-3">
+	            <div class="col-md-7"><input type="search" name="q" class="form-control" placeholder="Text in the output, such as an error message" value="`+html.EscapeString(f.Search)+`" required></div>
+	            <div class="col-md-3"><select name="job" class="form-select">`+jobOptions+`</select></div>
+	            <div class="col-md-2"><button type="submit" class="btn btn-primary">Search</button></div>
+	        </form>`)
+
+	if f.Search != "" {
+		if len(runs) == 0 {
+			fmt.Fprintln(w, `<p>No run output contains this text.</p>`)
+		}
+		for _, run := range runs {
+			job := html.EscapeString(run.Job)
+			if job == "" {
+				job = html.EscapeString(run.Command)
+			}
+			if run.RunNumber > 0 {
+				job += fmt.Sprintf(" run #%d", run.RunNumber)
+			}
+			fmt.Fprintf(w, `<div class="card mb-2">
+				<div class="card-body">
+					<div class="d-flex justify-content-between">
+						<div><strong>%s</strong> <span class="text-muted">%s, %s</span></div>
+						<a href="%s" class="btn btn-sm btn-outline-primary">Download</a>
+					</div>
+					<pre class="mb-0 mt-2 text-wrap">%s</pre>
+				</div>
+			</div>`, job, displayStorageTime(run.Timestamp, loc), html.EscapeString(run.Status),
+				html.EscapeString(tenantURL(r, "/download?task_id="+url.QueryEscape(run.UID))), html.EscapeString(run.Match))
+		}
+		if len(runs) == f.Limit {
+			next := url.Values{"q": {f.Search}, "before": {fmt.Sprint(runs[len(runs)-1].ID)}}
+			if f.Job != "" {
+				next.Set("job", f.Job)
+			}
+			fmt.Fprintln(w, `<a href="`+html.EscapeString(tenantURL(r, "/search?"+next.Encode()))+`" class="btn btn-outline-secondary">Older</a>`)
+		}
+	}
+
+	fmt.Fprintln(w, `
+	    </div>
+	</body>
+	</html>
+	`)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cookie holding the session token
+const sessionCookieName = "gtask_session"
+
+// Struct to hold a signed-in session
+type Session struct {
+	Tenant     string
+	User       string
+	Source     string // "local" for local users and the account from the settings, "sso" for single sign-on, "basic" for API requests with basic authentication
+	Role       string // role granted by the identity provider, for single sign-on only
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+type sessionContextKey struct{}
+
+// Paths that stay reachable without signing in: the login page, pages meant
+// for the public, and endpoints with their own authentication
+var publicPathPrefixes = []string{"/login", "/status", "/badge/", "/webhooks/", "/slack/", "/metrics", "/healthz"}
+
+// Function to tell whether signing in is required, which is the case once an
+// administrator password is configured, local users exist or single sign-on is set up
+func authEnabled() bool {
+	return os.Getenv("ADMIN_PASSWORD") != "" || usersExist.Load() || oidcEnabled()
+}
+
+// Helper function to hash a session token; only hashes are stored so a leaked
+// database does not hand out sessions
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Function to start a session for a user and hand its token to the browser
+func createSession(w http.ResponseWriter, r *http.Request, tenant, user, source, role string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return fmt.Errorf("error generating session token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	now := formatStorageTime(time.Now())
+
+	mu.Lock()
+	_, err := db.Exec(`INSERT INTO sessions (token_hash, tenant, user, source, role, created_at, last_seen_at, remote_addr, user_agent) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		hashSessionToken(token), tenant, user, source, role, now, now, r.RemoteAddr, r.UserAgent())
+	mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || getEnvBool("SESSION_COOKIE_SECURE", false),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Function to look up the session of a request. Sessions idle for longer than
+// SESSION_IDLE_TIMEOUT or older than SESSION_MAX_AGE are ended.
+func lookupSession(r *http.Request) (Session, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return Session{}, false
+	}
+	tokenHash := hashSessionToken(cookie.Value)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var s Session
+	var createdAt, lastSeenAt string
+	err = db.QueryRow(`SELECT tenant, user, source, role, created_at, last_seen_at FROM sessions WHERE token_hash = ?`, tokenHash).
+		Scan(&s.Tenant, &s.User, &s.Source, &s.Role, &createdAt, &lastSeenAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error loading session: %s\n", err)
+		}
+		return Session{}, false
+	}
+	s.CreatedAt, _ = time.Parse(storageTimeFormat, createdAt)
+	s.LastSeenAt, _ = time.Parse(storageTimeFormat, lastSeenAt)
+
+	now := time.Now()
+	if now.Sub(s.LastSeenAt) > getEnvDuration("SESSION_IDLE_TIMEOUT", 30*time.Minute) ||
+		now.Sub(s.CreatedAt) > getEnvDuration("SESSION_MAX_AGE", 12*time.Hour) {
+		if _, err := db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash); err != nil {
+			fmt.Printf("Error ending expired session: %s\n", err)
+		}
+		return Session{}, false
+	}
+
+	// Only record activity once a minute to keep page loads from writing
+	if now.Sub(s.LastSeenAt) > time.Minute {
+		s.LastSeenAt = now
+		if _, err := db.Exec(`UPDATE sessions SET last_seen_at = ? WHERE token_hash = ?`, formatStorageTime(now), tokenHash); err != nil {
+			fmt.Printf("Error updating session: %s\n", err)
+		}
+	}
+	return s, true
+}
+
+// Function to end the session of a request, or with everywhere set, every
+// session of its user
+func endSession(w http.ResponseWriter, r *http.Request, everywhere bool) error {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	tokenHash := hashSessionToken(cookie.Value)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if everywhere {
+		_, err = db.Exec(`
+			DELETE FROM sessions
+			WHERE (tenant, user) IN (SELECT tenant, user FROM sessions WHERE token_hash = ?)`, tokenHash)
+	} else {
+		_, err = db.Exec(`DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+	}
+	if err != nil {
+		return fmt.Errorf("error ending session: %w", err)
+	}
+	return nil
+}
+
+// Function to delete sessions that can no longer be used
+func pruneSessions() {
+	now := time.Now()
+	idleBefore := formatStorageTime(now.Add(-getEnvDuration("SESSION_IDLE_TIMEOUT", 30*time.Minute)))
+	createdBefore := formatStorageTime(now.Add(-getEnvDuration("SESSION_MAX_AGE", 12*time.Hour)))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := db.Exec(`DELETE FROM sessions WHERE last_seen_at < ? OR created_at < ?`, idleBefore, createdBefore); err != nil {
+		fmt.Printf("Error pruning sessions: %s\n", err)
+	}
+}
+
+// Function to get the session a request was made with, if any
+func requestSession(r *http.Request) (Session, bool) {
+	s, ok := r.Context().Value(sessionContextKey{}).(Session)
+	return s, ok
+}
+
+// Function to wrap the web server so that, when signing in is required, pages
+// other than the public ones need a session of the request's tenant. Requests
+// without one are sent to the login page, except API requests, which may use
+// HTTP basic authentication instead and are refused when they have neither.
+func sessionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := lookupSession(r); ok && s.Tenant == requestTenant(r) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s)))
+			return
+		}
+		if !authEnabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range publicPathPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			if username, ok := basicAuthUser(r); ok {
+				s := Session{Tenant: requestTenant(r), User: username, Source: "basic"}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s)))
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="gtask"`)
+			writeJSONError(w, http.StatusUnauthorized, "sign in or use HTTP basic authentication")
+			return
+		}
+		http.Redirect(w, r, tenantURL(r, "/login")+"?next="+url.QueryEscape(tenantURL(r, r.URL.RequestURI())), http.StatusSeeOther)
+	})
+}
+
+// Helper function to keep redirects after login on this site
+func safeRedirectTarget(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// Handler for the login page
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := safeRedirectTarget(r.FormValue("next"))
+	if next == "/" {
+		next = tenantURL(r, "/")
+	}
+	message := ""
+
+	if r.Method == http.MethodPost {
+		tenant := requestTenant(r)
+		username := r.FormValue("username")
+		allowed, wait := checkLogin(r, tenant, username, r.FormValue("password"))
+		switch {
+		case wait > 0:
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			w.WriteHeader(http.StatusTooManyRequests)
+			message = fmt.Sprintf(`<div class="alert alert-danger">Too many failed sign-ins, try again in %s.</div>`, wait.Round(time.Second))
+		case allowed && totpRequired(tenant, username):
+			startSecondFactor(w, r, tenant, username, next)
+			return
+		case allowed:
+			completeLogin(w, r, tenant, username, next)
+			return
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			message = `<div class="alert alert-danger">Invalid username or password.</div>`
+		}
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Sign In</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5" style="max-width: 420px;">
+	        <h1>Sign In</h1>
+	        `+message+`
+	        <form action="`+tenantURL(r, "/login")+`" method="post">
+	            <input type="hidden" name="next" value="`+html.EscapeString(next)+`">
+	            <div class="mb-3">
+	                <label for="username" class="form-label">Username</label>
+	                <input type="text" class="form-control" id="username" name="username" autocomplete="username" required>
+	            </div>
+	            <div class="mb-3">
+	                <label for="password" class="form-label">Password</label>
+	                <input type="password" class="form-control" id="password" name="password" autocomplete="current-password" required>
+	            </div>
+	            <button type="submit" class="btn btn-primary">Sign In</button>
+	        </form>
+	        `+ssoButton(r, next)+`
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Function to finish signing in by starting a session and returning to the
+// page the user came from
+func completeLogin(w http.ResponseWriter, r *http.Request, tenant, username, next string) {
+	pruneSessions()
+	if err := createSession(w, r, tenant, username, "local", ""); err != nil {
+		fmt.Printf("Error creating session: %s\n", err)
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	recordEvent(tenant, eventAuth, fmt.Sprintf("User %s signed in from %s", username, r.RemoteAddr))
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// Helper function to render the single sign-on button of the login page
+func ssoButton(r *http.Request, next string) string {
+	if !oidcEnabled() {
+		return ""
+	}
+	return `<hr><a href="` + tenantURL(r, "/login/sso") + `?next=` + url.QueryEscape(next) + `" class="btn btn-outline-primary w-100">Sign In with SSO</a>`
+}
+
+// Handler for signing out, from every device when everywhere=1 is given
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	everywhere := r.FormValue("everywhere") == "1"
+	s, _ := requestSession(r)
+	if err := endSession(w, r, everywhere); err != nil {
+		http.Error(w, "Error signing out", http.StatusInternalServerError)
+		return
+	}
+	if everywhere && s.User != "" {
+		recordEvent(s.Tenant, eventAuth, fmt.Sprintf("User %s signed out everywhere", s.User))
+	}
+	http.Redirect(w, r, tenantURL(r, "/login"), http.StatusSeeOther)
+}
+
+// Helper function to render who is signed in, with sign-out buttons, for the dashboard
+func sessionBar(r *http.Request) string {
+	s, ok := requestSession(r)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(`<form action="%s" method="post" class="d-flex align-items-center gap-2 mb-3">
+	            <span class="text-muted">Signed in as %s</span>
+	            <a href="%s" class="btn btn-sm btn-outline-secondary">Two-Factor Authentication</a>
+	            <button type="submit" class="btn btn-sm btn-outline-secondary">Sign Out</button>
+	            <button type="submit" name="everywhere" value="1" class="btn btn-sm btn-outline-danger">Sign Out Everywhere</button>
+	        </form>`, tenantURL(r, "/logout"), html.EscapeString(s.User), tenantURL(r, "/account/2fa"))
+}
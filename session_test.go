@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// Helper function to give a test a fresh database
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+	database, err := initDatabase(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("initDatabase: %s", err)
+	}
+	db = database
+	t.Cleanup(func() {
+		database.Close()
+		db = nil
+	})
+}
+
+func TestSessionMiddleware(t *testing.T) {
+	openTestDatabase(t)
+	t.Setenv("ADMIN_PASSWORD", "secret")
+
+	var user string
+	handler := sessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, _ := requestSession(r)
+		user = s.User
+	}))
+
+	tests := []struct {
+		name         string
+		method, path string
+		username     string
+		password     string
+		wantStatus   int
+		wantUser     string
+	}{
+		{name: "anonymous API read", method: "GET", path: "/api/v1/users", wantStatus: http.StatusUnauthorized},
+		{name: "anonymous API write", method: "PUT", path: "/api/v1/jobs/backup", wantStatus: http.StatusUnauthorized},
+		{name: "API with wrong password", method: "GET", path: "/api/v1/users", username: "admin", password: "wrong", wantStatus: http.StatusUnauthorized},
+		{name: "API with basic auth", method: "GET", path: "/api/v1/users", username: "admin", password: "secret", wantStatus: http.StatusOK, wantUser: "admin"},
+		{name: "anonymous run history", method: "GET", path: "/api/v1/runs?job=backup", wantStatus: http.StatusUnauthorized},
+		{name: "anonymous search", method: "GET", path: "/api/v1/search?q=error", wantStatus: http.StatusUnauthorized},
+		{name: "anonymous run diff", method: "GET", path: "/api/v1/runs/diff?from=a&to=b", wantStatus: http.StatusUnauthorized},
+		{name: "anonymous page", method: "GET", path: "/jobs", wantStatus: http.StatusSeeOther},
+		{name: "status page", method: "GET", path: "/status", wantStatus: http.StatusOK},
+		{name: "webhook", method: "POST", path: "/webhooks/scheduler/pause", wantStatus: http.StatusOK},
+		{name: "Slack command", method: "POST", path: "/slack/command", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user = ""
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+			if tt.username != "" {
+				r.SetBasicAuth(tt.username, tt.password)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if user != tt.wantUser {
+				t.Errorf("session user = %q, want %q", user, tt.wantUser)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestSessionMiddlewareWithoutAuth(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "")
+	reached := false
+	handler := sessionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/runs", nil))
+	if !reached || w.Code != http.StatusOK {
+		t.Fatalf("status = %d, reached = %v; want the API open while signing in is not required", w.Code, reached)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Struct to track the job runs in progress, so a shutdown can wait for them
+type runTracker struct {
+	mu       sync.Mutex
+	count    int
+	draining bool
+	idle     chan struct{} // closed once draining and no runs are left
+	stopping chan struct{} // closed once draining
+}
+
+// Runs in progress across every tenant
+var inFlight = &runTracker{stopping: make(chan struct{})}
+
+// Function to count a run as started. Returns false once the scheduler is
+// shutting down, in which case the run must not start.
+func (t *runTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.count++
+	return true
+}
+
+// Function to count a run as finished
+func (t *runTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count--
+	if t.draining && t.count == 0 {
+		close(t.idle)
+	}
+}
+
+// Function to wait before retrying a run. Returns false without waiting out
+// the delay when the scheduler starts shutting down or abort is closed.
+func (t *runTracker) wait(delay time.Duration, abort <-chan struct{}) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-t.stopping:
+		return false
+	case <-abort:
+		return false
+	}
+}
+
+// Function to refuse new runs, returning the number still in progress and a
+// channel closed once they have all finished
+func (t *runTracker) drain() (int, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.draining {
+		t.draining = true
+		close(t.stopping)
+		t.idle = make(chan struct{})
+		if t.count == 0 {
+			close(t.idle)
+		}
+	}
+	return t.count, t.idle
+}
+
+// Function to shut the scheduler down gracefully after a signal: no new runs
+// are started, running jobs get SHUTDOWN_TIMEOUT to finish and are cancelled
+// after that, so their output is still recorded, and the web server is
+// stopped. The caller then flushes the write queue and closes the database.
+func shutdown(c *cron.Cron, server *http.Server, sig os.Signal) {
+	c.Stop()
+	running, idle := inFlight.drain()
+	timeout := getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	recordEvent("", eventScheduler, fmt.Sprintf("Scheduler stopping on %s, waiting up to %s for %d running jobs", sig, timeout, running))
+
+	select {
+	case <-idle:
+	case <-time.After(timeout):
+		left := cancelAllRuns("shutdown")
+		recordEvent("", eventScheduler, fmt.Sprintf("Cancelled %d jobs still running after %s", left, timeout))
+		select {
+		case <-idle:
+		case <-time.After(getEnvDuration("RUN_CANCEL_GRACE", 5*time.Second) + time.Second):
+			fmt.Println("Error stopping: jobs are still running, their runs are not recorded")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("Error stopping server: %s\n", err)
+	}
+	recordEvent("", eventScheduler, "Scheduler stopped on "+runnerName)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Struct to hold a run that took longer than its job's sla option
+type slaBreach struct {
+	ID         int64  `json:"id"`
+	Job        string `json:"job"`
+	TaskID     string `json:"task_id"`
+	SLA        string `json:"sla"`
+	StartedAt  string `json:"started_at"`
+	BreachedAt string `json:"breached_at"`
+	FinishedAt string `json:"finished_at,omitempty"` // empty while the run is in progress
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Status     string `json:"status,omitempty"`
+}
+
+// Function to watch a run attempt for an SLA breach. The returned function is
+// called when the attempt ends and reports whether the SLA was breached.
+func watchSLA(j Job, uid string, start time.Time) func(status string, end time.Time) bool {
+	if j.SLA <= 0 {
+		return func(string, time.Time) bool { return false }
+	}
+	breached := make(chan struct{})
+	timer := time.AfterFunc(j.SLA, func() {
+		defer close(breached)
+		recordSLABreach(j, uid, start)
+	})
+	return func(status string, end time.Time) bool {
+		if timer.Stop() {
+			return false
+		}
+		<-breached
+		finishSLABreach(j, uid, status, end.Sub(start))
+		return true
+	}
+}
+
+// Function to record that a run is taking longer than its job's SLA and
+// notify, while the run is still in progress
+func recordSLABreach(j Job, uid string, start time.Time) {
+	mu.Lock()
+	_, err := db.Exec(`INSERT INTO sla_breaches (tenant, job_name, task_id, sla, started_at, breached_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		j.Tenant, j.Name, uid, j.SLA.String(), formatStorageTime(start), formatStorageTime(time.Now()))
+	mu.Unlock()
+	if err != nil {
+		fmt.Printf("Error recording SLA breach of job %s: %s\n", j.Name, err)
+	}
+
+	message := fmt.Sprintf("Run %s of job %s has been running for longer than its SLA of %s", uid, j.Name, j.SLA)
+	recordEvent(j.Tenant, eventJob, message)
+	notifyTenant(j.Tenant, "warning", fmt.Sprintf("SLA breached by job %s", j.Name), message)
+}
+
+// Function to complete a recorded SLA breach once the run has ended
+func finishSLABreach(j Job, uid, status string, duration time.Duration) {
+	mu.Lock()
+	_, err := db.Exec(`UPDATE sla_breaches SET finished_at = ?, duration_ms = ?, status = ? WHERE task_id = ?`,
+		formatStorageTime(time.Now()), duration.Milliseconds(), status, uid)
+	mu.Unlock()
+	if err != nil {
+		fmt.Printf("Error recording SLA breach of job %s: %s\n", j.Name, err)
+	}
+}
+
+// Function to list a tenant's latest SLA breaches, of one job when name is not empty
+func listSLABreaches(tenant, name string, limit int) ([]slaBreach, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`
+		SELECT id, job_name, task_id, sla, started_at, breached_at, finished_at, duration_ms, status
+		FROM sla_breaches
+		WHERE tenant = ? AND (? = '' OR job_name = ?)
+		ORDER BY id DESC
+		LIMIT ?`, tenant, name, name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying SLA breaches: %w", err)
+	}
+	defer rows.Close()
+
+	list := []slaBreach{}
+	for rows.Next() {
+		var b slaBreach
+		if err := rows.Scan(&b.ID, &b.Job, &b.TaskID, &b.SLA, &b.StartedAt, &b.BreachedAt, &b.FinishedAt, &b.DurationMs, &b.Status); err != nil {
+			return nil, fmt.Errorf("error reading SLA breaches: %w", err)
+		}
+		list = append(list, b)
+	}
+	return list, rows.Err()
+}
+
+// Handler for GET /api/v1/sla-breaches, listing the tenant's latest SLA
+// breaches, newest first. ?job= limits the list to one job, ?limit= sets its
+// length (100 by default).
+func apiSLABreachesHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeJSONError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+	list, err := listSLABreaches(requestTenant(r), r.URL.Query().Get("job"), limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
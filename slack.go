@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Requests signed longer ago than this are rejected to prevent replays
+const slackMaxRequestAge = 5 * time.Minute
+
+// Function to verify a Slack request signature, as described at
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(r *http.Request, body []byte, secret string) error {
+	timestamp := r.Header.Get("X-Slack-Request-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid request timestamp")
+	}
+	if age := time.Since(time.Unix(sent, 0)); math.Abs(float64(age)) > float64(slackMaxRequestAge) {
+		return fmt.Errorf("request timestamp is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// Handler for the Slack slash command, e.g. "/gtask run nightly-backup" or
+// "/gtask status". Requests must be signed with the SLACK_SIGNING_SECRET of
+// their tenant.
+func slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv(tenantSetting(requestTenant(r), "SLACK_SIGNING_SECRET"))
+	if secret == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Error reading request", http.StatusBadRequest)
+		return
+	}
+	if err := verifySlackSignature(r, body, secret); err != nil {
+		recordEvent(requestTenant(r), eventAuth, fmt.Sprintf("Rejected Slack command from %s: %s", r.RemoteAddr, err))
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Invalid form body", http.StatusBadRequest)
+		return
+	}
+
+	// Job names may contain spaces, so everything after the subcommand is the name
+	user := form.Get("user_name")
+	command, name, _ := strings.Cut(strings.TrimSpace(form.Get("text")), " ")
+	name = strings.TrimSpace(name)
+
+	switch {
+	case command == "run" && name != "":
+		j, ok := lookupJob(requestTenant(r), name)
+		if !ok {
+			writeSlackReply(w, false, fmt.Sprintf("No scheduled job is named `%s`.", name))
+			return
+		}
+		recordEvent(j.Tenant, eventJob, fmt.Sprintf("Job %s started from Slack by %s", j.Name, user))
+		go job(j, nil)
+		writeSlackReply(w, true, fmt.Sprintf("%s started `%s`. Use `/gtask status %s` to see how it went.", user, j.Name, j.Name))
+	case command == "status" && name != "":
+		writeSlackReply(w, false, slackJobStatus(requestTenant(r), name))
+	case command == "status":
+		writeSlackReply(w, false, slackSchedulerStatus(requestTenant(r)))
+	default:
+		writeSlackReply(w, false, "Usage:\n`/gtask run <job>` starts a job now\n`/gtask status` shows the scheduler summary\n`/gtask status <job>` shows a job's latest run")
+	}
+}
+
+// Helper function to answer a slash command, visible to the whole channel when inChannel is set
+func writeSlackReply(w http.ResponseWriter, inChannel bool, text string) {
+	responseType := "ephemeral"
+	if inChannel {
+		responseType = "in_channel"
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"response_type": responseType, "text": text})
+}
+
+// Function to describe a tenant's jobs for "/gtask status"
+func slackSchedulerStatus(tenant string) string {
+	summary, err := loadSummary(tenant)
+	if err != nil {
+		return "Error loading the summary: " + err.Error()
+	}
+	text := fmt.Sprintf("%d active jobs, %d running now. Today: %d runs, %d failures, %.1fs average duration.",
+		summary.ActiveJobs, summary.CurrentlyRunning, summary.RunsToday, summary.FailuresToday, summary.AvgDurationSeconds)
+	if state := currentPauseState(tenant); state.Paused {
+		text += fmt.Sprintf("\nScheduling is paused since %s by %s.", state.Timestamp, state.Actor)
+	}
+	return text
+}
+
+// Function to describe the latest run of a tenant's job for "/gtask status <job>"
+func slackJobStatus(tenant, name string) string {
+	mu.Lock()
+	var status, timestamp string
+	var runNumber int64
+	err := db.QueryRow(`
+		SELECT status, timestamp, run_number FROM job_status
+		WHERE tenant = ? AND job_name = ? ORDER BY job_id DESC LIMIT 1`, tenant, name).Scan(&status, &timestamp, &runNumber)
+	mu.Unlock()
+
+	switch {
+	case err == sql.ErrNoRows:
+		return fmt.Sprintf("`%s` has no recorded runs.", name)
+	case err != nil:
+		return "Error loading the job's runs: " + err.Error()
+	}
+	text := fmt.Sprintf("`%s`: %s at %s", name, status, displayStorageTime(timestamp, time.Local))
+	if runNumber > 0 {
+		text += fmt.Sprintf(" (run #%d)", runNumber)
+	}
+	if state := jobPauseState(tenant, name); state.Paused {
+		text += fmt.Sprintf("\nThe job is paused since %s by %s.", state.Timestamp, state.Actor)
+	}
+	return text
+}
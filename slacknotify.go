@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notifier that posts notifications to a Slack channel through an incoming webhook
+type slackNotifier struct {
+	webhookURL string
+	successes  bool // post successful runs too
+	minLevel   string
+	template   *template.Template // text of run messages, see loadNotifyTemplate
+}
+
+// Function to configure the Slack notifier of a tenant from the SLACK_*
+// settings, see tenantSetting. Returns false when SLACK_WEBHOOK_URL is not set.
+func newSlackNotifier(tenant string) (*slackNotifier, bool, error) {
+	setting := func(name string) string { return tenantSetting(tenant, name) }
+	webhookURL := getEnvString(setting("SLACK_WEBHOOK_URL"), "")
+	if webhookURL == "" {
+		return nil, false, nil
+	}
+	if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, false, fmt.Errorf("%s must be an http or https URL", setting("SLACK_WEBHOOK_URL"))
+	}
+	n := &slackNotifier{
+		webhookURL: webhookURL,
+		successes:  getEnvBool(setting("SLACK_NOTIFY_SUCCESS"), false),
+		minLevel:   getEnvString(setting("SLACK_MIN_LEVEL"), "warning"),
+	}
+	if _, ok := notificationLevels[n.minLevel]; !ok {
+		return nil, false, fmt.Errorf("invalid %s %q, expected info, warning or critical", setting("SLACK_MIN_LEVEL"), n.minLevel)
+	}
+	var err error
+	if n.template, err = loadNotifyTemplate(setting("SLACK_TEMPLATE")); err != nil {
+		return nil, false, err
+	}
+	return n, true, nil
+}
+
+func (s *slackNotifier) Notify(n Notification) error {
+	var text string
+	if n.Run != nil {
+		if n.Run.Status == "Success" && !s.successes {
+			return nil
+		}
+		text = slackRunText(*n.Run)
+		if s.template != nil {
+			text = renderNotification(s.template, n)
+		}
+	} else {
+		if notificationLevels[n.Level] < notificationLevels[s.minLevel] {
+			return nil
+		}
+		icon := ":information_source:"
+		switch n.Level {
+		case "warning":
+			icon = ":warning:"
+		case "critical":
+			icon = ":rotating_light:"
+		}
+		text = fmt.Sprintf("%s *%s*\n%s", icon, slackEscape(n.Subject), slackEscape(n.Message))
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(s.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Helper function to format a run for Slack: its job, status, duration and a
+// link to its log, plus the end of its output when it failed
+func slackRunText(run JobStatus) string {
+	var text strings.Builder
+	if run.Status == "Success" {
+		fmt.Fprintf(&text, ":white_check_mark: *Job %s succeeded*", slackEscape(run.JobName))
+	} else {
+		fmt.Fprintf(&text, ":x: *Job %s failed* (%s)", slackEscape(run.JobName), slackEscape(run.Status))
+	}
+	if run.Tenant != defaultTenant {
+		fmt.Fprintf(&text, " in tenant %s", slackEscape(run.Tenant))
+	}
+	fmt.Fprintf(&text, "\nRun #%d took %s", run.RunNumber, runDuration(run).Round(time.Millisecond))
+	if link := runLogURL(run); link != "" {
+		fmt.Fprintf(&text, " · <%s|Download log>", link)
+	}
+	if run.Status != "Success" && run.Output != "" {
+		output := truncateOutput(run.Output, getEnvInt("NOTIFY_OUTPUT_LIMIT", 2000))
+		fmt.Fprintf(&text, "\n```%s```", slackEscape(strings.ReplaceAll(output, "```", "'''")))
+	}
+	return text.String()
+}
+
+// Helper function to escape the characters Slack gives a meaning in messages
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Store keeping jobs and runs in the SQLite database, which mu guards here as
+// everywhere else
+type sqliteStore struct {
+	db *sql.DB
+}
+
+// Function to create the store on an open database whose statements are prepared
+func newSQLiteStore(database *sql.DB) *sqliteStore {
+	return &sqliteStore{db: database}
+}
+
+// Function to load the enabled jobs from the jobs table
+func (s *sqliteStore) ListJobs() ([]Job, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT id, tenant, name, cron_expr, command, options, max_runs FROM jobs WHERE enabled = 1 ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var result []Job
+	byID := make(map[int64]int)
+	for rows.Next() {
+		var j Job
+		if err := rows.Scan(&j.ID, &j.Tenant, &j.Name, &j.CronExpr, &j.Command, &j.Options, &j.MaxRuns); err != nil {
+			return nil, fmt.Errorf("error reading jobs: %w", err)
+		}
+		byID[j.ID] = len(result)
+		result = append(result, j)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading jobs: %w", err)
+	}
+	rows.Close()
+
+	schedules, err := s.db.Query(`SELECT job_id, cron_expr, kind FROM job_schedules ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying job schedules: %w", err)
+	}
+	defer schedules.Close()
+	for schedules.Next() {
+		var id int64
+		var expr, kind string
+		if err := schedules.Scan(&id, &expr, &kind); err != nil {
+			return nil, fmt.Errorf("error reading job schedules: %w", err)
+		}
+		i, ok := byID[id]
+		switch {
+		case !ok:
+		case kind == "exclude":
+			result[i].Exclusions = append(result[i].Exclusions, expr)
+		default:
+			result[i].Schedules = append(result[i].Schedules, expr)
+		}
+	}
+	return result, schedules.Err()
+}
+
+// Function to add a job to a tenant's jobs in the jobs table. The source is
+// "file" for jobs that are also written to the cron jobs file and "db" otherwise.
+func (s *sqliteStore) CreateJob(tenant, source string, j Job) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO jobs (tenant, name, cron_expr, schedule_phrase, command, options, source, enabled, max_runs, retries, retry_backoff, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+		ON CONFLICT(tenant, name) DO NOTHING`,
+		tenant, j.Name, j.CronExpr, j.Phrase, j.Command, j.Options, source, j.MaxRuns, j.Retries, retryBackoffColumn(j), time.Now().Format("02-01-2006 15:04:05"))
+	if err != nil {
+		return fmt.Errorf("error saving job %s: %w", j.Name, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("job %s already exists", j.Name)
+	}
+	if err := replaceDependencies(tx, tenant, j.Name, j.After); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing changes: %w", err)
+	}
+	return nil
+}
+
+// Function to create or update one job of a tenant, returning what changed
+func (s *sqliteStore) UpsertJob(tenant string, j Job) (putJobResponse, error) {
+	resp := putJobResponse{Name: j.Name, Changes: []string{}}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return resp, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := loadAppliedJobs(tx, tenant)
+	if err != nil {
+		return resp, err
+	}
+	if existing, ok := current[j.Name]; ok {
+		changes := applyChanges(*existing, j, "api")
+		if len(changes) == 0 {
+			return resp, nil
+		}
+		resp.Changes = changes
+	} else {
+		resp.Created = true
+	}
+	resp.Changed = true
+
+	if err := saveAppliedJob(tx, tenant, "api", j, time.Now().Format("02-01-2006 15:04:05")); err != nil {
+		return resp, err
+	}
+	if err := tx.Commit(); err != nil {
+		return resp, fmt.Errorf("error committing changes: %w", err)
+	}
+	return resp, nil
+}
+
+// Function to delete a tenant's job and its schedules from the jobs table,
+// returning where it came from. Its run history is kept.
+func (s *sqliteStore) DeleteJob(tenant, name string) (string, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var id int64
+	var source string
+	err := s.db.QueryRow(`SELECT id, source FROM jobs WHERE tenant = ? AND name = ?`, tenant, name).Scan(&id, &source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errJobNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("error loading job %s: %w", name, err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM job_schedules WHERE job_id = ?`, id); err != nil {
+		return "", fmt.Errorf("error deleting schedules of job %s: %w", name, err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM job_dependencies WHERE job_id = ?`, id); err != nil {
+		return "", fmt.Errorf("error deleting dependencies of job %s: %w", name, err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM jobs WHERE id = ?`, id); err != nil {
+		return "", fmt.Errorf("error deleting job %s: %w", name, err)
+	}
+	return source, nil
+}
+
+// Function to make the jobs a source owns in a tenant exactly the desired ones,
+// in one transaction: missing jobs are created, changed ones updated and the
+// source's jobs that are no longer desired deleted. Jobs of other sources with
+// a desired name are taken over, except those of the cron jobs file, which
+// would take them back on the next restart.
+func (s *sqliteStore) ReplaceJobs(tenant, source string, desired []Job) (jobSync, error) {
+	var result jobSync
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	current, err := loadAppliedJobs(tx, tenant)
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now().Format("02-01-2006 15:04:05")
+	wanted := make(map[string]bool, len(desired))
+	for _, j := range desired {
+		wanted[j.Name] = true
+		existing, ok := current[j.Name]
+		switch {
+		case !ok:
+			result.Created = append(result.Created, j.Name)
+		case existing.Source == "file" && source != "file":
+			return jobSync{}, fmt.Errorf("job %s is defined in %s", j.Name, cronJobsFile)
+		case len(applyChanges(*existing, j, source)) > 0:
+			result.Updated = append(result.Updated, j.Name)
+		default:
+			continue
+		}
+		if err := saveAppliedJob(tx, tenant, source, j, now); err != nil {
+			return jobSync{}, err
+		}
+	}
+
+	for name, existing := range current {
+		if wanted[name] || existing.Source != source {
+			continue
+		}
+		for _, statement := range []string{`DELETE FROM job_schedules WHERE job_id = ?`, `DELETE FROM job_dependencies WHERE job_id = ?`, `DELETE FROM jobs WHERE id = ?`} {
+			if _, err := tx.Exec(statement, existing.ID); err != nil {
+				return jobSync{}, fmt.Errorf("error deleting job %s: %w", name, err)
+			}
+		}
+		result.Deleted = append(result.Deleted, name)
+	}
+	sort.Strings(result.Deleted)
+
+	if err := tx.Commit(); err != nil {
+		return jobSync{}, fmt.Errorf("error committing changes: %w", err)
+	}
+	return result, nil
+}
+
+// Function to count a run of a job before it starts, returning its run number
+// and whether the job has used up its max_runs, in which case it is disabled,
+// and archived as well when it is a one-shot job. A run beyond max_runs is not
+// counted and gets errRunLimitReached.
+func (s *sqliteStore) CountRun(j Job) (int64, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var runNumber int64
+	var exhausted bool
+	result, err := s.db.Exec(`UPDATE jobs SET run_count = run_count + 1 WHERE id = ? AND (max_runs = 0 OR run_count < max_runs)`, j.ID)
+	if err == nil {
+		if counted, _ := result.RowsAffected(); counted == 0 {
+			return 0, false, errRunLimitReached
+		}
+		err = s.db.QueryRow(`SELECT run_count, max_runs > 0 AND run_count >= max_runs FROM jobs WHERE id = ?`, j.ID).Scan(&runNumber, &exhausted)
+	}
+	if err == nil && exhausted {
+		_, err = s.db.Exec(`UPDATE jobs SET enabled = 0, archived = ? WHERE id = ?`, j.IsOneShot(), j.ID)
+	}
+	return runNumber, exhausted, err
+}
+
+// Function to load the editable fields of a tenant's job
+func (s *sqliteStore) GetEditableJob(tenant, name string) (editableJob, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var j editableJob
+	err := s.db.QueryRow(`SELECT cron_expr, schedule_phrase, command, description, source FROM jobs WHERE tenant = ? AND name = ?`, tenant, name).
+		Scan(&j.Schedule, &j.Phrase, &j.Command, &j.Description, &j.Source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return j, errJobNotFound
+	}
+	if err != nil {
+		return j, fmt.Errorf("error loading job %s: %w", name, err)
+	}
+	return j, nil
+}
+
+// Function to save the editable fields of a tenant's job
+func (s *sqliteStore) EditJob(tenant, name string, j editableJob) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE jobs SET cron_expr = ?, schedule_phrase = ?, command = ?, description = ?, updated_at = ? WHERE tenant = ? AND name = ?`,
+		j.Schedule, j.Phrase, j.Command, j.Description, getCurrentTime(), tenant, name)
+	if err != nil {
+		return fmt.Errorf("error saving job %s: %w", name, err)
+	}
+	return nil
+}
+
+// Function to count a failed run of a job towards its consecutive failures,
+// or start the count over after a success, returning the new count
+func (s *sqliteStore) RecordOutcome(j Job, failed bool) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !failed {
+		_, err := s.db.Exec(`UPDATE jobs SET consecutive_failures = 0 WHERE id = ? AND consecutive_failures > 0`, j.ID)
+		return 0, err
+	}
+	var failures int
+	_, err := s.db.Exec(`UPDATE jobs SET consecutive_failures = consecutive_failures + 1 WHERE id = ?`, j.ID)
+	if err == nil {
+		err = s.db.QueryRow(`SELECT consecutive_failures FROM jobs WHERE id = ?`, j.ID).Scan(&failures)
+	}
+	return failures, err
+}
+
+// Function to disable an enabled job, keeping the reason to show with it
+func (s *sqliteStore) DisableJob(j Job, reason string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE jobs SET enabled = 0, disabled_reason = ?, updated_at = ? WHERE id = ? AND enabled = 1`, reason, getCurrentTime(), j.ID)
+	return err
+}
+
+// Function to enable a tenant's job again, clearing its failure count
+func (s *sqliteStore) EnableJob(tenant, name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, err := s.db.Exec(`UPDATE jobs SET enabled = 1, consecutive_failures = 0, disabled_reason = '', updated_at = ?
+		WHERE tenant = ? AND name = ? AND archived = 0`, getCurrentTime(), tenant, name)
+	if err != nil {
+		return fmt.Errorf("error enabling job %s: %w", name, err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errJobNotFound
+	}
+	return nil
+}
+
+// Function to store the time a job is next expected to run, empty when it
+// will not run again
+func (s *sqliteStore) SaveNextRun(j Job, nextRunAt string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	_, err := s.db.Exec(`UPDATE jobs SET next_run_at = ? WHERE id = ?`, nextRunAt, j.ID)
+	return err
+}
+
+// Function to load the stored next run times of the enabled jobs, by job ID
+func (s *sqliteStore) NextRuns() (map[int64]time.Time, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := s.db.Query(`SELECT id, next_run_at FROM jobs WHERE enabled = 1 AND next_run_at != ''`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	next := make(map[int64]time.Time)
+	for rows.Next() {
+		var id int64
+		var nextRunAt string
+		if err := rows.Scan(&id, &nextRunAt); err != nil {
+			return nil, err
+		}
+		if t, err := time.Parse(storageTimeFormat, nextRunAt); err == nil {
+			next[id] = t
+		}
+	}
+	return next, rows.Err()
+}
+
+// Function to insert a batch of run statuses in a single transaction. Rows
+// that fail for good are skipped; a transient error rolls back the batch so
+// it can be retried as a whole.
+func (s *sqliteStore) SaveRuns(batch []JobStatus) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt := tx.Stmt(insertJobStatusStmt)
+
+	for _, jobStatus := range batch {
+		// Triggers whose command did not run have no exit code, duration, output size or PID
+		var exitCode, durationMs, outputBytes, pid any
+		if jobStatus.StartedAt != "" {
+			exitCode, durationMs, outputBytes = jobStatus.ExitCode, jobStatus.DurationMs, jobStatus.OutputBytes
+		}
+		if jobStatus.PID != 0 {
+			pid = jobStatus.PID
+		}
+		result, err := stmt.Exec(jobStatus.UID, jobStatus.Command, jobStatus.Timestamp, jobStatus.Status, jobStatus.Output, jobStatus.Env, jobStatus.Runner,
+			jobStatus.JobName, jobStatus.RunNumber, jobStatus.DriftMs, jobStatus.StartedAt, jobStatus.FinishedAt, jobStatus.Tenant, jobStatus.Attempt, exitCode, durationMs,
+			jobStatus.Hostname, pid, jobStatus.OutputHash, outputBytes)
+		if err != nil {
+			if isTransientDBError(err) {
+				return err
+			}
+			fmt.Printf("Error inserting into database: %s\n", err)
+			continue
+		}
+
+		// Get the auto-incremental ID
+		autoIncrementalID, _ := result.LastInsertId()
+		jobStatus.AutoIncrementalID = autoIncrementalID
+
+		// Debug logging for database insertion
+		fmt.Printf("Inserted job status into database with Auto Incremental ID: %d\n", jobStatus.AutoIncrementalID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing job statuses to database: %w", err)
+	}
+	return nil
+}
+
+// Function to load a tenant's run by its UID, with its output
+func (s *sqliteStore) GetRun(tenant, uid string) (RunLog, error) {
+	var run RunLog
+	var exitCode, durationMs, pid, outputBytes sql.NullInt64
+	err := jobLogStmt.QueryRow(uid, tenant).Scan(&run.UID, &run.Command, &run.Timestamp, &run.Status, &run.Output, &run.Env, &run.Runner, &run.Job, &run.RunNumber,
+		&exitCode, &durationMs, &run.StartedAt, &run.FinishedAt, &run.Hostname, &pid, &outputBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return run, errRunNotFound
+	}
+	if err != nil {
+		return run, fmt.Errorf("error loading run %s: %w", uid, err)
+	}
+	if exitCode.Valid {
+		run.ExitCode = &exitCode.Int64
+	}
+	if durationMs.Valid {
+		run.DurationMs = &durationMs.Int64
+	}
+	if outputBytes.Valid {
+		run.OutputBytes = &outputBytes.Int64
+	}
+	if pid.Valid {
+		run.PID = &pid.Int64
+	}
+	return run, nil
+}
+
+// Function to list a tenant's runs matching a filter, newest first
+func (s *sqliteStore) ListRuns(tenant string, f runFilter) ([]PastRun, error) {
+	// Outputs are only read to cut the excerpt of a search
+	output := `''`
+	if f.Search != "" {
+		output = `output`
+	}
+	query := `SELECT job_id, task_id, job_name, command, status, exit_code, run_number, attempt, timestamp, started_at, finished_at, duration_ms, output_bytes, runner, hostname, pid, ` + output + `
+		FROM job_status WHERE tenant = ?`
+	args := []any{tenant}
+	if f.Search != "" {
+		condition, arg := outputSearchCondition(f.Search)
+		query += ` AND ` + condition
+		args = append(args, arg)
+	}
+	if f.Job != "" {
+		query += ` AND job_name = ?`
+		args = append(args, f.Job)
+	}
+	switch f.Status {
+	case "":
+	case "failed":
+		query += ` AND status LIKE 'Fail%'`
+	default:
+		query += ` AND status = ?`
+		args = append(args, f.Status)
+	}
+	if !f.Since.IsZero() {
+		query += ` AND timestamp >= ?`
+		args = append(args, formatStorageTime(f.Since))
+	}
+	if !f.Until.IsZero() {
+		query += ` AND timestamp < ?`
+		args = append(args, formatStorageTime(f.Until))
+	}
+	if f.Before > 0 {
+		query += ` AND job_id < ?`
+		args = append(args, f.Before)
+	}
+	query += ` ORDER BY job_id DESC LIMIT ?`
+	args = append(args, f.Limit)
+
+	mu.Lock()
+	defer mu.Unlock()
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []PastRun{}
+	for rows.Next() {
+		var run PastRun
+		var exitCode, durationMs, outputBytes, pid sql.NullInt64
+		var output sql.NullString
+		if err := rows.Scan(&run.ID, &run.UID, &run.Job, &run.Command, &run.Status, &exitCode, &run.RunNumber, &run.Attempt, &run.Timestamp,
+			&run.StartedAt, &run.FinishedAt, &durationMs, &outputBytes, &run.Runner, &run.Hostname, &pid, &output); err != nil {
+			return nil, fmt.Errorf("error reading runs: %w", err)
+		}
+		if f.Search != "" {
+			run.Match = searchExcerpt(output.String, f.Search)
+		}
+		if exitCode.Valid {
+			run.ExitCode = &exitCode.Int64
+		}
+		if durationMs.Valid {
+			run.DurationMs = &durationMs.Int64
+		}
+		if outputBytes.Valid {
+			run.OutputBytes = &outputBytes.Int64
+		}
+		if pid.Valid {
+			run.PID = &pid.Int64
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// Function to compute the statistics of a tenant's job over the runs
+// triggered in [from, to)
+func (s *sqliteStore) JobStats(tenant, name string, from, to time.Time) (JobStats, error) {
+	stats := JobStats{Job: name, From: from.UTC().Format(time.RFC3339), To: to.UTC().Format(time.RFC3339), RunsPerDay: []DayStats{}}
+	filter := `tenant = ? AND job_name = ? AND timestamp >= ? AND timestamp < ? AND ` + lastAttemptCondition
+	args := []any{tenant, name, formatStorageTime(from), formatStorageTime(to)}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Runs per day, counting toward the totals
+	rows, err := s.db.Query(`SELECT substr(timestamp, 1, 10), COUNT(*),
+		       COALESCE(SUM(CASE WHEN status = 'Success' THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN status LIKE 'Fail%' THEN 1 ELSE 0 END), 0)
+		FROM job_status WHERE `+filter+` GROUP BY 1`, args...)
+	if err != nil {
+		return stats, fmt.Errorf("error counting runs: %w", err)
+	}
+	days := make(map[string]DayStats)
+	for rows.Next() {
+		var day DayStats
+		if err := rows.Scan(&day.Date, &day.Runs, &day.Succeeded, &day.Failed); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("error counting runs: %w", err)
+		}
+		days[day.Date] = day
+		stats.Runs += day.Runs
+		stats.Succeeded += day.Succeeded
+		stats.Failed += day.Failed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("error counting runs: %w", err)
+	}
+	// Every day of the window is listed, those without runs too
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		stats.RunsPerDay = append(stats.RunsPerDay, DayStats{Date: date, Runs: days[date].Runs, Succeeded: days[date].Succeeded, Failed: days[date].Failed})
+	}
+	if finished := stats.Succeeded + stats.Failed; finished > 0 {
+		rate := float64(stats.Succeeded) / float64(finished)
+		stats.SuccessRate = &rate
+	}
+
+	// Durations, with nearest-rank percentiles
+	var timed int
+	var avg float64
+	err = s.db.QueryRow(`SELECT COUNT(duration_ms), COALESCE(AVG(duration_ms), 0) FROM job_status WHERE `+filter+` AND duration_ms IS NOT NULL`, args...).Scan(&timed, &avg)
+	if err != nil {
+		return stats, fmt.Errorf("error summarizing durations: %w", err)
+	}
+	if timed > 0 {
+		stats.AvgDurationMs = &avg
+		percentile := func(p int) (*int64, error) {
+			var ms int64
+			rank := (timed*p + 99) / 100
+			err := s.db.QueryRow(`SELECT duration_ms FROM job_status WHERE `+filter+` AND duration_ms IS NOT NULL ORDER BY duration_ms LIMIT 1 OFFSET ?`,
+				append(args, rank-1)...).Scan(&ms)
+			return &ms, err
+		}
+		if stats.P50DurationMs, err = percentile(50); err != nil {
+			return stats, fmt.Errorf("error summarizing durations: %w", err)
+		}
+		if stats.P95DurationMs, err = percentile(95); err != nil {
+			return stats, fmt.Errorf("error summarizing durations: %w", err)
+		}
+	}
+
+	// Failure streaks, runs of failures not broken by a success. Runs that
+	// neither succeeded nor failed, such as skipped ones, do not break them.
+	outcomes := `SELECT job_id, status LIKE 'Fail%' AS failed FROM job_status WHERE ` + filter + ` AND (status = 'Success' OR status LIKE 'Fail%')`
+	err = s.db.QueryRow(`WITH outcomes AS (`+outcomes+`)
+		SELECT COUNT(*) FROM outcomes WHERE failed AND job_id > COALESCE((SELECT MAX(job_id) FROM outcomes WHERE NOT failed), 0)`, args...).Scan(&stats.CurrentFailureStreak)
+	if err != nil {
+		return stats, fmt.Errorf("error counting failure streaks: %w", err)
+	}
+	err = s.db.QueryRow(`WITH outcomes AS (`+outcomes+`),
+		streaks AS (SELECT failed, SUM(NOT failed) OVER (ORDER BY job_id) AS streak FROM outcomes)
+		SELECT COALESCE(MAX(n), 0) FROM (SELECT COUNT(*) AS n FROM streaks WHERE failed GROUP BY streak)`, args...).Scan(&stats.LongestFailureStreak)
+	if err != nil {
+		return stats, fmt.Errorf("error counting failure streaks: %w", err)
+	}
+	return stats, nil
+}
+
+// Function to get the time the latest run of a tenant's job was recorded
+func (s *sqliteStore) LatestRunAt(tenant, name string) (time.Time, bool, error) {
+	mu.Lock()
+	var timestamp string
+	err := s.db.QueryRow(`SELECT timestamp FROM job_status WHERE tenant = ? AND job_name = ? ORDER BY job_id DESC LIMIT 1`, tenant, name).Scan(&timestamp)
+	mu.Unlock()
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	recorded, err := time.Parse(storageTimeFormat, timestamp)
+	return recorded, err == nil, err
+}
+
+// Function to get the latest successful run of a tenant's job with an output
+// hash, other than the given run
+func (s *sqliteStore) PreviousOutput(tenant, name, exceptUID string) (checkedOutput, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var previous checkedOutput
+	err := s.db.QueryRow(`SELECT task_id, output_hash, timestamp FROM job_status
+		WHERE tenant = ? AND job_name = ? AND status = 'Success' AND output_hash != '' AND task_id != ?
+		ORDER BY job_id DESC LIMIT 1`, tenant, name, exceptUID).Scan(&previous.uid, &previous.hash, &previous.timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return checkedOutput{}, nil
+	}
+	if err != nil {
+		return checkedOutput{}, err
+	}
+	return previous, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Statements used on every run or page load, prepared once at startup and
+// shared across goroutines
+var (
+	insertJobStatusStmt  *sql.Stmt
+	distinctCommandsStmt *sql.Stmt
+	jobLogStmt           *sql.Stmt
+)
+
+// Function to prepare the hot-path statements against the database
+func prepareStatements(database *sql.DB) error {
+	statements := []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&insertJobStatusStmt, `INSERT INTO job_status (task_id, command, timestamp, status, output, env, runner, job_name, run_number, drift_ms, started_at, finished_at, tenant, attempt, exit_code, duration_ms, hostname, pid, output_hash, output_bytes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`},
+		{&distinctCommandsStmt, `
+		SELECT command, task_id, MAX(timestamp) AS last_run, runner, run_number, job_name,
+		       SUM(CASE WHEN status = 'Success' THEN 1 ELSE 0 END) AS success_count,
+		       SUM(CASE WHEN status LIKE 'Fail%' THEN 1 ELSE 0 END) AS failure_count,
+		       output, exit_code, duration_ms, started_at, hostname, pid
+		FROM job_status
+		WHERE tenant = ?
+		GROUP BY command
+		ORDER BY last_run DESC
+	`},
+		{&jobLogStmt, `SELECT task_id, command, timestamp, status, output, env, runner, job_name, run_number, exit_code, duration_ms, started_at, finished_at, hostname, pid, output_bytes FROM job_status WHERE task_id = ? AND tenant = ?`},
+	}
+
+	for _, s := range statements {
+		stmt, err := database.Prepare(s.query)
+		if err != nil {
+			return fmt.Errorf("error preparing statement: %w", err)
+		}
+		*s.stmt = stmt
+	}
+	return nil
+}
+
+// Function to close the prepared statements before the database is closed
+func closeStatements() {
+	for _, stmt := range []*sql.Stmt{insertJobStatusStmt, distinctCommandsStmt, jobLogStmt} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window of the job statistics unless the request selects one, and the longest allowed
+const (
+	defaultStatsWindow = 30 * 24 * time.Hour
+	maxStatsWindow     = 366 * 24 * time.Hour
+)
+
+// SQL condition keeping only the last attempt of each run of job_status, so
+// that retried runs count once
+const lastAttemptCondition = `NOT EXISTS (SELECT 1 FROM job_status r WHERE r.tenant = job_status.tenant AND r.job_name = job_status.job_name
+	AND r.run_number = job_status.run_number AND r.attempt > job_status.attempt)`
+
+// Struct to hold the statistics of a job's runs over a window, as returned by
+// GET /api/v1/jobs/{name}/stats. Durations are those of runs that ran the
+// command; rates and durations are null when there are none.
+type JobStats struct {
+	Job                  string     `json:"job"`
+	From                 string     `json:"from"`
+	To                   string     `json:"to"`
+	Runs                 int        `json:"runs"`
+	Succeeded            int        `json:"succeeded"`
+	Failed               int        `json:"failed"`
+	SuccessRate          *float64   `json:"success_rate"` // succeeded out of succeeded and failed runs
+	AvgDurationMs        *float64   `json:"avg_duration_ms"`
+	P50DurationMs        *int64     `json:"p50_duration_ms"`
+	P95DurationMs        *int64     `json:"p95_duration_ms"`
+	CurrentFailureStreak int        `json:"current_failure_streak"`
+	LongestFailureStreak int        `json:"longest_failure_streak"`
+	RunsPerDay           []DayStats `json:"runs_per_day"`
+}
+
+// Struct to hold a job's run counts on one UTC day
+type DayStats struct {
+	Date      string `json:"date"`
+	Runs      int    `json:"runs"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+}
+
+// Function to parse the window of a statistics request, such as 7d or 12h,
+// defaulting to 30 days
+func parseStatsWindow(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultStatsWindow, nil
+	}
+	var window time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q, expected a number of days such as 7d or a duration such as 12h", value)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if window, err = time.ParseDuration(value); err != nil {
+			return 0, fmt.Errorf("invalid window %q, expected a number of days such as 7d or a duration such as 12h", value)
+		}
+	}
+	if window <= 0 || window > maxStatsWindow {
+		return 0, fmt.Errorf("window must be positive and at most 366d")
+	}
+	return window, nil
+}
+
+// Handler for GET /api/v1/jobs/{name}/stats, returning the statistics of a
+// job's runs over the last window (such as 7d or 12h, 30 days by default)
+func apiJobStatsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant, name := requestTenant(r), r.PathValue("name")
+	window, err := parseStatsWindow(r.URL.Query().Get("window"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	to := time.Now()
+	stats, err := storage.JobStats(tenant, name, to.Add(-window), to)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Jobs no longer scheduled still have statistics while their runs are kept
+	if _, ok := lookupJob(tenant, name); !ok && stats.Runs == 0 {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no job named %s has runs", name))
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Struct to hold what the public status page shows for one job
+type publicJobStatus struct {
+	Name        string
+	LastSuccess time.Time
+	Days        []statusDay // oldest first
+}
+
+// Struct to hold the outcome of a job's runs on one day
+type statusDay struct {
+	Date     time.Time
+	Runs     int
+	Failures int
+}
+
+// Function to load a tenant's jobs that opted into the status page with the
+// public=true option, along with their daily run history over the last days days
+func loadPublicStatus(tenant string, days int) ([]publicJobStatus, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	since := today.AddDate(0, 0, -(days - 1))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`SELECT name, options FROM jobs WHERE tenant = ? AND enabled = 1 AND archived = 0 ORDER BY name`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying jobs: %w", err)
+	}
+	var result []publicJobStatus
+	for rows.Next() {
+		var j Job
+		if err := rows.Scan(&j.Name, &j.Options); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading jobs: %w", err)
+		}
+		if parseJobOptions(&j, j.Options) != nil || !j.Public {
+			continue
+		}
+		status := publicJobStatus{Name: j.Name, Days: make([]statusDay, days)}
+		for i := range status.Days {
+			status.Days[i].Date = since.AddDate(0, 0, i)
+		}
+		result = append(result, status)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading jobs: %w", err)
+	}
+
+	for i := range result {
+		status := &result[i]
+		runs, err := db.Query(`
+			SELECT status, started_at FROM job_status
+			WHERE tenant = ? AND job_name = ? AND started_at >= ?`, tenant, status.Name, formatStorageTime(since))
+		if err != nil {
+			return nil, fmt.Errorf("error querying runs: %w", err)
+		}
+		for runs.Next() {
+			var runStatus, startedAt string
+			if err := runs.Scan(&runStatus, &startedAt); err != nil {
+				runs.Close()
+				return nil, fmt.Errorf("error reading runs: %w", err)
+			}
+			started, err := time.Parse(storageTimeFormat, startedAt)
+			if err != nil {
+				continue
+			}
+			started = started.In(now.Location())
+			day := int(math.Round(time.Date(started.Year(), started.Month(), started.Day(), 0, 0, 0, 0, now.Location()).Sub(since).Hours() / 24))
+			if day < 0 || day >= days {
+				continue
+			}
+			status.Days[day].Runs++
+			if isFailureStatus(runStatus) {
+				status.Days[day].Failures++
+			}
+		}
+		runs.Close()
+
+		// Runs older than the history window still count for the last success
+		var lastSuccess string
+		err = db.QueryRow(`
+			SELECT COALESCE(MAX(finished_at), '') FROM job_status
+			WHERE tenant = ? AND job_name = ? AND status = 'Success' AND finished_at != ''`, tenant, status.Name).Scan(&lastSuccess)
+		if err != nil {
+			return nil, fmt.Errorf("error querying last success: %w", err)
+		}
+		if t, err := time.Parse(storageTimeFormat, lastSuccess); err == nil {
+			status.LastSuccess = t.Local()
+		}
+	}
+	return result, nil
+}
+
+// Handler for the public status page. It needs no account and shows only the
+// name, last success and daily history of jobs with the public=true option,
+// never their commands or output.
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	days := getEnvInt("STATUS_PAGE_DAYS", 30)
+	if days < 1 {
+		days = 1
+	}
+	statuses, err := loadPublicStatus(requestTenant(r), days)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Job Status</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	    <style>
+	        .uptime { display: flex; gap: 2px; height: 32px; }
+	        .uptime span { flex: 1; border-radius: 2px; }
+	    </style>
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Job Status</h1>
+	        <p class="text-muted">Daily results over the last `+fmt.Sprint(days)+` days.</p>`)
+
+	if len(statuses) == 0 {
+		fmt.Fprintln(w, `<p>No jobs are published on this page.</p>`)
+	}
+	for _, status := range statuses {
+		lastSuccess, badge := "Never", "bg-secondary"
+		if !status.LastSuccess.IsZero() {
+			lastSuccess = status.LastSuccess.Format("02-01-2006 15:04:05")
+		}
+		if latest := status.Days[len(status.Days)-1]; latest.Runs > 0 {
+			badge = "bg-success"
+			if latest.Failures > 0 {
+				badge = "bg-danger"
+			}
+		}
+
+		fmt.Fprintf(w, `<div class="card mb-3"><div class="card-body">
+	            <h5 class="card-title"><span class="badge %s me-2">&nbsp;</span>%s</h5>
+	            <p class="card-text text-muted small">Last success: %s</p>
+	            <div class="uptime">`, badge, html.EscapeString(status.Name), lastSuccess)
+		for _, day := range status.Days {
+			color, text := "bg-secondary-subtle", "no runs"
+			switch {
+			case day.Failures == day.Runs && day.Runs > 0:
+				color, text = "bg-danger", fmt.Sprintf("%d failed", day.Failures)
+			case day.Failures > 0:
+				color, text = "bg-warning", fmt.Sprintf("%d of %d failed", day.Failures, day.Runs)
+			case day.Runs > 0:
+				color, text = "bg-success", fmt.Sprintf("%d succeeded", day.Runs)
+			}
+			fmt.Fprintf(w, `<span class="%s" title="%s: %s"></span>`, color, day.Date.Format("02-01-2006"), text)
+		}
+		fmt.Fprintln(w, `</div></div></div>`)
+	}
+
+	fmt.Fprintln(w, `
+	    </div>
+	</body>
+	</html>
+	`)
+}
@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// Interface to where jobs and their runs are kept. Defining, scheduling and
+// running jobs and the jobs and runs APIs go through it instead of querying
+// the database themselves, so that other backends can be added and code using
+// it can run against a fake. Reports built from many tables at once, such as
+// the dashboard, timeline, status page and digest, and the tables of users,
+// sessions, tenants, calendars, maintenance windows and events are not part of
+// it and still use the database directly. The SQLite database is the only
+// implementation, see sqliteStore.
+type Store interface {
+	// Jobs
+	ListJobs() ([]Job, error) // enabled jobs of every tenant, with their schedules and exclusions
+	CreateJob(tenant, source string, j Job) error
+	UpsertJob(tenant string, j Job) (putJobResponse, error)
+	DeleteJob(tenant, name string) (source string, err error)
+	ReplaceJobs(tenant, source string, desired []Job) (jobSync, error) // the source's jobs become exactly the desired ones
+	CountRun(j Job) (runNumber int64, exhausted bool, err error)       // errRunLimitReached when the job has used up its max_runs
+	GetEditableJob(tenant, name string) (editableJob, error)           // errJobNotFound when the tenant has no such job
+	EditJob(tenant, name string, j editableJob) error
+	RecordOutcome(j Job, failed bool) (consecutiveFailures int, err error)
+	DisableJob(j Job, reason string) error
+	EnableJob(tenant, name string) error // errJobNotFound when the tenant has no such job
+	SaveNextRun(j Job, nextRunAt string) error
+	NextRuns() (map[int64]time.Time, error) // stored next run times of the enabled jobs, by job ID
+
+	// Runs
+	SaveRuns(batch []JobStatus) error
+	GetRun(tenant, uid string) (RunLog, error) // errRunNotFound when the tenant has no such run
+	ListRuns(tenant string, f runFilter) ([]PastRun, error)
+	JobStats(tenant, name string, from, to time.Time) (JobStats, error)
+	LatestRunAt(tenant, name string) (at time.Time, found bool, err error)
+	PreviousOutput(tenant, name, exceptUID string) (checkedOutput, error) // zero when no successful run has an output hash
+}
+
+// Storage used by the scheduler, set up once the database is open
+var storage Store
+
+// Struct to hold a past run together with its output, as downloaded
+type RunLog struct {
+	PastRun
+	Output string
+	Env    string
+}
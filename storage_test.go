@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Helper function to serve a request with handlers registered on their own mux
+func serveTestRequest(t *testing.T, pattern string, handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, handler)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestAPIRunsHandlerWithFakeStore(t *testing.T) {
+	fake := useFakeStore(t)
+	fake.SaveRuns([]JobStatus{
+		{UID: "a", JobName: "backup", Status: "Success", Tenant: defaultTenant, Timestamp: "2026-01-01T02:00:00.000Z"},
+		{UID: "b", JobName: "report", Status: "Failure", Tenant: defaultTenant, Timestamp: "2026-01-01T03:00:00.000Z"},
+		{UID: "c", JobName: "backup", Status: "Failure", Tenant: defaultTenant, Timestamp: "2026-01-02T02:00:00.000Z"},
+		{UID: "d", JobName: "backup", Status: "Success", Tenant: "acme", Timestamp: "2026-01-02T02:00:00.000Z"},
+	})
+
+	tests := []struct {
+		target     string
+		wantStatus int
+		wantUIDs   []string
+	}{
+		{"/api/v1/runs", http.StatusOK, []string{"c", "b", "a"}},
+		{"/api/v1/runs?job=backup", http.StatusOK, []string{"c", "a"}},
+		{"/api/v1/runs?job=backup&status=Success", http.StatusOK, []string{"a"}},
+		{"/api/v1/runs?since=yesterday", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serveTestRequest(t, "GET /api/v1/runs", apiRunsHandler, "GET", tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var runs []PastRun
+			if err := json.Unmarshal(w.Body.Bytes(), &runs); err != nil {
+				t.Fatalf("decoding response: %s", err)
+			}
+			var uids []string
+			for _, run := range runs {
+				uids = append(uids, run.UID)
+			}
+			if strings.Join(uids, ",") != strings.Join(tt.wantUIDs, ",") {
+				t.Errorf("runs = %v, want %v", uids, tt.wantUIDs)
+			}
+		})
+	}
+}
+
+func TestAPIEditJobHandlerWithFakeStore(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "")
+	fake := useFakeStore(t)
+	if err := fake.CreateJob(defaultTenant, "api", Job{Name: "backup", CronExpr: "0 2 * * *", Command: "./backup.sh"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		job, body   string
+		wantStatus  int
+		wantCommand string
+		wantExpr    string
+	}{
+		{"change command", "backup", `{"command": "./backup.sh --full"}`, http.StatusOK, "./backup.sh --full", "0 2 * * *"},
+		{"natural language schedule", "backup", `{"schedule": "every day at 3am"}`, http.StatusOK, "./backup.sh --full", "0 3 * * *"},
+		{"invalid schedule", "backup", `{"schedule": "whenever"}`, http.StatusBadRequest, "./backup.sh --full", "0 3 * * *"},
+		{"multi-line command", "backup", `{"command": "a\nb"}`, http.StatusBadRequest, "./backup.sh --full", "0 3 * * *"},
+		{"missing job", "nope", `{"command": "true"}`, http.StatusNotFound, "./backup.sh --full", "0 3 * * *"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(t, "PATCH /api/v1/jobs/{name}", apiEditJobHandler, "PATCH", "/api/v1/jobs/"+tt.job, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			stored := fake.jobs[jobKey(defaultTenant, "backup")]
+			if stored.Command != tt.wantCommand || stored.CronExpr != tt.wantExpr {
+				t.Errorf("job = %q %q, want %q %q", stored.CronExpr, stored.Command, tt.wantExpr, tt.wantCommand)
+			}
+		})
+	}
+}
+
+func TestCountRunStopsAtMaxRuns(t *testing.T) {
+	openTestDatabase(t)
+	s := newSQLiteStore(db)
+	if err := s.CreateJob(defaultTenant, "db", Job{Name: "migrate", CronExpr: "* * * * *", Command: "./migrate.sh", MaxRuns: 3}); err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ListJobs()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("ListJobs = %v, %v", list, err)
+	}
+
+	// Overlapping triggers all try to count a run at once
+	var wg sync.WaitGroup
+	var counted, exhausted, refused atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, last, err := s.CountRun(list[0])
+			switch {
+			case errors.Is(err, errRunLimitReached):
+				refused.Add(1)
+			case err != nil:
+				t.Errorf("CountRun: %s", err)
+			default:
+				counted.Add(1)
+				if last {
+					exhausted.Add(1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if counted.Load() != 3 || exhausted.Load() != 1 || refused.Load() != 7 {
+		t.Errorf("counted %d runs, %d of them the last, and refused %d; want 3, 1 and 7", counted.Load(), exhausted.Load(), refused.Load())
+	}
+}
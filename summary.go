@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Number of job commands executing right now, per tenant
+var (
+	runningCounts   = make(map[string]int64)
+	runningCountsMu sync.Mutex
+)
+
+// Function to count a job command of a tenant starting (delta 1) or ending (delta -1)
+func addRunning(tenant string, delta int64) {
+	runningCountsMu.Lock()
+	defer runningCountsMu.Unlock()
+	runningCounts[tenant] += delta
+}
+
+// Function to get the number of a tenant's job commands executing right now
+func runningCount(tenant string) int64 {
+	runningCountsMu.Lock()
+	defer runningCountsMu.Unlock()
+	return runningCounts[tenant]
+}
+
+// Struct to hold the at-a-glance totals shown on the dashboard
+type Summary struct {
+	ActiveJobs         int     `json:"active_jobs"`
+	RunsToday          int     `json:"runs_today"`
+	FailuresToday      int     `json:"failures_today"`
+	CurrentlyRunning   int64   `json:"currently_running"`
+	AvgDurationSeconds float64 `json:"avg_duration_seconds"`
+}
+
+// Function to compute a tenant's dashboard summary, counting runs since local midnight
+func loadSummary(tenant string) (Summary, error) {
+	now := time.Now()
+	midnight := formatStorageTime(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	summary := Summary{CurrentlyRunning: runningCount(tenant)}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	err := db.QueryRow(`SELECT COUNT(*) FROM jobs WHERE tenant = ? AND enabled = 1 AND archived = 0`, tenant).Scan(&summary.ActiveJobs)
+	if err != nil {
+		return summary, fmt.Errorf("error counting jobs: %w", err)
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(*),
+		       COALESCE(SUM(CASE WHEN status LIKE 'Fail%' THEN 1 ELSE 0 END), 0),
+		       COALESCE(AVG((julianday(finished_at) - julianday(started_at)) * 86400), 0)
+		FROM job_status
+		WHERE tenant = ? AND started_at >= ?`, tenant, midnight).Scan(&summary.RunsToday, &summary.FailuresToday, &summary.AvgDurationSeconds)
+	if err != nil {
+		return summary, fmt.Errorf("error summarizing runs: %w", err)
+	}
+	return summary, nil
+}
+
+// Handler for GET /api/v1/summary
+func apiSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	summary, err := loadSummary(requestTenant(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
+
+// Helper function to render the summary as a row of cards for the dashboard
+func summaryCards(summary Summary) string {
+	card := func(title, value string) string {
+		return fmt.Sprintf(`<div class="col"><div class="card text-center"><div class="card-body">
+	                <div class="text-muted small">%s</div><div class="fs-3">%s</div>
+	            </div></div></div>`, title, value)
+	}
+	return `<div class="row row-cols-2 row-cols-md-5 g-3 mb-3">` +
+		card("Active Jobs", fmt.Sprint(summary.ActiveJobs)) +
+		card("Runs Today", fmt.Sprint(summary.RunsToday)) +
+		card("Failures Today", fmt.Sprint(summary.FailuresToday)) +
+		card("Running Now", fmt.Sprint(summary.CurrentlyRunning)) +
+		card("Avg Duration", fmt.Sprintf("%.1fs", summary.AvgDurationSeconds)) +
+		`</div>`
+}
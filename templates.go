@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Struct to hold what notification templates can use: the run's JobStatus
+// fields, such as {{.JobName}}, {{.Status}}, {{.Output}} and {{.Hostname}},
+// and the values below
+type runTemplateData struct {
+	JobStatus
+	Level    string
+	Subject  string
+	Duration time.Duration
+	LogURL   string // empty when PUBLIC_URL is not set
+}
+
+// Functions available in notification templates
+var templateFuncs = template.FuncMap{
+	"head":  func(n int, s string) string { return strings.ToValidUTF8(s[:min(n, len(s))], "") },
+	"tail":  func(n int, s string) string { return strings.ToValidUTF8(s[len(s)-min(n, len(s)):], "") },
+	"trim":  strings.TrimSpace,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+}
+
+// Function to load the notification template of a channel from its setting,
+// falling back to NOTIFY_TEMPLATE. A value starting with @ names a file
+// holding the template. Returns nil when neither is set.
+func loadNotifyTemplate(setting string) (*template.Template, error) {
+	name, text := setting, os.Getenv(setting)
+	if text == "" {
+		name, text = "NOTIFY_TEMPLATE", os.Getenv("NOTIFY_TEMPLATE")
+	}
+	if text == "" {
+		return nil, nil
+	}
+	if path, ok := strings.CutPrefix(text, "@"); ok {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		text = string(content)
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// Function to render a run notification with a template. Returns the
+// notification's own message when there is no template or it fails to render.
+func renderNotification(tmpl *template.Template, n Notification) string {
+	if tmpl == nil || n.Run == nil {
+		return n.Message
+	}
+	data := runTemplateData{
+		JobStatus: *n.Run,
+		Level:     n.Level,
+		Subject:   n.Subject,
+		Duration:  runDuration(*n.Run),
+		LogURL:    runLogURL(*n.Run),
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		fmt.Printf("Error rendering notification template %s: %s\n", tmpl.Name(), err)
+		return n.Message
+	}
+	return out.String()
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tenant owning the jobs of the cron jobs file and all data from before tenants
+const defaultTenant = "default"
+
+// Tenant names are used in URLs and subdomains
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Known tenants, loaded once at startup
+var tenants = map[string]bool{defaultTenant: true}
+
+// Struct to hold the tenant a request was made for
+type tenantContext struct {
+	Name   string
+	Prefix string // path prefix the tenant was selected with, e.g. "/t/acme"
+}
+
+type tenantContextKey struct{}
+
+// Function to create the tenants listed in the TENANTS setting and load all
+// known tenants
+func loadTenants() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := []string{defaultTenant}
+	for _, name := range strings.Split(os.Getenv("TENANTS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !tenantNamePattern.MatchString(name) {
+			fmt.Printf("Skipping invalid tenant name %q, use lowercase letters, digits and dashes\n", name)
+			continue
+		}
+		names = append(names, name)
+	}
+	now := time.Now().Format("02-01-2006 15:04:05")
+	for _, name := range names {
+		if _, err := db.Exec(`INSERT OR IGNORE INTO tenants (name, created_at) VALUES (?, ?)`, name, now); err != nil {
+			return fmt.Errorf("error creating tenant %s: %w", name, err)
+		}
+	}
+
+	rows, err := db.Query(`SELECT name FROM tenants`)
+	if err != nil {
+		return fmt.Errorf("error loading tenants: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("error loading tenants: %w", err)
+		}
+		tenants[name] = true
+	}
+	return rows.Err()
+}
+
+// Function to wrap the web server so every request is made for a tenant. The
+// tenant is taken from a /t/<tenant>/ path prefix, which is removed before the
+// request is routed, or from the subdomain of TENANT_DOMAIN. Other requests are
+// for the default tenant.
+func tenantMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := tenantContext{Name: defaultTenant}
+
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/t/"); ok {
+			name, path, found := strings.Cut(rest, "/")
+			if !found {
+				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+			tenant = tenantContext{Name: name, Prefix: "/t/" + name}
+			r = r.Clone(r.Context())
+			r.URL.Path = "/" + path
+			r.URL.RawPath = ""
+		} else if domain := os.Getenv("TENANT_DOMAIN"); domain != "" {
+			host := r.Host
+			if i := strings.LastIndex(host, ":"); i != -1 {
+				host = host[:i]
+			}
+			if name, ok := strings.CutSuffix(host, "."+domain); ok {
+				tenant.Name = name
+			}
+		}
+
+		if !tenants[tenant.Name] {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenant)))
+	})
+}
+
+// Function to get the tenant a request was made for
+func requestTenant(r *http.Request) string {
+	if tenant, ok := r.Context().Value(tenantContextKey{}).(tenantContext); ok {
+		return tenant.Name
+	}
+	return defaultTenant
+}
+
+// Function to build a link to a page of the tenant a request was made for
+func tenantURL(r *http.Request, path string) string {
+	tenant, _ := r.Context().Value(tenantContextKey{}).(tenantContext)
+	return tenant.Prefix + path
+}
+
+// Function to build the key of a tenant's job in the in-memory maps
+func jobKey(tenant, name string) string {
+	return tenant + "/" + name
+}
+
+// Prefix of the settings that override a deployment-wide setting for one
+// tenant, e.g. TENANT_ANALYTICS_SMTP_TO for the analytics tenant
+const tenantSettingPrefix = "TENANT_"
+
+// Helper function to get the prefix of a tenant's own settings, the tenant
+// name in capitals with dashes as underscores
+func tenantSettingsPrefix(tenant string) string {
+	return tenantSettingPrefix + strings.ToUpper(strings.ReplaceAll(tenant, "-", "_")) + "_"
+}
+
+// Function to get the name of the setting to read for a tenant: the tenant's
+// own TENANT_<NAME>_<name> when it is set, else the deployment-wide one. An
+// empty tenant always gets the deployment-wide setting.
+func tenantSetting(tenant, name string) string {
+	if tenant == "" {
+		return name
+	}
+	if own := tenantSettingsPrefix(tenant) + name; os.Getenv(own) != "" {
+		return own
+	}
+	return name
+}
+
+// Function to tell whether a tenant has any setting of its own starting with
+// one of the given prefixes, such as "SMTP_"
+func hasTenantSettings(tenant string, prefixes ...string) bool {
+	own := tenantSettingsPrefix(tenant)
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(key, own)
+		if !ok || value == "" {
+			continue
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(rest, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
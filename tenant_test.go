@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestTenantSetting(t *testing.T) {
+	t.Setenv("SMTP_TO", "ops@example.com")
+	t.Setenv("TENANT_DATA_TEAM_SMTP_TO", "data@example.com")
+	t.Setenv("TENANT_PAYMENTS_SMTP_TO", "")
+
+	tests := []struct {
+		tenant, name string
+		want         string
+	}{
+		{"", "SMTP_TO", "SMTP_TO"},
+		{"default", "SMTP_TO", "SMTP_TO"},
+		{"data-team", "SMTP_TO", "TENANT_DATA_TEAM_SMTP_TO"},
+		{"data-team", "SMTP_HOST", "SMTP_HOST"},
+		{"payments", "SMTP_TO", "SMTP_TO"}, // empty overrides are ignored
+	}
+	for _, tt := range tests {
+		if got := tenantSetting(tt.tenant, tt.name); got != tt.want {
+			t.Errorf("tenantSetting(%q, %q) = %q, want %q", tt.tenant, tt.name, got, tt.want)
+		}
+	}
+
+	if !hasTenantSettings("data-team", "SLACK_", "SMTP_") {
+		t.Error("data-team has an SMTP setting of its own")
+	}
+	if hasTenantSettings("data-team", "SLACK_") || hasTenantSettings("payments", "SMTP_") {
+		t.Error("tenants without settings of their own reported as having them")
+	}
+}
+
+func TestNotificationsGoToTheTenantsChannels(t *testing.T) {
+	shared := recordNotifications(t)
+	own := &recordingNotifier{}
+	notifiersMu.Lock()
+	tenantNotifiers["payments"] = []Notifier{own}
+	notifiersMu.Unlock()
+	t.Cleanup(func() {
+		notifiersMu.Lock()
+		delete(tenantNotifiers, "payments")
+		notifiersMu.Unlock()
+	})
+
+	notify("critical", "Database unavailable", "")
+	notifyTenant("payments", "warning", "Missed run of job settle", "")
+	notifyTenant("analytics", "warning", "Missed run of job etl", "")
+
+	subjects := func(n *recordingNotifier) []string {
+		var s []string
+		for _, sent := range n.sent {
+			s = append(s, sent.Subject)
+		}
+		return s
+	}
+	if got := subjects(shared); len(got) != 2 || got[0] != "Database unavailable" || got[1] != "Missed run of job etl" {
+		t.Errorf("deployment-wide channels got %q", got)
+	}
+	if got := subjects(own); len(got) != 1 || got[0] != "Missed run of job settle" {
+		t.Errorf("payments channels got %q", got)
+	}
+}
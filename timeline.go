@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Struct to hold one run interval returned by the timeline API
+type timelineRun struct {
+	UID        string `json:"uid"`
+	Job        string `json:"job"`
+	Command    string `json:"command"`
+	Status     string `json:"status"`
+	StartedAt  string `json:"started_at"`
+	FinishedAt string `json:"finished_at"`
+}
+
+// Function to parse the from/to window of a timeline request, defaulting to the last hour
+func timelineWindow(r *http.Request) (time.Time, time.Time, error) {
+	to := time.Now()
+	from := to.Add(-time.Hour)
+
+	if value := r.URL.Query().Get("to"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to time %q, expected RFC 3339", value)
+		}
+		to = t
+	}
+	if value := r.URL.Query().Get("from"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from time %q, expected RFC 3339", value)
+		}
+		from = t
+	} else if r.URL.Query().Get("to") != "" {
+		from = to.Add(-time.Hour)
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// Handler for GET /api/v1/timeline, returning the runs that overlap the
+// from/to window (RFC 3339, the last hour by default) ordered by start time
+func apiTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	from, to, err := timelineWindow(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`
+		SELECT task_id, COALESCE(NULLIF(job_name, ''), command), command, status, started_at, finished_at
+		FROM job_status
+		WHERE tenant = ? AND started_at != '' AND started_at < ? AND finished_at > ?
+		ORDER BY started_at`, requestTenant(r), formatStorageTime(to), formatStorageTime(from))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	runs := []timelineRun{}
+	for rows.Next() {
+		var run timelineRun
+		if err := rows.Scan(&run.UID, &run.Job, &run.Command, &run.Status, &run.StartedAt, &run.FinishedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Error reading from database")
+			return
+		}
+		runs = append(runs, run)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from": formatStorageTime(from),
+		"to":   formatStorageTime(to),
+		"runs": runs,
+	})
+}
+
+// Handler for the timeline page, which draws the runs from the timeline API
+// as one row of bars per job so overlapping runs stand out
+func timelineHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Run Timeline</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	    <style>
+	        .lane { position: relative; height: 28px; background: #f8f9fa; border-bottom: 1px solid #dee2e6; }
+	        .bar { position: absolute; top: 4px; height: 20px; min-width: 2px; border-radius: 2px; opacity: 0.8; }
+	        .bar-success { background: #198754; }
+	        .bar-failure { background: #dc3545; }
+	        .bar-other { background: #6c757d; }
+	        .label { width: 200px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+	    </style>
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Run Timeline</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	        </div>
+	        <div class="mb-3">
+	            <label for="window" class="form-label">Window:</label>
+	            <select id="window" class="form-select" onchange="loadTimeline()">
+	                <option value="15">Last 15 minutes</option>
+	                <option value="60" selected>Last hour</option>
+	                <option value="360">Last 6 hours</option>
+	                <option value="1440">Last 24 hours</option>
+	            </select>
+	        </div>
+	        <p id="range" class="text-muted"></p>
+	        <div id="timeline"></div>
+	    </div>
+	    <script>
+	        function loadTimeline() {
+	            var minutes = document.getElementById('window').value;
+	            var to = new Date();
+	            var from = new Date(to.getTime() - minutes * 60000);
+	            var url = '`+tenantURL(r, "/api/v1/timeline")+`?from=' + encodeURIComponent(from.toISOString()) + '&to=' + encodeURIComponent(to.toISOString());
+	            fetch(url).then(function(response) { return response.json(); }).then(function(data) {
+	                render(data, from.getTime(), to.getTime());
+	            });
+	        }
+
+	        function render(data, start, end) {
+	            var lanes = {};
+	            data.runs.forEach(function(run) {
+	                (lanes[run.job] = lanes[run.job] || []).push(run);
+	            });
+
+	            var container = document.getElementById('timeline');
+	            container.innerHTML = '';
+	            document.getElementById('range').textContent = new Date(start).toLocaleString() + ' to ' + new Date(end).toLocaleString() + ', ' + data.runs.length + ' runs';
+
+	            Object.keys(lanes).sort().forEach(function(job) {
+	                var row = document.createElement('div');
+	                row.className = 'd-flex align-items-center';
+	                var label = document.createElement('div');
+	                label.className = 'label pe-2';
+	                label.textContent = job;
+	                label.title = job;
+	                var lane = document.createElement('div');
+	                lane.className = 'lane flex-grow-1';
+
+	                lanes[job].forEach(function(run) {
+	                    var runStart = Math.max(Date.parse(run.started_at), start);
+	                    var runEnd = Math.min(Date.parse(run.finished_at), end);
+	                    var bar = document.createElement('div');
+	                    bar.className = 'bar ' + (run.status === 'Success' ? 'bar-success' : run.status.indexOf('Fail') === 0 ? 'bar-failure' : 'bar-other');
+	                    bar.style.left = ((runStart - start) / (end - start) * 100) + '%';
+	                    bar.style.width = ((runEnd - runStart) / (end - start) * 100) + '%';
+	                    bar.title = run.status + ': ' + new Date(run.started_at).toLocaleTimeString() + ' - ' + new Date(run.finished_at).toLocaleTimeString();
+	                    lane.appendChild(bar);
+	                });
+
+	                row.appendChild(label);
+	                row.appendChild(lane);
+	                container.appendChild(row);
+	            });
+	        }
+
+	        loadTimeline();
+	    </script>
+	</body>
+	</html>
+	`)
+}
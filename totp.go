@@ -0,0 +1,462 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Time step and length of TOTP codes, the defaults of authenticator apps
+const (
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+// Number of recovery codes handed out at enrollment
+const recoveryCodeCount = 10
+
+// Cookie holding the token of a sign-in waiting for its second factor
+const secondFactorCookieName = "gtask_2fa"
+
+// Struct to hold a sign-in whose password was correct but whose second factor
+// has not been given yet
+type pendingLogin struct {
+	Tenant  string
+	User    string
+	Next    string
+	Expires time.Time
+}
+
+// Sign-ins waiting for their second factor, by token
+var (
+	pendingLogins   = make(map[string]pendingLogin)
+	pendingLoginsMu sync.Mutex
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Helper function to generate a random hex token of n bytes
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Function to compute the TOTP code of a secret for a time step (RFC 6238)
+func totpCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// Function to check a TOTP code, allowing one step of clock drift either way.
+// Codes of steps up to lastStep were already used and are refused so a code
+// cannot be replayed. The step of the code is returned.
+func verifyTOTP(secret, code string, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+	code = strings.ReplaceAll(code, " ", "")
+	now := time.Now().Unix() / totpPeriod
+	for step := now - 1; step <= now+1; step++ {
+		if step > lastStep && subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Helper function to hash a recovery code; like session tokens, recovery codes
+// are only stored as hashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Function to get the TOTP state of a local user
+func userTOTP(tenant, username string) (secret string, enabled bool, lastStep int64, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	err = db.QueryRow(`SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE tenant = ? AND username = ?`, tenant, username).
+		Scan(&secret, &enabled, &lastStep)
+	if err == sql.ErrNoRows {
+		err = errUserNotFound
+	}
+	return secret, enabled, lastStep, err
+}
+
+// Function to tell whether a user has to give a second factor to sign in
+func totpRequired(tenant, username string) bool {
+	_, enabled, _, err := userTOTP(tenant, username)
+	return err == nil && enabled
+}
+
+// Function to store a new secret for a user who is enrolling, replacing any
+// earlier unconfirmed one
+func startTOTPEnrollment(tenant, username string) (string, error) {
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("error generating secret: %w", err)
+	}
+	secret := totpEncoding.EncodeToString(key)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, err := db.Exec(`UPDATE users SET totp_secret = ?, totp_enabled = 0 WHERE tenant = ? AND username = ?`, secret, tenant, username); err != nil {
+		return "", fmt.Errorf("error saving secret: %w", err)
+	}
+	return secret, nil
+}
+
+// Function to replace a user's recovery codes, returning the new codes
+func generateRecoveryCodes(tenant, username string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		token, err := randomToken(5)
+		if err != nil {
+			return nil, fmt.Errorf("error generating recovery codes: %w", err)
+		}
+		codes[i] = token[:5] + "-" + token[5:]
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM user_recovery_codes WHERE tenant = ? AND username = ?`, tenant, username); err != nil {
+		return nil, fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	for _, code := range codes {
+		if _, err := tx.Exec(`INSERT INTO user_recovery_codes (tenant, username, code_hash, used_at) VALUES (?, ?, ?, '')`,
+			tenant, username, hashRecoveryCode(code)); err != nil {
+			return nil, fmt.Errorf("error saving recovery codes: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error saving recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Function to confirm an enrollment with a code from the authenticator app,
+// turning on the second factor and returning the user's recovery codes
+func confirmTOTPEnrollment(tenant, username, code string) ([]string, error) {
+	secret, enabled, lastStep, err := userTOTP(tenant, username)
+	if err != nil {
+		return nil, err
+	}
+	if enabled || secret == "" {
+		return nil, fmt.Errorf("no enrollment in progress")
+	}
+	step, ok := verifyTOTP(secret, code, lastStep)
+	if !ok {
+		return nil, fmt.Errorf("invalid code, check the time of your device")
+	}
+
+	mu.Lock()
+	_, err = db.Exec(`UPDATE users SET totp_enabled = 1, totp_last_step = ? WHERE tenant = ? AND username = ?`, step, tenant, username)
+	mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+	return generateRecoveryCodes(tenant, username)
+}
+
+// Function to turn off the second factor of a user and forget their secret
+// and recovery codes
+func disableTOTP(tenant, username string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	result, err := db.Exec(`UPDATE users SET totp_secret = '', totp_enabled = 0, totp_last_step = 0 WHERE tenant = ? AND username = ?`, tenant, username)
+	if err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	if _, err := db.Exec(`DELETE FROM user_recovery_codes WHERE tenant = ? AND username = ?`, tenant, username); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	return nil
+}
+
+// Function to check the second factor of a user, which is either a code from
+// the authenticator app or an unused recovery code. Recovery codes only work once.
+func checkSecondFactor(tenant, username, code string) (usedRecoveryCode bool, ok bool) {
+	secret, enabled, lastStep, err := userTOTP(tenant, username)
+	if err != nil || !enabled {
+		return false, false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if step, valid := verifyTOTP(secret, code, lastStep); valid {
+		// Only accept the step if no other request used it in the meantime
+		result, err := db.Exec(`UPDATE users SET totp_last_step = ? WHERE tenant = ? AND username = ? AND totp_last_step < ?`, step, tenant, username, step)
+		if err != nil {
+			fmt.Printf("Error saving TOTP step: %s\n", err)
+			return false, false
+		}
+		n, _ := result.RowsAffected()
+		return false, n == 1
+	}
+	result, err := db.Exec(`
+		UPDATE user_recovery_codes SET used_at = ?
+		WHERE tenant = ? AND username = ? AND code_hash = ? AND used_at = ''`,
+		time.Now().Format("02-01-2006 15:04:05"), tenant, username, hashRecoveryCode(code))
+	if err != nil {
+		fmt.Printf("Error checking recovery code: %s\n", err)
+		return false, false
+	}
+	n, _ := result.RowsAffected()
+	return true, n == 1
+}
+
+// Function to count the unused recovery codes of a user
+func unusedRecoveryCodes(tenant, username string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM user_recovery_codes WHERE tenant = ? AND username = ? AND used_at = ''`, tenant, username).Scan(&n)
+	return n
+}
+
+// Function to hold a sign-in until its second factor is given, sending the
+// browser to the second factor page
+func startSecondFactor(w http.ResponseWriter, r *http.Request, tenant, username, next string) {
+	token, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Error signing in", http.StatusInternalServerError)
+		return
+	}
+	timeout := getEnvDuration("TOTP_LOGIN_TIMEOUT", 5*time.Minute)
+
+	pendingLoginsMu.Lock()
+	now := time.Now()
+	for t, p := range pendingLogins {
+		if now.After(p.Expires) {
+			delete(pendingLogins, t)
+		}
+	}
+	pendingLogins[hashSessionToken(token)] = pendingLogin{Tenant: tenant, User: username, Next: next, Expires: now.Add(timeout)}
+	pendingLoginsMu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     secondFactorCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(timeout.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || getEnvBool("SESSION_COOKIE_SECURE", false),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, tenantURL(r, "/login/2fa"), http.StatusSeeOther)
+}
+
+// Handler for the second step of signing in, asking for a code from the
+// authenticator app or a recovery code
+func secondFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var pending pendingLogin
+	var tokenHash string
+	if cookie, err := r.Cookie(secondFactorCookieName); err == nil {
+		tokenHash = hashSessionToken(cookie.Value)
+		pendingLoginsMu.Lock()
+		pending = pendingLogins[tokenHash]
+		pendingLoginsMu.Unlock()
+	}
+	if pending.User == "" || time.Now().After(pending.Expires) || pending.Tenant != requestTenant(r) {
+		http.Redirect(w, r, tenantURL(r, "/login"), http.StatusSeeOther)
+		return
+	}
+
+	message := ""
+	if r.Method == http.MethodPost {
+		accountKey := "user:" + jobKey(pending.Tenant, pending.User)
+		usedRecoveryCode, ok := false, false
+		wait := loginLockedFor(accountKey, "ip:"+remoteIP(r))
+		if wait == 0 {
+			usedRecoveryCode, ok = checkSecondFactor(pending.Tenant, pending.User, r.FormValue("code"))
+		}
+		switch {
+		case wait > 0:
+			w.WriteHeader(http.StatusTooManyRequests)
+			message = fmt.Sprintf(`<div class="alert alert-danger">Too many failed sign-ins, try again in %s.</div>`, wait.Round(time.Second))
+		case ok:
+			pendingLoginsMu.Lock()
+			delete(pendingLogins, tokenHash)
+			pendingLoginsMu.Unlock()
+			http.SetCookie(w, &http.Cookie{Name: secondFactorCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+			if usedRecoveryCode {
+				recordAuditEvent(pending.Tenant, pending.User, "recovery_code_used",
+					fmt.Sprintf("%d recovery codes left", unusedRecoveryCodes(pending.Tenant, pending.User)), remoteIP(r))
+			}
+			completeLogin(w, r, pending.Tenant, pending.User, pending.Next)
+			return
+		default:
+			recordFailedLogin(r, pending.Tenant, pending.User)
+			w.WriteHeader(http.StatusUnauthorized)
+			message = `<div class="alert alert-danger">Invalid code.</div>`
+		}
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Two-Factor Authentication</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5" style="max-width: 420px;">
+	        <h1>Two-Factor Authentication</h1>
+	        `+message+`
+	        <form action="`+tenantURL(r, "/login/2fa")+`" method="post">
+	            <div class="mb-3">
+	                <label for="code" class="form-label">Code from your authenticator app, or a recovery code</label>
+	                <input type="text" class="form-control" id="code" name="code" autocomplete="one-time-code" autofocus required>
+	            </div>
+	            <button type="submit" class="btn btn-primary">Verify</button>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Handler for the page on which signed-in local users turn two-factor
+// authentication on or off and replace their recovery codes
+func accountTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := requestSession(r)
+	if !ok {
+		http.Redirect(w, r, tenantURL(r, "/login"), http.StatusSeeOther)
+		return
+	}
+	secret, enabled, _, err := userTOTP(s.Tenant, s.User)
+	if err == errUserNotFound || s.Source == "sso" {
+		http.Error(w, "Two-factor authentication is only available to local users", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	var message, body string
+	var codes []string
+	if r.Method == http.MethodPost {
+		switch action := r.FormValue("action"); {
+		case action == "enroll" && !enabled:
+			secret, err = startTOTPEnrollment(s.Tenant, s.User)
+		case action == "confirm" && !enabled:
+			codes, err = confirmTOTPEnrollment(s.Tenant, s.User, r.FormValue("code"))
+			if err == nil {
+				enabled = true
+				recordAuditEvent(s.Tenant, s.User, "totp_enabled", "user "+s.User, remoteIP(r))
+			}
+		case (action == "disable" || action == "regenerate") && enabled:
+			// Changes to an enrolled factor need a current code, so a stolen
+			// session alone cannot remove it
+			if _, valid := checkSecondFactor(s.Tenant, s.User, r.FormValue("code")); !valid {
+				err = fmt.Errorf("invalid code")
+			} else if action == "disable" {
+				err = disableTOTP(s.Tenant, s.User)
+				enabled, secret = false, ""
+				recordAuditEvent(s.Tenant, s.User, "totp_disabled", "user "+s.User, remoteIP(r))
+			} else {
+				codes, err = generateRecoveryCodes(s.Tenant, s.User)
+				recordAuditEvent(s.Tenant, s.User, "recovery_codes_regenerated", "user "+s.User, remoteIP(r))
+			}
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			message = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+		}
+	}
+
+	action := tenantURL(r, "/account/2fa")
+	codeField := `<input type="text" name="code" class="form-control" placeholder="Current code" autocomplete="one-time-code" required>`
+	switch {
+	case len(codes) > 0:
+		body = `<div class="alert alert-success">Two-factor authentication is on. Store these recovery codes in a safe place; each works once, and they will not be shown again.</div>
+	        <pre class="fs-5">` + strings.Join(codes, "\n") + `</pre>
+	        <a href="` + tenantURL(r, "/") + `" class="btn btn-primary">Done</a>`
+	case enabled:
+		body = fmt.Sprintf(`<p>Two-factor authentication is on. %d recovery codes are left.</p>
+	        <form action="%s" method="post" class="d-flex gap-2" style="max-width: 520px;">
+	            %s
+	            <button type="submit" name="action" value="regenerate" class="btn btn-outline-primary text-nowrap">New Recovery Codes</button>
+	            <button type="submit" name="action" value="disable" class="btn btn-outline-danger text-nowrap">Turn Off</button>
+	        </form>`, unusedRecoveryCodes(s.Tenant, s.User), action, codeField)
+	case secret != "":
+		uri := fmt.Sprintf("otpauth://totp/%s:%s?secret=%s&issuer=%s&period=%d&digits=%d",
+			url.PathEscape(totpIssuer()), url.PathEscape(s.User), secret, url.QueryEscape(totpIssuer()), totpPeriod, totpDigits)
+		png, err := qrcode.Encode(uri, qrcode.Medium, 240)
+		if err != nil {
+			http.Error(w, "Error generating QR code", http.StatusInternalServerError)
+			return
+		}
+		body = `<p>Scan the QR code with an authenticator app, or enter the key <code>` + secret + `</code>, then enter the code it shows.</p>
+	        <img src="data:image/png;base64,` + base64.StdEncoding.EncodeToString(png) + `" alt="QR code" class="mb-3">
+	        <form action="` + action + `" method="post" class="d-flex gap-2" style="max-width: 360px;">
+	            ` + codeField + `
+	            <button type="submit" name="action" value="confirm" class="btn btn-primary">Turn On</button>
+	        </form>`
+	default:
+		body = `<p>Two-factor authentication is off. With it on, signing in also asks for a code from an authenticator app.</p>
+	        <form action="` + action + `" method="post">
+	            <button type="submit" name="action" value="enroll" class="btn btn-primary">Set Up</button>
+	        </form>`
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Two-Factor Authentication</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Two-Factor Authentication</h1>
+	        `+message+`
+	        `+body+`
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Helper function to get the name authenticator apps list accounts under
+func totpIssuer() string {
+	return getEnvString("TOTP_ISSUER", "GTaskScheduler")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 for SHA-1, cut to six digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %q, want %q", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	// Keep clear of a step boundary so the current step holds for the whole test
+	if left := totpPeriod - time.Now().Unix()%totpPeriod; left < 2 {
+		time.Sleep(time.Duration(left) * time.Second)
+	}
+	now := time.Now().Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current code", totpCode(key, now), 0, now, true},
+		{"code with a space", totpCode(key, now)[:3] + " " + totpCode(key, now)[3:], 0, now, true},
+		{"previous step", totpCode(key, now-1), 0, now - 1, true},
+		{"next step", totpCode(key, now+1), 0, now + 1, true},
+		{"too old", totpCode(key, now-3), 0, 0, false},
+		{"already used", totpCode(key, now), now, 0, false},
+		{"wrong code", "000000x", 0, 0, false},
+	}
+	for _, tt := range tests {
+		step, ok := verifyTOTP(secret, tt.code, tt.lastStep)
+		if ok != tt.wantOK || step != tt.wantStep {
+			t.Errorf("%s: verifyTOTP = %d, %v; want %d, %v", tt.name, step, ok, tt.wantStep, tt.wantOK)
+		}
+	}
+
+	if _, ok := verifyTOTP("not base32!", totpCode(key, now), 0); ok {
+		t.Error("verifyTOTP accepted a code for an invalid secret")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exporter of run spans to an OpenTelemetry collector, nil when tracing is off
+var traceExporter *otlpExporter
+
+// Exporter sending spans to an OTLP/HTTP endpoint, JSON encoded
+type otlpExporter struct {
+	endpoint string // URL spans are posted to, ending in /v1/traces
+	headers  map[string]string
+	resource []otlpAttribute
+}
+
+// Function to configure span export from the standard OTEL_* settings.
+// Returns false when no OTLP endpoint is set.
+func newOTLPExporter() (*otlpExporter, bool, error) {
+	endpoint := getEnvString("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if endpoint == "" {
+		base := getEnvString("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		if base == "" {
+			return nil, false, nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, false, fmt.Errorf("OTLP endpoint %q must be an http or https URL", endpoint)
+	}
+
+	e := &otlpExporter{endpoint: endpoint, headers: make(map[string]string)}
+	// Headers are written as comma separated key=value pairs, with URL encoded values
+	for _, pair := range strings.Split(getEnvString("OTEL_EXPORTER_OTLP_HEADERS", ""), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, false, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS entry %q, expected key=value", pair)
+		}
+		if decoded, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = decoded
+		}
+		e.headers[strings.TrimSpace(key)] = value
+	}
+
+	hostname, _ := os.Hostname()
+	e.resource = []otlpAttribute{
+		stringAttribute("service.name", getEnvString("OTEL_SERVICE_NAME", "gtask")),
+		stringAttribute("service.instance.id", runnerName),
+		stringAttribute("host.name", hostname),
+	}
+	return e, true, nil
+}
+
+// Struct to hold a span covering one run of a job, all its attempts included
+type runSpan struct {
+	traceID [16]byte
+	spanID  [8]byte
+	job     Job
+	start   time.Time
+}
+
+// Function to start the span of a run. Returns nil when tracing is off.
+func startRunSpan(j Job) *runSpan {
+	if traceExporter == nil {
+		return nil
+	}
+	span := &runSpan{job: j, start: time.Now()}
+	rand.Read(span.traceID[:])
+	rand.Read(span.spanID[:])
+	return span
+}
+
+// Function to get the W3C traceparent header value of a span, passed to the
+// job's command as TRACEPARENT so that the services it calls join the trace
+func (s *runSpan) traceParent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(s.traceID[:]) + "-" + hex.EncodeToString(s.spanID[:]) + "-01"
+}
+
+// Function to end the span of a run with its final attempt and export it in
+// the background. Export errors are recorded as integration events.
+func (s *runSpan) end(status JobStatus) {
+	if s == nil {
+		return
+	}
+	j := s.job
+	attributes := []otlpAttribute{
+		stringAttribute("gtask.tenant", j.Tenant),
+		stringAttribute("gtask.job.name", j.Name),
+		stringAttribute("gtask.job.schedule", strings.Join(j.CronExprs(), " | ")),
+		stringAttribute("gtask.run.uid", status.UID),
+		intAttribute("gtask.run.number", status.RunNumber),
+		intAttribute("gtask.run.attempts", int64(status.Attempt)),
+		stringAttribute("gtask.run.status", status.Status),
+		intAttribute("process.exit.code", int64(status.ExitCode)),
+		intAttribute("process.pid", int64(status.PID)),
+		stringAttribute("gtask.runner", status.Runner),
+	}
+	if !j.ScheduledAt.IsZero() {
+		attributes = append(attributes, stringAttribute("gtask.run.scheduled_at", j.ScheduledAt.UTC().Format(time.RFC3339)))
+	}
+	spanStatus := otlpStatus{Code: 1}
+	if status.Status != "Success" {
+		spanStatus = otlpStatus{Code: 2, Message: status.Status}
+	}
+
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              "job " + j.Name,
+		Kind:              1,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:        attributes,
+		Status:            spanStatus,
+	}
+	go func() {
+		if err := traceExporter.export(span); err != nil {
+			recordEvent(j.Tenant, eventIntegration, fmt.Sprintf("Error exporting trace of job %s: %s", j.Name, err))
+		}
+	}()
+}
+
+// Structs to hold the parts of an OTLP/JSON trace export request used here
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 1 for ok, 2 for error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"` // 1 for internal
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]any{"stringValue": value}}
+}
+
+// 64-bit integers are sent as strings in OTLP/JSON
+func intAttribute(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: map[string]any{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+// Helper function to post a span to the OTLP endpoint
+func (e *otlpExporter) export(span otlpSpan) error {
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": e.resource},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "gtask"},
+				"spans": []otlpSpan{span},
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
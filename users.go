@@ -0,0 +1,488 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles of users; only admins may manage users
+const (
+	roleAdmin = "admin"
+	roleUser  = "user"
+)
+
+// Struct to hold a local user. The password hash is never handed out.
+type User struct {
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Disabled  bool   `json:"disabled"`
+	TOTP      bool   `json:"totp"` // whether two-factor authentication is on
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Usernames are shown in the UI and stored with runs and audit events
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]{0,63}$`)
+
+var (
+	errUserNotFound = errors.New("user not found")
+	errUserExists   = errors.New("user already exists")
+)
+
+// Whether any local user exists, which makes signing in required
+var usersExist atomic.Bool
+
+// Hash compared against when a username is unknown, so that unknown and known
+// usernames take equally long to reject
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("gtask-dummy-password"), bcrypt.DefaultCost)
+
+// Function to check whether local users exist, at startup
+func loadUsersExist() error {
+	mu.Lock()
+	defer mu.Unlock()
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users)`).Scan(&exists); err != nil {
+		return fmt.Errorf("error loading users: %w", err)
+	}
+	usersExist.Store(exists)
+	return nil
+}
+
+// Function to check a new password against the password policy
+func validatePassword(password string) error {
+	minLength := getEnvInt("PASSWORD_MIN_LENGTH", 10)
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+	// bcrypt ignores everything after 72 bytes
+	if len(password) > 72 {
+		return fmt.Errorf("password must not be longer than 72 bytes")
+	}
+	return nil
+}
+
+// Function to hash a new password with bcrypt
+func hashPassword(password string) (string, error) {
+	if err := validatePassword(password); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), getEnvInt("BCRYPT_COST", bcrypt.DefaultCost))
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Function to list the users of a tenant
+func listUsers(tenant string) ([]User, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	rows, err := db.Query(`SELECT username, role, disabled, totp_enabled, created_at, updated_at FROM users WHERE tenant = ? ORDER BY username`, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("error querying users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.Username, &u.Role, &u.Disabled, &u.TOTP, &u.CreatedAt, &u.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("error reading users: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Function to create a local user of a tenant
+func createUser(tenant, username, password, role string) error {
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username %q, use letters, digits and . _ @ -", username)
+	}
+	if role != roleAdmin && role != roleUser {
+		return fmt.Errorf("invalid role %q, expected %s or %s", role, roleAdmin, roleUser)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	now := time.Now().Format("02-01-2006 15:04:05")
+	result, err := db.Exec(`
+		INSERT INTO users (tenant, username, password_hash, role, disabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?)
+		ON CONFLICT(tenant, username) DO NOTHING`, tenant, username, hash, role, now, now)
+	if err != nil {
+		return fmt.Errorf("error creating user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUserExists
+	}
+	usersExist.Store(true)
+	return nil
+}
+
+// Helper function to update a user and end all of their sessions
+func updateUser(tenant, username, set string, args ...any) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	args = append(args, time.Now().Format("02-01-2006 15:04:05"), tenant, username)
+	result, err := db.Exec(`UPDATE users SET `+set+`, updated_at = ? WHERE tenant = ? AND username = ?`, args...)
+	if err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	if _, err := db.Exec(`DELETE FROM sessions WHERE tenant = ? AND user = ?`, tenant, username); err != nil {
+		return fmt.Errorf("error ending sessions: %w", err)
+	}
+	return nil
+}
+
+// Function to disable or enable a user. Disabling a user signs them out everywhere.
+func setUserDisabled(tenant, username string, disabled bool) error {
+	return updateUser(tenant, username, "disabled = ?", disabled)
+}
+
+// Function to set a new password for a user, signing them out everywhere
+func resetUserPassword(tenant, username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return updateUser(tenant, username, "password_hash = ?", hash)
+}
+
+// Function to delete a user along with their sessions, preferences and recovery codes
+func deleteUser(tenant, username string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	result, err := db.Exec(`DELETE FROM users WHERE tenant = ? AND username = ?`, tenant, username)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errUserNotFound
+	}
+	for _, table := range []string{"sessions", "user_preferences"} {
+		if _, err := db.Exec(`DELETE FROM `+table+` WHERE tenant = ? AND user = ?`, tenant, username); err != nil {
+			return fmt.Errorf("error deleting user data: %w", err)
+		}
+	}
+	if _, err := db.Exec(`DELETE FROM user_recovery_codes WHERE tenant = ? AND username = ?`, tenant, username); err != nil {
+		return fmt.Errorf("error deleting user data: %w", err)
+	}
+	return nil
+}
+
+// Function to get the role of an enabled user, or "" if there is no such user.
+// The ADMIN_USER account from the settings is an admin of every tenant unless a
+// local user of the same name exists.
+func userRole(tenant, username string) string {
+	mu.Lock()
+	var role string
+	var disabled bool
+	err := db.QueryRow(`SELECT role, disabled FROM users WHERE tenant = ? AND username = ?`, tenant, username).Scan(&role, &disabled)
+	mu.Unlock()
+	switch {
+	case err == nil && !disabled:
+		return role
+	case err == sql.ErrNoRows && os.Getenv("ADMIN_PASSWORD") != "" && username == adminUsername():
+		return roleAdmin
+	}
+	return ""
+}
+
+// Function to get the role of a signed-in user. The roles of single sign-on
+// users are granted by the identity provider when they sign in.
+func sessionRole(s Session) string {
+	if s.Source == "sso" {
+		return s.Role
+	}
+	return userRole(s.Tenant, s.User)
+}
+
+// Helper function to get the username of the account from the settings
+func adminUsername() string {
+	return getEnvString("ADMIN_USER", "admin")
+}
+
+// Function to check a username and password against the local users, or the
+// account from the settings
+func authenticate(tenant, username, password string) bool {
+	mu.Lock()
+	var hash string
+	var disabled bool
+	err := db.QueryRow(`SELECT password_hash, disabled FROM users WHERE tenant = ? AND username = ?`, tenant, username).Scan(&hash, &disabled)
+	mu.Unlock()
+
+	if err == nil {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil && !disabled
+	}
+	if err != sql.ErrNoRows {
+		fmt.Printf("Error loading user: %s\n", err)
+	}
+	bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+
+	adminPassword := os.Getenv("ADMIN_PASSWORD")
+	if err != sql.ErrNoRows || adminPassword == "" {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(adminUsername())) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(adminPassword)) == 1
+	return userOK && passwordOK
+}
+
+// Function to check that a request was made by an admin of its tenant, through
+// a session or HTTP basic authentication. Anyone is an admin while signing in
+// is not required. The admin's name is returned.
+func requestAdmin(r *http.Request) (string, bool) {
+	if !authEnabled() {
+		return r.RemoteAddr, true
+	}
+	if s, ok := requestSession(r); ok {
+		return s.User, sessionRole(s) == roleAdmin
+	}
+	if username, ok := basicAuthUser(r); ok {
+		return username, userRole(requestTenant(r), username) == roleAdmin
+	}
+	return "", false
+}
+
+// Function to check the HTTP basic authentication of a request against the
+// users of its tenant, returning the user it was made by
+func basicAuthUser(r *http.Request) (string, bool) {
+	tenant := requestTenant(r)
+	username, password, ok := r.BasicAuth()
+	// Basic authentication cannot carry a second factor, so users who have
+	// one must use a session
+	if !ok || totpRequired(tenant, username) {
+		return "", false
+	}
+	allowed, _ := checkLogin(r, tenant, username, password)
+	return username, allowed
+}
+
+// Helper function to describe a user management error for a response
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errUserExists):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// Function to apply a user management action on behalf of an admin, recording
+// it in the audit log
+func manageUser(r *http.Request, actor, action, username, password, role string) error {
+	tenant := requestTenant(r)
+	if s, ok := requestSession(r); ok && s.User == username && (action == "disable" || action == "delete") {
+		return fmt.Errorf("you cannot %s your own account", action)
+	}
+
+	var err error
+	switch action {
+	case "create":
+		err = createUser(tenant, username, password, role)
+	case "disable", "enable":
+		err = setUserDisabled(tenant, username, action == "disable")
+	case "reset":
+		err = resetUserPassword(tenant, username, password)
+	case "reset_2fa":
+		err = disableTOTP(tenant, username)
+	case "delete":
+		err = deleteUser(tenant, username)
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if err != nil {
+		return err
+	}
+	recordAuditEvent(tenant, actor, "user_"+action, "user "+username, remoteIP(r))
+	return nil
+}
+
+// Handler for the users page, listing the tenant's users with forms to create,
+// disable, enable, reset and delete them. Only admins may use it.
+func usersHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requestAdmin(r)
+	if !ok {
+		http.Error(w, "Only admins can manage users", http.StatusForbidden)
+		return
+	}
+
+	message := ""
+	if r.Method == http.MethodPost {
+		action := r.FormValue("action")
+		username := r.FormValue("username")
+		if err := manageUser(r, actor, action, username, r.FormValue("password"), r.FormValue("role")); err != nil {
+			w.WriteHeader(userErrorStatus(err))
+			message = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+		} else {
+			http.Redirect(w, r, tenantURL(r, "/users"), http.StatusSeeOther)
+			return
+		}
+	}
+
+	users, err := listUsers(requestTenant(r))
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Users</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Users</h1>
+	        `+message+`
+	        <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary mb-3">Back to Dashboard</a>
+	        <table class="table table-striped">
+	            <thead>
+	                <tr>
+	                    <th>Username</th>
+	                    <th>Role</th>
+	                    <th>Status</th>
+	                    <th>2FA</th>
+	                    <th>Created</th>
+	                    <th>Updated</th>
+	                    <th>Actions</th>
+	                </tr>
+	            </thead>
+	            <tbody>`)
+
+	action := tenantURL(r, "/users")
+	for _, u := range users {
+		status, toggle := "Active", "disable"
+		if u.Disabled {
+			status, toggle = "Disabled", "enable"
+		}
+		totp := "Off"
+		if u.TOTP {
+			totp = "On"
+		}
+		name := html.EscapeString(u.Username)
+		fmt.Fprintf(w, `<tr>
+				<td>%[2]s</td>
+				<td>%[3]s</td>
+				<td>%[4]s</td>
+				<td>%[8]s</td>
+				<td>%[5]s</td>
+				<td>%[6]s</td>
+				<td>
+					<form action="%[1]s" method="post" class="d-flex gap-2">
+						<input type="hidden" name="username" value="%[2]s">
+						<input type="password" name="password" class="form-control form-control-sm" placeholder="New password" autocomplete="new-password">
+						<button type="submit" name="action" value="reset" class="btn btn-sm btn-outline-primary">Reset Password</button>
+						<button type="submit" name="action" value="%[7]s" class="btn btn-sm btn-outline-warning text-capitalize">%[7]s</button>
+						<button type="submit" name="action" value="reset_2fa" class="btn btn-sm btn-outline-secondary text-nowrap">Reset 2FA</button>
+						<button type="submit" name="action" value="delete" class="btn btn-sm btn-outline-danger" onclick="return confirm('Delete user %[2]s?')">Delete</button>
+					</form>
+				</td>
+			</tr>`, action, name, u.Role, status, u.CreatedAt, u.UpdatedAt, toggle, totp)
+	}
+
+	fmt.Fprintln(w, `</tbody></table>
+	        <h2 class="h4 mt-4">Create User</h2>
+	        <form action="`+action+`" method="post" class="row g-2">
+	            <input type="hidden" name="action" value="create">
+	            <div class="col-md-3"><input type="text" name="username" class="form-control" placeholder="Username" required></div>
+	            <div class="col-md-3"><input type="password" name="password" class="form-control" placeholder="Password" autocomplete="new-password" required></div>
+	            <div class="col-md-2">
+	                <select name="role" class="form-select">
+	                    <option value="user">User</option>
+	                    <option value="admin">Admin</option>
+	                </select>
+	            </div>
+	            <div class="col-md-2"><button type="submit" class="btn btn-primary">Create</button></div>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Struct to hold the body of the user API endpoints
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+// Handler for GET /api/v1/users, listing the tenant's users
+func apiListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can manage users")
+		return
+	}
+	users, err := listUsers(requestTenant(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// Handler for POST /api/v1/users, POST /api/v1/users/{name}/{action} with
+// action disable, enable, reset or reset-2fa, and DELETE /api/v1/users/{name}
+func apiManageUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor, ok := requestAdmin(r)
+	if !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can manage users")
+		return
+	}
+	var req userRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	action, status := r.PathValue("action"), http.StatusOK
+	switch {
+	case r.Method == http.MethodDelete:
+		action, req.Username = "delete", r.PathValue("name")
+	case action == "reset-2fa":
+		action, req.Username = "reset_2fa", r.PathValue("name")
+	case r.PathValue("name") == "":
+		action, status = "create", http.StatusCreated
+		if req.Role == "" {
+			req.Role = roleUser
+		}
+	case action == "create" || action == "delete" || action == "reset_2fa":
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("unknown action %q", action))
+		return
+	default:
+		req.Username = r.PathValue("name")
+	}
+
+	if err := manageUser(r, actor, action, req.Username, req.Password, req.Role); err != nil {
+		writeJSONError(w, userErrorStatus(err), err.Error())
+		return
+	}
+	writeJSON(w, status, map[string]string{"username": req.Username, "action": action})
+}
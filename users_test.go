@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Helper function to build a request made with a local user's session
+func sessionRequest(method, target, body, username string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	s := Session{Tenant: defaultTenant, User: username, Source: "local"}
+	return r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s))
+}
+
+func TestFormsRefuseNonAdmins(t *testing.T) {
+	openTestDatabase(t)
+	t.Setenv("ADMIN_PASSWORD", "secret")
+	if err := createUser(defaultTenant, "alice", "correct horse battery", roleUser); err != nil {
+		t.Fatalf("createUser: %s", err)
+	}
+	if err := createUser(defaultTenant, "root", "correct horse battery", roleAdmin); err != nil {
+		t.Fatalf("createUser: %s", err)
+	}
+	if _, ok := requestAdmin(sessionRequest("GET", "/", "", "root")); !ok {
+		t.Fatal("an admin's session is not recognised as an admin")
+	}
+
+	tests := []struct {
+		name         string
+		handler      http.HandlerFunc
+		method, path string
+		body         string
+	}{
+		{"add job", submitJobHandler, "POST", "/submit-job", "cron_expr=*+*+*+*+*&command=id"},
+		{"delete job", deleteJobHandler, "POST", "/delete-job", "name=backup"},
+		{"enable job", enableJobHandler, "POST", "/enable-job", "name=backup"},
+		{"run job", runJobHandler, "POST", "/run-job", "name=backup"},
+		{"upload calendar", calendarsHandler, "POST", "/calendars", "name=holidays&dates=2026-12-25"},
+		{"delete calendar", deleteCalendarHandler, "POST", "/calendars/delete", "name=holidays"},
+		{"create maintenance window", maintenanceWindowsHandler, "POST", "/maintenance", "starts_at=2026-11-02T09:00&duration=1h"},
+		{"end maintenance window", endMaintenanceWindowHandler, "POST", "/maintenance/end", "id=1"},
+		{"pause scheduling", pauseHandler, "POST", "/scheduler/pause", "reason=deploy"},
+		{"resume scheduling", resumeHandler, "POST", "/scheduler/resume", ""},
+		{"cancel run", cancelRunHandler, "POST", "/cancel-run", "uid=0190d3c4"},
+		{"edit job", editJobHandler, "POST", "/edit-job", "name=backup&cron_expr=*+*+*+*+*&command=id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler(w, sessionRequest(tt.method, tt.path, tt.body, "alice"))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Settings read as numbers, durations and booleans, checked by gtask validate
+var (
+	intSettings = []string{
+		"BCRYPT_COST", "CALLBACK_RETRIES", "DB_BATCH_SIZE", "DB_BREAKER_THRESHOLD", "DB_BUFFER_MAX_ROWS", "DB_MAX_IDLE_CONNS", "DB_MAX_OPEN_CONNS", "DB_RETRY_ATTEMPTS", "DISK_PRUNE_KEEP_ROWS",
+		"DISK_PRUNE_PERCENT", "DISK_WARN_PERCENT", "EVENT_RETENTION_DAYS", "LOG_SHIP_BATCH_SIZE", "LOG_SHIP_OUTPUT_LIMIT", "LOGIN_MAX_ATTEMPTS", "LOGIN_MAX_ATTEMPTS_PER_IP",
+		"MAX_CONCURRENT_RUNS", "MAX_CONSECUTIVE_FAILURES", "MAX_OUTPUT_BYTES", "NOTIFY_OUTPUT_LIMIT", "PASSWORD_MIN_LENGTH", "RUN_RETENTION_DAYS", "SMTP_PORT", "STATUS_PAGE_DAYS",
+	}
+	durationSettings = []string{
+		"CALLBACK_RETRY_DELAY", "CALLBACK_TIMEOUT", "DB_BATCH_WINDOW", "DB_BREAKER_COOLDOWN", "DB_BUSY_TIMEOUT", "DB_CONN_MAX_IDLE_TIME", "DB_CONN_MAX_LIFETIME", "DB_RETRY_DELAY", "DISK_CHECK_INTERVAL", "GIT_SYNC_INTERVAL", "JOBS_FILE_POLL_INTERVAL", "LOAD_TEST_REPORT_INTERVAL", "LOG_SHIP_INTERVAL", "LOGIN_LOCKOUT",
+		"LOGIN_LOCKOUT_MAX", "MIN_SCHEDULE_INTERVAL", "MISSED_RUN_CHECK_INTERVAL", "MISSED_RUN_GRACE", "PING_TIMEOUT", "RECONCILE_INTERVAL", "RUN_CANCEL_GRACE", "SESSION_IDLE_TIMEOUT",
+		"SESSION_MAX_AGE", "SHUTDOWN_TIMEOUT", "TOTP_LOGIN_TIMEOUT",
+	}
+	boolSettings = []string{"SESSION_COOKIE_SECURE", "SLACK_NOTIFY_SUCCESS", "STRIP_ANSI"}
+)
+
+// Struct to collect the findings of gtask validate
+type validationReport struct {
+	errors   int
+	warnings int
+}
+
+// Function to start a new section of the report
+func (v *validationReport) Section(name string) {
+	fmt.Printf("\n%s\n", name)
+}
+
+// Function to report a check that passed
+func (v *validationReport) OK(format string, args ...any) {
+	fmt.Printf("  ok       %s\n", fmt.Sprintf(format, args...))
+}
+
+// Function to report a problem that does not stop the scheduler from working
+func (v *validationReport) Warn(format string, args ...any) {
+	v.warnings++
+	fmt.Printf("  warning  %s\n", fmt.Sprintf(format, args...))
+}
+
+// Function to report a problem that has to be fixed
+func (v *validationReport) Error(format string, args ...any) {
+	v.errors++
+	fmt.Printf("  error    %s\n", fmt.Sprintf(format, args...))
+}
+
+// Function to run the validate subcommand, which checks the settings, the
+// cron jobs file, the paths they refer to and the database without starting
+// the scheduler. It returns the exit code: 1 if anything has to be fixed.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	envPath := flags.String("env", ".env", "settings file to check")
+	jobsPath := flags.String("jobs", "cron_jobs.txt", "cron jobs file to check")
+	flags.Parse(args)
+
+	v := &validationReport{}
+	validateSettings(v, *envPath)
+	validateJobsFile(v, *jobsPath)
+	validateJobsYAML(v, jobsYAMLFile())
+	validateDatabase(v)
+
+	fmt.Printf("\n%d errors, %d warnings\n", v.errors, v.warnings)
+	if v.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Function to check the settings file and the values of all known settings
+func validateSettings(v *validationReport, envPath string) {
+	v.Section("Settings (" + envPath + ")")
+	if err := godotenv.Load(envPath); err != nil {
+		v.Error("cannot load settings file: %s", err)
+	} else {
+		v.OK("settings file loaded")
+	}
+
+	for _, name := range []string{"LOG_DIR", "DB_DIR"} {
+		dir := os.Getenv(name)
+		if dir == "" {
+			v.Error("%s is not set", name)
+			continue
+		}
+		if err := checkWritableDir(dir); err != nil {
+			v.Error("%s: %s", name, err)
+		} else {
+			v.OK("%s %s is writable", name, dir)
+		}
+	}
+
+	for _, name := range intSettings {
+		if value := os.Getenv(name); value != "" {
+			if _, err := strconv.Atoi(value); err != nil {
+				v.Error("%s=%s is not a number", name, value)
+			}
+		}
+	}
+	for _, name := range durationSettings {
+		if value := os.Getenv(name); value != "" {
+			if d, err := time.ParseDuration(value); err != nil || d < 0 {
+				v.Error("%s=%s is not a duration such as 30s or 5m", name, value)
+			}
+		}
+	}
+	for _, name := range boolSettings {
+		if value := os.Getenv(name); value != "" {
+			if _, err := strconv.ParseBool(value); err != nil {
+				v.Error("%s=%s is not true or false", name, value)
+			}
+		}
+	}
+	if warn, prune := getEnvInt("DISK_WARN_PERCENT", 85), getEnvInt("DISK_PRUNE_PERCENT", 95); warn >= prune {
+		v.Warn("DISK_WARN_PERCENT (%d) is not below DISK_PRUNE_PERCENT (%d), so no warning is sent before pruning", warn, prune)
+	}
+	for _, name := range []string{"DB_MAINTENANCE_SCHEDULE", "NOTIFY_DIGEST_SCHEDULE"} {
+		if expr := os.Getenv(name); expr != "" {
+			if _, err := parseSchedule(expr); err != nil {
+				v.Error("%s: %s", name, err)
+			}
+		}
+	}
+	// The empty name stands for the deployment-wide notification settings
+	notifying := []string{""}
+	for _, name := range strings.Split(os.Getenv("TENANTS"), ",") {
+		if name = strings.TrimSpace(name); name != "" && !tenantNamePattern.MatchString(name) {
+			v.Error("TENANTS: invalid tenant name %q, use lowercase letters, digits and dashes", name)
+		} else if name != "" {
+			notifying = append(notifying, name)
+		}
+	}
+
+	// Notification and integration settings, deployment-wide and per tenant
+	for _, tenant := range notifying {
+		setting := "WEBHOOK_TOKEN"
+		if tenant != "" {
+			setting = tenantSettingsPrefix(tenant) + setting
+		}
+		if token := os.Getenv(setting); token != "" && len(token) < 16 {
+			v.Warn("%s is shorter than 16 characters and easy to guess", setting)
+		}
+		if tenant != "" && !hasTenantSettings(tenant, "SMTP_", "SLACK_", "NOTIFY_TEMPLATE") {
+			continue
+		}
+		if _, _, err := newEmailNotifier(tenant); err != nil {
+			v.Error("email notifications%s: %s", ofTenant(tenant), err)
+		}
+		if _, _, err := newSlackNotifier(tenant); err != nil {
+			v.Error("Slack notifications%s: %s", ofTenant(tenant), err)
+		}
+	}
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" && len(password) < getEnvInt("PASSWORD_MIN_LENGTH", 10) {
+		v.Warn("ADMIN_PASSWORD is shorter than PASSWORD_MIN_LENGTH")
+	}
+	if os.Getenv("GIT_SYNC_REPO") != "" {
+		if _, err := exec.LookPath("git"); err != nil {
+			v.Error("GIT_SYNC_REPO: git is not installed")
+		}
+	}
+	if _, err := journalMode(); err != nil {
+		v.Error("DB_JOURNAL_MODE: %s", err)
+	}
+	if _, err := parseLogOutputs(getEnvString("LOG_OUTPUT", "file")); err != nil {
+		v.Error("LOG_OUTPUT: %s", err)
+	}
+	if _, err := newLogShippers(); err != nil {
+		v.Error("log shipping: %s", err)
+	}
+	if _, _, err := newOTLPExporter(); err != nil {
+		v.Error("tracing: %s", err)
+	}
+	if (os.Getenv("OIDC_ISSUER") == "") != (os.Getenv("OIDC_CLIENT_ID") == "") {
+		v.Error("OIDC_ISSUER and OIDC_CLIENT_ID must be set together")
+	}
+	if oidcEnabled() && os.Getenv("SSO_GROUP_ROLES") == "" {
+		v.Warn("single sign-on is set up without SSO_GROUP_ROLES, so nobody can sign in with it")
+	}
+	if _, err := parseGroupRoles(os.Getenv("SSO_GROUP_ROLES")); err != nil {
+		v.Error("SSO_GROUP_ROLES: %s", err)
+	}
+	v.OK("settings checked")
+}
+
+// Helper function to check that a directory exists, or can be created, and is writable
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		parent := filepath.Dir(filepath.Clean(dir))
+		if _, err := os.Stat(parent); err != nil {
+			return fmt.Errorf("%s does not exist and cannot be created: %w", dir, err)
+		}
+		return checkWritableDir(parent)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".gtask-validate-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
+// Function to check every line of the cron jobs file: syntax, options, cron
+// expressions, pipes, env files and the programs the commands run
+func validateJobsFile(v *validationReport, path string) {
+	v.Section("Jobs (" + path + ")")
+	file, err := os.Open(path)
+	if err != nil {
+		v.Error("cannot open jobs file: %s", err)
+		return
+	}
+	defer file.Close()
+
+	fileJobs := make(map[string]Job)
+	var order []string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			v.Warn("line %d: blank lines are skipped", lineNumber)
+			continue
+		}
+		j, err := parseJobLine(line)
+		if err != nil {
+			v.Error("line %d: %s", lineNumber, err)
+			continue
+		}
+		schedule, err := parseSchedule(j.CronExpr)
+		if err != nil {
+			v.Error("line %d: %s", lineNumber, err)
+			continue
+		}
+		if warning := frequentScheduleWarning(j.CronExpr, schedule); warning != "" && !j.Exclude {
+			v.Warn("line %d: %s", lineNumber, warning)
+		}
+
+		if existing, ok := fileJobs[j.Name]; ok {
+			if existing.Command != j.Command {
+				v.Error("line %d: job %s is already defined with a different command", lineNumber, j.Name)
+			}
+			continue
+		}
+		if j.Exclude {
+			v.Error("line %d: exclusions must follow the job they apply to", lineNumber)
+			continue
+		}
+		fileJobs[j.Name] = j
+		order = append(order, j.Name)
+
+		if j.EnvFile != "" {
+			if _, err := godotenv.Read(j.EnvFile); err != nil {
+				v.Error("line %d: env_file %s cannot be read: %s", lineNumber, j.EnvFile, err)
+			}
+		}
+		if err := checkCommandProgram(j.Command); err != nil {
+			if strings.Contains(strings.Fields(j.Command)[0], "/") {
+				v.Error("line %d: %s", lineNumber, err)
+			} else {
+				v.Warn("line %d: %s", lineNumber, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		v.Error("cannot read jobs file: %s", err)
+		return
+	}
+
+	for _, name := range order {
+		seen := map[string]bool{name: true}
+		for next := fileJobs[name].PipeTo; next != ""; next = fileJobs[next].PipeTo {
+			if _, ok := fileJobs[next]; !ok {
+				v.Error("job %s pipes to undefined job %s", name, next)
+				break
+			}
+			if seen[next] {
+				v.Error("job %s is part of a pipe cycle", name)
+				break
+			}
+			seen[next] = true
+		}
+	}
+
+	graph := make(map[string][]string, len(order))
+	for _, name := range order {
+		graph[name] = fileJobs[name].After
+	}
+	for _, name := range order {
+		for _, upstream := range fileJobs[name].After {
+			if _, ok := fileJobs[upstream]; !ok {
+				v.Warn("job %s runs after job %s, which is not in the jobs file", name, upstream)
+			}
+		}
+		if cycle := dependencyCycle(graph, name); cycle != nil {
+			v.Error("job %s is part of a dependency cycle: %s", name, strings.Join(cycle, " -> "))
+		}
+	}
+	v.OK("%d jobs checked", len(order))
+}
+
+// Function to check the declarative jobs file, JOBS_FILE, when there is one
+func validateJobsYAML(v *validationReport, path string) {
+	v.Section("Jobs (" + path + ")")
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		v.OK("no jobs file")
+		return
+	}
+	desired, err := loadJobsYAML(path)
+	if err != nil {
+		v.Error("%s", err)
+		return
+	}
+	for _, j := range desired {
+		if err := checkCommandProgram(j.Command); err != nil {
+			v.Warn("job %s: %s", j.Name, err)
+		}
+	}
+	v.OK("%d jobs checked", len(desired))
+}
+
+// Helper function to check that the program a command starts exists. Paths
+// are checked directly, other names are looked up in PATH.
+func checkCommandProgram(command string) error {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	program := fields[0]
+	if strings.Contains(program, "/") {
+		info, err := os.Stat(program)
+		if err != nil {
+			return fmt.Errorf("program %s does not exist", program)
+		}
+		if info.IsDir() || info.Mode()&0111 == 0 {
+			return fmt.Errorf("program %s is not executable", program)
+		}
+		return nil
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("program %s is not in PATH, unless it is a shell builtin", program)
+	}
+	return nil
+}
+
+// Function to check that the database can be opened and read, and that the
+// jobs stored in it have valid schedules
+func validateDatabase(v *validationReport) {
+	v.Section("Database")
+	dbDir := os.Getenv("DB_DIR")
+	if dbDir == "" {
+		v.Error("DB_DIR is not set")
+		return
+	}
+	path := filepath.Join(dbDir, "jobs.db")
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		v.OK("%s does not exist yet and will be created", path)
+		return
+	}
+
+	database, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		v.Error("cannot open %s: %s", path, err)
+		return
+	}
+	defer database.Close()
+	if err := database.Ping(); err != nil {
+		v.Error("cannot connect to %s: %s", path, err)
+		return
+	}
+	var integrity string
+	if err := database.QueryRow(`PRAGMA quick_check`).Scan(&integrity); err != nil || integrity != "ok" {
+		v.Error("integrity check of %s failed: %v %s", path, err, integrity)
+		return
+	}
+	v.OK("%s is readable and passes the integrity check", path)
+
+	rows, err := database.Query(`
+		SELECT j.tenant, j.name, j.cron_expr FROM jobs j WHERE j.enabled = 1
+		UNION ALL
+		SELECT j.tenant, j.name, s.cron_expr FROM job_schedules s JOIN jobs j ON j.id = s.job_id WHERE j.enabled = 1`)
+	if err != nil {
+		v.Warn("cannot read stored jobs, the database may be from an older version: %s", err)
+		return
+	}
+	defer rows.Close()
+	invalid := make(map[string]bool)
+	for rows.Next() {
+		var tenant, name, expr string
+		if err := rows.Scan(&tenant, &name, &expr); err != nil {
+			v.Error("cannot read stored jobs: %s", err)
+			return
+		}
+		if _, err := parseSchedule(expr); err != nil {
+			invalid[fmt.Sprintf("job %s of tenant %s: %s", name, tenant, err)] = true
+		}
+	}
+	problems := make([]string, 0, len(invalid))
+	for problem := range invalid {
+		problems = append(problems, problem)
+	}
+	sort.Strings(problems)
+	for _, problem := range problems {
+		v.Error("%s", problem)
+	}
+	v.OK("stored jobs checked")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Function to check the bearer token of a control webhook request against the
+// WEBHOOK_TOKEN of its tenant. Webhooks are disabled while no token is configured.
+func webhookAuthorized(r *http.Request) bool {
+	token := os.Getenv(tenantSetting(requestTenant(r), "WEBHOOK_TOKEN"))
+	if token == "" {
+		return false
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
+
+// Handler for the control webhooks, pausing or resuming the whole scheduler
+// (POST /webhooks/scheduler/{action}) or a single job
+// (POST /webhooks/jobs/{name}/{action}). Every accepted call is stored in
+// scheduler_pause_events with the source "webhook"; rejected calls are logged.
+func controlWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	jobName := r.PathValue("name")
+	if !webhookAuthorized(r) {
+		recordEvent(requestTenant(r), eventAuth, fmt.Sprintf("Rejected unauthorized control webhook %s from %s", r.URL.Path, r.RemoteAddr))
+		writeJSONError(w, http.StatusUnauthorized, "invalid or missing webhook token")
+		return
+	}
+
+	var paused bool
+	switch r.PathValue("action") {
+	case "pause":
+		paused = true
+	case "resume":
+	default:
+		writeJSONError(w, http.StatusNotFound, "unknown action, expected pause or resume")
+		return
+	}
+
+	var req pauseRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Actor == "" {
+		req.Actor = r.RemoteAddr
+	}
+
+	tenant := requestTenant(r)
+	var state PauseState
+	if jobName == "" {
+		if err := setPaused(tenant, paused, req.Actor, req.Reason, "webhook"); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		state = currentPauseState(tenant)
+	} else {
+		err := setJobPaused(tenant, jobName, paused, req.Actor, req.Reason, "webhook")
+		if errors.Is(err, errJobNotFound) {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", jobName))
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		state = jobPauseState(tenant, jobName)
+	}
+
+	writeJSON(w, http.StatusOK, pauseResponse{
+		Paused:    state.Paused,
+		Actor:     state.Actor,
+		Reason:    state.Reason,
+		Timestamp: state.Timestamp,
+	})
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errWindowNotFound = errors.New("maintenance window not found")
+
+// Struct to hold a maintenance window, during which the scheduled runs of a
+// job, or of all jobs of the tenant when Job is empty, are suppressed
+type maintenanceWindow struct {
+	ID        int64  `json:"id"`
+	Job       string `json:"job,omitempty"`
+	StartsAt  string `json:"starts_at"`         // RFC 3339 UTC, see formatStorageTime
+	EndsAt    string `json:"ends_at,omitempty"` // empty while the window lasts until it is ended
+	Reason    string `json:"reason,omitempty"`
+	CreatedBy string `json:"created_by"`
+	EndedBy   string `json:"ended_by,omitempty"`
+	Active    bool   `json:"active"`
+}
+
+// Columns of maintenance_windows in the order scanned by scanMaintenanceWindow
+const maintenanceWindowColumns = `id, job_name, starts_at, ends_at, reason, created_by, ended_by`
+
+// Helper function to read a maintenance window row, working out whether it is active at now
+func scanMaintenanceWindow(row interface{ Scan(...any) error }, now time.Time) (maintenanceWindow, error) {
+	var w maintenanceWindow
+	if err := row.Scan(&w.ID, &w.Job, &w.StartsAt, &w.EndsAt, &w.Reason, &w.CreatedBy, &w.EndedBy); err != nil {
+		return w, err
+	}
+	current := formatStorageTime(now)
+	w.Active = w.StartsAt <= current && (w.EndsAt == "" || w.EndsAt > current)
+	return w, nil
+}
+
+// Function to create a maintenance window for a tenant. Windows without an
+// end last until they are ended.
+func createMaintenanceWindow(tenant string, w maintenanceWindow) (maintenanceWindow, error) {
+	if w.EndsAt != "" && w.EndsAt <= w.StartsAt {
+		return w, fmt.Errorf("the window must end after it starts")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if w.Job != "" {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM jobs WHERE tenant = ? AND name = ?)`, tenant, w.Job).Scan(&exists); err != nil {
+			return w, fmt.Errorf("error looking up job: %w", err)
+		}
+		if !exists {
+			return w, errJobNotFound
+		}
+	}
+	result, err := db.Exec(`INSERT INTO maintenance_windows (tenant, job_name, starts_at, ends_at, reason, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tenant, w.Job, w.StartsAt, w.EndsAt, w.Reason, w.CreatedBy, formatStorageTime(time.Now()))
+	if err != nil {
+		return w, fmt.Errorf("error saving maintenance window: %w", err)
+	}
+	w.ID, _ = result.LastInsertId()
+	current := formatStorageTime(time.Now())
+	w.Active = w.StartsAt <= current && (w.EndsAt == "" || w.EndsAt > current)
+	return w, nil
+}
+
+// Function to end a tenant's maintenance window now. A window that has not
+// started yet is called off.
+func endMaintenanceWindow(tenant string, id int64, actor string) (maintenanceWindow, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	result, err := db.Exec(`UPDATE maintenance_windows SET ends_at = ?, ended_by = ? WHERE id = ? AND tenant = ? AND (ends_at = '' OR ends_at > ?)`,
+		formatStorageTime(now), actor, id, tenant, formatStorageTime(now))
+	if err != nil {
+		return maintenanceWindow{}, fmt.Errorf("error ending maintenance window: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return maintenanceWindow{}, errWindowNotFound
+	}
+	return scanMaintenanceWindow(db.QueryRow(`SELECT `+maintenanceWindowColumns+` FROM maintenance_windows WHERE id = ?`, id), now)
+}
+
+// Function to list a tenant's maintenance windows, those still to come or in
+// progress first, then the 50 that ended last
+func listMaintenanceWindows(tenant string) ([]maintenanceWindow, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	rows, err := db.Query(`
+		SELECT `+maintenanceWindowColumns+` FROM (
+			SELECT * FROM maintenance_windows WHERE tenant = ? AND (ends_at = '' OR ends_at > ?)
+			UNION ALL
+			SELECT * FROM (SELECT * FROM maintenance_windows WHERE tenant = ? AND ends_at != '' AND ends_at <= ? ORDER BY ends_at DESC LIMIT 50)
+		) ORDER BY ends_at = '' DESC, ends_at DESC, starts_at DESC`,
+		tenant, formatStorageTime(now), tenant, formatStorageTime(now))
+	if err != nil {
+		return nil, fmt.Errorf("error querying maintenance windows: %w", err)
+	}
+	defer rows.Close()
+
+	list := []maintenanceWindow{}
+	for rows.Next() {
+		w, err := scanMaintenanceWindow(rows, now)
+		if err != nil {
+			return nil, fmt.Errorf("error reading maintenance windows: %w", err)
+		}
+		list = append(list, w)
+	}
+	return list, rows.Err()
+}
+
+// Function to find the maintenance window, if any, that covers a job at t
+func activeMaintenanceWindow(tenant, name string, t time.Time) (maintenanceWindow, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	w, err := scanMaintenanceWindow(db.QueryRow(`
+		SELECT `+maintenanceWindowColumns+` FROM maintenance_windows
+		WHERE tenant = ? AND (job_name = '' OR job_name = ?) AND starts_at <= ? AND (ends_at = '' OR ends_at > ?)
+		ORDER BY id LIMIT 1`, tenant, name, formatStorageTime(t), formatStorageTime(t)), t)
+	if errors.Is(err, sql.ErrNoRows) {
+		return w, false
+	}
+	if err != nil {
+		fmt.Printf("Error checking maintenance windows: %s\n", err)
+		return w, false
+	}
+	return w, true
+}
+
+// Helper function to describe what a maintenance window covers, for events and run output
+func (w maintenanceWindow) describe() string {
+	target := "all jobs"
+	if w.Job != "" {
+		target = "job " + w.Job
+	}
+	text := fmt.Sprintf("maintenance window %d for %s", w.ID, target)
+	if w.Reason != "" {
+		text += " (" + w.Reason + ")"
+	}
+	return text
+}
+
+// Struct to hold the body of POST /api/v1/maintenance-windows
+type maintenanceWindowRequest struct {
+	Job      string `json:"job"`
+	StartsAt string `json:"starts_at"` // RFC 3339, now when left out
+	EndsAt   string `json:"ends_at"`   // RFC 3339
+	Duration string `json:"duration"`  // e.g. "2h", instead of ends_at
+	Reason   string `json:"reason"`
+	Actor    string `json:"actor"`
+}
+
+// Function to turn a window request into a window, resolving its start and end
+func (req maintenanceWindowRequest) toWindow(now time.Time) (maintenanceWindow, error) {
+	w := maintenanceWindow{Job: req.Job, Reason: req.Reason, CreatedBy: req.Actor}
+	start := now
+	if req.StartsAt != "" {
+		t, err := time.Parse(time.RFC3339, req.StartsAt)
+		if err != nil {
+			return w, fmt.Errorf("invalid starts_at %q, expected RFC 3339", req.StartsAt)
+		}
+		start = t
+	}
+	w.StartsAt = formatStorageTime(start)
+
+	switch {
+	case req.EndsAt != "" && req.Duration != "":
+		return w, fmt.Errorf("set either ends_at or duration")
+	case req.EndsAt != "":
+		t, err := time.Parse(time.RFC3339, req.EndsAt)
+		if err != nil {
+			return w, fmt.Errorf("invalid ends_at %q, expected RFC 3339", req.EndsAt)
+		}
+		w.EndsAt = formatStorageTime(t)
+	case req.Duration != "":
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d <= 0 {
+			return w, fmt.Errorf("invalid duration %q, expected e.g. 2h", req.Duration)
+		}
+		w.EndsAt = formatStorageTime(start.Add(d))
+	}
+	return w, nil
+}
+
+// Handler for GET /api/v1/maintenance-windows, listing the tenant's windows
+func apiMaintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := listMaintenanceWindows(requestTenant(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// Handler for POST /api/v1/maintenance-windows, creating a window
+func apiCreateMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can create maintenance windows")
+		return
+	}
+	var req maintenanceWindowRequest
+	if err := readJSON(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Actor == "" {
+		req.Actor = r.RemoteAddr
+	}
+	window, err := req.toWindow(time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tenant := requestTenant(r)
+	window, err = createMaintenanceWindow(tenant, window)
+	if errors.Is(err, errJobNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("job %s not found", req.Job))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	recordWindowCreated(tenant, window)
+	writeJSON(w, http.StatusCreated, window)
+}
+
+// Handler for POST /api/v1/maintenance-windows/{id}/end, ending a window now
+func apiEndMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		writeJSONError(w, http.StatusForbidden, "only admins can end maintenance windows")
+		return
+	}
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid window ID")
+		return
+	}
+	tenant := requestTenant(r)
+	window, err := endMaintenanceWindow(tenant, id, requestActor(r))
+	if errors.Is(err, errWindowNotFound) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("no maintenance window %d is in progress or to come", id))
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Ended %s by %s", window.describe(), window.EndedBy))
+	writeJSON(w, http.StatusOK, window)
+}
+
+// Helper function to record the creation of a maintenance window as an event
+func recordWindowCreated(tenant string, w maintenanceWindow) {
+	until := "until it is ended"
+	if w.EndsAt != "" {
+		until = "until " + w.EndsAt
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Created %s from %s %s by %s", w.describe(), w.StartsAt, until, w.CreatedBy))
+}
+
+// Handler for the maintenance windows page (GET /maintenance), listing the
+// windows with a form to create one (POST)
+func maintenanceWindowsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	user := ensureRequestUser(w, r)
+	prefs, err := loadPreferences(tenant, user)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	loc := prefs.Location()
+
+	message := ""
+	if r.Method == http.MethodPost {
+		if _, ok := requestAdmin(r); !ok {
+			http.Error(w, "Only admins can create maintenance windows", http.StatusForbidden)
+			return
+		}
+		window, err := windowFromForm(r, loc)
+		if err == nil {
+			window, err = createMaintenanceWindow(tenant, window)
+		}
+		if err == nil {
+			recordWindowCreated(tenant, window)
+			http.Redirect(w, r, tenantURL(r, "/maintenance"), http.StatusSeeOther)
+			return
+		}
+		if errors.Is(err, errJobNotFound) {
+			err = fmt.Errorf("job %s not found", r.FormValue("job"))
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		message = `<div class="alert alert-danger">` + html.EscapeString(err.Error()) + `</div>`
+	}
+
+	list, err := listMaintenanceWindows(tenant)
+	if err != nil {
+		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		return
+	}
+	showTime := func(timestamp string) string {
+		t, err := time.Parse(storageTimeFormat, timestamp)
+		if err != nil {
+			return html.EscapeString(timestamp)
+		}
+		return t.In(loc).Format("02-01-2006 15:04")
+	}
+
+	var rows strings.Builder
+	for _, window := range list {
+		target := "All jobs"
+		if window.Job != "" {
+			target = html.EscapeString(window.Job)
+		}
+		ends := "Until ended"
+		if window.EndsAt != "" {
+			ends = showTime(window.EndsAt)
+		}
+		state, action := "Ended", ""
+		if window.EndedBy != "" {
+			state = "Ended by " + html.EscapeString(window.EndedBy)
+		}
+		if window.Active || window.EndsAt == "" || window.EndsAt > formatStorageTime(time.Now()) {
+			state = "Upcoming"
+			if window.Active {
+				state = `<span class="badge text-bg-warning">Active</span>`
+			}
+			action = fmt.Sprintf(`<form action="%s" method="post" class="m-0">
+					<input type="hidden" name="id" value="%d">
+					<button type="submit" class="btn btn-sm btn-outline-danger">End Now</button>
+				</form>`, tenantURL(r, "/maintenance/end"), window.ID)
+		}
+		fmt.Fprintf(&rows, `<tr>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+				<td>%s</td>
+			</tr>`, target, showTime(window.StartsAt), ends, html.EscapeString(window.Reason), html.EscapeString(window.CreatedBy), state, action)
+	}
+	if len(list) == 0 {
+		rows.WriteString(`<tr><td colspan="7" class="text-muted">No maintenance windows.</td></tr>`)
+	}
+
+	fmt.Fprintln(w, `
+	<!DOCTYPE html>
+	<html lang="en">
+	<head>
+	    <meta charset="UTF-8">
+	    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+	    <title>Maintenance Windows</title>
+	    <link href="https://cdn.jsdelivr.net/npm/bootstrap@5.3.0/dist/css/bootstrap.min.css" rel="stylesheet">
+	</head>
+	<body>
+	    <div class="container mt-5">
+	        <h1>Maintenance Windows</h1>
+	        <div class="mb-3">
+	            <a href="`+tenantURL(r, "/")+`" class="btn btn-outline-secondary">Dashboard</a>
+	        </div>
+	        `+message+`
+	        <p class="text-muted">Scheduled runs that fall in a window are skipped and recorded with the status <code>Suppressed (maintenance)</code>. Times are in `+html.EscapeString(loc.String())+`.</p>
+	        <table class="table table-striped table-hover">
+	            <thead>
+	                <tr>
+	                    <th>Jobs</th>
+	                    <th>Starts</th>
+	                    <th>Ends</th>
+	                    <th>Reason</th>
+	                    <th>Created By</th>
+	                    <th>State</th>
+	                    <th></th>
+	                </tr>
+	            </thead>
+	            <tbody>`+rows.String()+`</tbody>
+	        </table>
+	        <h2 class="h5">New Window</h2>
+	        <form action="`+tenantURL(r, "/maintenance")+`" method="post">
+	            <div class="row g-3 mb-3">
+	                <div class="col-md-4">
+	                    <label for="job" class="form-label">Job</label>
+	                    <input type="text" class="form-control" id="job" name="job" placeholder="All jobs">
+	                </div>
+	                <div class="col-md-4">
+	                    <label for="startsAt" class="form-label">Starts</label>
+	                    <input type="datetime-local" class="form-control" id="startsAt" name="starts_at">
+	                    <div class="form-text">Leave empty to start now.</div>
+	                </div>
+	                <div class="col-md-4">
+	                    <label for="endsAt" class="form-label">Ends</label>
+	                    <input type="datetime-local" class="form-control" id="endsAt" name="ends_at">
+	                    <div class="form-text">Leave empty to last until ended.</div>
+	                </div>
+	            </div>
+	            <div class="mb-3">
+	                <label for="reason" class="form-label">Reason</label>
+	                <input type="text" class="form-control" id="reason" name="reason">
+	            </div>
+	            <button type="submit" class="btn btn-primary">Create Window</button>
+	        </form>
+	    </div>
+	</body>
+	</html>
+	`)
+}
+
+// Helper function to read a maintenance window from the form on the
+// maintenance windows page, whose times are in the user's time zone
+func windowFromForm(r *http.Request, loc *time.Location) (maintenanceWindow, error) {
+	w := maintenanceWindow{Job: strings.TrimSpace(r.FormValue("job")), Reason: r.FormValue("reason"), CreatedBy: requestActor(r)}
+	parse := func(field string) (time.Time, error) {
+		t, err := time.ParseInLocation("2006-01-02T15:04", r.FormValue(field), loc)
+		if err != nil {
+			return t, fmt.Errorf("invalid time %q", r.FormValue(field))
+		}
+		return t, nil
+	}
+
+	start := time.Now()
+	if r.FormValue("starts_at") != "" {
+		t, err := parse("starts_at")
+		if err != nil {
+			return w, err
+		}
+		start = t
+	}
+	w.StartsAt = formatStorageTime(start)
+	if r.FormValue("ends_at") != "" {
+		t, err := parse("ends_at")
+		if err != nil {
+			return w, err
+		}
+		w.EndsAt = formatStorageTime(t)
+	}
+	return w, nil
+}
+
+// Handler for the End Now buttons on the maintenance windows page
+func endMaintenanceWindowHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requestAdmin(r); !ok {
+		http.Error(w, "Only admins can end maintenance windows", http.StatusForbidden)
+		return
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid window ID", http.StatusBadRequest)
+		return
+	}
+	tenant := requestTenant(r)
+	window, err := endMaintenanceWindow(tenant, id, requestActor(r))
+	if errors.Is(err, errWindowNotFound) {
+		http.Error(w, fmt.Sprintf("No maintenance window %d is in progress or to come", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recordEvent(tenant, eventConfig, fmt.Sprintf("Ended %s by %s", window.describe(), window.EndedBy))
+	http.Redirect(w, r, tenantURL(r, "/maintenance"), http.StatusSeeOther)
+}
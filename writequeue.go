@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Queue of run statuses waiting to be written to the database
+var (
+	writeQueue     chan JobStatus
+	writeQueueDone sync.WaitGroup
+	stopFlush      chan struct{}
+)
+
+// Function to start the goroutine that writes queued run statuses. Runs that
+// complete close together are committed in one transaction of at most
+// DB_BATCH_SIZE rows, gathered for up to DB_BATCH_WINDOW.
+func startWriteQueue() {
+	batchSize := getEnvInt("DB_BATCH_SIZE", 100)
+	window := getEnvDuration("DB_BATCH_WINDOW", time.Second)
+
+	writeQueue = make(chan JobStatus, batchSize*10)
+	writeQueueDone.Add(1)
+
+	go func() {
+		defer writeQueueDone.Done()
+		for first := range writeQueue {
+			batch := []JobStatus{first}
+			timeout := time.After(window)
+		collect:
+			for len(batch) < batchSize {
+				select {
+				case jobStatus, ok := <-writeQueue:
+					if !ok {
+						break collect
+					}
+					batch = append(batch, jobStatus)
+				case <-timeout:
+					break collect
+				}
+			}
+			writeJobStatuses(batch)
+		}
+	}()
+
+	// Statuses buffered during a database outage are retried even when no
+	// new runs complete
+	stopFlush = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if dbBreaker.report().Database.BufferedStatuses > 0 {
+					writeJobStatuses(nil)
+				}
+			case <-stopFlush:
+				return
+			}
+		}
+	}()
+}
+
+// Function to stop the write queue once everything queued has been written
+func stopWriteQueue() {
+	if writeQueue == nil {
+		return
+	}
+	close(stopFlush)
+	close(writeQueue)
+	writeQueueDone.Wait()
+	if buffered := dbBreaker.report().Database.BufferedStatuses; buffered > 0 {
+		fmt.Printf("Error stopping: %d run statuses could not be written to the database\n", buffered)
+	}
+}
+
+// Function to write a batch of run statuses, together with any statuses
+// buffered while the database was unavailable. When the database fails or the
+// circuit breaker is open the batch is buffered for the next attempt.
+func writeJobStatuses(batch []JobStatus) {
+	batch = append(dbBreaker.takeBuffered(), batch...)
+	if len(batch) == 0 {
+		return
+	}
+
+	start := time.Now()
+	err := guardDB("writing run statuses", func() error {
+		return storage.SaveRuns(batch)
+	})
+	if err != nil {
+		if errors.Is(err, errStoreUnavailable) || isTransientDBError(err) {
+			dbBreaker.buffer(batch)
+		}
+		fmt.Printf("Error inserting into database: %s\n", err)
+		return
+	}
+	observeLoadTestWrite(len(batch), time.Since(start))
+}